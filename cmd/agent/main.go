@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"log"
@@ -11,14 +12,18 @@ import (
 	"syscall"
 
 	"github.com/invinciblewest/metrics/pkg/encryption"
+	"github.com/invinciblewest/metrics/pkg/tlsconfig"
 
 	"github.com/invinciblewest/metrics/internal/agent"
 	"github.com/invinciblewest/metrics/internal/agent/collectors"
 	"github.com/invinciblewest/metrics/internal/agent/config"
 	"github.com/invinciblewest/metrics/internal/agent/senders"
+	"github.com/invinciblewest/metrics/internal/export"
 	"github.com/invinciblewest/metrics/internal/logger"
 	"github.com/invinciblewest/metrics/internal/storage/memstorage"
 	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 )
 
 var (
@@ -65,9 +70,62 @@ func main() {
 		}
 	}
 
-	addr := "http://" + cfg.Address
-	sendersList := []senders.Sender{
-		senders.NewHTTPSender(addr, cfg.HashKey, http.DefaultClient, cryptor),
+	var tlsConfig *tls.Config
+	if cfg.TLSCA != "" || cfg.TLSCert != "" {
+		tlsConfig, err = tlsconfig.Client(cfg.TLSCA, cfg.TLSCert, cfg.TLSKey)
+		if err != nil {
+			logger.Log.Fatal("failed to load tls config", zap.Error(err))
+		}
+	}
+
+	var sendersList []senders.Sender
+	if cfg.GRPCAddress != "" {
+		var opts []grpc.DialOption
+		if tlsConfig != nil {
+			opts = append(opts, grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)))
+		}
+		if cfg.Token != "" {
+			opts = append(opts, senders.WithToken(cfg.Token))
+		}
+		var grpcSender *senders.GRPCSender
+		grpcSender, err = senders.NewGRPCSender(cfg.GRPCAddress, cfg.HashKey, opts...)
+		if err != nil {
+			logger.Log.Fatal("failed to initialize grpc sender", zap.Error(err))
+		}
+		defer grpcSender.Close()
+		sendersList = append(sendersList, grpcSender)
+	} else {
+		addr := "http://" + cfg.Address
+		client := http.DefaultClient
+		if tlsConfig != nil {
+			addr = "https://" + cfg.Address
+			client = &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+		}
+		httpSender := senders.NewHTTPSender(addr, cfg.HashKey, client, cryptor)
+		if cfg.Token != "" {
+			httpSender.SetToken(cfg.Token)
+		}
+		httpSender.SetStreaming(cfg.Stream)
+		if cfg.SignKey != "" {
+			var signer *encryption.Signer
+			signer, err = encryption.NewSigner(cfg.SignKey)
+			if err != nil {
+				logger.Log.Fatal("failed to load sign key", zap.Error(err))
+			}
+			httpSender.SetSigner(signer)
+		}
+		sendersList = append(sendersList, httpSender)
+	}
+
+	if cfg.InfluxURL != "" {
+		influxSender := senders.NewExportSender(export.NewInflux(cfg.InfluxURL, cfg.InfluxToken, export.WithPrefix(cfg.ExportPrefix)))
+		defer influxSender.Close()
+		sendersList = append(sendersList, influxSender)
+	}
+	if cfg.GraphiteAddr != "" {
+		graphiteSender := senders.NewExportSender(export.NewGraphite(cfg.GraphiteAddr, export.WithPrefix(cfg.ExportPrefix)))
+		defer graphiteSender.Close()
+		sendersList = append(sendersList, graphiteSender)
 	}
 
 	agentApp := agent.NewAgent(st, collectorsList, sendersList, cfg.PollInterval, cfg.ReportInterval)
@@ -1,17 +1,89 @@
 package main
 
 import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
 	"encoding/pem"
+	"flag"
+	"fmt"
+	"log"
 	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/invinciblewest/metrics/pkg/tlsconfig"
 )
 
 func main() {
+	out := flag.String("out", ".", "output directory")
+	keyType := flag.String("type", "rsa", "key pair type: rsa, ec (P-256, encryption and signatures) or ed25519 (signatures)")
+	withTLS := flag.Bool("tls", false, "generate local CA, server and agent TLS certificates instead of a key pair")
+	hosts := flag.String("hosts", "localhost,127.0.0.1", "comma-separated server host names and IP addresses")
+	agents := flag.String("agents", "agent", "comma-separated agent names written to client certificate subjects")
+	flag.Parse()
+
+	var err error
+	if *withTLS {
+		err = generateTLS(*out, strings.Split(*hosts, ","), strings.Split(*agents, ","))
+	} else {
+		err = generateKeyPair(*out, *keyType)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// generateKeyPair создает пару ключей заданного типа: private.pem и public.pem.
+func generateKeyPair(dir, keyType string) error {
+	switch keyType {
+	case "rsa":
+		return generateRSA(dir)
+	case "ec":
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return err
+		}
+		der, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			return err
+		}
+		return writeKeyPair(dir, &pem.Block{Type: "EC PRIVATE KEY", Bytes: der}, key.Public())
+	case "ed25519":
+		public, private, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return err
+		}
+		der, err := x509.MarshalPKCS8PrivateKey(private)
+		if err != nil {
+			return err
+		}
+		return writeKeyPair(dir, &pem.Block{Type: "PRIVATE KEY", Bytes: der}, public)
+	}
+	return fmt.Errorf("unknown key type %q", keyType)
+}
+
+// writeKeyPair записывает приватный ключ в private.pem, а публичный в формате PKIX в public.pem.
+func writeKeyPair(dir string, private *pem.Block, public crypto.PublicKey) error {
+	if err := os.WriteFile(filepath.Join(dir, "private.pem"), pem.EncodeToMemory(private), 0600); err != nil {
+		return err
+	}
+	der, err := x509.MarshalPKIXPublicKey(public)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, "public.pem"), pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0644)
+}
+
+// generateRSA создает пару ключей RSA для шифрования метрик: private.pem и public.pem.
+func generateRSA(dir string) error {
 	privateKey, err := rsa.GenerateKey(rand.Reader, 8192)
 	if err != nil {
-		panic(err)
+		return err
 	}
 
 	publicKey := &privateKey.PublicKey
@@ -21,21 +93,60 @@ func main() {
 		Type:  "RSA PRIVATE KEY",
 		Bytes: privateKeyBytes,
 	})
-	err = os.WriteFile("private.pem", privateKeyPEM, 0644)
+	err = os.WriteFile(filepath.Join(dir, "private.pem"), privateKeyPEM, 0644)
 	if err != nil {
-		panic(err)
+		return err
 	}
 
 	publicKeyBytes, err := x509.MarshalPKIXPublicKey(publicKey)
 	if err != nil {
-		panic(err)
+		return err
 	}
 	publicKeyPEM := pem.EncodeToMemory(&pem.Block{
 		Type:  "RSA PUBLIC KEY",
 		Bytes: publicKeyBytes,
 	})
-	err = os.WriteFile("public.pem", publicKeyPEM, 0644)
+	return os.WriteFile(filepath.Join(dir, "public.pem"), publicKeyPEM, 0644)
+}
+
+// generateTLS создает локальный центр сертификации (ca.pem, ca-key.pem), сертификат сервера
+// (server.pem, server-key.pem) и клиентские сертификаты агентов (<name>.pem, <name>-key.pem).
+func generateTLS(dir string, hosts, agents []string) error {
+	ca, err := tlsconfig.NewAuthority("metrics local CA")
+	if err != nil {
+		return err
+	}
+	caKey, err := ca.KeyPEM()
+	if err != nil {
+		return err
+	}
+	if err = writePair(dir, "ca", ca.CertPEM(), caKey); err != nil {
+		return err
+	}
+
+	cert, key, err := ca.IssueServer("metrics server", hosts)
 	if err != nil {
-		panic(err)
+		return err
+	}
+	if err = writePair(dir, "server", cert, key); err != nil {
+		return err
+	}
+
+	for _, agent := range agents {
+		if cert, key, err = ca.IssueClient(agent); err != nil {
+			return err
+		}
+		if err = writePair(dir, agent, cert, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writePair записывает сертификат в <name>.pem, а приватный ключ в <name>-key.pem.
+func writePair(dir, name string, cert, key []byte) error {
+	if err := os.WriteFile(filepath.Join(dir, name+".pem"), cert, 0644); err != nil {
+		return err
 	}
+	return os.WriteFile(filepath.Join(dir, name+"-key.pem"), key, 0600)
 }
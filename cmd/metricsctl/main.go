@@ -0,0 +1,352 @@
+/*
+Package main реализует утилиту metricsctl для переноса и выгрузки метрик между хранилищами.
+
+Хранилище задается строкой: DSN PostgreSQL (postgres://...) или путь к JSON-файлу
+хранилища в памяти (с необязательным префиксом file:).
+
+Команды:
+
+	metricsctl migrate -from ./storage.json -to postgres://... [-filter 'CPU*'] [-counters add|overwrite] [-dry-run]
+	metricsctl export -from postgres://... [-format ndjson|csv] [-filter 'Heap*'] [-out metrics.ndjson]
+	metricsctl backup -from postgres://... -out metrics.bak [-crypto-key public.pem]
+	metricsctl restore -to ./storage.json -in metrics.bak [-crypto-key private.pem] [-mode replace|merge]
+	metricsctl token issue -store ./tokens.json -agent host1 [-prefixes 'host1.,Heap'] [-read]
+	metricsctl token revoke -store postgres://... -id 3f2a9c1b7d4e5f60
+	metricsctl token list -store ./tokens.json
+
+Хранилище токенов задается так же, как у сервера (флаг -tokens): DSN PostgreSQL или путь к JSON-файлу.
+Секрет токена выводится только при выдаче, на сервере хранится его хеш.
+*/
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/invinciblewest/metrics/internal/backup"
+	"github.com/invinciblewest/metrics/internal/migrate"
+	"github.com/invinciblewest/metrics/internal/storage"
+	"github.com/invinciblewest/metrics/internal/storage/memstorage"
+	"github.com/invinciblewest/metrics/internal/storage/pgstorage"
+	"github.com/invinciblewest/metrics/internal/tokens"
+	"github.com/invinciblewest/metrics/pkg/encryption"
+	_ "github.com/lib/pq"
+)
+
+var (
+	errUsage      = errors.New("usage: metricsctl <migrate|export|backup|restore|token> [flags]")
+	errTokenUsage = errors.New("usage: metricsctl token <issue|revoke|list> [flags]")
+)
+
+func main() {
+	if err := run(context.Background(), os.Args[1:], os.Stdout); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run(ctx context.Context, args []string, stdout io.Writer) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+
+	switch args[0] {
+	case "migrate":
+		return runMigrate(ctx, args[1:], stdout)
+	case "export":
+		return runExport(ctx, args[1:], stdout)
+	case "backup":
+		return runBackup(ctx, args[1:], stdout)
+	case "restore":
+		return runRestore(ctx, args[1:], stdout)
+	case "token":
+		return runToken(ctx, args[1:], stdout)
+	default:
+		return errUsage
+	}
+}
+
+func runMigrate(ctx context.Context, args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	from := fs.String("from", "", "source storage (postgres dsn or file path)")
+	to := fs.String("to", "", "destination storage (postgres dsn or file path)")
+	filter := fs.String("filter", "", "metric name glob pattern")
+	counters := fs.String("counters", string(migrate.CounterAdd), "counter handling: add or overwrite")
+	dryRun := fs.Bool("dry-run", false, "do not write to destination")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *from == "" || *to == "" {
+		return errors.New("both -from and -to are required")
+	}
+
+	src, err := openSource(ctx, *from)
+	if err != nil {
+		return err
+	}
+	defer src.Close(ctx)
+
+	dst, err := openStorage(ctx, *to)
+	if err != nil {
+		return err
+	}
+	defer dst.Close(ctx)
+
+	result, err := migrate.Migrate(ctx, src, dst, migrate.Options{
+		Filter:   *filter,
+		Counters: migrate.CounterMode(*counters),
+		DryRun:   *dryRun,
+	})
+	if err != nil {
+		return err
+	}
+
+	prefix := ""
+	if *dryRun {
+		prefix = "[dry-run] "
+	}
+	_, err = fmt.Fprintf(stdout, "%smigrated gauges: %d, counters: %d, skipped: %d\n",
+		prefix, result.Gauges, result.Counters, result.Skipped)
+	return err
+}
+
+func runExport(ctx context.Context, args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	from := fs.String("from", "", "source storage (postgres dsn or file path)")
+	format := fs.String("format", migrate.FormatNDJSON, "export format: ndjson or csv")
+	filter := fs.String("filter", "", "metric name glob pattern")
+	out := fs.String("out", "", "output file path (stdout if empty)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *from == "" {
+		return errors.New("-from is required")
+	}
+
+	src, err := openSource(ctx, *from)
+	if err != nil {
+		return err
+	}
+	defer src.Close(ctx)
+
+	w := stdout
+	if *out != "" {
+		var file *os.File
+		file, err = os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		w = file
+	}
+
+	_, err = migrate.Export(ctx, src, w, *format, *filter)
+	return err
+}
+
+func runBackup(ctx context.Context, args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("backup", flag.ContinueOnError)
+	from := fs.String("from", "", "source storage (postgres dsn or file path)")
+	out := fs.String("out", "", "backup file path")
+	cryptoKey := fs.String("crypto-key", "", "path to public key for backup encryption")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *from == "" || *out == "" {
+		return errors.New("both -from and -out are required")
+	}
+
+	var cryptor *encryption.Cryptor
+	if *cryptoKey != "" {
+		var err error
+		cryptor, err = encryption.NewCryptor(*cryptoKey, "")
+		if err != nil {
+			return err
+		}
+	}
+
+	src, err := openSource(ctx, *from)
+	if err != nil {
+		return err
+	}
+	defer src.Close(ctx)
+
+	archive, err := backup.Create(ctx, src)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Create(*out)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err = backup.Write(file, archive, cryptor); err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(stdout, "backup created: %d metrics\n", len(archive.Metrics))
+	return err
+}
+
+func runRestore(ctx context.Context, args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("restore", flag.ContinueOnError)
+	to := fs.String("to", "", "destination storage (postgres dsn or file path)")
+	in := fs.String("in", "", "backup file path")
+	cryptoKey := fs.String("crypto-key", "", "path to private key for backup decryption")
+	mode := fs.String("mode", string(backup.ModeReplace), "restore mode: replace or merge")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *to == "" || *in == "" {
+		return errors.New("both -to and -in are required")
+	}
+
+	var keyring *encryption.Keyring
+	if *cryptoKey != "" {
+		var err error
+		keyring, err = encryption.NewKeyring(*cryptoKey)
+		if err != nil {
+			return err
+		}
+	}
+
+	file, err := os.Open(*in)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	archive, err := backup.Read(file, keyring)
+	if err != nil {
+		return err
+	}
+
+	dst, err := openStorage(ctx, *to)
+	if err != nil {
+		return err
+	}
+	defer dst.Close(ctx)
+
+	if err = backup.Restore(ctx, dst, archive, backup.Mode(*mode)); err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(stdout, "backup restored: %d metrics (%s)\n", len(archive.Metrics), *mode)
+	return err
+}
+
+func runToken(ctx context.Context, args []string, stdout io.Writer) error {
+	if len(args) == 0 {
+		return errTokenUsage
+	}
+
+	fs := flag.NewFlagSet("token "+args[0], flag.ContinueOnError)
+	storeSpec := fs.String("store", "", "token store (postgres dsn or file path)")
+	agentName := fs.String("agent", "", "agent name (issue)")
+	prefixes := fs.String("prefixes", "", "comma-separated metric name prefixes the agent may write, all names if empty (issue)")
+	read := fs.Bool("read", false, "allow reading metrics (issue)")
+	id := fs.String("id", "", "token id (revoke)")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	if *storeSpec == "" {
+		return errors.New("-store is required")
+	}
+
+	store, err := tokens.Open(*storeSpec)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	switch args[0] {
+	case "issue":
+		var scope []string
+		if *prefixes != "" {
+			scope = strings.Split(*prefixes, ",")
+		}
+		secret, token, issueErr := tokens.Issue(ctx, store, *agentName, scope, *read)
+		if issueErr != nil {
+			return issueErr
+		}
+		_, err = fmt.Fprintf(stdout, "token issued: id %s, agent %s\n%s\n", token.ID, token.Agent, secret)
+		return err
+	case "revoke":
+		if *id == "" {
+			return errors.New("-id is required")
+		}
+		if err = store.Revoke(ctx, *id); err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(stdout, "token revoked: %s\n", *id)
+		return err
+	case "list":
+		list, listErr := store.List(ctx)
+		if listErr != nil {
+			return listErr
+		}
+		for _, token := range list {
+			scope := "*"
+			if len(token.Prefixes) > 0 {
+				scope = strings.Join(token.Prefixes, ",")
+			}
+			if _, err = fmt.Fprintf(stdout, "%s\t%s\twrite=%s\tread=%t\t%s\n",
+				token.ID, token.Agent, scope, token.Read, token.CreatedAt.Format(time.RFC3339)); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return errTokenUsage
+	}
+}
+
+// openSource открывает хранилище-источник. В отличие от хранилища назначения файл источника должен существовать:
+// иначе ошибка в пути выглядела бы как пустое хранилище.
+func openSource(ctx context.Context, spec string) (storage.Storage, error) {
+	if path, ok := filePath(spec); ok {
+		if _, err := os.Stat(path); err != nil {
+			return nil, fmt.Errorf("source storage: %w", err)
+		}
+	}
+	return openStorage(ctx, spec)
+}
+
+// filePath возвращает путь к файлу хранилища, если строка не является DSN PostgreSQL.
+func filePath(spec string) (string, bool) {
+	if strings.HasPrefix(spec, "postgres://") || strings.HasPrefix(spec, "postgresql://") {
+		return "", false
+	}
+	return strings.TrimPrefix(spec, "file:"), true
+}
+
+// openStorage открывает хранилище по строке: DSN PostgreSQL или путь к файлу хранилища в памяти.
+// Отсутствующий файл открывается как пустое хранилище.
+func openStorage(ctx context.Context, spec string) (storage.Storage, error) {
+	path, ok := filePath(spec)
+	if !ok {
+		db, err := sql.Open("postgres", spec)
+		if err != nil {
+			return nil, err
+		}
+		if err = pgstorage.InstallSchema(db); err != nil {
+			return nil, err
+		}
+		return pgstorage.NewPGStorage(db), nil
+	}
+
+	st := memstorage.NewMemStorage(path, false)
+	if err := st.Load(ctx); err != nil {
+		return nil, err
+	}
+	return st, nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/invinciblewest/metrics/internal/models"
+	"github.com/invinciblewest/metrics/internal/storage/memstorage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRun_Migrate(t *testing.T) {
+	ctx := context.TODO()
+	dir := t.TempDir()
+	from := filepath.Join(dir, "from.json")
+	to := filepath.Join(dir, "to.json")
+
+	src := memstorage.NewMemStorage(from, false)
+	value := 3.14
+	delta := int64(5)
+	require.NoError(t, src.UpdateBatch(ctx, []models.Metric{
+		{ID: "Alloc", MType: models.TypeGauge, Value: &value},
+		{ID: "PollCount", MType: models.TypeCounter, Delta: &delta},
+	}))
+	require.NoError(t, src.Save(ctx))
+
+	t.Run("file to file", func(t *testing.T) {
+		var stdout bytes.Buffer
+		require.NoError(t, run(ctx, []string{"migrate", "-from", from, "-to", "file:" + to}, &stdout))
+		assert.Equal(t, "migrated gauges: 1, counters: 1, skipped: 0\n", stdout.String())
+
+		dst := memstorage.NewMemStorage(to, false)
+		require.NoError(t, dst.Load(ctx))
+		gauge, err := dst.GetGauge(ctx, "Alloc")
+		require.NoError(t, err)
+		assert.Equal(t, value, *gauge.Value)
+		counter, err := dst.GetCounter(ctx, "PollCount")
+		require.NoError(t, err)
+		assert.Equal(t, delta, *counter.Delta)
+	})
+	t.Run("missing source", func(t *testing.T) {
+		missing := filepath.Join(dir, "missing.json")
+		created := filepath.Join(dir, "created.json")
+		err := run(ctx, []string{"migrate", "-from", missing, "-to", created}, &bytes.Buffer{})
+		assert.ErrorIs(t, err, os.ErrNotExist)
+		_, err = os.Stat(created)
+		assert.ErrorIs(t, err, os.ErrNotExist)
+	})
+	t.Run("missing export source", func(t *testing.T) {
+		err := run(ctx, []string{"export", "-from", filepath.Join(dir, "missing.json")}, &bytes.Buffer{})
+		assert.ErrorIs(t, err, os.ErrNotExist)
+	})
+}
@@ -2,26 +2,42 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"database/sql"
 	"errors"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
+	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
 	"github.com/invinciblewest/metrics/pkg/encryption"
+	"github.com/invinciblewest/metrics/pkg/tlsconfig"
 
+	"github.com/invinciblewest/metrics/internal/export"
 	"github.com/invinciblewest/metrics/internal/logger"
+	"github.com/invinciblewest/metrics/internal/ratelimit"
+	"github.com/invinciblewest/metrics/internal/server/alerting"
 	"github.com/invinciblewest/metrics/internal/server/config"
+	"github.com/invinciblewest/metrics/internal/server/forwarding"
+	"github.com/invinciblewest/metrics/internal/server/grpcserver"
 	"github.com/invinciblewest/metrics/internal/server/handlers"
+	"github.com/invinciblewest/metrics/internal/server/recording"
+	"github.com/invinciblewest/metrics/internal/server/remotewrite"
 	"github.com/invinciblewest/metrics/internal/server/services"
+	"github.com/invinciblewest/metrics/internal/signature"
 	"github.com/invinciblewest/metrics/internal/storage"
 	"github.com/invinciblewest/metrics/internal/storage/memstorage"
 	"github.com/invinciblewest/metrics/internal/storage/pgstorage"
+	"github.com/invinciblewest/metrics/internal/storage/shardstorage"
+	"github.com/invinciblewest/metrics/internal/tokens"
 	_ "github.com/lib/pq"
 	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 )
 
 var (
@@ -48,20 +64,36 @@ func main() {
 
 	var st storage.Storage
 
-	if cfg.DatabaseDSN != "" {
-		logger.Log.Info("using PostgreSQL storage")
+	if len(cfg.DatabaseShards) > 0 {
+		logger.Log.Info("using sharded PostgreSQL storage", zap.Int("shards", len(cfg.DatabaseShards)))
 
-		var db *sql.DB
-		db, err = sql.Open("postgres", cfg.DatabaseDSN)
-		if err != nil {
-			logger.Log.Fatal("failed to connect to database", zap.Error(err))
+		shards := make([]storage.Storage, 0, len(cfg.DatabaseShards))
+		for _, dsn := range cfg.DatabaseShards {
+			var shard *pgstorage.PGStorage
+			shard, err = newPGStorage(dsn)
+			if err != nil {
+				logger.Log.Fatal("failed to initialize shard", zap.Error(err))
+			}
+			shards = append(shards, shard)
 		}
 
-		if err = pgstorage.InstallSchema(db); err != nil {
-			logger.Log.Fatal("failed to install schema", zap.Error(err))
+		st, err = shardstorage.NewShardStorage(shards...)
+		if err != nil {
+			logger.Log.Fatal("failed to initialize sharded storage", zap.Error(err))
 		}
+		defer func(st storage.Storage, ctx context.Context) {
+			err = st.Close(ctx)
+			if err != nil {
+				logger.Log.Fatal("failed to close storage", zap.Error(err))
+			}
+		}(st, ctx)
+	} else if cfg.DatabaseDSN != "" {
+		logger.Log.Info("using PostgreSQL storage")
 
-		st = pgstorage.NewPGStorage(db)
+		st, err = newPGStorage(cfg.DatabaseDSN)
+		if err != nil {
+			logger.Log.Fatal("failed to initialize database storage", zap.Error(err))
+		}
 		defer func(st storage.Storage, ctx context.Context) {
 			err = st.Close(ctx)
 			if err != nil {
@@ -104,26 +136,250 @@ func main() {
 		}()
 	}
 
-	var cryptor *encryption.Cryptor
-	if cfg.CryptoKey != "" {
-		cryptor, err = encryption.NewCryptor("", cfg.CryptoKey)
+	keys, err := signature.LoadKeys(cfg.HashKey, cfg.HashKeysFile)
+	if err != nil {
+		logger.Log.Fatal("failed to load hash keys", zap.Error(err))
+	}
+
+	var keyring *encryption.Keyring
+	if cryptoKeys := cryptoKeyPaths(cfg); len(cryptoKeys) > 0 {
+		keyring, err = encryption.NewKeyring(cryptoKeys...)
 		if err != nil {
 			logger.Log.Fatal("failed to create cryptor", zap.Error(err))
 		}
 	}
 
-	handler := handlers.NewHandler(services.NewMetricsService(st))
-	router := handlers.GetRouter(handler, cfg.HashKey, cryptor)
+	var verifier *encryption.Verifier
+	if len(cfg.SignatureKeys) > 0 {
+		verifier, err = encryption.NewVerifier(cfg.SignatureKeys...)
+		if err != nil {
+			logger.Log.Fatal("failed to load signature keys", zap.Error(err))
+		}
+	}
+
+	go reloadKeys(ctx, keys, keyring, verifier)
+
+	trustedSubnet, err := parseSubnet(cfg.TrustedSubnet)
+	if err != nil {
+		logger.Log.Fatal("failed to parse trusted subnet", zap.Error(err))
+	}
+	readSubnet, err := parseSubnet(cfg.ReadSubnet)
+	if err != nil {
+		logger.Log.Fatal("failed to parse read trusted subnet", zap.Error(err))
+	}
+
+	var tlsConfig *tls.Config
+	if cfg.TLSCert != "" || cfg.TLSKey != "" {
+		tlsConfig, err = tlsconfig.Server(cfg.TLSCert, cfg.TLSKey, cfg.TLSClientCA)
+		if err != nil {
+			logger.Log.Fatal("failed to load tls config", zap.Error(err))
+		}
+	}
+
+	serviceOpts := []services.Option{
+		services.WithMaxBatchSize(cfg.MaxBatchSize),
+		services.WithIdempotencyWindow(time.Duration(cfg.DedupWindow) * time.Second),
+		services.WithMaxMetrics(cfg.MaxMetrics),
+		services.WithSubscriptionBuffer(cfg.SubBuffer),
+		services.WithHeartbeat(time.Duration(cfg.Heartbeat) * time.Second),
+		services.WithRateSamples(cfg.RateSamples),
+		services.WithRateRetention(time.Duration(cfg.RateRetention) * time.Second),
+	}
+	forwardDone := make(chan struct{})
+	if cfg.ForwardTargets != "" {
+		var destinations []forwarding.Destination
+		destinations, err = forwarding.LoadDestinations(cfg.ForwardTargets)
+		if err != nil {
+			logger.Log.Fatal("failed to load forwarding destinations", zap.Error(err))
+		}
+		var forwardOpts []forwarding.Option
+		if cfg.ForwardSpool != "" {
+			forwardOpts = append(forwardOpts, forwarding.WithSpool(cfg.ForwardSpool, 0, 0))
+		}
+		var forwarder *forwarding.Forwarder
+		forwarder, err = forwarding.NewForwarder(destinations, forwardOpts...)
+		if err != nil {
+			logger.Log.Fatal("failed to create forwarder", zap.Error(err))
+		}
+		serviceOpts = append(serviceOpts, services.WithForwarder(forwarder))
+		go func() {
+			forwarder.Run(ctx)
+			close(forwardDone)
+		}()
+	} else {
+		close(forwardDone)
+	}
+	service := services.NewMetricsService(st, serviceOpts...)
+	go func() {
+		<-ctx.Done()
+		service.CloseSubscriptions()
+	}()
+	routerOpts := []handlers.RouterOption{
+		handlers.WithAdmin(handlers.NewAdminHandler(service, keyring), cfg.AdminToken),
+		handlers.WithTrustedSubnet(trustedSubnet, readSubnet),
+		handlers.WithHashPolicy(cfg.HashStrict, time.Duration(cfg.HashWindow)*time.Second),
+		handlers.WithVerifier(verifier),
+		handlers.WithMaxBodySize(cfg.MaxBodySize),
+	}
+	grpcOpts := grpcserver.WithTrustedSubnet(trustedSubnet, readSubnet)
+	if cfg.MaxBodySize > 0 {
+		grpcOpts = append(grpcOpts, grpc.MaxRecvMsgSize(int(cfg.MaxBodySize)))
+	}
+	if cfg.Tokens != "" {
+		var tokenStore tokens.Store
+		tokenStore, err = tokens.Open(cfg.Tokens)
+		if err != nil {
+			logger.Log.Fatal("failed to open token store", zap.Error(err))
+		}
+		defer tokenStore.Close()
+		routerOpts = append(routerOpts, handlers.WithTokens(tokenStore))
+		grpcOpts = append(grpcOpts, grpcserver.WithTokens(tokenStore)...)
+	}
+	if cfg.RateLimit > 0 {
+		limiter := ratelimit.NewLimiter(cfg.RateLimit, cfg.RateBurst)
+		routerOpts = append(routerOpts, handlers.WithRateLimit(limiter))
+		grpcOpts = append(grpcOpts, grpcserver.WithRateLimit(limiter)...)
+	}
+
+	if cfg.RecordRules != "" {
+		var rules []recording.Rule
+		rules, err = recording.LoadRules(cfg.RecordRules)
+		if err != nil {
+			logger.Log.Fatal("failed to load recording rules", zap.Error(err))
+		}
+		recorder := recording.NewRecorder(&service, rules, recording.WithInterval(time.Duration(cfg.RecordInterval)*time.Second))
+		go recorder.Run(ctx)
+	}
+	if cfg.AlertRules != "" {
+		var rules []alerting.Rule
+		rules, err = alerting.LoadRules(cfg.AlertRules)
+		if err != nil {
+			logger.Log.Fatal("failed to load alerting rules", zap.Error(err))
+		}
+		sinks := []alerting.Sink{alerting.NewLogSink()}
+		if cfg.AlertWebhook != "" {
+			sinks = append(sinks, alerting.NewWebhookSink(cfg.AlertWebhook, nil))
+		}
+		engine := alerting.NewEngine(&service, rules,
+			alerting.WithSinks(sinks...),
+			alerting.WithInterval(time.Duration(cfg.AlertInterval)*time.Second),
+		)
+		go engine.Run(ctx)
+		routerOpts = append(routerOpts, handlers.WithAlerts(handlers.NewAlertsHandler(engine)))
+	}
+
+	var exporters []export.Exporter
+	if cfg.InfluxURL != "" {
+		exporters = append(exporters, export.NewInflux(cfg.InfluxURL, cfg.InfluxToken, export.WithPrefix(cfg.ExportPrefix)))
+	}
+	if cfg.GraphiteAddr != "" {
+		exporters = append(exporters, export.NewGraphite(cfg.GraphiteAddr, export.WithPrefix(cfg.ExportPrefix)))
+	}
+	if len(exporters) > 0 {
+		pusher := export.NewPusher(st, time.Duration(cfg.ExportInterval)*time.Second, exporters...)
+		go pusher.Run(ctx)
+	}
+
+	if cfg.RemoteWrite {
+		receiver := remotewrite.NewReceiver(&service)
+		routerOpts = append(routerOpts, handlers.WithRemoteWrite(handlers.NewRemoteWriteHandler(receiver, cfg.MaxBodySize)))
+	}
 
-	if err = run(ctx, cfg.Address, router); err != nil && !errors.Is(err, http.ErrServerClosed) {
+	router := handlers.GetRouter(handlers.NewHandler(service), keys, keyring, routerOpts...)
+
+	if cfg.GRPCAddress != "" {
+		if tlsConfig != nil {
+			grpcOpts = append(grpcOpts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+		}
+		// gRPC проверяет только подписи HMAC: строгий режим с одними ключами Ed25519/ECDSA оставил бы его открытым.
+		if cfg.HashStrict && !keys.Enabled() && verifier != nil {
+			logger.Log.Fatal("strict hash mode over gRPC requires an HMAC key")
+		}
+		policy := grpcserver.HashPolicy{Strict: cfg.HashStrict, Window: time.Duration(cfg.HashWindow) * time.Second}
+		grpcServer := grpcserver.NewServer(service, keys, policy, grpcOpts...)
+		go func() {
+			if serveErr := runGRPC(ctx, cfg.GRPCAddress, grpcServer); serveErr != nil {
+				logger.Log.Fatal("grpc server error", zap.Error(serveErr))
+			}
+		}()
+	}
+
+	if err = run(ctx, cfg.Address, router, tlsConfig); err != nil && !errors.Is(err, http.ErrServerClosed) {
 		logger.Log.Fatal("server error", zap.Error(err))
 	}
+	// Пакеты, ожидающие пересылки, сохраняются в очередь на диске до завершения.
+	<-forwardDone
 }
 
-func run(ctx context.Context, addr string, handler http.Handler) error {
+// newPGStorage подключается к базе данных по DSN, устанавливает схему и создает хранилище PostgreSQL.
+func newPGStorage(dsn string) (*pgstorage.PGStorage, error) {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = pgstorage.InstallSchema(db); err != nil {
+		return nil, err
+	}
+
+	return pgstorage.NewPGStorage(db), nil
+}
+
+// cryptoKeyPaths возвращает пути к приватным ключам: основной ключ первым, затем дополнительные.
+func cryptoKeyPaths(cfg config.Config) []string {
+	var paths []string
+	for _, path := range append([]string{cfg.CryptoKey}, cfg.CryptoKeys...) {
+		if path != "" {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// reloadKeys перечитывает файлы ключей HMAC, шифрования и подписи при получении SIGHUP.
+// Установленные соединения не разрываются: новые ключи применяются к следующим запросам.
+func reloadKeys(ctx context.Context, keys *signature.Keys, keyring *encryption.Keyring, verifier *encryption.Verifier) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			if err := keys.Reload(); err != nil {
+				logger.Log.Error("failed to reload hash keys", zap.Error(err))
+			}
+			if keyring != nil {
+				if err := keyring.Reload(); err != nil {
+					logger.Log.Error("failed to reload crypto keys", zap.Error(err))
+				}
+			}
+			if verifier != nil {
+				if err := verifier.Reload(); err != nil {
+					logger.Log.Error("failed to reload signature keys", zap.Error(err))
+				}
+			}
+			logger.Log.Info("keys reloaded")
+		}
+	}
+}
+
+// parseSubnet разбирает подсеть в нотации CIDR. Для пустой строки возвращается nil.
+func parseSubnet(cidr string) (*net.IPNet, error) {
+	if cidr == "" {
+		return nil, nil
+	}
+	_, subnet, err := net.ParseCIDR(cidr)
+	return subnet, err
+}
+
+func run(ctx context.Context, addr string, handler http.Handler, tlsConfig *tls.Config) error {
 	server := &http.Server{
-		Addr:    addr,
-		Handler: handler,
+		Addr:      addr,
+		Handler:   handler,
+		TLSConfig: tlsConfig,
 	}
 
 	go func() {
@@ -138,10 +394,29 @@ func run(ctx context.Context, addr string, handler http.Handler) error {
 		}
 	}()
 
-	logger.Log.Info("server is starting", zap.String("address", addr))
+	logger.Log.Info("server is starting", zap.String("address", addr), zap.Bool("tls", tlsConfig != nil))
+	if tlsConfig != nil {
+		return server.ListenAndServeTLS("", "")
+	}
 	return server.ListenAndServe()
 }
 
+func runGRPC(ctx context.Context, addr string, server *grpc.Server) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		<-ctx.Done()
+		logger.Log.Info("grpc server is shutting down...")
+		server.GracefulStop()
+	}()
+
+	logger.Log.Info("grpc server is starting", zap.String("address", addr))
+	return server.Serve(listener)
+}
+
 func checkValue(val string) string {
 	if val == "" {
 		return "N/A"
@@ -2,7 +2,10 @@ package agent
 
 import (
 	"context"
+	"errors"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/golang/mock/gomock"
 	"github.com/invinciblewest/metrics/internal/agent/collectors"
@@ -12,6 +15,7 @@ import (
 	"github.com/invinciblewest/metrics/internal/models"
 	"github.com/invinciblewest/metrics/internal/storage/memstorage"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestNewAgent(t *testing.T) {
@@ -49,3 +53,46 @@ func TestNewAgent(t *testing.T) {
 		assert.NoError(t, err)
 	}()
 }
+
+// failingExporter экспортер, выгрузка в который всегда завершается ошибкой.
+type failingExporter struct{}
+
+func (failingExporter) Export(context.Context, []models.Metric) error {
+	return errors.New("influx is unavailable")
+}
+
+func (failingExporter) Close() error {
+	return nil
+}
+
+func TestAgent_FailingExporter(t *testing.T) {
+	st := memstorage.NewMemStorage("", false)
+	delta := int64(1)
+	require.NoError(t, st.UpdateCounter(context.TODO(), models.Metric{ID: "PollCount", MType: models.TypeCounter, Delta: &delta}))
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var sent atomic.Int32
+	mSender := mocks2.NewMockSender(ctrl)
+	mSender.EXPECT().SendMetric(gomock.Any(), gomock.Any()).DoAndReturn(func(context.Context, []models.Metric) error {
+		sent.Add(1)
+		return nil
+	}).AnyTimes()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		agent := NewAgent(st, nil, []senders.Sender{senders.NewExportSender(failingExporter{}), mSender}, 1, 1)
+		done <- agent.Run(ctx, 2)
+	}()
+
+	// Ошибка выгрузки не останавливает агента: метрики продолжают отправляться на сервер.
+	require.Eventually(t, func() bool { return sent.Load() >= 2 }, 5*time.Second, 50*time.Millisecond)
+	select {
+	case err := <-done:
+		t.Fatalf("agent stopped: %v", err)
+	default:
+	}
+	cancel()
+}
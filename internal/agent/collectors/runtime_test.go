@@ -4,6 +4,7 @@ import (
 	"context"
 	"testing"
 
+	"github.com/invinciblewest/metrics/internal/models"
 	"github.com/invinciblewest/metrics/internal/storage/memstorage"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -57,7 +58,11 @@ func TestRuntimeCollector_Collect(t *testing.T) {
 			"RandomValue",
 		}
 
-		gaugeList := st.GetGaugeList(ctx)
+		gaugeList := make(map[string]models.Metric)
+		for metric, err := range st.GetGaugeList(ctx) {
+			assert.NoError(t, err)
+			gaugeList[metric.ID] = metric
+		}
 		for _, v := range gaugeKeyList {
 			assert.Contains(t, gaugeList, v)
 		}
@@ -67,7 +72,11 @@ func TestRuntimeCollector_Collect(t *testing.T) {
 			"PollCount",
 		}
 
-		counterList := st.GetCounterList(ctx)
+		counterList := make(map[string]models.Metric)
+		for metric, err := range st.GetCounterList(ctx) {
+			assert.NoError(t, err)
+			counterList[metric.ID] = metric
+		}
 		for _, v := range counterKeyList {
 			assert.Contains(t, counterList, v)
 		}
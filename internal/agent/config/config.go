@@ -11,14 +11,25 @@ import (
 
 // Config содержит конфигурацию агента, включая адрес сервера, интервалы опроса и отчета.
 type Config struct {
-	Address        string `env:"ADDRESS"`         // Адрес сервера, на который будет отправлять метрики агент.
-	PollInterval   int    `env:"POLL_INTERVAL"`   // Интервал опроса метрик в секундах.
-	ReportInterval int    `env:"REPORT_INTERVAL"` // Интервал отправки отчетов на сервер в секундах.
-	LogLevel       string `env:"LOG_LEVEL"`       // Уровень логирования, например, "info", "debug", "error".
-	HashKey        string `env:"KEY"`             // Ключ для хеширования метрик перед отправкой на сервер.
-	RateLimit      int    `env:"RATE_LIMIT"`      // Ограничение скорости отправки метрик на сервер (количество метрик в секунду).
-	Pprof          bool   `env:"PPROF"`           // Флаг, указывающий, нужно ли включать pprof для профилирования производительности.
-	CryptoKey      string `env:"CRYPTO_KEY"`      // Ключ для шифрования метрик перед отправкой на сервер.
+	Address        string `env:"ADDRESS"`          // Адрес сервера, на который будет отправлять метрики агент.
+	PollInterval   int    `env:"POLL_INTERVAL"`    // Интервал опроса метрик в секундах.
+	ReportInterval int    `env:"REPORT_INTERVAL"`  // Интервал отправки отчетов на сервер в секундах.
+	LogLevel       string `env:"LOG_LEVEL"`        // Уровень логирования, например, "info", "debug", "error".
+	HashKey        string `env:"KEY"`              // Ключ для хеширования метрик перед отправкой на сервер.
+	RateLimit      int    `env:"RATE_LIMIT"`       // Ограничение скорости отправки метрик на сервер (количество метрик в секунду).
+	Pprof          bool   `env:"PPROF"`            // Флаг, указывающий, нужно ли включать pprof для профилирования производительности.
+	CryptoKey      string `env:"CRYPTO_KEY"`       // Ключ для шифрования метрик перед отправкой на сервер.
+	GRPCAddress    string `env:"GRPC_ADDRESS"`     // Адрес gRPC-сервера, если задан, метрики отправляются по gRPC вместо HTTP.
+	SignKey        string `env:"SIGN_KEY"`         // Путь к приватному ключу Ed25519 или ECDSA для подписи запросов.
+	TLSCA          string `env:"TLS_CA"`           // Путь к сертификату центра для проверки сервера, если задан, метрики отправляются по TLS.
+	TLSCert        string `env:"TLS_CERT"`         // Путь к клиентскому сертификату агента для mTLS.
+	TLSKey         string `env:"TLS_KEY"`          // Путь к приватному ключу клиентского сертификата агента.
+	Token          string `env:"TOKEN"`            // Токен агента, передаваемый серверу в заголовке Authorization.
+	Stream         bool   `env:"STREAM"`           // Флаг потоковой отправки метрик по HTTP в формате NDJSON без буферизации всего отчета.
+	InfluxURL      string `env:"INFLUX_URL"`       // Адрес записи InfluxDB, если задан, метрики дополнительно выгружаются в InfluxDB.
+	InfluxToken    string `env:"INFLUX_TOKEN"`     // Токен InfluxDB, передаваемый в заголовке Authorization.
+	GraphiteAddr   string `env:"GRAPHITE_ADDRESS"` // Адрес приема метрик Graphite, если задан, метрики дополнительно выгружаются в Graphite.
+	ExportPrefix   string `env:"EXPORT_PREFIX"`    // Префикс имен метрик, выгружаемых в InfluxDB и Graphite, например имя хоста.
 }
 
 // JSONConfig представляет структуру JSON файла конфигурации агента
@@ -27,6 +38,17 @@ type JSONConfig struct {
 	ReportInterval string `json:"report_interval"`
 	PollInterval   string `json:"poll_interval"`
 	CryptoKey      string `json:"crypto_key"`
+	GRPCAddress    string `json:"grpc_address"`
+	SignKey        string `json:"sign_key"`
+	TLSCA          string `json:"tls_ca"`
+	TLSCert        string `json:"tls_cert"`
+	TLSKey         string `json:"tls_key"`
+	Token          string `json:"token"`
+	Stream         *bool  `json:"stream"`
+	InfluxURL      string `json:"influx_url"`
+	InfluxToken    string `json:"influx_token"`
+	GraphiteAddr   string `json:"graphite_address"`
+	ExportPrefix   string `json:"export_prefix"`
 }
 
 // GetConfig считывает конфигурацию агента из флагов командной строки и переменных окружения.
@@ -53,6 +75,17 @@ func GetConfig() (Config, error) {
 	flag.IntVar(&config.RateLimit, "L", config.RateLimit, "rate limit")
 	flag.BoolVar(&config.Pprof, "pprof", config.Pprof, "enable pprof")
 	flag.StringVar(&config.CryptoKey, "crypto-key", config.CryptoKey, "path to crypto key for metrics encryption")
+	flag.StringVar(&config.GRPCAddress, "grpc-address", config.GRPCAddress, "grpc server address")
+	flag.StringVar(&config.SignKey, "sign-key", config.SignKey, "path to Ed25519 or ECDSA private key for request signatures")
+	flag.StringVar(&config.TLSCA, "tls-ca", config.TLSCA, "path to CA certificate for server verification")
+	flag.StringVar(&config.TLSCert, "tls-cert", config.TLSCert, "path to agent TLS client certificate")
+	flag.StringVar(&config.TLSKey, "tls-key", config.TLSKey, "path to agent TLS client private key")
+	flag.StringVar(&config.Token, "token", config.Token, "agent api token")
+	flag.BoolVar(&config.Stream, "stream", config.Stream, "stream metrics over http as ndjson")
+	flag.StringVar(&config.InfluxURL, "influx-url", config.InfluxURL, "influxdb write url to export metrics to")
+	flag.StringVar(&config.InfluxToken, "influx-token", config.InfluxToken, "influxdb api token")
+	flag.StringVar(&config.GraphiteAddr, "graphite-address", config.GraphiteAddr, "graphite plaintext address to export metrics to")
+	flag.StringVar(&config.ExportPrefix, "export-prefix", config.ExportPrefix, "prefix of metric names exported to influxdb and graphite")
 	flag.StringVar(&configFile, "c", "", "config file path")
 	flag.StringVar(&configFile, "config", "", "config file path")
 	flag.Parse()
@@ -107,4 +140,37 @@ func applyJSONConfig(config *Config, jsonConfig *JSONConfig) {
 	if jsonConfig.CryptoKey != "" {
 		config.CryptoKey = jsonConfig.CryptoKey
 	}
+	if jsonConfig.GRPCAddress != "" {
+		config.GRPCAddress = jsonConfig.GRPCAddress
+	}
+	if jsonConfig.SignKey != "" {
+		config.SignKey = jsonConfig.SignKey
+	}
+	if jsonConfig.Token != "" {
+		config.Token = jsonConfig.Token
+	}
+	if jsonConfig.Stream != nil {
+		config.Stream = *jsonConfig.Stream
+	}
+	if jsonConfig.InfluxURL != "" {
+		config.InfluxURL = jsonConfig.InfluxURL
+	}
+	if jsonConfig.InfluxToken != "" {
+		config.InfluxToken = jsonConfig.InfluxToken
+	}
+	if jsonConfig.GraphiteAddr != "" {
+		config.GraphiteAddr = jsonConfig.GraphiteAddr
+	}
+	if jsonConfig.ExportPrefix != "" {
+		config.ExportPrefix = jsonConfig.ExportPrefix
+	}
+	if jsonConfig.TLSCA != "" {
+		config.TLSCA = jsonConfig.TLSCA
+	}
+	if jsonConfig.TLSCert != "" {
+		config.TLSCert = jsonConfig.TLSCert
+	}
+	if jsonConfig.TLSKey != "" {
+		config.TLSKey = jsonConfig.TLSKey
+	}
 }
@@ -44,6 +44,7 @@ func TestLoadJSONConfig(t *testing.T) {
 }
 
 func TestApplyJSONConfig(t *testing.T) {
+	stream := true
 	config := Config{
 		Address:        "localhost:8080",
 		PollInterval:   2,
@@ -56,6 +57,16 @@ func TestApplyJSONConfig(t *testing.T) {
 		ReportInterval: "5s",
 		PollInterval:   "1s",
 		CryptoKey:      "/path/to/key.pem",
+		TLSCA:          "/path/to/ca.pem",
+		TLSCert:        "/path/to/agent.pem",
+		TLSKey:         "/path/to/agent-key.pem",
+		SignKey:        "/path/to/sign.pem",
+		Token:          "mt_token",
+		Stream:         &stream,
+		InfluxURL:      "http://influx.local:8086/write?db=metrics",
+		InfluxToken:    "influx_token",
+		GraphiteAddr:   "graphite.local:2003",
+		ExportPrefix:   "host1.",
 	}
 
 	applyJSONConfig(&config, jsonConfig)
@@ -64,6 +75,16 @@ func TestApplyJSONConfig(t *testing.T) {
 	assert.Equal(t, 5, config.ReportInterval)
 	assert.Equal(t, 1, config.PollInterval)
 	assert.Equal(t, "/path/to/key.pem", config.CryptoKey)
+	assert.Equal(t, "/path/to/ca.pem", config.TLSCA)
+	assert.Equal(t, "/path/to/agent.pem", config.TLSCert)
+	assert.Equal(t, "/path/to/agent-key.pem", config.TLSKey)
+	assert.Equal(t, "/path/to/sign.pem", config.SignKey)
+	assert.Equal(t, "mt_token", config.Token)
+	assert.True(t, config.Stream)
+	assert.Equal(t, "http://influx.local:8086/write?db=metrics", config.InfluxURL)
+	assert.Equal(t, "influx_token", config.InfluxToken)
+	assert.Equal(t, "graphite.local:2003", config.GraphiteAddr)
+	assert.Equal(t, "host1.", config.ExportPrefix)
 }
 
 func TestApplyJSONConfigPartial(t *testing.T) {
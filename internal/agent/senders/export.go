@@ -0,0 +1,36 @@
+package senders
+
+import (
+	"context"
+
+	"github.com/invinciblewest/metrics/internal/export"
+	"github.com/invinciblewest/metrics/internal/models"
+)
+
+// ExportSender отправляет метрики во внешнюю систему хранения, например InfluxDB или Graphite,
+// в дополнение к серверу метрик.
+type ExportSender struct {
+	exporter export.Exporter
+}
+
+// NewExportSender создает отправителя, выгружающего метрики через exporter.
+func NewExportSender(exporter export.Exporter) *ExportSender {
+	return &ExportSender{
+		exporter: exporter,
+	}
+}
+
+// SendMetric выгружает текущие значения метрик.
+func (s *ExportSender) SendMetric(ctx context.Context, metrics []models.Metric) error {
+	return s.exporter.Export(ctx, metrics)
+}
+
+// Auxiliary сообщает, что выгрузка дополняет отправку на сервер и ее ошибки не останавливают агента.
+func (s *ExportSender) Auxiliary() bool {
+	return true
+}
+
+// Close закрывает соединения экспортера.
+func (s *ExportSender) Close() error {
+	return s.exporter.Close()
+}
@@ -0,0 +1,194 @@
+package senders
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/invinciblewest/metrics/internal/logger"
+	"github.com/invinciblewest/metrics/internal/models"
+	pb "github.com/invinciblewest/metrics/internal/proto"
+	"github.com/invinciblewest/metrics/internal/signature"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+)
+
+// grpcBatchSize максимальное количество метрик в одной части потока UpdateBatch.
+const grpcBatchSize = 100
+
+// GRPCSender отправляет метрики на сервер через gRPC потоком частей пакета со сжатием gzip.
+type GRPCSender struct {
+	conn   *grpc.ClientConn
+	client pb.MetricsClient
+}
+
+// NewGRPCSender создает новый экземпляр GRPCSender с заданным адресом сервера и ключом хеширования.
+// В метаданные каждого вызова добавляется адрес исходящего интерфейса агента.
+// Дополнительные опции подключения применяются после опций по умолчанию и могут их переопределить.
+func NewGRPCSender(serverAddr string, hashKey string, opts ...grpc.DialOption) (*GRPCSender, error) {
+	opts = append([]grpc.DialOption{
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultCallOptions(grpc.UseCompressor(gzip.Name)),
+		grpc.WithChainUnaryInterceptor(hashUnaryClientInterceptor(hashKey)),
+		grpc.WithChainStreamInterceptor(hashStreamClientInterceptor(hashKey)),
+	}, opts...)
+
+	if realIP, err := outboundIP(serverAddr); err == nil {
+		opts = append(opts,
+			grpc.WithChainUnaryInterceptor(realIPUnaryClientInterceptor(realIP)),
+			grpc.WithChainStreamInterceptor(realIPStreamClientInterceptor(realIP)),
+		)
+	} else {
+		logger.Log.Warn("failed to detect outbound ip", zap.Error(err))
+	}
+
+	conn, err := grpc.NewClient(serverAddr, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &GRPCSender{
+		conn:   conn,
+		client: pb.NewMetricsClient(conn),
+	}, nil
+}
+
+// SendMetric отправляет список метрик на сервер потоком частей пакета с ключом идемпотентности отчета.
+func (s *GRPCSender) SendMetric(ctx context.Context, metrics []models.Metric) error {
+	key, err := signature.NewNonce()
+	if err != nil {
+		return err
+	}
+	ctx = metadata.AppendToOutgoingContext(ctx, pb.IdempotencyKeyMetadataKey, key)
+
+	stream, err := s.client.UpdateBatch(ctx)
+	if err != nil {
+		return err
+	}
+
+	for start := 0; start < len(metrics); start += grpcBatchSize {
+		end := min(start+grpcBatchSize, len(metrics))
+		req := &pb.UpdateBatchRequest{
+			Metrics: make([]*pb.Metric, 0, end-start),
+		}
+		for _, metric := range metrics[start:end] {
+			req.Metrics = append(req.Metrics, pb.FromModel(metric))
+		}
+		if err = stream.Send(req); err != nil {
+			return err
+		}
+	}
+
+	_, err = stream.CloseAndRecv()
+	return err
+}
+
+// Close закрывает подключение к серверу.
+func (s *GRPCSender) Close() error {
+	return s.conn.Close()
+}
+
+// hashUnaryClientInterceptor создает перехватчик, добавляющий в метаданные HMAC-SHA256 запроса,
+// метку времени и nonce вызова, которые входят в подпись вместе с именем метода.
+func hashUnaryClientInterceptor(hashKey string) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if message, ok := req.(proto.Message); ok && hashKey != "" {
+			timestamp := signature.Timestamp(time.Now())
+			nonce, err := signature.NewNonce()
+			if err != nil {
+				return err
+			}
+			hash, err := pb.SignCall(hashKey, method, timestamp, nonce, message)
+			if err != nil {
+				return err
+			}
+			ctx = metadata.AppendToOutgoingContext(ctx,
+				pb.HashMetadataKey, base64.StdEncoding.EncodeToString(hash),
+				pb.KeyIDMetadataKey, signature.KeyID(hashKey),
+				pb.TimestampMetadataKey, timestamp,
+				pb.NonceMetadataKey, nonce,
+			)
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// hashStreamClientInterceptor создает перехватчик, добавляющий в метаданные метку времени и nonce потока
+// и подписывающий каждую отправляемую часть пакета вместе с ними, именем метода и номером части.
+// Перед закрытием потока UpdateBatch отправляется подписанное завершающее сообщение с количеством сообщений,
+// по которому сервер отличает полностью переданный пакет от оборванного.
+func hashStreamClientInterceptor(hashKey string) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		if hashKey == "" {
+			return streamer(ctx, desc, cc, method, opts...)
+		}
+		stream := &hashClientStream{hashKey: hashKey, method: method, timestamp: signature.Timestamp(time.Now())}
+		var err error
+		if stream.nonce, err = signature.NewNonce(); err != nil {
+			return nil, err
+		}
+		ctx = metadata.AppendToOutgoingContext(ctx,
+			pb.KeyIDMetadataKey, signature.KeyID(hashKey),
+			pb.TimestampMetadataKey, stream.timestamp,
+			pb.NonceMetadataKey, stream.nonce,
+		)
+		if stream.ClientStream, err = streamer(ctx, desc, cc, method, opts...); err != nil {
+			return nil, err
+		}
+		return stream, nil
+	}
+}
+
+// hashClientStream подписывает отправляемые части пакета.
+type hashClientStream struct {
+	grpc.ClientStream
+	hashKey   string
+	method    string
+	timestamp string
+	nonce     string
+	seq       int
+}
+
+func (s *hashClientStream) SendMsg(m any) error {
+	if req, ok := m.(*pb.UpdateBatchRequest); ok {
+		if err := pb.SignBatch(s.hashKey, s.method, s.timestamp, s.nonce, s.seq, req); err != nil {
+			return err
+		}
+		s.seq++
+	}
+	return s.ClientStream.SendMsg(m)
+}
+
+// CloseSend отправляет завершающее сообщение потока UpdateBatch и закрывает отправку.
+// Если сервер уже завершил поток, SendMsg возвращает io.EOF, а причину вернет получение ответа.
+func (s *hashClientStream) CloseSend() error {
+	if s.method == pb.Metrics_UpdateBatch_FullMethodName {
+		if err := s.SendMsg(&pb.UpdateBatchRequest{Parts: int64(s.seq + 1)}); err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+	}
+	return s.ClientStream.CloseSend()
+}
+
+// realIPUnaryClientInterceptor создает перехватчик, добавляющий адрес агента в метаданные унарного вызова.
+func realIPUnaryClientInterceptor(realIP string) grpc.UnaryClientInterceptor {
+	key := strings.ToLower(RealIPHeader)
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		return invoker(metadata.AppendToOutgoingContext(ctx, key, realIP), method, req, reply, cc, opts...)
+	}
+}
+
+// realIPStreamClientInterceptor создает перехватчик, добавляющий адрес агента в метаданные потокового вызова.
+func realIPStreamClientInterceptor(realIP string) grpc.StreamClientInterceptor {
+	key := strings.ToLower(RealIPHeader)
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return streamer(metadata.AppendToOutgoingContext(ctx, key, realIP), desc, cc, method, opts...)
+	}
+}
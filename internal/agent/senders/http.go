@@ -4,8 +4,6 @@ import (
 	"bytes"
 	"compress/gzip"
 	"context"
-	"crypto/hmac"
-	"crypto/sha256"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
@@ -20,6 +18,7 @@ import (
 	"github.com/go-resty/resty/v2"
 	"github.com/invinciblewest/metrics/internal/logger"
 	"github.com/invinciblewest/metrics/internal/models"
+	"github.com/invinciblewest/metrics/internal/signature"
 	"go.uber.org/zap"
 )
 
@@ -31,6 +30,9 @@ type HTTPSender struct {
 	gzipPool   *sync.Pool
 	bufPool    *sync.Pool
 	cryptor    *encryption.Cryptor
+	signer     *encryption.Signer
+	realIP     string
+	streaming  bool
 }
 
 // NewHTTPSender создает новый экземпляр HTTPSender с заданным адресом сервера, ключом хеширования и HTTP клиентом.
@@ -62,8 +64,14 @@ func NewHTTPSender(serverAddr string, hashKey string, client *http.Client, crypt
 			logger.Log.Info("retrying request...")
 		})
 
-	return &HTTPSender{
+	realIP, err := outboundIP(serverAddr)
+	if err != nil {
+		logger.Log.Warn("failed to detect outbound ip", zap.Error(err))
+	}
+
+	s := &HTTPSender{
 		serverAddr: serverAddr,
+		realIP:     realIP,
 		client:     restyClient,
 		hashKey:    hashKey,
 		gzipPool: &sync.Pool{
@@ -78,15 +86,88 @@ func NewHTTPSender(serverAddr string, hashKey string, client *http.Client, crypt
 		},
 		cryptor: cryptor,
 	}
+	restyClient.OnBeforeRequest(openStreamBody)
+	restyClient.OnBeforeRequest(s.signRequest)
+	return s
+}
+
+// SetToken задает токен агента, который передается серверу в заголовке Authorization.
+func (s *HTTPSender) SetToken(token string) {
+	s.client.SetAuthToken(token)
+}
+
+// SetStreaming включает потоковую отправку метрик на /updates/stream.
+func (s *HTTPSender) SetStreaming(streaming bool) {
+	s.streaming = streaming
+}
+
+// SetSigner задает ключ Ed25519 или ECDSA, которым запросы подписываются вместо HMAC или вместе с ним.
+func (s *HTTPSender) SetSigner(signer *encryption.Signer) {
+	s.signer = signer
+}
+
+// signRequest подписывает каждую попытку отправки запроса заново,
+// чтобы повторные попытки получали новые метку времени и nonce. В подпись входят метод и URI запроса
+// в том виде, в котором их получит сервер.
+func (s *HTTPSender) signRequest(_ *resty.Client, req *resty.Request) error {
+	if s.hashKey == "" && s.signer == nil {
+		return nil
+	}
+
+	body, _ := req.Body.([]byte)
+	target, err := url.Parse(req.URL)
+	if err != nil {
+		return err
+	}
+	uri := target.RequestURI()
+	nonce, err := signature.NewNonce()
+	if err != nil {
+		return err
+	}
+	timestamp := signature.Timestamp(time.Now())
+	req.SetHeader(signature.HeaderTimestamp, timestamp)
+	req.SetHeader(signature.HeaderNonce, nonce)
+
+	if s.hashKey != "" {
+		req.SetHeader(signature.HeaderKeyID, signature.KeyID(s.hashKey))
+		req.SetHeader(signature.HeaderHash, base64.StdEncoding.EncodeToString(signature.Sum(s.hashKey, req.Method, uri, timestamp, nonce, body)))
+	}
+	if s.signer != nil {
+		var sig []byte
+		if sig, err = s.signer.Sign(signature.Payload(req.Method, uri, timestamp, nonce, body)); err != nil {
+			return err
+		}
+		req.SetHeader(signature.HeaderSignatureKeyID, s.signer.KeyID())
+		req.SetHeader(signature.HeaderSignature, base64.StdEncoding.EncodeToString(sig))
+	}
+	return nil
 }
 
 // SendMetric отправляет список метрик на сервер в формате JSON, сжимаемом с помощью gzip.
+// Все попытки отправки отчета передают один ключ идемпотентности, поэтому повтор после потерянного ответа
+// не увеличивает счетчики на сервере повторно.
+// В потоковом режиме метрики отправляются на /updates/stream. Если запросы не подписываются и не шифруются,
+// тело кодируется в NDJSON по мере передачи и отчет целиком в памяти не собирается; иначе тело,
+// необходимое для подписи, собирается заранее в виде массива JSON.
 func (s *HTTPSender) SendMetric(ctx context.Context, metrics []models.Metric) error {
-	path, err := url.JoinPath(s.serverAddr, "updates")
+	endpoint := "updates"
+	if s.streaming {
+		endpoint = "updates/stream"
+	}
+	path, err := url.JoinPath(s.serverAddr, endpoint)
+	if err != nil {
+		return err
+	}
+	key, err := signature.NewNonce()
 	if err != nil {
 		return err
 	}
 
+	if s.streaming && s.hashKey == "" && s.signer == nil && s.cryptor == nil {
+		body := &streamBody{metrics: metrics, gzipPool: s.gzipPool}
+		return s.post(ctx, path, key, "application/x-ndjson", body)
+	}
+
 	buf := s.bufPool.Get().(*bytes.Buffer)
 	buf.Reset()
 	defer s.bufPool.Put(buf)
@@ -119,20 +200,31 @@ func (s *HTTPSender) SendMetric(ctx context.Context, metrics []models.Metric) er
 		}
 	}
 
+	return s.post(ctx, path, key, "application/json", buf.Bytes())
+}
+
+// post отправляет сжатое тело отчета с ключом идемпотентности key.
+func (s *HTTPSender) post(ctx context.Context, path, key, contentType string, body any) error {
 	req := s.client.R().
 		SetHeader("Content-Encoding", "gzip").
 		SetHeader("Accept-Encoding", "gzip").
-		SetHeader("Content-Type", "application/json").
-		SetBody(buf.Bytes()).
+		SetHeader("Content-Type", contentType).
+		SetHeader(IdempotencyKeyHeader, key).
+		SetBody(body).
 		SetContext(ctx)
 
-	if s.hashKey != "" {
-		hash := hmac.New(sha256.New, []byte(s.hashKey))
-		hash.Write(buf.Bytes())
-		req.SetHeader("HashSHA256", base64.StdEncoding.EncodeToString(hash.Sum(nil)))
+	if s.realIP != "" {
+		req.SetHeader(RealIPHeader, s.realIP)
+	}
+	if s.cryptor != nil {
+		req.SetHeader(encryption.KeyIDHeader, s.cryptor.KeyID())
 	}
 
 	resp, err := req.Post(path)
+	if attempt, ok := req.Body.(*streamAttempt); ok {
+		// Запрос мог завершиться до передачи тела транспорту.
+		attempt.Close()
+	}
 
 	if err != nil {
 		return err
@@ -142,3 +234,48 @@ func (s *HTTPSender) SendMetric(ctx context.Context, metrics []models.Metric) er
 	}
 	return nil
 }
+
+// streamBody тело потоковой отправки: метрики кодируются в NDJSON и сжимаются gzip по мере передачи.
+// Каждая попытка отправки получает собственный поток, поэтому повторы передают отчет целиком.
+type streamBody struct {
+	metrics  []models.Metric
+	gzipPool *sync.Pool
+}
+
+// streamAttempt поток тела одной попытки отправки.
+type streamAttempt struct {
+	*io.PipeReader
+	source *streamBody
+}
+
+// open запускает кодирование метрик в новый поток.
+func (b *streamBody) open() *streamAttempt {
+	pr, pw := io.Pipe()
+	go func() {
+		gz := b.gzipPool.Get().(*gzip.Writer)
+		defer b.gzipPool.Put(gz)
+		gz.Reset(pw)
+
+		enc := json.NewEncoder(gz)
+		for _, metric := range b.metrics {
+			if err := enc.Encode(metric); err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+		}
+		pw.CloseWithError(gz.Close())
+	}()
+	return &streamAttempt{PipeReader: pr, source: b}
+}
+
+// openStreamBody подставляет новый поток тела перед каждой попыткой отправки запроса.
+// Поток предыдущей попытки закрывает транспорт.
+func openStreamBody(_ *resty.Client, req *resty.Request) error {
+	switch body := req.Body.(type) {
+	case *streamBody:
+		req.Body = body.open()
+	case *streamAttempt:
+		req.Body = body.source.open()
+	}
+	return nil
+}
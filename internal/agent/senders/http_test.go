@@ -5,12 +5,15 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/invinciblewest/metrics/internal/models"
 	"github.com/invinciblewest/metrics/internal/server/handlers"
 	"github.com/invinciblewest/metrics/internal/server/services"
+	"github.com/invinciblewest/metrics/internal/signature"
 	"github.com/invinciblewest/metrics/internal/storage/memstorage"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestNewHTTPSender(t *testing.T) {
@@ -37,7 +40,7 @@ func TestHTTPSender_Send(t *testing.T) {
 				handlers.NewHandler(
 					services.NewMetricsService(st),
 				),
-				"",
+				nil,
 				nil,
 			),
 		)
@@ -46,6 +49,122 @@ func TestHTTPSender_Send(t *testing.T) {
 		err := s.SendMetric(ctx, createMetrics())
 		assert.NoError(t, err)
 	})
+	t.Run("signed", func(t *testing.T) {
+		st := memstorage.NewMemStorage("", false)
+		srv := httptest.NewServer(handlers.GetRouter(
+			handlers.NewHandler(services.NewMetricsService(st)),
+			signature.NewKeys("secret"),
+			nil,
+			handlers.WithHashPolicy(true, time.Minute),
+		))
+		defer srv.Close()
+		s := NewHTTPSender(srv.URL, "secret", http.DefaultClient, nil)
+		assert.NoError(t, s.SendMetric(ctx, createMetrics()))
+		assert.NoError(t, s.SendMetric(ctx, createMetrics()))
+	})
+	t.Run("real ip", func(t *testing.T) {
+		var realIP string
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			realIP = r.Header.Get(RealIPHeader)
+		}))
+		defer srv.Close()
+		s := createSender(srv.URL)
+		err := s.SendMetric(ctx, createMetrics())
+		assert.NoError(t, err)
+		assert.Equal(t, "127.0.0.1", realIP)
+	})
+	t.Run("token", func(t *testing.T) {
+		var authorization string
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			authorization = r.Header.Get("Authorization")
+		}))
+		defer srv.Close()
+		s := createSender(srv.URL)
+		s.SetToken("mt_token")
+		err := s.SendMetric(ctx, createMetrics())
+		assert.NoError(t, err)
+		assert.Equal(t, "Bearer mt_token", authorization)
+	})
+	t.Run("idempotent retry", func(t *testing.T) {
+		st := memstorage.NewMemStorage("", false)
+		router := handlers.GetRouter(
+			handlers.NewHandler(services.NewMetricsService(st, services.WithIdempotencyWindow(time.Minute))),
+			nil,
+			nil,
+		)
+		var keys []string
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			keys = append(keys, r.Header.Get(IdempotencyKeyHeader))
+			if len(keys) == 1 {
+				router.ServeHTTP(httptest.NewRecorder(), r)
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+			router.ServeHTTP(w, r)
+		}))
+		defer srv.Close()
+
+		delta := int64(5)
+		s := createSender(srv.URL)
+		err := s.SendMetric(ctx, []models.Metric{{ID: "PollCount", MType: models.TypeCounter, Delta: &delta}})
+		require.NoError(t, err)
+		require.Len(t, keys, 2)
+		assert.NotEmpty(t, keys[0])
+		assert.Equal(t, keys[0], keys[1])
+
+		counter, err := st.GetCounter(ctx, "PollCount")
+		require.NoError(t, err)
+		assert.Equal(t, int64(5), *counter.Delta)
+	})
+	t.Run("streaming retry", func(t *testing.T) {
+		st := memstorage.NewMemStorage("", false)
+		router := handlers.GetRouter(
+			handlers.NewHandler(services.NewMetricsService(st, services.WithIdempotencyWindow(time.Minute))),
+			nil,
+			nil,
+		)
+		var attempts []string
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			attempts = append(attempts, r.URL.Path+" "+r.Header.Get("Content-Type"))
+			if len(attempts) == 1 {
+				router.ServeHTTP(httptest.NewRecorder(), r)
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+			router.ServeHTTP(w, r)
+		}))
+		defer srv.Close()
+
+		metrics := make([]models.Metric, 0, 2500)
+		for i := 0; i < cap(metrics); i++ {
+			delta := int64(1)
+			metrics = append(metrics, models.Metric{ID: "PollCount", MType: models.TypeCounter, Delta: &delta})
+		}
+		s := createSender(srv.URL)
+		s.SetStreaming(true)
+		require.NoError(t, s.SendMetric(ctx, metrics))
+		assert.Equal(t, []string{"/updates/stream application/x-ndjson", "/updates/stream application/x-ndjson"}, attempts)
+
+		counter, err := st.GetCounter(ctx, "PollCount")
+		require.NoError(t, err)
+		assert.Equal(t, int64(2500), *counter.Delta)
+	})
+	t.Run("streaming signed", func(t *testing.T) {
+		st := memstorage.NewMemStorage("", false)
+		srv := httptest.NewServer(handlers.GetRouter(
+			handlers.NewHandler(services.NewMetricsService(st)),
+			signature.NewKeys("secret"),
+			nil,
+			handlers.WithHashPolicy(true, time.Minute),
+		))
+		defer srv.Close()
+		s := NewHTTPSender(srv.URL, "secret", http.DefaultClient, nil)
+		s.SetStreaming(true)
+		require.NoError(t, s.SendMetric(ctx, createMetrics()))
+
+		_, err := st.GetGauge(ctx, "test")
+		assert.NoError(t, err)
+	})
 }
 
 func createMetrics() []models.Metric {
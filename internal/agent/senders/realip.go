@@ -0,0 +1,37 @@
+package senders
+
+import (
+	"net"
+	"net/url"
+)
+
+// RealIPHeader заголовок, в котором агент передает свой адрес для проверки доверенной подсети.
+const RealIPHeader = "X-Real-IP"
+
+// IdempotencyKeyHeader заголовок с ключом идемпотентности отчета: повторная отправка отчета
+// с тем же ключом не применяет метрики на сервере второй раз.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// outboundIP определяет адрес локального интерфейса, через который идет трафик к серверу.
+// Адрес сервера может быть задан как URL или как host:port. Пакеты при этом не отправляются.
+func outboundIP(serverAddr string) (string, error) {
+	host := serverAddr
+	if u, err := url.Parse(serverAddr); err == nil && u.Host != "" {
+		host = u.Host
+		if u.Port() == "" {
+			port := "80"
+			if u.Scheme == "https" {
+				port = "443"
+			}
+			host = net.JoinHostPort(u.Hostname(), port)
+		}
+	}
+
+	conn, err := net.Dial("udp", host)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	return conn.LocalAddr().(*net.UDPAddr).IP.String(), nil
+}
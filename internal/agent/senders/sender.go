@@ -16,21 +16,31 @@ type Sender interface {
 	SendMetric(ctx context.Context, metrics []models.Metric) error
 }
 
+// Auxiliary реализуют дополнительные отправители, например выгрузка в InfluxDB или Graphite.
+type Auxiliary interface {
+	// Auxiliary сообщает, что ошибка отправителя не должна останавливать агента.
+	Auxiliary() bool
+}
+
 // SendMetrics отправляет метрики на сервер с использованием пула воркеров и заданных отправителей.
+// Ошибки дополнительных отправителей (Auxiliary) только записываются в журнал: недоступность внешней системы
+// не должна прерывать отправку метрик на сервер.
 func SendMetrics(workersPool *worker.Pool, st storage.Storage, senders ...Sender) {
 	for _, s := range senders {
 		workersPool.AddJob(func(ctx context.Context) error {
 			logger.Log.Info("sending metrics to server...")
 
-			metrics := make([]models.Metric, 0)
-			for _, v := range st.GetGaugeList(ctx) {
-				metrics = append(metrics, v)
-			}
-			for _, v := range st.GetCounterList(ctx) {
-				metrics = append(metrics, v)
+			metrics, err := storage.Collect(st.List(ctx))
+			if err != nil {
+				logger.Log.Error("failed to list metrics: ", zap.Error(err))
+				return err
 			}
-			err := s.SendMetric(ctx, metrics)
+			err = s.SendMetric(ctx, metrics)
 			if err != nil {
+				if aux, ok := s.(Auxiliary); ok && aux.Auxiliary() {
+					logger.Log.Warn("failed to export metrics", zap.Error(err))
+					return nil
+				}
 				logger.Log.Error("failed to send metrics: ", zap.Error(err))
 				return err
 			}
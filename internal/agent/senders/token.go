@@ -0,0 +1,24 @@
+package senders
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+)
+
+// tokenCredentials передает токен агента в метаданных authorization каждого вызова.
+type tokenCredentials string
+
+func (t tokenCredentials) GetRequestMetadata(context.Context, ...string) (map[string]string, error) {
+	return map[string]string{"authorization": "Bearer " + string(t)}, nil
+}
+
+// RequireTransportSecurity разрешает передачу токена без TLS, как и остальные настройки агента.
+func (t tokenCredentials) RequireTransportSecurity() bool {
+	return false
+}
+
+// WithToken возвращает опцию подключения, передающую токен агента в каждом gRPC-вызове.
+func WithToken(token string) grpc.DialOption {
+	return grpc.WithPerRPCCredentials(tokenCredentials(token))
+}
@@ -0,0 +1,104 @@
+package backup
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/invinciblewest/metrics/pkg/encryption"
+)
+
+// magic сигнатура файла архива.
+var magic = []byte("MBAK")
+
+// flagEncrypted признак содержимого, зашифрованного encryption.Cryptor.
+const flagEncrypted byte = 1
+
+// ErrEncryptedArchive возвращается при попытке прочитать зашифрованный архив без ключа.
+var ErrEncryptedArchive = errors.New("archive is encrypted")
+
+// Write записывает архив в w.
+// Содержимое архива сжимается gzip и, если задан cryptor, шифруется им в формате encryption.Cryptor.
+//
+// Формат: "MBAK" | версия (1 байт) | флаги (1 байт) | данные.
+func Write(w io.Writer, a Archive, cryptor *encryption.Cryptor) error {
+	var body bytes.Buffer
+	gz := gzip.NewWriter(&body)
+	if err := json.NewEncoder(gz).Encode(a); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+
+	data := body.Bytes()
+	var flags byte
+	if cryptor != nil {
+		flags |= flagEncrypted
+		var err error
+		if data, err = cryptor.Encrypt(data); err != nil {
+			return err
+		}
+	}
+
+	header := append([]byte{}, magic...)
+	header = append(header, byte(a.Version), flags)
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+// Read читает и проверяет архив из r. Зашифрованный архив расшифровывается любым ключом из keyring,
+// поэтому архивы, созданные до ротации ключей, остаются читаемыми.
+func Read(r io.Reader, keyring *encryption.Keyring) (Archive, error) {
+	br := bufio.NewReader(r)
+
+	header := make([]byte, len(magic)+2)
+	if _, err := io.ReadFull(br, header); err != nil {
+		return Archive{}, fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+	}
+	if !bytes.Equal(header[:len(magic)], magic) {
+		return Archive{}, fmt.Errorf("%w: bad signature", ErrInvalidArchive)
+	}
+	if version := int(header[len(magic)]); version != Version {
+		return Archive{}, fmt.Errorf("%w: %d", ErrUnsupportedVersion, version)
+	}
+
+	var body io.Reader = br
+	if header[len(magic)+1]&flagEncrypted != 0 {
+		if keyring == nil {
+			return Archive{}, ErrEncryptedArchive
+		}
+		sealed, err := io.ReadAll(br)
+		if err != nil {
+			return Archive{}, err
+		}
+		plain, err := keyring.Decrypt("", sealed)
+		if err != nil {
+			return Archive{}, fmt.Errorf("%w: %w", ErrInvalidArchive, err)
+		}
+		body = bytes.NewReader(plain)
+	}
+
+	gz, err := gzip.NewReader(body)
+	if err != nil {
+		return Archive{}, fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+	}
+	defer gz.Close()
+
+	var a Archive
+	if err = json.NewDecoder(gz).Decode(&a); err != nil {
+		return Archive{}, fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+	}
+	if err = a.Validate(); err != nil {
+		return Archive{}, err
+	}
+
+	return a, nil
+}
@@ -0,0 +1,131 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/invinciblewest/metrics/internal/models"
+	"github.com/invinciblewest/metrics/internal/storage"
+)
+
+// Version текущая версия формата архива.
+const Version = 1
+
+// Mode определяет способ восстановления состояния из архива.
+type Mode string
+
+const (
+	ModeReplace Mode = "replace" // ModeReplace полностью заменяет состояние хранилища содержимым архива.
+	ModeMerge   Mode = "merge"   // ModeMerge записывает метрики из архива поверх текущего состояния, сохраняя остальные метрики.
+)
+
+var (
+	ErrUnknownMode        = errors.New("unknown restore mode")
+	ErrInvalidArchive     = errors.New("invalid archive")
+	ErrUnsupportedVersion = errors.New("unsupported archive version")
+)
+
+// Archive представляет собой снимок состояния хранилища метрик.
+type Archive struct {
+	Version   int             `json:"version"`    // Version версия формата архива.
+	CreatedAt time.Time       `json:"created_at"` // CreatedAt время создания снимка.
+	Metrics   []models.Metric `json:"metrics"`    // Metrics метрики, входящие в снимок.
+}
+
+// Create создает архив с согласованным снимком состояния хранилища.
+func Create(ctx context.Context, st storage.Storage) (Archive, error) {
+	snapshotter, ok := st.(storage.Snapshotter)
+	if !ok {
+		return Archive{}, storage.ErrNotSupported
+	}
+
+	metrics, err := snapshotter.Snapshot(ctx)
+	if err != nil {
+		return Archive{}, err
+	}
+
+	return Archive{
+		Version:   Version,
+		CreatedAt: time.Now().UTC(),
+		Metrics:   metrics,
+	}, nil
+}
+
+// Validate проверяет версию архива и корректность метрик в нем.
+func (a Archive) Validate() error {
+	if a.Version != Version {
+		return fmt.Errorf("%w: %d", ErrUnsupportedVersion, a.Version)
+	}
+
+	seen := make(map[string]struct{}, len(a.Metrics))
+	for i, metric := range a.Metrics {
+		if metric.ID == "" {
+			return fmt.Errorf("%w: metric %d has empty id", ErrInvalidArchive, i)
+		}
+		switch metric.MType {
+		case models.TypeGauge:
+			if metric.Value == nil {
+				return fmt.Errorf("%w: gauge %q has no value", ErrInvalidArchive, metric.ID)
+			}
+		case models.TypeCounter:
+			if metric.Delta == nil {
+				return fmt.Errorf("%w: counter %q has no delta", ErrInvalidArchive, metric.ID)
+			}
+		default:
+			return fmt.Errorf("%w: metric %q has unknown type %q", ErrInvalidArchive, metric.ID, metric.MType)
+		}
+
+		key := metric.MType + ":" + metric.ID
+		if _, exists := seen[key]; exists {
+			return fmt.Errorf("%w: duplicate metric %q", ErrInvalidArchive, metric.ID)
+		}
+		seen[key] = struct{}{}
+	}
+
+	return nil
+}
+
+// Restore проверяет архив и восстанавливает из него состояние хранилища в заданном режиме.
+func Restore(ctx context.Context, st storage.Storage, a Archive, mode Mode) error {
+	if err := a.Validate(); err != nil {
+		return err
+	}
+
+	switch mode {
+	case ModeReplace:
+		snapshotter, ok := st.(storage.Snapshotter)
+		if !ok {
+			return storage.ErrNotSupported
+		}
+		if err := snapshotter.Replace(ctx, a.Metrics); err != nil {
+			return err
+		}
+	case ModeMerge:
+		batch := make([]models.Metric, 0, len(a.Metrics))
+		for _, metric := range a.Metrics {
+			if metric.MType == models.TypeCounter {
+				delta := *metric.Delta
+				current, err := st.GetCounter(ctx, metric.ID)
+				if err != nil && !errors.Is(err, storage.ErrNotFound) {
+					return err
+				}
+				if err == nil {
+					delta -= *current.Delta
+				}
+				metric.Delta = &delta
+			}
+			batch = append(batch, metric)
+		}
+		if len(batch) > 0 {
+			if err := st.UpdateBatch(ctx, batch); err != nil {
+				return err
+			}
+		}
+	default:
+		return ErrUnknownMode
+	}
+
+	return st.Save(ctx)
+}
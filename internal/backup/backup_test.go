@@ -0,0 +1,200 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/invinciblewest/metrics/internal/models"
+	"github.com/invinciblewest/metrics/internal/storage/memstorage"
+	"github.com/invinciblewest/metrics/pkg/encryption"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreate(t *testing.T) {
+	st := newStorage(t)
+	archive, err := Create(context.TODO(), st)
+	require.NoError(t, err)
+	assert.Equal(t, Version, archive.Version)
+	assert.Len(t, archive.Metrics, 2)
+	assert.NoError(t, archive.Validate())
+}
+
+func TestArchive_Validate(t *testing.T) {
+	value := 1.0
+	tests := []struct {
+		name    string
+		archive Archive
+	}{
+		{
+			name:    "wrong version",
+			archive: Archive{Version: 2},
+		},
+		{
+			name:    "empty id",
+			archive: Archive{Version: Version, Metrics: []models.Metric{{MType: models.TypeGauge, Value: &value}}},
+		},
+		{
+			name:    "gauge without value",
+			archive: Archive{Version: Version, Metrics: []models.Metric{{ID: "test", MType: models.TypeGauge}}},
+		},
+		{
+			name:    "counter without delta",
+			archive: Archive{Version: Version, Metrics: []models.Metric{{ID: "test", MType: models.TypeCounter}}},
+		},
+		{
+			name:    "unknown type",
+			archive: Archive{Version: Version, Metrics: []models.Metric{{ID: "test", MType: "unknown"}}},
+		},
+		{
+			name: "duplicate",
+			archive: Archive{Version: Version, Metrics: []models.Metric{
+				{ID: "test", MType: models.TypeGauge, Value: &value},
+				{ID: "test", MType: models.TypeGauge, Value: &value},
+			}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Error(t, test.archive.Validate())
+		})
+	}
+}
+
+func TestRestore(t *testing.T) {
+	ctx := context.TODO()
+	archive, err := Create(ctx, newStorage(t))
+	require.NoError(t, err)
+
+	t.Run("replace", func(t *testing.T) {
+		st := memstorage.NewMemStorage("", false)
+		extra := 5.0
+		require.NoError(t, st.UpdateGauge(ctx, models.Metric{ID: "extra", MType: models.TypeGauge, Value: &extra}))
+
+		require.NoError(t, Restore(ctx, st, archive, ModeReplace))
+		_, err := st.GetGauge(ctx, "extra")
+		assert.Error(t, err)
+		counter, err := st.GetCounter(ctx, "PollCount")
+		require.NoError(t, err)
+		assert.Equal(t, int64(7), *counter.Delta)
+	})
+	t.Run("merge", func(t *testing.T) {
+		st := memstorage.NewMemStorage("", false)
+		extra := 5.0
+		delta := int64(100)
+		require.NoError(t, st.UpdateBatch(ctx, []models.Metric{
+			{ID: "extra", MType: models.TypeGauge, Value: &extra},
+			{ID: "PollCount", MType: models.TypeCounter, Delta: &delta},
+		}))
+
+		require.NoError(t, Restore(ctx, st, archive, ModeMerge))
+		_, err := st.GetGauge(ctx, "extra")
+		assert.NoError(t, err)
+		counter, err := st.GetCounter(ctx, "PollCount")
+		require.NoError(t, err)
+		assert.Equal(t, int64(7), *counter.Delta)
+	})
+	t.Run("unknown mode", func(t *testing.T) {
+		st := memstorage.NewMemStorage("", false)
+		assert.ErrorIs(t, Restore(ctx, st, archive, "unknown"), ErrUnknownMode)
+	})
+}
+
+func TestWriteRead(t *testing.T) {
+	archive, err := Create(context.TODO(), newStorage(t))
+	require.NoError(t, err)
+
+	t.Run("plain", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, Write(&buf, archive, nil))
+
+		restored, err := Read(&buf, nil)
+		require.NoError(t, err)
+		assert.ElementsMatch(t, archive.Metrics, restored.Metrics)
+	})
+	t.Run("encrypted", func(t *testing.T) {
+		publicPath, privatePath := writeKeys(t)
+		encryptor, err := encryption.NewCryptor(publicPath, "")
+		require.NoError(t, err)
+		decryptor, err := encryption.NewKeyring(privatePath)
+		require.NoError(t, err)
+
+		var buf bytes.Buffer
+		require.NoError(t, Write(&buf, archive, encryptor))
+		data := buf.Bytes()
+
+		_, err = Read(bytes.NewReader(data), nil)
+		assert.ErrorIs(t, err, ErrEncryptedArchive)
+
+		restored, err := Read(bytes.NewReader(data), decryptor)
+		require.NoError(t, err)
+		assert.ElementsMatch(t, archive.Metrics, restored.Metrics)
+
+		data[len(data)-1] ^= 0xff
+		_, err = Read(bytes.NewReader(data), decryptor)
+		assert.ErrorIs(t, err, ErrInvalidArchive)
+	})
+	t.Run("rotated key", func(t *testing.T) {
+		oldPublic, oldPrivate := writeKeys(t)
+		_, newPrivate := writeKeys(t)
+		encryptor, err := encryption.NewCryptor(oldPublic, "")
+		require.NoError(t, err)
+		keyring, err := encryption.NewKeyring(newPrivate, oldPrivate)
+		require.NoError(t, err)
+
+		var buf bytes.Buffer
+		require.NoError(t, Write(&buf, archive, encryptor))
+		restored, err := Read(&buf, keyring)
+		require.NoError(t, err)
+		assert.ElementsMatch(t, archive.Metrics, restored.Metrics)
+	})
+	t.Run("bad signature", func(t *testing.T) {
+		_, err := Read(bytes.NewReader([]byte("NOPE\x01\x00")), nil)
+		assert.ErrorIs(t, err, ErrInvalidArchive)
+	})
+	t.Run("unsupported version", func(t *testing.T) {
+		_, err := Read(bytes.NewReader([]byte("MBAK\x09\x00")), nil)
+		assert.ErrorIs(t, err, ErrUnsupportedVersion)
+	})
+}
+
+func newStorage(t *testing.T) *memstorage.MemStorage {
+	st := memstorage.NewMemStorage("", false)
+	value := 3.14
+	delta := int64(7)
+	err := st.UpdateBatch(context.TODO(), []models.Metric{
+		{ID: "Alloc", MType: models.TypeGauge, Value: &value},
+		{ID: "PollCount", MType: models.TypeCounter, Delta: &delta},
+	})
+	require.NoError(t, err)
+	return st
+}
+
+func writeKeys(t *testing.T) (string, string) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	publicBytes, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	publicPath := filepath.Join(dir, "public.pem")
+	privatePath := filepath.Join(dir, "private.pem")
+	require.NoError(t, os.WriteFile(publicPath, pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PUBLIC KEY",
+		Bytes: publicBytes,
+	}), 0600))
+	require.NoError(t, os.WriteFile(privatePath, pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(privateKey),
+	}), 0600))
+
+	return publicPath, privatePath
+}
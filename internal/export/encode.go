@@ -0,0 +1,64 @@
+package export
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/invinciblewest/metrics/internal/models"
+)
+
+var (
+	// influxEscaper экранирует специальные символы имени измерения InfluxDB.
+	influxEscaper = strings.NewReplacer(",", `\,`, " ", `\ `, "\n", `\n`)
+	// graphiteEscaper заменяет символы, недопустимые в имени метрики Graphite.
+	graphiteEscaper = strings.NewReplacer(" ", "_", "\t", "_", "\n", "_")
+)
+
+// AppendInflux добавляет к dst строку line protocol для метрики: имя метрики становится измерением,
+// тип — тегом type, значение — полем value; значение счетчика записывается целым числом.
+// Это единственный кодировщик line protocol: его используют и экспортер, и пересылка метрик.
+func AppendInflux(dst []byte, prefix string, metric models.Metric, at time.Time) []byte {
+	dst = append(dst, influxEscaper.Replace(prefix+metric.ID)...)
+	dst = append(dst, ",type="...)
+	dst = append(dst, metric.MType...)
+	dst = append(dst, " value="...)
+	switch metric.MType {
+	case models.TypeGauge:
+		dst = strconv.AppendFloat(dst, *metric.Value, 'g', -1, 64)
+	case models.TypeCounter:
+		dst = strconv.AppendInt(dst, *metric.Delta, 10)
+		dst = append(dst, 'i')
+	}
+	dst = append(dst, ' ')
+	dst = strconv.AppendInt(dst, at.UnixNano(), 10)
+	return append(dst, '\n')
+}
+
+// appendGraphite добавляет к dst строку текстового протокола Graphite: путь, значение и время в секундах.
+func appendGraphite(dst []byte, prefix string, metric models.Metric, at time.Time) []byte {
+	dst = append(dst, graphiteEscaper.Replace(prefix+metric.ID)...)
+	dst = append(dst, ' ')
+	switch metric.MType {
+	case models.TypeGauge:
+		dst = strconv.AppendFloat(dst, *metric.Value, 'f', -1, 64)
+	case models.TypeCounter:
+		dst = strconv.AppendInt(dst, *metric.Delta, 10)
+	}
+	dst = append(dst, ' ')
+	dst = strconv.AppendInt(dst, at.Unix(), 10)
+	return append(dst, '\n')
+}
+
+// Encodable сообщает, есть ли у метрики значение, которое можно выгрузить: NaN и бесконечности
+// не поддерживаются ни InfluxDB, ни Graphite.
+func Encodable(metric models.Metric) bool {
+	switch metric.MType {
+	case models.TypeGauge:
+		return metric.Value != nil && !math.IsNaN(*metric.Value) && !math.IsInf(*metric.Value, 0)
+	case models.TypeCounter:
+		return metric.Delta != nil
+	}
+	return false
+}
@@ -0,0 +1,84 @@
+// Package export выгружает метрики во внешние системы хранения: в InfluxDB в формате line protocol по HTTP
+// и в Graphite в текстовом формате по TCP. Экспортеры используются как сервером для периодической выгрузки
+// всех метрик, так и агентом в качестве дополнительных отправителей.
+package export
+
+import (
+	"context"
+	"time"
+
+	"github.com/invinciblewest/metrics/internal/models"
+)
+
+const (
+	defaultBatchSize = 500              // defaultBatchSize количество метрик в одном запросе или записи.
+	defaultTimeout   = 10 * time.Second // defaultTimeout время ожидания подключения, записи или ответа.
+)
+
+// Exporter выгружает метрики во внешнюю систему.
+type Exporter interface {
+	// Export выгружает текущие значения метрик.
+	Export(ctx context.Context, metrics []models.Metric) error
+	// Close освобождает соединения экспортера.
+	Close() error
+}
+
+// Option задает дополнительную настройку экспортера.
+type Option func(*options)
+
+type options struct {
+	batchSize int
+	prefix    string
+	timeout   time.Duration
+	now       func() time.Time
+}
+
+func newOptions(opts []Option) options {
+	o := options{
+		batchSize: defaultBatchSize,
+		timeout:   defaultTimeout,
+		now:       time.Now,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// WithBatchSize задает количество метрик в одном запросе или записи. Нулевое значение оставляет размер по умолчанию.
+func WithBatchSize(n int) Option {
+	return func(o *options) {
+		if n > 0 {
+			o.batchSize = n
+		}
+	}
+}
+
+// WithPrefix задает префикс имен метрик, например имя хоста, с которого они получены.
+func WithPrefix(prefix string) Option {
+	return func(o *options) {
+		o.prefix = prefix
+	}
+}
+
+// WithTimeout задает время ожидания подключения, записи или ответа. Нулевое значение оставляет время по умолчанию.
+func WithTimeout(d time.Duration) Option {
+	return func(o *options) {
+		if d > 0 {
+			o.timeout = d
+		}
+	}
+}
+
+// batches делит метрики на пакеты не больше size метрик.
+func batches(metrics []models.Metric, size int) [][]models.Metric {
+	result := make([][]models.Metric, 0, (len(metrics)+size-1)/size)
+	for len(metrics) > size {
+		result = append(result, metrics[:size])
+		metrics = metrics[size:]
+	}
+	if len(metrics) > 0 {
+		result = append(result, metrics)
+	}
+	return result
+}
@@ -0,0 +1,112 @@
+package export
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/invinciblewest/metrics/internal/models"
+	"github.com/invinciblewest/metrics/internal/storage/memstorage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func gauge(id string, value float64) models.Metric {
+	return models.Metric{ID: id, MType: models.TypeGauge, Value: &value}
+}
+
+func counter(id string, delta int64) models.Metric {
+	return models.Metric{ID: id, MType: models.TypeCounter, Delta: &delta}
+}
+
+func TestEncode(t *testing.T) {
+	at := time.Unix(1700000000, 0)
+	tests := []struct {
+		name     string
+		metric   models.Metric
+		influx   string
+		graphite string
+	}{
+		{
+			name:     "gauge",
+			metric:   gauge("Alloc", 1.5),
+			influx:   "host1.Alloc,type=gauge value=1.5 1700000000000000000\n",
+			graphite: "host1.Alloc 1.5 1700000000\n",
+		},
+		{
+			name:     "large gauge",
+			metric:   gauge("TotalMemory", 8e9),
+			influx:   "host1.TotalMemory,type=gauge value=8e+09 1700000000000000000\n",
+			graphite: "host1.TotalMemory 8000000000 1700000000\n",
+		},
+		{
+			name:     "counter",
+			metric:   counter("PollCount", 42),
+			influx:   "host1.PollCount,type=counter value=42i 1700000000000000000\n",
+			graphite: "host1.PollCount 42 1700000000\n",
+		},
+		{
+			name:     "escaped name",
+			metric:   gauge("Free Memory,MB", 1),
+			influx:   "host1.Free\\ Memory\\,MB,type=gauge value=1 1700000000000000000\n",
+			graphite: "host1.Free_Memory,MB 1 1700000000\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.True(t, Encodable(tt.metric))
+			assert.Equal(t, tt.influx, string(AppendInflux(nil, "host1.", tt.metric, at)))
+			assert.Equal(t, tt.graphite, string(appendGraphite(nil, "host1.", tt.metric, at)))
+		})
+	}
+
+	assert.False(t, Encodable(gauge("NaN", math.NaN())))
+	assert.False(t, Encodable(models.Metric{ID: "Empty", MType: models.TypeCounter}))
+}
+
+func TestBatches(t *testing.T) {
+	metrics := []models.Metric{gauge("a", 1), gauge("b", 2), gauge("c", 3)}
+	assert.Len(t, batches(metrics, 2), 2)
+	assert.Len(t, batches(metrics, 3), 1)
+	assert.Empty(t, batches(nil, 3))
+}
+
+// recordingExporter запоминает выгруженные метрики.
+type recordingExporter struct {
+	exported [][]models.Metric
+	err      error
+	closed   bool
+}
+
+func (e *recordingExporter) Export(_ context.Context, metrics []models.Metric) error {
+	e.exported = append(e.exported, metrics)
+	return e.err
+}
+
+func (e *recordingExporter) Close() error {
+	e.closed = true
+	return nil
+}
+
+func TestPusher_Push(t *testing.T) {
+	ctx := context.TODO()
+	st := memstorage.NewMemStorage("", false)
+	require.NoError(t, st.UpdateBatch(ctx, []models.Metric{gauge("Alloc", 1.5), counter("PollCount", 3)}))
+
+	failing := &recordingExporter{err: errors.New("unavailable")}
+	working := &recordingExporter{}
+	pusher := NewPusher(st, time.Hour, failing, working)
+
+	err := pusher.Push(ctx)
+	assert.ErrorIs(t, err, failing.err)
+	require.Len(t, working.exported, 1, "failed exporter does not stop the others")
+	assert.ElementsMatch(t, []models.Metric{gauge("Alloc", 1.5), counter("PollCount", 3)}, working.exported[0])
+
+	runCtx, cancel := context.WithCancel(ctx)
+	cancel()
+	pusher.Run(runCtx)
+	assert.True(t, failing.closed)
+	assert.True(t, working.closed)
+}
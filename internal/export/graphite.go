@@ -0,0 +1,123 @@
+package export
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/invinciblewest/metrics/internal/models"
+)
+
+// aliveProbe время ожидания при проверке, что соединение с Graphite не закрыто.
+const aliveProbe = time.Millisecond
+
+// Graphite выгружает метрики в Graphite в текстовом формате по TCP. Соединение устанавливается
+// при первой выгрузке и используется повторно; после ошибки записи оно устанавливается заново.
+type Graphite struct {
+	addr string
+	opts options
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+// NewGraphite создает экспортер в Graphite, принимающий метрики по адресу addr, например graphite:2003.
+func NewGraphite(addr string, opts ...Option) *Graphite {
+	return &Graphite{
+		addr: addr,
+		opts: newOptions(opts),
+	}
+}
+
+// Export записывает метрики пакетами по batchSize строк. Если запись не удалась, соединение
+// закрывается, и пакет записывается еще раз по новому соединению.
+func (e *Graphite) Export(ctx context.Context, metrics []models.Metric) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.conn != nil && !e.alive() {
+		e.reset()
+	}
+	at := e.opts.now()
+	var buf []byte
+	for _, batch := range batches(metrics, e.opts.batchSize) {
+		buf = buf[:0]
+		for _, metric := range batch {
+			if Encodable(metric) {
+				buf = appendGraphite(buf, e.opts.prefix, metric, at)
+			}
+		}
+		if len(buf) == 0 {
+			continue
+		}
+
+		err := e.write(ctx, buf)
+		if err != nil && ctx.Err() == nil {
+			err = e.write(ctx, buf)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// write записывает данные, при необходимости устанавливая соединение. После ошибки соединение закрывается.
+func (e *Graphite) write(ctx context.Context, data []byte) error {
+	if e.conn == nil {
+		dialer := net.Dialer{Timeout: e.opts.timeout}
+		conn, err := dialer.DialContext(ctx, "tcp", e.addr)
+		if err != nil {
+			return err
+		}
+		e.conn = conn
+	}
+
+	deadline := time.Now().Add(e.opts.timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	if err := e.conn.SetWriteDeadline(deadline); err != nil {
+		e.reset()
+		return err
+	}
+	if _, err := e.conn.Write(data); err != nil {
+		e.reset()
+		return err
+	}
+	return nil
+}
+
+// alive проверяет, что Graphite не закрыл соединение. Graphite ничего не пишет в соединение, поэтому
+// короткое чтение завершается по таймауту, если соединение открыто, и ошибкой, если оно закрыто.
+// Без проверки первая запись в закрытое соединение завершилась бы успешно, а данные были бы потеряны.
+func (e *Graphite) alive() bool {
+	if err := e.conn.SetReadDeadline(time.Now().Add(aliveProbe)); err != nil {
+		return false
+	}
+	var one [1]byte
+	_, err := e.conn.Read(one[:])
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// reset закрывает соединение, чтобы следующая запись установила новое.
+func (e *Graphite) reset() {
+	_ = e.conn.Close()
+	e.conn = nil
+}
+
+// Close закрывает соединение.
+func (e *Graphite) Close() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.conn == nil {
+		return nil
+	}
+	err := e.conn.Close()
+	e.conn = nil
+	return err
+}
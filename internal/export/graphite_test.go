@@ -0,0 +1,91 @@
+package export
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/invinciblewest/metrics/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// graphiteServer тестовый прием метрик Graphite, передающий принятые строки в канал.
+type graphiteServer struct {
+	listener net.Listener
+	lines    chan string
+	conns    chan net.Conn
+}
+
+func newGraphiteServer(t *testing.T) *graphiteServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	s := &graphiteServer{listener: listener, lines: make(chan string, 100), conns: make(chan net.Conn, 10)}
+	go func() {
+		for {
+			conn, acceptErr := listener.Accept()
+			if acceptErr != nil {
+				return
+			}
+			s.conns <- conn
+			go func() {
+				scanner := bufio.NewScanner(conn)
+				for scanner.Scan() {
+					s.lines <- scanner.Text()
+				}
+			}()
+		}
+	}()
+	t.Cleanup(func() { _ = listener.Close() })
+	return s
+}
+
+func (s *graphiteServer) next(t *testing.T) string {
+	select {
+	case line := <-s.lines:
+		return line
+	case <-time.After(time.Second):
+		t.Fatal("no line received")
+		return ""
+	}
+}
+
+func TestGraphite_Export(t *testing.T) {
+	server := newGraphiteServer(t)
+	exporter := NewGraphite(server.listener.Addr().String(), WithPrefix("host1."), WithBatchSize(1))
+	exporter.opts.now = func() time.Time { return time.Unix(1700000000, 0) }
+	defer exporter.Close()
+
+	require.NoError(t, exporter.Export(context.TODO(), []models.Metric{gauge("Alloc", 1.5), counter("PollCount", 3)}))
+	assert.Equal(t, "host1.Alloc 1.5 1700000000", server.next(t))
+	assert.Equal(t, "host1.PollCount 3 1700000000", server.next(t))
+	conn := <-server.conns
+	assert.Empty(t, server.conns, "batches share one connection")
+
+	// Graphite закрыл соединение: следующая выгрузка устанавливает новое и не теряет метрики.
+	require.NoError(t, conn.Close())
+	require.Eventually(t, func() bool { return !exporter.aliveLocked() }, time.Second, 10*time.Millisecond)
+	require.NoError(t, exporter.Export(context.TODO(), []models.Metric{gauge("Alloc", 2.5)}))
+	assert.Equal(t, "host1.Alloc 2.5 1700000000", server.next(t))
+	assert.Len(t, server.conns, 1)
+}
+
+func TestGraphite_Unavailable(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := listener.Addr().String()
+	require.NoError(t, listener.Close())
+
+	exporter := NewGraphite(addr, WithTimeout(100*time.Millisecond))
+	assert.Error(t, exporter.Export(context.TODO(), []models.Metric{gauge("Alloc", 1)}))
+	assert.NoError(t, exporter.Close())
+}
+
+// aliveLocked проверяет соединение экспортера под блокировкой.
+func (e *Graphite) aliveLocked() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.conn != nil && e.alive()
+}
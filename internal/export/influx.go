@@ -0,0 +1,99 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/invinciblewest/metrics/internal/models"
+)
+
+// ErrRejected возвращается, если InfluxDB отклонил запрос ошибкой клиента: повторная отправка не поможет.
+var ErrRejected = errors.New("write rejected")
+
+// Influx выгружает метрики в InfluxDB в формате line protocol по HTTP.
+type Influx struct {
+	url    string
+	token  string
+	client *http.Client
+	opts   options
+}
+
+// NewInflux создает экспортер в InfluxDB. url — адрес записи вместе с параметрами, например
+// http://influx:8086/write?db=metrics для InfluxDB 1.x или http://influx:8086/api/v2/write?org=o&bucket=b для 2.x.
+// Непустой token передается в заголовке Authorization.
+func NewInflux(url, token string, opts ...Option) *Influx {
+	o := newOptions(opts)
+	return &Influx{
+		url:    url,
+		token:  token,
+		client: &http.Client{Timeout: o.timeout},
+		opts:   o,
+	}
+}
+
+// Export отправляет метрики пакетами по batchSize строк. Если запрос не удался из-за соединения
+// или ошибки сервера, неиспользуемые соединения закрываются и пакет отправляется еще раз по новому соединению.
+func (e *Influx) Export(ctx context.Context, metrics []models.Metric) error {
+	at := e.opts.now()
+	var buf []byte
+	for _, batch := range batches(metrics, e.opts.batchSize) {
+		buf = buf[:0]
+		for _, metric := range batch {
+			if Encodable(metric) {
+				buf = AppendInflux(buf, e.opts.prefix, metric, at)
+			}
+		}
+		if len(buf) == 0 {
+			continue
+		}
+
+		err := e.write(ctx, buf)
+		if err != nil && !errors.Is(err, ErrRejected) && ctx.Err() == nil {
+			e.client.CloseIdleConnections()
+			err = e.write(ctx, buf)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// write выполняет один запрос записи.
+func (e *Influx) write(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if e.token != "" {
+		req.Header.Set("Authorization", "Token "+e.token)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode >= 400 && resp.StatusCode < 500 &&
+		resp.StatusCode != http.StatusRequestTimeout && resp.StatusCode != http.StatusTooManyRequests:
+		return fmt.Errorf("%w: %s: %s", ErrRejected, resp.Status, bytes.TrimSpace(message))
+	default:
+		return fmt.Errorf("influx responded %s: %s", resp.Status, bytes.TrimSpace(message))
+	}
+}
+
+// Close закрывает неиспользуемые соединения.
+func (e *Influx) Close() error {
+	e.client.CloseIdleConnections()
+	return nil
+}
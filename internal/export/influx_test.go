@@ -0,0 +1,70 @@
+package export
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/invinciblewest/metrics/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInflux_Export(t *testing.T) {
+	var mu sync.Mutex
+	var bodies []string
+	var fail int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		assert.Equal(t, "/write", r.URL.Path)
+		assert.Equal(t, "metrics", r.URL.Query().Get("db"))
+		assert.Equal(t, "Token secret", r.Header.Get("Authorization"))
+		if fail > 0 {
+			fail--
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	exporter := NewInflux(server.URL+"/write?db=metrics", "secret", WithBatchSize(2))
+	exporter.opts.now = func() time.Time { return time.Unix(1700000000, 0) }
+	defer exporter.Close()
+
+	metrics := []models.Metric{gauge("Alloc", 1.5), gauge("Frees", 2), counter("PollCount", 3)}
+	require.NoError(t, exporter.Export(context.TODO(), metrics))
+	require.Len(t, bodies, 2)
+	assert.Equal(t, "Alloc,type=gauge value=1.5 1700000000000000000\nFrees,type=gauge value=2 1700000000000000000\n", bodies[0])
+	assert.Equal(t, "PollCount,type=counter value=3i 1700000000000000000\n", bodies[1])
+
+	// Ошибка сервера повторяется один раз по новому соединению.
+	fail = 1
+	require.NoError(t, exporter.Export(context.TODO(), metrics[:1]))
+	assert.Len(t, bodies, 3)
+
+	fail = 2
+	assert.Error(t, exporter.Export(context.TODO(), metrics[:1]))
+}
+
+func TestInflux_Rejected(t *testing.T) {
+	var calls int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		http.Error(w, "unable to parse points", http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	err := NewInflux(server.URL, "").Export(context.TODO(), []models.Metric{gauge("Alloc", 1)})
+	assert.ErrorIs(t, err, ErrRejected)
+	assert.True(t, strings.Contains(err.Error(), "unable to parse points"))
+	assert.Equal(t, 1, calls, "rejected write is not retried")
+}
@@ -0,0 +1,79 @@
+package export
+
+import (
+	"context"
+	"errors"
+	"iter"
+	"time"
+
+	"github.com/invinciblewest/metrics/internal/logger"
+	"github.com/invinciblewest/metrics/internal/models"
+	"github.com/invinciblewest/metrics/internal/storage"
+	"go.uber.org/zap"
+)
+
+// defaultPushInterval интервал выгрузки метрик по умолчанию.
+const defaultPushInterval = 10 * time.Second
+
+// Lister источник выгружаемых метрик, например хранилище сервера.
+type Lister interface {
+	List(ctx context.Context) iter.Seq2[models.Metric, error]
+}
+
+// Pusher периодически выгружает все метрики источника через экспортеры.
+type Pusher struct {
+	source    Lister
+	exporters []Exporter
+	interval  time.Duration
+}
+
+// NewPusher создает выгрузку метрик source через exporters каждые interval.
+// Нулевой interval оставляет интервал по умолчанию.
+func NewPusher(source Lister, interval time.Duration, exporters ...Exporter) *Pusher {
+	if interval <= 0 {
+		interval = defaultPushInterval
+	}
+	return &Pusher{
+		source:    source,
+		exporters: exporters,
+		interval:  interval,
+	}
+}
+
+// Run выгружает метрики каждые interval до отмены контекста, затем закрывает экспортеры.
+func (p *Pusher) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	defer func() {
+		for _, exporter := range p.exporters {
+			if err := exporter.Close(); err != nil {
+				logger.Log.Error("failed to close exporter", zap.Error(err))
+			}
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := p.Push(ctx); err != nil {
+				logger.Log.Error("failed to export metrics", zap.Error(err))
+			}
+		}
+	}
+}
+
+// Push выгружает текущий снимок метрик через все экспортеры. Ошибка одного экспортера
+// не мешает выгрузке через остальные.
+func (p *Pusher) Push(ctx context.Context) error {
+	metrics, err := storage.Collect(p.source.List(ctx))
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, exporter := range p.exporters {
+		errs = append(errs, exporter.Export(ctx, metrics))
+	}
+	return errors.Join(errs...)
+}
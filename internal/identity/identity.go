@@ -0,0 +1,17 @@
+// Package identity передает идентичность агента, установленную при аутентификации, через контекст запроса.
+package identity
+
+import "context"
+
+type contextKey struct{}
+
+// WithAgent возвращает контекст с идентичностью агента.
+func WithAgent(ctx context.Context, agent string) context.Context {
+	return context.WithValue(ctx, contextKey{}, agent)
+}
+
+// Agent возвращает идентичность агента из контекста, если она была установлена.
+func Agent(ctx context.Context) (string, bool) {
+	agent, ok := ctx.Value(contextKey{}).(string)
+	return agent, ok && agent != ""
+}
@@ -4,6 +4,8 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/invinciblewest/metrics/internal/identity"
+
 	"go.uber.org/zap"
 )
 
@@ -30,6 +32,11 @@ func (r *loggingResponseWriter) WriteHeader(statusCode int) {
 	r.responseData.status = statusCode
 }
 
+// Unwrap возвращает исходный http.ResponseWriter для http.ResponseController.
+func (r *loggingResponseWriter) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
 // Middleware возвращает middleware для логирования HTTP запросов.
 func Middleware() func(next http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
@@ -47,13 +54,17 @@ func Middleware() func(next http.Handler) http.Handler {
 
 			next.ServeHTTP(&lw, r)
 
-			Log.Info("got incoming HTTP request",
+			fields := []zap.Field{
 				zap.String("uri", r.RequestURI),
 				zap.String("method", r.Method),
 				zap.Int("status", responseData.status),
 				zap.Int("size", responseData.size),
 				zap.Duration("duration", time.Since(start)),
-			)
+			}
+			if agent, ok := identity.Agent(r.Context()); ok {
+				fields = append(fields, zap.String("agent", agent))
+			}
+			Log.Info("got incoming HTTP request", fields...)
 		})
 	}
 }
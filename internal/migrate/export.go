@@ -0,0 +1,70 @@
+package migrate
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+
+	"github.com/invinciblewest/metrics/internal/models"
+	"github.com/invinciblewest/metrics/internal/storage"
+)
+
+const (
+	FormatNDJSON = "ndjson" // FormatNDJSON формат экспорта, в котором каждая метрика записывается отдельной JSON-строкой.
+	FormatCSV    = "csv"    // FormatCSV формат экспорта в виде CSV с заголовком id,type,value.
+)
+
+// ErrUnknownFormat возвращается при неизвестном формате экспорта.
+var ErrUnknownFormat = errors.New("unknown export format")
+
+// Export записывает метрики хранилища, подходящие под шаблон, в w в заданном формате.
+func Export(ctx context.Context, st storage.Storage, w io.Writer, format, filter string) (int, error) {
+	if format != FormatNDJSON && format != FormatCSV {
+		return 0, ErrUnknownFormat
+	}
+
+	metrics, _, err := Collect(ctx, st, filter)
+	if err != nil {
+		return 0, err
+	}
+
+	switch format {
+	case FormatNDJSON:
+		enc := json.NewEncoder(w)
+		for _, metric := range metrics {
+			if err = enc.Encode(metric); err != nil {
+				return 0, err
+			}
+		}
+	case FormatCSV:
+		cw := csv.NewWriter(w)
+		if err = cw.Write([]string{"id", "type", "value"}); err != nil {
+			return 0, err
+		}
+		for _, metric := range metrics {
+			if err = cw.Write([]string{metric.ID, metric.MType, formatValue(metric)}); err != nil {
+				return 0, err
+			}
+		}
+		cw.Flush()
+		if err = cw.Error(); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(metrics), nil
+}
+
+// formatValue возвращает строковое представление значения метрики.
+func formatValue(metric models.Metric) string {
+	switch metric.MType {
+	case models.TypeGauge:
+		return strconv.FormatFloat(*metric.Value, 'f', -1, 64)
+	case models.TypeCounter:
+		return strconv.FormatInt(*metric.Delta, 10)
+	}
+	return ""
+}
@@ -0,0 +1,121 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"path"
+	"sort"
+
+	"github.com/invinciblewest/metrics/internal/models"
+	"github.com/invinciblewest/metrics/internal/storage"
+)
+
+// CounterMode определяет, как значения счетчиков источника переносятся в приемник.
+type CounterMode string
+
+const (
+	CounterAdd       CounterMode = "add"       // CounterAdd прибавляет значение счетчика источника к значению в приемнике.
+	CounterOverwrite CounterMode = "overwrite" // CounterOverwrite заменяет значение счетчика в приемнике значением из источника.
+)
+
+// ErrUnknownCounterMode возвращается при неизвестном режиме переноса счетчиков.
+var ErrUnknownCounterMode = errors.New("unknown counter mode")
+
+// Options содержит параметры переноса метрик.
+type Options struct {
+	Filter   string      // Filter шаблон имени метрики в формате path.Match, пустая строка означает все метрики.
+	Counters CounterMode // Counters режим переноса счетчиков.
+	DryRun   bool        // DryRun включает режим, при котором изменения не записываются в приемник.
+}
+
+// Result содержит статистику переноса метрик.
+type Result struct {
+	Gauges   int // Gauges количество перенесенных метрик типа Gauge.
+	Counters int // Counters количество перенесенных метрик типа Counter.
+	Skipped  int // Skipped количество метрик, не прошедших фильтр.
+}
+
+// Migrate переносит метрики из хранилища src в хранилище dst.
+func Migrate(ctx context.Context, src, dst storage.Storage, opts Options) (Result, error) {
+	var result Result
+
+	mode := opts.Counters
+	if mode == "" {
+		mode = CounterAdd
+	}
+	if mode != CounterAdd && mode != CounterOverwrite {
+		return result, ErrUnknownCounterMode
+	}
+
+	metrics, skipped, err := Collect(ctx, src, opts.Filter)
+	if err != nil {
+		return result, err
+	}
+	result.Skipped = skipped
+
+	batch := make([]models.Metric, 0, len(metrics))
+	for _, metric := range metrics {
+		switch metric.MType {
+		case models.TypeGauge:
+			value := *metric.Value
+			metric.Value = &value
+			result.Gauges++
+		case models.TypeCounter:
+			delta := *metric.Delta
+			if mode == CounterOverwrite {
+				var current models.Metric
+				current, err = dst.GetCounter(ctx, metric.ID)
+				if err != nil && !errors.Is(err, storage.ErrNotFound) {
+					return result, err
+				}
+				if err == nil {
+					delta -= *current.Delta
+				}
+			}
+			metric.Delta = &delta
+			result.Counters++
+		}
+		batch = append(batch, metric)
+	}
+
+	if opts.DryRun || len(batch) == 0 {
+		return result, nil
+	}
+
+	if err = dst.UpdateBatch(ctx, batch); err != nil {
+		return result, err
+	}
+	return result, dst.Save(ctx)
+}
+
+// Collect возвращает отсортированный по идентификатору список метрик хранилища, подходящих под шаблон,
+// и количество пропущенных метрик.
+func Collect(ctx context.Context, st storage.Storage, filter string) ([]models.Metric, int, error) {
+	if _, err := path.Match(filter, ""); err != nil {
+		return nil, 0, err
+	}
+
+	metrics := make([]models.Metric, 0)
+	skipped := 0
+	for metric, err := range st.List(ctx) {
+		if err != nil {
+			return nil, 0, err
+		}
+		if filter != "" {
+			if matched, _ := path.Match(filter, metric.ID); !matched {
+				skipped++
+				continue
+			}
+		}
+		metrics = append(metrics, metric)
+	}
+
+	sort.Slice(metrics, func(i, j int) bool {
+		if metrics[i].ID == metrics[j].ID {
+			return metrics[i].MType < metrics[j].MType
+		}
+		return metrics[i].ID < metrics[j].ID
+	})
+
+	return metrics, skipped, nil
+}
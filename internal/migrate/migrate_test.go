@@ -0,0 +1,136 @@
+package migrate
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/invinciblewest/metrics/internal/models"
+	"github.com/invinciblewest/metrics/internal/storage"
+	"github.com/invinciblewest/metrics/internal/storage/memstorage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrate(t *testing.T) {
+	ctx := context.TODO()
+
+	tests := []struct {
+		name          string
+		opts          Options
+		expectError   bool
+		expectResult  Result
+		expectCounter int64
+		expectGauges  int
+	}{
+		{
+			name:          "add counters",
+			opts:          Options{Counters: CounterAdd},
+			expectResult:  Result{Gauges: 2, Counters: 1},
+			expectCounter: 15,
+			expectGauges:  2,
+		},
+		{
+			name:          "overwrite counters",
+			opts:          Options{Counters: CounterOverwrite},
+			expectResult:  Result{Gauges: 2, Counters: 1},
+			expectCounter: 10,
+			expectGauges:  2,
+		},
+		{
+			name:          "filter",
+			opts:          Options{Filter: "CPU*"},
+			expectResult:  Result{Gauges: 1, Skipped: 2},
+			expectCounter: 5,
+			expectGauges:  1,
+		},
+		{
+			name:          "dry run",
+			opts:          Options{DryRun: true},
+			expectResult:  Result{Gauges: 2, Counters: 1},
+			expectCounter: 5,
+			expectGauges:  0,
+		},
+		{
+			name:        "unknown counter mode",
+			opts:        Options{Counters: "unknown"},
+			expectError: true,
+		},
+		{
+			name:        "bad filter",
+			opts:        Options{Filter: "["},
+			expectError: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			src := newSource(t)
+			dst := memstorage.NewMemStorage("", false)
+			delta := int64(5)
+			require.NoError(t, dst.UpdateCounter(ctx, models.Metric{ID: "PollCount", MType: models.TypeCounter, Delta: &delta}))
+
+			result, err := Migrate(ctx, src, dst, test.opts)
+			if test.expectError {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expectResult, result)
+
+			counter, err := dst.GetCounter(ctx, "PollCount")
+			require.NoError(t, err)
+			assert.Equal(t, test.expectCounter, *counter.Delta)
+			gauges, err := storage.Collect(dst.GetGaugeList(ctx))
+			require.NoError(t, err)
+			assert.Len(t, gauges, test.expectGauges)
+
+			srcCounter, err := src.GetCounter(ctx, "PollCount")
+			require.NoError(t, err)
+			assert.Equal(t, int64(10), *srcCounter.Delta)
+		})
+	}
+}
+
+func TestExport(t *testing.T) {
+	ctx := context.TODO()
+
+	t.Run("ndjson", func(t *testing.T) {
+		var buf bytes.Buffer
+		n, err := Export(ctx, newSource(t), &buf, FormatNDJSON, "")
+		require.NoError(t, err)
+		assert.Equal(t, 3, n)
+		assert.Equal(t, `{"id":"CPUutilization0","type":"gauge","value":12.5}
+{"id":"HeapAlloc","type":"gauge","value":1024}
+{"id":"PollCount","type":"counter","delta":10}
+`, buf.String())
+	})
+	t.Run("csv", func(t *testing.T) {
+		var buf bytes.Buffer
+		n, err := Export(ctx, newSource(t), &buf, FormatCSV, "Heap*")
+		require.NoError(t, err)
+		assert.Equal(t, 1, n)
+		assert.Equal(t, "id,type,value\nHeapAlloc,gauge,1024\n", buf.String())
+	})
+	t.Run("unknown format", func(t *testing.T) {
+		var buf bytes.Buffer
+		_, err := Export(ctx, newSource(t), &buf, "xml", "")
+		assert.ErrorIs(t, err, ErrUnknownFormat)
+	})
+}
+
+func newSource(t *testing.T) *memstorage.MemStorage {
+	ctx := context.TODO()
+	st := memstorage.NewMemStorage("", false)
+
+	cpu := 12.5
+	heap := 1024.0
+	delta := int64(10)
+	err := st.UpdateBatch(ctx, []models.Metric{
+		{ID: "CPUutilization0", MType: models.TypeGauge, Value: &cpu},
+		{ID: "HeapAlloc", MType: models.TypeGauge, Value: &heap},
+		{ID: "PollCount", MType: models.TypeCounter, Delta: &delta},
+	})
+	require.NoError(t, err)
+	return st
+}
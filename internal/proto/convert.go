@@ -0,0 +1,49 @@
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative metrics.proto
+
+package proto
+
+import (
+	"github.com/invinciblewest/metrics/internal/models"
+)
+
+// FromModel преобразует метрику модели в сообщение gRPC.
+func FromModel(metric models.Metric) *Metric {
+	return &Metric{
+		Id:    metric.ID,
+		Type:  TypeFromModel(metric.MType),
+		Delta: metric.Delta,
+		Value: metric.Value,
+	}
+}
+
+// ToModel преобразует сообщение gRPC в метрику модели.
+func ToModel(metric *Metric) models.Metric {
+	return models.Metric{
+		ID:    metric.GetId(),
+		MType: TypeToModel(metric.GetType()),
+		Delta: metric.Delta,
+		Value: metric.Value,
+	}
+}
+
+// TypeFromModel преобразует тип метрики модели в тип сообщения gRPC.
+func TypeFromModel(mType string) Metric_MType {
+	switch mType {
+	case models.TypeGauge:
+		return Metric_GAUGE
+	case models.TypeCounter:
+		return Metric_COUNTER
+	}
+	return Metric_UNSPECIFIED
+}
+
+// TypeToModel преобразует тип сообщения gRPC в тип метрики модели.
+func TypeToModel(mType Metric_MType) string {
+	switch mType {
+	case Metric_GAUGE:
+		return models.TypeGauge
+	case Metric_COUNTER:
+		return models.TypeCounter
+	}
+	return ""
+}
@@ -0,0 +1,77 @@
+package proto
+
+import (
+	"crypto/hmac"
+	"net/http"
+	"strconv"
+
+	"github.com/invinciblewest/metrics/internal/signature"
+	"google.golang.org/protobuf/proto"
+)
+
+// HashMetadataKey ключ метаданных, в котором передается HMAC-SHA256 унарных запросов и ответов.
+const HashMetadataKey = "hashsha256"
+
+// KeyIDMetadataKey ключ метаданных с идентификатором ключа HMAC, которым подписан вызов.
+const KeyIDMetadataKey = "x-hash-key-id"
+
+// TimestampMetadataKey ключ метаданных с временем подписи вызова в секундах Unix.
+const TimestampMetadataKey = "x-signature-timestamp"
+
+// NonceMetadataKey ключ метаданных с одноразовым случайным значением вызова.
+const NonceMetadataKey = "x-signature-nonce"
+
+// IdempotencyKeyMetadataKey ключ метаданных с ключом идемпотентности пакета UpdateBatch.
+const IdempotencyKeyMetadataKey = "idempotency-key"
+
+// Sign вычисляет HMAC-SHA256 детерминированного двоичного представления сообщения.
+func Sign(key string, m proto.Message) ([]byte, error) {
+	return SignCall(key, "", "", "", m)
+}
+
+// SignCall вычисляет HMAC-SHA256 сообщения вместе с полным именем метода, меткой времени и nonce вызова
+// так же, как signature.Sum для тела HTTP-запроса: вызов gRPC передается запросом POST на путь с именем метода.
+// Без метки времени и nonce подпись совпадает с Sign.
+func SignCall(key, method, timestamp, nonce string, m proto.Message) ([]byte, error) {
+	data, err := proto.MarshalOptions{Deterministic: true}.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	return signature.Sum(key, http.MethodPost, method, timestamp, nonce, data), nil
+}
+
+// SignBatch вычисляет подпись части пакета с порядковым номером seq и записывает ее в поле hash.
+// Подпись связана с методом, меткой времени и nonce потока и номером части, поэтому части нельзя переставить
+// или перенести в другой поток. Завершающее сообщение с полем parts подписывается так же, поэтому
+// количество частей нельзя подменить. Без метки времени и nonce часть подписывается только по содержимому,
+// как в предыдущих версиях агента.
+func SignBatch(key, method, timestamp, nonce string, seq int, req *UpdateBatchRequest) error {
+	req.Hash = nil
+	hash, err := SignCall(key, method, timestamp, batchNonce(timestamp, nonce, seq), req)
+	if err != nil {
+		return err
+	}
+	req.Hash = hash
+	return nil
+}
+
+// VerifyBatch проверяет подпись части пакета с порядковым номером seq из поля hash.
+func VerifyBatch(key, method, timestamp, nonce string, seq int, req *UpdateBatchRequest) (bool, error) {
+	received := req.GetHash()
+	unsigned := proto.Clone(req).(*UpdateBatchRequest)
+	unsigned.Hash = nil
+
+	expected, err := SignCall(key, method, timestamp, batchNonce(timestamp, nonce, seq), unsigned)
+	if err != nil {
+		return false, err
+	}
+	return hmac.Equal(expected, received), nil
+}
+
+// batchNonce возвращает подписываемое значение nonce части пакета: nonce потока и номер части.
+func batchNonce(timestamp, nonce string, seq int) string {
+	if timestamp == "" && nonce == "" {
+		return ""
+	}
+	return nonce + "/" + strconv.Itoa(seq)
+}
@@ -0,0 +1,83 @@
+// Package ratelimit реализует ограничение частоты запросов алгоритмом token bucket
+// с отдельной корзиной для каждого клиента.
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// sweepInterval период удаления корзин клиентов, которые давно не отправляли запросы.
+const sweepInterval = time.Minute
+
+// bucket корзина токенов одного клиента.
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Limiter ограничивает частоту запросов каждого клиента: корзина клиента вмещает burst токенов
+// и пополняется со скоростью rate токенов в секунду, каждый запрос расходует один токен.
+type Limiter struct {
+	mu        sync.Mutex
+	rate      float64
+	burst     float64
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// NewLimiter создает ограничитель с заданной частотой запросов в секунду и размером корзины.
+// Если burst меньше единицы, размер корзины равен частоте, округленной вверх.
+func NewLimiter(rate float64, burst int) *Limiter {
+	if burst < 1 {
+		burst = int(math.Max(1, math.Ceil(rate)))
+	}
+	return &Limiter{
+		rate:    rate,
+		burst:   float64(burst),
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+// Allow расходует токен клиента key. Если токенов нет, возвращает false и время,
+// через которое появится следующий токен.
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	}
+	b.tokens--
+	return true, 0
+}
+
+// sweep удаляет корзины, которые за время простоя успели бы заполниться полностью:
+// для таких клиентов новая корзина ничем не отличается от старой.
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < sweepInterval {
+		return
+	}
+	l.lastSweep = now
+
+	full := time.Duration(l.burst / l.rate * float64(time.Second))
+	for key, b := range l.buckets {
+		if now.Sub(b.last) >= full {
+			delete(l.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimiter_Allow(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	l := NewLimiter(2, 3)
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		ok, _ := l.Allow("agent")
+		assert.True(t, ok)
+	}
+	ok, retryAfter := l.Allow("agent")
+	assert.False(t, ok)
+	assert.Equal(t, 500*time.Millisecond, retryAfter)
+
+	ok, _ = l.Allow("other")
+	assert.True(t, ok)
+
+	now = now.Add(500 * time.Millisecond)
+	ok, _ = l.Allow("agent")
+	assert.True(t, ok)
+	ok, _ = l.Allow("agent")
+	assert.False(t, ok)
+}
+
+func TestLimiter_Sweep(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	l := NewLimiter(10, 0)
+	l.now = func() time.Time { return now }
+
+	l.Allow("agent")
+	now = now.Add(2 * sweepInterval)
+	l.Allow("other")
+	assert.Len(t, l.buckets, 1)
+	assert.Contains(t, l.buckets, "other")
+}
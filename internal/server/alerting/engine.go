@@ -0,0 +1,285 @@
+package alerting
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/invinciblewest/metrics/internal/logger"
+	"github.com/invinciblewest/metrics/internal/models"
+	"github.com/invinciblewest/metrics/internal/server/services"
+	"github.com/invinciblewest/metrics/internal/storage"
+	"go.uber.org/zap"
+)
+
+// defaultInterval интервал вычисления правил по умолчанию.
+const defaultInterval = 15 * time.Second
+
+// State состояние оповещения.
+type State string
+
+const (
+	StateInactive State = "inactive" // StateInactive условие правила не выполняется.
+	StatePending  State = "pending"  // StatePending условие выполняется меньше, чем For правила.
+	StateFiring   State = "firing"   // StateFiring оповещение сработало.
+	StateResolved State = "resolved" // StateResolved условие сработавшего оповещения перестало выполняться.
+)
+
+// Alert состояние оповещения одного правила.
+type Alert struct {
+	Rule        string     `json:"rule"`                  // Rule имя правила.
+	Metric      string     `json:"metric"`                // Metric имя метрики.
+	MType       string     `json:"type"`                  // MType тип метрики.
+	Description string     `json:"description"`           // Description условие правила.
+	State       State      `json:"state"`                 // State текущее состояние.
+	Value       *float64   `json:"value,omitempty"`       // Value значение метрики при последнем вычислении.
+	ActiveAt    *time.Time `json:"active_at,omitempty"`   // ActiveAt время, с которого выполняется условие.
+	FiredAt     *time.Time `json:"fired_at,omitempty"`    // FiredAt время срабатывания оповещения.
+	ResolvedAt  *time.Time `json:"resolved_at,omitempty"` // ResolvedAt время разрешения оповещения.
+}
+
+// Source источник метрик для вычисления правил.
+// Подписка на обновления нужна правилам отсутствия: хранилище не помнит время обновления метрик.
+type Source interface {
+	Get(ctx context.Context, mType, id string) (models.Metric, error)
+	Subscribe(filter services.SubscriptionFilter) (*services.Subscription, error)
+}
+
+// Option задает дополнительную настройку Engine.
+type Option func(*Engine)
+
+// WithSinks задает получателей уведомлений о срабатывании и разрешении оповещений.
+func WithSinks(sinks ...Sink) Option {
+	return func(e *Engine) {
+		e.sinks = append(e.sinks, sinks...)
+	}
+}
+
+// WithInterval задает интервал вычисления правил. Нулевое значение оставляет интервал по умолчанию.
+func WithInterval(d time.Duration) Option {
+	return func(e *Engine) {
+		if d > 0 {
+			e.interval = d
+		}
+	}
+}
+
+// Engine периодически вычисляет правила оповещений и отслеживает их состояние.
+type Engine struct {
+	source   Source
+	rules    []Rule
+	sinks    []Sink
+	interval time.Duration
+	now      func() time.Time
+
+	mu       sync.Mutex
+	alerts   []Alert
+	lastSeen map[seenKey]time.Time
+	started  time.Time
+}
+
+// seenKey идентифицирует метрику, время обновления которой отслеживается.
+type seenKey struct {
+	mType string
+	id    string
+}
+
+// NewEngine создает вычислитель правил rules по метрикам source.
+func NewEngine(source Source, rules []Rule, opts ...Option) *Engine {
+	e := &Engine{
+		source:   source,
+		rules:    rules,
+		interval: defaultInterval,
+		now:      time.Now,
+		alerts:   make([]Alert, len(rules)),
+		lastSeen: make(map[seenKey]time.Time),
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+	e.started = e.now()
+	for i, rule := range rules {
+		e.alerts[i] = Alert{
+			Rule:        rule.Name,
+			Metric:      rule.Metric,
+			MType:       rule.MType,
+			Description: rule.Description(),
+			State:       StateInactive,
+		}
+	}
+	return e
+}
+
+// Run вычисляет правила каждые interval и отслеживает обновления метрик правил отсутствия
+// до отмены контекста. Метрика, не обновлявшаяся с запуска, считается обновленной при запуске.
+func (e *Engine) Run(ctx context.Context) {
+	if ids := e.absentMetrics(); len(ids) > 0 {
+		filter := services.SubscriptionFilter{IDs: ids}
+		if sub, err := e.source.Subscribe(filter); err != nil {
+			logger.Log.Error("failed to subscribe to metric updates", zap.Error(err))
+		} else {
+			go e.watch(ctx, filter, sub)
+		}
+	}
+
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			e.Evaluate(ctx)
+		}
+	}
+}
+
+// Alerts возвращает текущее состояние оповещений всех правил в порядке их описания.
+func (e *Engine) Alerts() []Alert {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	alerts := make([]Alert, len(e.alerts))
+	copy(alerts, e.alerts)
+	return alerts
+}
+
+// Evaluate вычисляет все правила и отправляет уведомления об изменившихся оповещениях.
+// Ошибка чтения метрики оставляет состояние правила без изменений до следующего вычисления.
+func (e *Engine) Evaluate(ctx context.Context) {
+	var notifications []Alert
+	for i, rule := range e.rules {
+		holds, value, err := e.check(ctx, rule)
+		if err != nil {
+			logger.Log.Error("failed to evaluate alerting rule", zap.String("rule", rule.Name), zap.Error(err))
+			continue
+		}
+
+		e.mu.Lock()
+		if e.transition(&e.alerts[i], rule, holds, value) {
+			notifications = append(notifications, e.alerts[i])
+		}
+		e.mu.Unlock()
+	}
+
+	for _, alert := range notifications {
+		for _, sink := range e.sinks {
+			if err := sink.Notify(ctx, alert); err != nil {
+				logger.Log.Error("failed to send alert notification", zap.String("rule", alert.Rule), zap.Error(err))
+			}
+		}
+	}
+}
+
+// check вычисляет условие правила. Для порогового правила возвращает также значение метрики;
+// отсутствующая метрика не удовлетворяет пороговому условию.
+func (e *Engine) check(ctx context.Context, rule Rule) (bool, *float64, error) {
+	if rule.Absent > 0 {
+		e.mu.Lock()
+		seen, ok := e.lastSeen[seenKey{mType: rule.MType, id: rule.Metric}]
+		e.mu.Unlock()
+		if !ok {
+			seen = e.started
+		}
+		return e.now().Sub(seen) >= rule.Absent, nil, nil
+	}
+
+	metric, err := e.source.Get(ctx, rule.MType, rule.Metric)
+	if errors.Is(err, storage.ErrNotFound) {
+		return false, nil, nil
+	}
+	if err != nil {
+		return false, nil, err
+	}
+	var value float64
+	if metric.MType == models.TypeCounter {
+		value = float64(*metric.Delta)
+	} else {
+		value = *metric.Value
+	}
+	return rule.holds(value), &value, nil
+}
+
+// transition переводит оповещение в новое состояние по результату вычисления условия
+// и сообщает, нужно ли отправить уведомление: при срабатывании и при разрешении.
+func (e *Engine) transition(alert *Alert, rule Rule, holds bool, value *float64) bool {
+	now := e.now()
+	alert.Value = value
+
+	if !holds {
+		switch alert.State {
+		case StateFiring:
+			alert.State = StateResolved
+			alert.ActiveAt = nil
+			alert.ResolvedAt = &now
+			return true
+		case StatePending:
+			alert.State = StateInactive
+			alert.ActiveAt = nil
+		}
+		return false
+	}
+
+	switch alert.State {
+	case StateInactive, StateResolved:
+		alert.State = StatePending
+		alert.ActiveAt = &now
+		alert.FiredAt = nil
+		alert.ResolvedAt = nil
+	case StateFiring:
+		return false
+	}
+	if now.Sub(*alert.ActiveAt) < rule.For {
+		return false
+	}
+	alert.State = StateFiring
+	alert.FiredAt = &now
+	return true
+}
+
+// absentMetrics возвращает имена метрик правил отсутствия.
+func (e *Engine) absentMetrics() []string {
+	var ids []string
+	for _, rule := range e.rules {
+		if rule.Absent > 0 {
+			ids = append(ids, rule.Metric)
+		}
+	}
+	return ids
+}
+
+// watch запоминает время обновления метрик из подписки sub. Если подписка отключена из-за переполнения
+// буфера, она оформляется заново: пропущенные обновления могут задержать разрешение правила отсутствия
+// не более чем до следующего обновления метрики.
+func (e *Engine) watch(ctx context.Context, filter services.SubscriptionFilter, sub *services.Subscription) {
+	for {
+		e.follow(ctx, sub)
+		sub.Close()
+		if ctx.Err() != nil || !errors.Is(sub.Err(), services.ErrSlowConsumer) {
+			return
+		}
+		logger.Log.Warn("alerting subscription dropped, resubscribing")
+
+		var err error
+		if sub, err = e.source.Subscribe(filter); err != nil {
+			logger.Log.Error("failed to subscribe to metric updates", zap.Error(err))
+			return
+		}
+	}
+}
+
+// follow запоминает время обновлений из подписки до ее окончания или отмены контекста.
+func (e *Engine) follow(ctx context.Context, sub *services.Subscription) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-sub.Done():
+			return
+		case metric := <-sub.Updates():
+			e.mu.Lock()
+			e.lastSeen[seenKey{mType: metric.MType, id: metric.ID}] = e.now()
+			e.mu.Unlock()
+		}
+	}
+}
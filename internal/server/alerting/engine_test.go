@@ -0,0 +1,172 @@
+package alerting
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/invinciblewest/metrics/internal/models"
+	"github.com/invinciblewest/metrics/internal/server/services"
+	"github.com/invinciblewest/metrics/internal/storage/memstorage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingSink запоминает полученные уведомления.
+type recordingSink struct {
+	mu     sync.Mutex
+	alerts []Alert
+}
+
+func (s *recordingSink) Notify(_ context.Context, alert Alert) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.alerts = append(s.alerts, alert)
+	return nil
+}
+
+func (s *recordingSink) states() []State {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	states := make([]State, 0, len(s.alerts))
+	for _, alert := range s.alerts {
+		states = append(states, alert.State)
+	}
+	return states
+}
+
+// clock управляемое время для вычисления правил.
+type clock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func TestEngine_Threshold(t *testing.T) {
+	ctx := context.TODO()
+	service := services.NewMetricsService(memstorage.NewMemStorage("", false))
+	setFree := func(value float64) {
+		_, err := service.Update(ctx, models.Metric{ID: "FreeMemory", MType: models.TypeGauge, Value: &value})
+		require.NoError(t, err)
+	}
+
+	sink := &recordingSink{}
+	rules := []Rule{{Name: "low-memory", Metric: "FreeMemory", MType: models.TypeGauge, Op: OpLess, Threshold: 500e6, For: 2 * time.Minute}}
+	engine := NewEngine(&service, rules, WithSinks(sink))
+	c := &clock{now: time.Now()}
+	engine.now = c.Now
+
+	engine.Evaluate(ctx)
+	assert.Equal(t, StateInactive, engine.Alerts()[0].State, "missing metric does not satisfy the threshold")
+
+	setFree(100e6)
+	engine.Evaluate(ctx)
+	alert := engine.Alerts()[0]
+	assert.Equal(t, StatePending, alert.State)
+	require.NotNil(t, alert.Value)
+	assert.Equal(t, 100e6, *alert.Value)
+
+	c.Advance(time.Minute)
+	engine.Evaluate(ctx)
+	assert.Equal(t, StatePending, engine.Alerts()[0].State)
+	assert.Empty(t, sink.states())
+
+	c.Advance(time.Minute)
+	engine.Evaluate(ctx)
+	alert = engine.Alerts()[0]
+	assert.Equal(t, StateFiring, alert.State)
+	assert.NotNil(t, alert.FiredAt)
+	assert.Equal(t, []State{StateFiring}, sink.states())
+
+	c.Advance(time.Minute)
+	engine.Evaluate(ctx)
+	assert.Equal(t, []State{StateFiring}, sink.states(), "firing alert is notified once")
+
+	setFree(1e9)
+	engine.Evaluate(ctx)
+	alert = engine.Alerts()[0]
+	assert.Equal(t, StateResolved, alert.State)
+	assert.NotNil(t, alert.ResolvedAt)
+	assert.Equal(t, []State{StateFiring, StateResolved}, sink.states())
+
+	setFree(100e6)
+	engine.Evaluate(ctx)
+	setFree(1e9)
+	engine.Evaluate(ctx)
+	assert.Equal(t, StateInactive, engine.Alerts()[0].State, "pending alert clears without notification")
+	assert.Len(t, sink.states(), 2)
+}
+
+func TestEngine_Absent(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	service := services.NewMetricsService(memstorage.NewMemStorage("", false))
+	poll := func() {
+		delta := int64(1)
+		_, err := service.Update(ctx, models.Metric{ID: "PollCount", MType: models.TypeCounter, Delta: &delta})
+		require.NoError(t, err)
+	}
+
+	sink := &recordingSink{}
+	rules := []Rule{{Name: "agent-silent", Metric: "PollCount", MType: models.TypeCounter, Absent: time.Minute}}
+	engine := NewEngine(&service, rules, WithSinks(sink), WithInterval(time.Hour))
+	c := &clock{now: time.Now()}
+	engine.now = c.Now
+	engine.started = c.Now()
+	go engine.Run(ctx)
+
+	c.Advance(30 * time.Second)
+	engine.Evaluate(ctx)
+	assert.Equal(t, StateInactive, engine.Alerts()[0].State)
+
+	c.Advance(30 * time.Second)
+	engine.Evaluate(ctx)
+	assert.Equal(t, StateFiring, engine.Alerts()[0].State, "metric not updated since start")
+
+	require.Eventually(t, func() bool {
+		poll()
+		engine.Evaluate(ctx)
+		return engine.Alerts()[0].State == StateResolved
+	}, time.Second, 10*time.Millisecond)
+
+	c.Advance(time.Minute)
+	engine.Evaluate(ctx)
+	assert.Equal(t, StateFiring, engine.Alerts()[0].State)
+	assert.Equal(t, []State{StateFiring, StateResolved, StateFiring}, sink.states())
+}
+
+func TestWebhookSink(t *testing.T) {
+	var received Alert
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+		if received.Rule == "broken" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer srv.Close()
+
+	sink := NewWebhookSink(srv.URL, nil)
+	value := 1.5
+	alert := Alert{Rule: "low-memory", Metric: "FreeMemory", MType: models.TypeGauge, State: StateFiring, Value: &value}
+	require.NoError(t, sink.Notify(context.TODO(), alert))
+	assert.Equal(t, alert, received)
+
+	assert.Error(t, sink.Notify(context.TODO(), Alert{Rule: "broken"}))
+	assert.NoError(t, NewLogSink().Notify(context.TODO(), alert))
+}
@@ -0,0 +1,209 @@
+// Package alerting вычисляет правила оповещений по метрикам сервера и отправляет уведомления
+// о срабатывании и разрешении оповещений.
+package alerting
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/invinciblewest/metrics/internal/models"
+)
+
+// ErrInvalidRule возвращается для правила с некорректным описанием.
+var ErrInvalidRule = errors.New("invalid alerting rule")
+
+// Операторы сравнения пороговых правил.
+const (
+	OpLess         = "<"
+	OpLessEqual    = "<="
+	OpGreater      = ">"
+	OpGreaterEqual = ">="
+	OpEqual        = "=="
+	OpNotEqual     = "!="
+)
+
+// Rule правило оповещения. Пороговое правило срабатывает, когда значение метрики удовлетворяет
+// условию Op Threshold; правило отсутствия — когда метрика не обновлялась дольше Absent.
+// Условие должно выполняться непрерывно в течение For, прежде чем оповещение сработает.
+type Rule struct {
+	Name      string        // Name уникальное имя правила.
+	Metric    string        // Metric имя метрики.
+	MType     string        // MType тип метрики: gauge или counter.
+	Op        string        // Op оператор сравнения порогового правила.
+	Threshold float64       // Threshold порог порогового правила.
+	Absent    time.Duration // Absent время без обновлений, после которого срабатывает правило отсутствия.
+	For       time.Duration // For время, в течение которого условие должно выполняться до срабатывания.
+}
+
+// Description возвращает условие правила в читаемом виде.
+func (r Rule) Description() string {
+	if r.Absent > 0 {
+		return fmt.Sprintf("no update to %s %s for %s", r.MType, r.Metric, r.Absent)
+	}
+	return fmt.Sprintf("%s %s %s %s", r.MType, r.Metric, r.Op, strconv.FormatFloat(r.Threshold, 'g', -1, 64))
+}
+
+// holds сообщает, выполняется ли пороговое условие правила для значения value.
+func (r Rule) holds(value float64) bool {
+	switch r.Op {
+	case OpLess:
+		return value < r.Threshold
+	case OpLessEqual:
+		return value <= r.Threshold
+	case OpGreater:
+		return value > r.Threshold
+	case OpGreaterEqual:
+		return value >= r.Threshold
+	case OpEqual:
+		return value == r.Threshold
+	case OpNotEqual:
+		return value != r.Threshold
+	}
+	return false
+}
+
+// validate проверяет, что правило описано полностью и однозначно.
+func (r Rule) validate() error {
+	if r.Name == "" || r.Metric == "" {
+		return fmt.Errorf("%w: name and metric are required", ErrInvalidRule)
+	}
+	if r.MType != models.TypeGauge && r.MType != models.TypeCounter {
+		return fmt.Errorf("%w %q: unknown metric type %q", ErrInvalidRule, r.Name, r.MType)
+	}
+	if r.For < 0 || r.Absent < 0 {
+		return fmt.Errorf("%w %q: negative duration", ErrInvalidRule, r.Name)
+	}
+	if (r.Op == "") == (r.Absent == 0) {
+		return fmt.Errorf("%w %q: exactly one of op and absent must be set", ErrInvalidRule, r.Name)
+	}
+	if r.Op != "" && !r.knownOp() {
+		return fmt.Errorf("%w %q: unknown operator %q", ErrInvalidRule, r.Name, r.Op)
+	}
+	return nil
+}
+
+// knownOp сообщает, поддерживается ли оператор правила.
+func (r Rule) knownOp() bool {
+	switch r.Op {
+	case OpLess, OpLessEqual, OpGreater, OpGreaterEqual, OpEqual, OpNotEqual:
+		return true
+	}
+	return false
+}
+
+// rulesFile структура файла правил.
+type rulesFile struct {
+	Rules []ruleJSON `json:"rules"`
+}
+
+// ruleJSON описание правила в файле. Длительности задаются в формате time.ParseDuration,
+// порог — числом или строкой с единицей измерения, например "500MB".
+type ruleJSON struct {
+	Name      string          `json:"name"`
+	Metric    string          `json:"metric"`
+	MType     string          `json:"type"`
+	Op        string          `json:"op"`
+	Threshold json.RawMessage `json:"threshold"`
+	Absent    string          `json:"absent"`
+	For       string          `json:"for"`
+}
+
+// LoadRules читает правила оповещений из JSON-файла вида {"rules": [...]}.
+func LoadRules(path string) ([]Rule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseRules(data)
+}
+
+// ParseRules разбирает правила оповещений в формате файла правил.
+func ParseRules(data []byte) ([]Rule, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	var file rulesFile
+	if err := dec.Decode(&file); err != nil {
+		return nil, err
+	}
+
+	rules := make([]Rule, 0, len(file.Rules))
+	names := make(map[string]struct{}, len(file.Rules))
+	for _, raw := range file.Rules {
+		rule, err := raw.rule()
+		if err != nil {
+			return nil, err
+		}
+		if err = rule.validate(); err != nil {
+			return nil, err
+		}
+		if _, ok := names[rule.Name]; ok {
+			return nil, fmt.Errorf("%w %q: duplicate name", ErrInvalidRule, rule.Name)
+		}
+		names[rule.Name] = struct{}{}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// rule преобразует описание из файла в правило.
+func (r ruleJSON) rule() (Rule, error) {
+	rule := Rule{Name: r.Name, Metric: r.Metric, MType: r.MType, Op: r.Op}
+	var err error
+	if len(r.Threshold) > 0 {
+		if rule.Threshold, err = parseThreshold(r.Threshold); err != nil {
+			return Rule{}, fmt.Errorf("%w %q: threshold: %v", ErrInvalidRule, r.Name, err)
+		}
+	}
+	if r.Absent != "" {
+		if rule.Absent, err = time.ParseDuration(r.Absent); err != nil {
+			return Rule{}, fmt.Errorf("%w %q: absent: %v", ErrInvalidRule, r.Name, err)
+		}
+	}
+	if r.For != "" {
+		if rule.For, err = time.ParseDuration(r.For); err != nil {
+			return Rule{}, fmt.Errorf("%w %q: for: %v", ErrInvalidRule, r.Name, err)
+		}
+	}
+	return rule, nil
+}
+
+// units множители единиц измерения порога: десятичные (KB, MB, GB, TB) и двоичные (KiB, MiB, GiB, TiB).
+var units = []struct {
+	suffix     string
+	multiplier float64
+}{
+	{"KiB", 1 << 10}, {"MiB", 1 << 20}, {"GiB", 1 << 30}, {"TiB", 1 << 40},
+	{"KB", 1e3}, {"MB", 1e6}, {"GB", 1e9}, {"TB", 1e12},
+}
+
+// parseThreshold разбирает порог: число JSON или строку с числом и необязательной единицей измерения.
+func parseThreshold(raw json.RawMessage) (float64, error) {
+	var value float64
+	if err := json.Unmarshal(raw, &value); err == nil {
+		return value, nil
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return 0, err
+	}
+	s = strings.TrimSpace(s)
+	multiplier := 1.0
+	for _, unit := range units {
+		if strings.HasSuffix(s, unit.suffix) {
+			s = strings.TrimSpace(strings.TrimSuffix(s, unit.suffix))
+			multiplier = unit.multiplier
+			break
+		}
+	}
+	value, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, err
+	}
+	return value * multiplier, nil
+}
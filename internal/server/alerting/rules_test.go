@@ -0,0 +1,102 @@
+package alerting
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRules(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		expected []Rule
+		wantErr  bool
+	}{
+		{
+			name: "threshold and absence",
+			data: `{"rules":[
+				{"name":"low-memory","metric":"FreeMemory","type":"gauge","op":"<","threshold":"500MB","for":"2m"},
+				{"name":"agent-silent","metric":"PollCount","type":"counter","absent":"1m"}
+			]}`,
+			expected: []Rule{
+				{Name: "low-memory", Metric: "FreeMemory", MType: "gauge", Op: OpLess, Threshold: 500e6, For: 2 * time.Minute},
+				{Name: "agent-silent", Metric: "PollCount", MType: "counter", Absent: time.Minute},
+			},
+		},
+		{
+			name: "numeric and binary thresholds",
+			data: `{"rules":[
+				{"name":"a","metric":"CPUutilization1","type":"gauge","op":">=","threshold":90.5},
+				{"name":"b","metric":"TotalMemory","type":"gauge","op":"!=","threshold":"2 GiB"}
+			]}`,
+			expected: []Rule{
+				{Name: "a", Metric: "CPUutilization1", MType: "gauge", Op: OpGreaterEqual, Threshold: 90.5},
+				{Name: "b", Metric: "TotalMemory", MType: "gauge", Op: OpNotEqual, Threshold: 2 << 30},
+			},
+		},
+		{
+			name:    "unknown operator",
+			data:    `{"rules":[{"name":"a","metric":"m","type":"gauge","op":"~","threshold":1}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "both conditions",
+			data:    `{"rules":[{"name":"a","metric":"m","type":"gauge","op":"<","threshold":1,"absent":"1m"}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "no condition",
+			data:    `{"rules":[{"name":"a","metric":"m","type":"gauge"}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "unknown type",
+			data:    `{"rules":[{"name":"a","metric":"m","type":"histogram","absent":"1m"}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "duplicate name",
+			data:    `{"rules":[{"name":"a","metric":"m","type":"gauge","absent":"1m"},{"name":"a","metric":"n","type":"gauge","absent":"1m"}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "bad threshold",
+			data:    `{"rules":[{"name":"a","metric":"m","type":"gauge","op":"<","threshold":"lots"}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "unknown field",
+			data:    `{"rules":[{"name":"a","metric":"m","type":"gauge","absent":"1m","severity":"page"}]}`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, err := ParseRules([]byte(tt.data))
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, rules)
+		})
+	}
+}
+
+func TestLoadRules(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"rules":[{"name":"a","metric":"m","type":"gauge","op":"<","threshold":1}]}`), 0600))
+
+	rules, err := LoadRules(path)
+	require.NoError(t, err)
+	require.Len(t, rules, 1)
+	assert.Equal(t, "gauge m < 1", rules[0].Description())
+
+	_, err = LoadRules(filepath.Join(t.TempDir(), "missing.json"))
+	assert.Error(t, err)
+}
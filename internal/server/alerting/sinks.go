@@ -0,0 +1,88 @@
+package alerting
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/invinciblewest/metrics/internal/logger"
+	"go.uber.org/zap"
+)
+
+// defaultWebhookTimeout время ожидания ответа получателя уведомлений по умолчанию.
+const defaultWebhookTimeout = 10 * time.Second
+
+// Sink получатель уведомлений об оповещениях. Notify вызывается при срабатывании оповещения
+// (состояние firing) и при его разрешении (состояние resolved).
+type Sink interface {
+	Notify(ctx context.Context, alert Alert) error
+}
+
+// LogSink записывает уведомления в журнал сервера.
+type LogSink struct{}
+
+// NewLogSink создает получателя, записывающего уведомления в журнал.
+func NewLogSink() LogSink {
+	return LogSink{}
+}
+
+// Notify записывает уведомление в журнал: срабатывание с уровнем warn, разрешение с уровнем info.
+func (LogSink) Notify(_ context.Context, alert Alert) error {
+	fields := []zap.Field{
+		zap.String("rule", alert.Rule),
+		zap.String("condition", alert.Description),
+	}
+	if alert.Value != nil {
+		fields = append(fields, zap.Float64("value", *alert.Value))
+	}
+	if alert.State == StateFiring {
+		logger.Log.Warn("alert firing", fields...)
+	} else {
+		logger.Log.Info("alert resolved", fields...)
+	}
+	return nil
+}
+
+// WebhookSink отправляет уведомления POST-запросом с оповещением в формате JSON.
+type WebhookSink struct {
+	url    string
+	client *http.Client
+}
+
+// NewWebhookSink создает получателя, отправляющего уведомления на url.
+// Если client равен nil, используется клиент с ограничением времени ответа.
+func NewWebhookSink(url string, client *http.Client) *WebhookSink {
+	if client == nil {
+		client = &http.Client{Timeout: defaultWebhookTimeout}
+	}
+	return &WebhookSink{
+		url:    url,
+		client: client,
+	}
+}
+
+// Notify отправляет оповещение. Ответ с кодом вне диапазона 2xx считается ошибкой.
+func (s *WebhookSink) Notify(ctx context.Context, alert Alert) error {
+	body, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"flag"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/caarlos0/env/v6"
@@ -11,30 +12,107 @@ import (
 
 // Config содержит конфигурацию сервера
 type Config struct {
-	Address         string `env:"ADDRESS"`           // Адрес сервера, на котором будет запущен сервер.
-	LogLevel        string `env:"LOG_LEVEL"`         // Уровень логирования, например, "info", "debug", "error".
-	StoreInterval   int    `env:"STORE_INTERVAL"`    // Интервал сохранения метрик в хранилище в секундах.
-	FileStoragePath string `env:"FILE_STORAGE_PATH"` // Путь к файлу, в котором будет храниться информация о метриках.
-	Restore         bool   `env:"RESTORE"`           // Флаг, указывающий, нужно ли восстанавливать метрики из файла при запуске сервера.
-	DatabaseDSN     string `env:"DATABASE_DSN"`      // DSN (Data Source Name) для подключения к базе данных, если используется.
-	HashKey         string `env:"KEY"`               // Ключ для хеширования метрик и проверки их целостности.
-	CryptoKey       string `env:"CRYPTO_KEY"`        // Приватный ключ для проверки метрик от агента.
+	Address         string   `env:"ADDRESS"`                          // Адрес сервера, на котором будет запущен сервер.
+	LogLevel        string   `env:"LOG_LEVEL"`                        // Уровень логирования, например, "info", "debug", "error".
+	StoreInterval   int      `env:"STORE_INTERVAL"`                   // Интервал сохранения метрик в хранилище в секундах.
+	FileStoragePath string   `env:"FILE_STORAGE_PATH"`                // Путь к файлу, в котором будет храниться информация о метриках.
+	Restore         bool     `env:"RESTORE"`                          // Флаг, указывающий, нужно ли восстанавливать метрики из файла при запуске сервера.
+	DatabaseDSN     string   `env:"DATABASE_DSN"`                     // DSN (Data Source Name) для подключения к базе данных, если используется.
+	DatabaseShards  []string `env:"DATABASE_SHARDS" envSeparator:","` // Список DSN баз данных, между которыми распределяются метрики.
+	HashKey         string   `env:"KEY"`                              // Ключ для хеширования метрик и проверки их целостности.
+	HashKeysFile    string   `env:"KEY_FILE"`                         // Путь к файлу с дополнительными активными ключами HMAC, по одному на строку; перечитывается по SIGHUP.
+	HashStrict      bool     `env:"HASH_STRICT"`                      // Флаг строгого режима: метрики без подписи, метки времени и nonce отклоняются.
+	HashWindow      int      `env:"HASH_WINDOW"`                      // Допустимое отклонение метки времени подписанного запроса в секундах.
+	CryptoKey       string   `env:"CRYPTO_KEY"`                       // Приватный ключ для проверки метрик от агента.
+	CryptoKeys      []string `env:"CRYPTO_KEYS" envSeparator:","`     // Дополнительные приватные ключи, которые принимаются во время ротации; перечитываются по SIGHUP.
+	SignatureKeys   []string `env:"SIGNATURE_KEYS" envSeparator:","`  // Публичные ключи Ed25519 или ECDSA агентов для проверки подписей запросов; перечитываются по SIGHUP.
+	AdminToken      string   `env:"ADMIN_TOKEN"`                      // Токен доступа к административным маршрутам, пустое значение отключает их.
+	GRPCAddress     string   `env:"GRPC_ADDRESS"`                     // Адрес gRPC-сервера, пустое значение отключает его.
+	TrustedSubnet   string   `env:"TRUSTED_SUBNET"`                   // Подсеть в нотации CIDR, из которой принимаются метрики, пустое значение снимает ограничение.
+	ReadSubnet      string   `env:"READ_TRUSTED_SUBNET"`              // Подсеть в нотации CIDR, из которой разрешено чтение метрик и /ping, пустое значение снимает ограничение.
+	TLSCert         string   `env:"TLS_CERT"`                         // Путь к сертификату сервера в формате PEM, если задан вместе с ключом, сервер принимает только TLS.
+	TLSKey          string   `env:"TLS_KEY"`                          // Путь к приватному ключу сертификата сервера в формате PEM.
+	TLSClientCA     string   `env:"TLS_CLIENT_CA"`                    // Путь к сертификату центра, которым подписаны сертификаты агентов; включает mTLS.
+	Tokens          string   `env:"TOKENS"`                           // Хранилище токенов агентов: путь к JSON-файлу или DSN PostgreSQL; пустое значение отключает проверку токенов.
+	RateLimit       float64  `env:"RATE_LIMIT"`                       // Допустимое количество запросов в секунду от одного агента или адреса, 0 снимает ограничение.
+	RateBurst       int      `env:"RATE_BURST"`                       // Количество запросов, которые клиент может отправить подряд сверх RateLimit; 0 означает значение RateLimit.
+	MaxBodySize     int64    `env:"MAX_BODY_SIZE"`                    // Максимальный размер тела запроса в байтах, в том числе после распаковки; 0 снимает ограничение.
+	MaxBatchSize    int      `env:"MAX_BATCH_SIZE"`                   // Максимальное количество метрик в одном пакете, 0 снимает ограничение.
+	MaxMetrics      int      `env:"MAX_METRICS"`                      // Максимальное количество различных метрик в хранилище, 0 снимает ограничение.
+	DedupWindow     int      `env:"IDEMPOTENCY_WINDOW"`               // Время в секундах, в течение которого помнятся ключи идемпотентности пакетов; 0 отключает проверку ключей.
+	SubBuffer       int      `env:"SUBSCRIPTION_BUFFER"`              // Количество непрочитанных обновлений, после которого подписчик /subscribe отключается.
+	Heartbeat       int      `env:"SUBSCRIPTION_HEARTBEAT"`           // Интервал в секундах между сообщениями, поддерживающими соединение подписчика.
+	AlertRules      string   `env:"ALERT_RULES"`                      // Путь к JSON-файлу правил оповещений, пустое значение отключает оповещения.
+	AlertWebhook    string   `env:"ALERT_WEBHOOK"`                    // URL, на который отправляются уведомления об оповещениях, в дополнение к журналу.
+	AlertInterval   int      `env:"ALERT_INTERVAL"`                   // Интервал вычисления правил оповещений в секундах.
+	RecordRules     string   `env:"RECORDING_RULES"`                  // Путь к JSON-файлу правил записи производных метрик, пустое значение отключает их.
+	RecordInterval  int      `env:"RECORDING_INTERVAL"`               // Интервал вычисления правил записи в секундах.
+	RateSamples     int      `env:"RATE_SAMPLES"`                     // Количество последних значений каждого счетчика, запоминаемых для вычисления скорости /rate.
+	RateRetention   int      `env:"RATE_RETENTION"`                   // Время в секундах, в течение которого значение счетчика участвует в вычислении скорости.
+	ForwardTargets  string   `env:"FORWARD_DESTINATIONS"`             // Путь к JSON-файлу адресатов пересылки принятых метрик, пустое значение отключает пересылку.
+	ForwardSpool    string   `env:"FORWARD_SPOOL"`                    // Каталог очереди пакетов, которые не удалось переслать; пустое значение отключает очередь на диске.
+	InfluxURL       string   `env:"INFLUX_URL"`                       // Адрес записи InfluxDB, если задан, все метрики периодически выгружаются в InfluxDB.
+	InfluxToken     string   `env:"INFLUX_TOKEN"`                     // Токен InfluxDB, передаваемый в заголовке Authorization.
+	GraphiteAddr    string   `env:"GRAPHITE_ADDRESS"`                 // Адрес приема метрик Graphite, если задан, все метрики периодически выгружаются в Graphite.
+	ExportPrefix    string   `env:"EXPORT_PREFIX"`                    // Префикс имен метрик, выгружаемых в InfluxDB и Graphite.
+	ExportInterval  int      `env:"EXPORT_INTERVAL"`                  // Интервал выгрузки метрик в InfluxDB и Graphite в секундах.
+	RemoteWrite     bool     `env:"REMOTE_WRITE"`                     // Флаг приема запросов Prometheus remote_write на /api/v1/write; в строгом режиме подписи требуется токен агента или подпись.
 }
 
 // JSONConfig представляет структуру JSON файла конфигурации сервера
 type JSONConfig struct {
-	Address       string `json:"address"`
-	Restore       *bool  `json:"restore"`
-	StoreInterval string `json:"store_interval"`
-	StoreFile     string `json:"store_file"`
-	DatabaseDSN   string `json:"database_dsn"`
-	CryptoKey     string `json:"crypto_key"`
+	Address        string   `json:"address"`
+	Restore        *bool    `json:"restore"`
+	StoreInterval  string   `json:"store_interval"`
+	StoreFile      string   `json:"store_file"`
+	DatabaseDSN    string   `json:"database_dsn"`
+	DatabaseShards []string `json:"database_shards"`
+	CryptoKey      string   `json:"crypto_key"`
+	CryptoKeys     []string `json:"crypto_keys"`
+	HashKeysFile   string   `json:"key_file"`
+	SignatureKeys  []string `json:"signature_keys"`
+	AdminToken     string   `json:"admin_token"`
+	GRPCAddress    string   `json:"grpc_address"`
+	HashStrict     *bool    `json:"hash_strict"`
+	HashWindow     string   `json:"hash_window"`
+	TrustedSubnet  string   `json:"trusted_subnet"`
+	ReadSubnet     string   `json:"read_trusted_subnet"`
+	TLSCert        string   `json:"tls_cert"`
+	TLSKey         string   `json:"tls_key"`
+	TLSClientCA    string   `json:"tls_client_ca"`
+	Tokens         string   `json:"tokens"`
+	RateLimit      float64  `json:"rate_limit"`
+	RateBurst      int      `json:"rate_burst"`
+	MaxBodySize    int64    `json:"max_body_size"`
+	MaxBatchSize   int      `json:"max_batch_size"`
+	MaxMetrics     int      `json:"max_metrics"`
+	DedupWindow    string   `json:"idempotency_window"`
+	SubBuffer      int      `json:"subscription_buffer"`
+	Heartbeat      string   `json:"subscription_heartbeat"`
+	AlertRules     string   `json:"alert_rules"`
+	AlertWebhook   string   `json:"alert_webhook"`
+	AlertInterval  string   `json:"alert_interval"`
+	RecordRules    string   `json:"recording_rules"`
+	RecordInterval string   `json:"recording_interval"`
+	RateSamples    int      `json:"rate_samples"`
+	RateRetention  string   `json:"rate_retention"`
+	ForwardTargets string   `json:"forward_destinations"`
+	ForwardSpool   string   `json:"forward_spool"`
+	InfluxURL      string   `json:"influx_url"`
+	InfluxToken    string   `json:"influx_token"`
+	GraphiteAddr   string   `json:"graphite_address"`
+	ExportPrefix   string   `json:"export_prefix"`
+	ExportInterval string   `json:"export_interval"`
+	RemoteWrite    *bool    `json:"remote_write"`
 }
 
 // GetConfig считывает конфигурацию сервера из флагов командной строки и переменных окружения.
 func GetConfig() (Config, error) {
 	var config Config
 	var configFile string
+	var databaseShards string
+	var cryptoKeys string
+	var signatureKeys string
 
 	config = Config{
 		Address:         "localhost:8080",
@@ -44,7 +122,17 @@ func GetConfig() (Config, error) {
 		Restore:         true,
 		DatabaseDSN:     "",
 		HashKey:         "",
+		HashWindow:      300,
 		CryptoKey:       "",
+		MaxBodySize:     10 << 20,
+		DedupWindow:     300,
+		SubBuffer:       64,
+		Heartbeat:       15,
+		AlertInterval:   15,
+		RecordInterval:  15,
+		RateSamples:     64,
+		RateRetention:   3600,
+		ExportInterval:  10,
 	}
 
 	flag.StringVar(&config.Address, "a", config.Address, "server address")
@@ -53,12 +141,59 @@ func GetConfig() (Config, error) {
 	flag.StringVar(&config.FileStoragePath, "f", config.FileStoragePath, "storage path")
 	flag.BoolVar(&config.Restore, "r", config.Restore, "restore")
 	flag.StringVar(&config.DatabaseDSN, "d", config.DatabaseDSN, "database dsn")
+	flag.StringVar(&databaseShards, "shards", "", "comma-separated list of database shard dsns")
 	flag.StringVar(&config.HashKey, "k", config.HashKey, "hash key")
+	flag.BoolVar(&config.HashStrict, "hash-strict", config.HashStrict, "reject unsigned metrics and require signature timestamp and nonce")
+	flag.IntVar(&config.HashWindow, "hash-window", config.HashWindow, "allowed signature timestamp skew in seconds")
+	flag.StringVar(&config.HashKeysFile, "key-file", config.HashKeysFile, "path to file with additional active hash keys")
 	flag.StringVar(&config.CryptoKey, "crypto-key", config.CryptoKey, "path to crypto key for metrics encryption")
+	flag.StringVar(&cryptoKeys, "crypto-keys", "", "comma-separated paths to additional private keys accepted during rotation")
+	flag.StringVar(&signatureKeys, "signature-keys", "", "comma-separated paths to agent Ed25519 or ECDSA public keys")
+	flag.StringVar(&config.AdminToken, "admin-token", config.AdminToken, "admin api token")
+	flag.StringVar(&config.GRPCAddress, "grpc-address", config.GRPCAddress, "grpc server address")
+	flag.StringVar(&config.TrustedSubnet, "t", config.TrustedSubnet, "trusted subnet in CIDR notation for metrics ingestion")
+	flag.StringVar(&config.ReadSubnet, "read-trusted-subnet", config.ReadSubnet, "trusted subnet in CIDR notation for reads and ping")
+	flag.StringVar(&config.TLSCert, "tls-cert", config.TLSCert, "path to server TLS certificate")
+	flag.StringVar(&config.TLSKey, "tls-key", config.TLSKey, "path to server TLS private key")
+	flag.StringVar(&config.TLSClientCA, "tls-client-ca", config.TLSClientCA, "path to CA certificate for agent authentication (mTLS)")
+	flag.StringVar(&config.Tokens, "tokens", config.Tokens, "agent tokens store: json file path or postgres dsn")
+	flag.Float64Var(&config.RateLimit, "rate-limit", config.RateLimit, "requests per second allowed from one agent or address, 0 disables the limit")
+	flag.IntVar(&config.RateBurst, "rate-burst", config.RateBurst, "requests allowed in a burst above the rate limit")
+	flag.Int64Var(&config.MaxBodySize, "max-body-size", config.MaxBodySize, "maximum request body size in bytes, 0 disables the limit")
+	flag.IntVar(&config.MaxBatchSize, "max-batch-size", config.MaxBatchSize, "maximum number of metrics in a batch, 0 disables the limit")
+	flag.IntVar(&config.MaxMetrics, "max-metrics", config.MaxMetrics, "maximum number of distinct metrics, 0 disables the limit")
+	flag.IntVar(&config.DedupWindow, "idempotency-window", config.DedupWindow, "seconds to remember batch idempotency keys, 0 disables deduplication")
+	flag.IntVar(&config.SubBuffer, "subscription-buffer", config.SubBuffer, "unread updates after which a subscriber is dropped")
+	flag.IntVar(&config.Heartbeat, "subscription-heartbeat", config.Heartbeat, "seconds between subscription heartbeats")
+	flag.StringVar(&config.AlertRules, "alert-rules", config.AlertRules, "path to alerting rules file")
+	flag.StringVar(&config.AlertWebhook, "alert-webhook", config.AlertWebhook, "url to post alert notifications to")
+	flag.IntVar(&config.AlertInterval, "alert-interval", config.AlertInterval, "alerting rules evaluation interval in seconds")
+	flag.StringVar(&config.RecordRules, "recording-rules", config.RecordRules, "path to recording rules file")
+	flag.IntVar(&config.RecordInterval, "recording-interval", config.RecordInterval, "recording rules evaluation interval in seconds")
+	flag.IntVar(&config.RateSamples, "rate-samples", config.RateSamples, "recent values of each counter kept to compute its rate")
+	flag.IntVar(&config.RateRetention, "rate-retention", config.RateRetention, "seconds a counter value is kept to compute its rate")
+	flag.StringVar(&config.ForwardTargets, "forward-destinations", config.ForwardTargets, "path to metrics forwarding destinations file")
+	flag.StringVar(&config.ForwardSpool, "forward-spool", config.ForwardSpool, "directory to spool batches that could not be forwarded")
+	flag.StringVar(&config.InfluxURL, "influx-url", config.InfluxURL, "influxdb write url to export metrics to")
+	flag.StringVar(&config.InfluxToken, "influx-token", config.InfluxToken, "influxdb api token")
+	flag.StringVar(&config.GraphiteAddr, "graphite-address", config.GraphiteAddr, "graphite plaintext address to export metrics to")
+	flag.StringVar(&config.ExportPrefix, "export-prefix", config.ExportPrefix, "prefix of metric names exported to influxdb and graphite")
+	flag.IntVar(&config.ExportInterval, "export-interval", config.ExportInterval, "influxdb and graphite export interval in seconds")
+	flag.BoolVar(&config.RemoteWrite, "remote-write", config.RemoteWrite, "accept prometheus remote_write requests on /api/v1/write")
 	flag.StringVar(&configFile, "c", "", "config file path")
 	flag.StringVar(&configFile, "config", "", "config file path")
 	flag.Parse()
 
+	if databaseShards != "" {
+		config.DatabaseShards = strings.Split(databaseShards, ",")
+	}
+	if cryptoKeys != "" {
+		config.CryptoKeys = strings.Split(cryptoKeys, ",")
+	}
+	if signatureKeys != "" {
+		config.SignatureKeys = strings.Split(signatureKeys, ",")
+	}
+
 	if configFile == "" {
 		configFile = os.Getenv("CONFIG")
 	}
@@ -74,10 +209,22 @@ func GetConfig() (Config, error) {
 	if err := env.Parse(&config); err != nil {
 		return Config{}, err
 	}
+	config.DatabaseShards = trimList(config.DatabaseShards)
 
 	return config, nil
 }
 
+// trimList удаляет пробелы вокруг элементов списка, например "dsn1, dsn2", и пустые элементы.
+func trimList(items []string) []string {
+	trimmed := make([]string, 0, len(items))
+	for _, item := range items {
+		if item = strings.TrimSpace(item); item != "" {
+			trimmed = append(trimmed, item)
+		}
+	}
+	return trimmed
+}
+
 func loadJSONConfig(filename string) (*JSONConfig, error) {
 	data, err := os.ReadFile(filename)
 	if err != nil {
@@ -110,7 +257,132 @@ func applyJSONConfig(config *Config, jsonConfig *JSONConfig) {
 	if jsonConfig.DatabaseDSN != "" {
 		config.DatabaseDSN = jsonConfig.DatabaseDSN
 	}
+	if len(jsonConfig.DatabaseShards) > 0 {
+		config.DatabaseShards = jsonConfig.DatabaseShards
+	}
 	if jsonConfig.CryptoKey != "" {
 		config.CryptoKey = jsonConfig.CryptoKey
 	}
+	if len(jsonConfig.CryptoKeys) > 0 {
+		config.CryptoKeys = jsonConfig.CryptoKeys
+	}
+	if jsonConfig.HashKeysFile != "" {
+		config.HashKeysFile = jsonConfig.HashKeysFile
+	}
+	if len(jsonConfig.SignatureKeys) > 0 {
+		config.SignatureKeys = jsonConfig.SignatureKeys
+	}
+	if jsonConfig.AdminToken != "" {
+		config.AdminToken = jsonConfig.AdminToken
+	}
+	if jsonConfig.GRPCAddress != "" {
+		config.GRPCAddress = jsonConfig.GRPCAddress
+	}
+	if jsonConfig.HashStrict != nil {
+		config.HashStrict = *jsonConfig.HashStrict
+	}
+	if jsonConfig.HashWindow != "" {
+		if duration, err := time.ParseDuration(jsonConfig.HashWindow); err == nil {
+			config.HashWindow = int(duration.Seconds())
+		}
+	}
+	if jsonConfig.TrustedSubnet != "" {
+		config.TrustedSubnet = jsonConfig.TrustedSubnet
+	}
+	if jsonConfig.ReadSubnet != "" {
+		config.ReadSubnet = jsonConfig.ReadSubnet
+	}
+	if jsonConfig.TLSCert != "" {
+		config.TLSCert = jsonConfig.TLSCert
+	}
+	if jsonConfig.TLSKey != "" {
+		config.TLSKey = jsonConfig.TLSKey
+	}
+	if jsonConfig.TLSClientCA != "" {
+		config.TLSClientCA = jsonConfig.TLSClientCA
+	}
+	if jsonConfig.Tokens != "" {
+		config.Tokens = jsonConfig.Tokens
+	}
+	if jsonConfig.RateLimit != 0 {
+		config.RateLimit = jsonConfig.RateLimit
+	}
+	if jsonConfig.RateBurst != 0 {
+		config.RateBurst = jsonConfig.RateBurst
+	}
+	if jsonConfig.MaxBodySize != 0 {
+		config.MaxBodySize = jsonConfig.MaxBodySize
+	}
+	if jsonConfig.MaxBatchSize != 0 {
+		config.MaxBatchSize = jsonConfig.MaxBatchSize
+	}
+	if jsonConfig.MaxMetrics != 0 {
+		config.MaxMetrics = jsonConfig.MaxMetrics
+	}
+	if jsonConfig.DedupWindow != "" {
+		if duration, err := time.ParseDuration(jsonConfig.DedupWindow); err == nil {
+			config.DedupWindow = int(duration.Seconds())
+		}
+	}
+	if jsonConfig.SubBuffer != 0 {
+		config.SubBuffer = jsonConfig.SubBuffer
+	}
+	if jsonConfig.Heartbeat != "" {
+		if duration, err := time.ParseDuration(jsonConfig.Heartbeat); err == nil {
+			config.Heartbeat = int(duration.Seconds())
+		}
+	}
+	if jsonConfig.AlertRules != "" {
+		config.AlertRules = jsonConfig.AlertRules
+	}
+	if jsonConfig.AlertWebhook != "" {
+		config.AlertWebhook = jsonConfig.AlertWebhook
+	}
+	if jsonConfig.AlertInterval != "" {
+		if duration, err := time.ParseDuration(jsonConfig.AlertInterval); err == nil {
+			config.AlertInterval = int(duration.Seconds())
+		}
+	}
+	if jsonConfig.RecordRules != "" {
+		config.RecordRules = jsonConfig.RecordRules
+	}
+	if jsonConfig.RecordInterval != "" {
+		if duration, err := time.ParseDuration(jsonConfig.RecordInterval); err == nil {
+			config.RecordInterval = int(duration.Seconds())
+		}
+	}
+	if jsonConfig.RateSamples != 0 {
+		config.RateSamples = jsonConfig.RateSamples
+	}
+	if jsonConfig.RateRetention != "" {
+		if duration, err := time.ParseDuration(jsonConfig.RateRetention); err == nil {
+			config.RateRetention = int(duration.Seconds())
+		}
+	}
+	if jsonConfig.ForwardTargets != "" {
+		config.ForwardTargets = jsonConfig.ForwardTargets
+	}
+	if jsonConfig.ForwardSpool != "" {
+		config.ForwardSpool = jsonConfig.ForwardSpool
+	}
+	if jsonConfig.InfluxURL != "" {
+		config.InfluxURL = jsonConfig.InfluxURL
+	}
+	if jsonConfig.InfluxToken != "" {
+		config.InfluxToken = jsonConfig.InfluxToken
+	}
+	if jsonConfig.GraphiteAddr != "" {
+		config.GraphiteAddr = jsonConfig.GraphiteAddr
+	}
+	if jsonConfig.ExportPrefix != "" {
+		config.ExportPrefix = jsonConfig.ExportPrefix
+	}
+	if jsonConfig.ExportInterval != "" {
+		if duration, err := time.ParseDuration(jsonConfig.ExportInterval); err == nil {
+			config.ExportInterval = int(duration.Seconds())
+		}
+	}
+	if jsonConfig.RemoteWrite != nil {
+		config.RemoteWrite = *jsonConfig.RemoteWrite
+	}
 }
@@ -58,12 +58,43 @@ func TestApplyJSONConfig(t *testing.T) {
 	}
 
 	jsonConfig := &JSONConfig{
-		Address:       "localhost:9090",
-		Restore:       boolPtr(false),
-		StoreInterval: "1m",
-		StoreFile:     "/tmp/test.json",
-		DatabaseDSN:   "postgres://test",
-		CryptoKey:     "/path/to/key.pem",
+		Address:        "localhost:9090",
+		Restore:        boolPtr(false),
+		StoreInterval:  "1m",
+		StoreFile:      "/tmp/test.json",
+		DatabaseDSN:    "postgres://test",
+		DatabaseShards: []string{"postgres://shard1", "postgres://shard2"},
+		CryptoKey:      "/path/to/key.pem",
+		TrustedSubnet:  "192.168.0.0/24",
+		ReadSubnet:     "10.0.0.0/8",
+		CryptoKeys:     []string{"/path/to/old.pem"},
+		HashKeysFile:   "/path/to/keys",
+		HashStrict:     boolPtr(true),
+		HashWindow:     "30s",
+		SignatureKeys:  []string{"/path/to/agent.pem"},
+		Tokens:         "/path/to/tokens.json",
+		RateLimit:      2.5,
+		MaxBodySize:    1024,
+		MaxBatchSize:   100,
+		MaxMetrics:     5000,
+		DedupWindow:    "10m",
+		SubBuffer:      16,
+		Heartbeat:      "30s",
+		AlertRules:     "/path/to/rules.json",
+		AlertWebhook:   "http://alerts.local/hook",
+		AlertInterval:  "1m",
+		RecordRules:    "/path/to/recording.json",
+		RecordInterval: "30s",
+		RateSamples:    128,
+		RateRetention:  "2h",
+		ForwardTargets: "/path/to/forward.json",
+		ForwardSpool:   "/var/spool/metrics",
+		InfluxURL:      "http://influx.local:8086/write?db=metrics",
+		InfluxToken:    "influx_token",
+		GraphiteAddr:   "graphite.local:2003",
+		ExportPrefix:   "server.",
+		ExportInterval: "1m",
+		RemoteWrite:    boolPtr(true),
 	}
 
 	applyJSONConfig(&config, jsonConfig)
@@ -73,7 +104,39 @@ func TestApplyJSONConfig(t *testing.T) {
 	assert.Equal(t, 60, config.StoreInterval)
 	assert.Equal(t, "/tmp/test.json", config.FileStoragePath)
 	assert.Equal(t, "postgres://test", config.DatabaseDSN)
+	assert.Equal(t, []string{"postgres://shard1", "postgres://shard2"}, config.DatabaseShards)
 	assert.Equal(t, "/path/to/key.pem", config.CryptoKey)
+	assert.Equal(t, "192.168.0.0/24", config.TrustedSubnet)
+	assert.Equal(t, "10.0.0.0/8", config.ReadSubnet)
+	assert.Equal(t, []string{"/path/to/old.pem"}, config.CryptoKeys)
+	assert.Equal(t, "/path/to/keys", config.HashKeysFile)
+	assert.True(t, config.HashStrict)
+	assert.Equal(t, 30, config.HashWindow)
+	assert.Equal(t, []string{"/path/to/agent.pem"}, config.SignatureKeys)
+	assert.Equal(t, "/path/to/tokens.json", config.Tokens)
+	assert.Equal(t, 2.5, config.RateLimit)
+	assert.Equal(t, 0, config.RateBurst)
+	assert.Equal(t, int64(1024), config.MaxBodySize)
+	assert.Equal(t, 100, config.MaxBatchSize)
+	assert.Equal(t, 5000, config.MaxMetrics)
+	assert.Equal(t, 600, config.DedupWindow)
+	assert.Equal(t, 16, config.SubBuffer)
+	assert.Equal(t, 30, config.Heartbeat)
+	assert.Equal(t, "/path/to/rules.json", config.AlertRules)
+	assert.Equal(t, "http://alerts.local/hook", config.AlertWebhook)
+	assert.Equal(t, 60, config.AlertInterval)
+	assert.Equal(t, "/path/to/recording.json", config.RecordRules)
+	assert.Equal(t, 30, config.RecordInterval)
+	assert.Equal(t, 128, config.RateSamples)
+	assert.Equal(t, 7200, config.RateRetention)
+	assert.Equal(t, "/path/to/forward.json", config.ForwardTargets)
+	assert.Equal(t, "/var/spool/metrics", config.ForwardSpool)
+	assert.Equal(t, "http://influx.local:8086/write?db=metrics", config.InfluxURL)
+	assert.Equal(t, "influx_token", config.InfluxToken)
+	assert.Equal(t, "graphite.local:2003", config.GraphiteAddr)
+	assert.Equal(t, "server.", config.ExportPrefix)
+	assert.Equal(t, 60, config.ExportInterval)
+	assert.True(t, config.RemoteWrite)
 }
 
 func TestApplyJSONConfigPartial(t *testing.T) {
@@ -102,6 +165,11 @@ func TestApplyJSONConfigPartial(t *testing.T) {
 	assert.Equal(t, "", config.CryptoKey)
 }
 
+func TestTrimList(t *testing.T) {
+	assert.Equal(t, []string{"postgres://shard1", "postgres://shard2"}, trimList([]string{" postgres://shard1", "postgres://shard2 ", ""}))
+	assert.Empty(t, trimList(nil))
+}
+
 func boolPtr(b bool) *bool {
 	return &b
 }
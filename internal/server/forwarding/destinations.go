@@ -0,0 +1,132 @@
+// Package forwarding пересылает принятые сервером метрики во внешние системы: сервер работает
+// как ретранслятор, дополнительно отправляя каждый принятый пакет на заданные HTTP-адреса.
+package forwarding
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+
+	"github.com/invinciblewest/metrics/internal/export"
+	"github.com/invinciblewest/metrics/internal/models"
+)
+
+// ErrInvalidDestination возвращается для адресата с некорректным описанием.
+var ErrInvalidDestination = errors.New("invalid forwarding destination")
+
+// validName допустимое имя адресата: оно используется как имя каталога очереди на диске.
+var validName = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]*$`)
+
+// Destination адресат пересылки метрик.
+type Destination struct {
+	Name    string            // Name имя адресата, уникальное среди адресатов.
+	URL     string            // URL адрес, на который отправляются пакеты методом POST.
+	Include []string          // Include шаблоны имен пересылаемых метрик в формате path.Match; пустой список выбирает все метрики.
+	Format  Format            // Format формат тела запроса.
+	Prefix  string            // Prefix добавляется к именам метрик перед отправкой.
+	Headers map[string]string // Headers дополнительные заголовки запроса, например для авторизации.
+}
+
+// matches сообщает, пересылается ли адресату метрика с именем id.
+func (d Destination) matches(id string) bool {
+	if len(d.Include) == 0 {
+		return true
+	}
+	for _, pattern := range d.Include {
+		if matched, _ := path.Match(pattern, id); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// filter возвращает метрики пакета, пересылаемые адресату, с именами, дополненными префиксом.
+// Метрики без значения и со значениями NaN и ±Inf пропускаются: их нельзя закодировать ни в JSON,
+// ни в line protocol, и адресат отклонил бы из-за них весь пакет.
+func (d Destination) filter(metrics []models.Metric) []models.Metric {
+	selected := make([]models.Metric, 0, len(metrics))
+	for _, metric := range metrics {
+		if !d.matches(metric.ID) || !export.Encodable(metric) {
+			continue
+		}
+		metric.ID = d.Prefix + metric.ID
+		selected = append(selected, metric)
+	}
+	return selected
+}
+
+// destinationsFile структура файла адресатов.
+type destinationsFile struct {
+	Destinations []destinationJSON `json:"destinations"`
+}
+
+// destinationJSON описание адресата в файле.
+type destinationJSON struct {
+	Name    string            `json:"name"`
+	URL     string            `json:"url"`
+	Include []string          `json:"include"`
+	Format  Format            `json:"format"`
+	Prefix  string            `json:"prefix"`
+	Headers map[string]string `json:"headers"`
+}
+
+// LoadDestinations читает адресатов пересылки из JSON-файла вида {"destinations": [{"name": ..., "url": ...}]}.
+func LoadDestinations(path string) ([]Destination, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseDestinations(data)
+}
+
+// ParseDestinations разбирает адресатов в формате файла адресатов.
+func ParseDestinations(data []byte) ([]Destination, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	var file destinationsFile
+	if err := dec.Decode(&file); err != nil {
+		return nil, err
+	}
+
+	destinations := make([]Destination, 0, len(file.Destinations))
+	names := make(map[string]struct{}, len(file.Destinations))
+	for _, raw := range file.Destinations {
+		if !validName.MatchString(raw.Name) {
+			return nil, fmt.Errorf("%w %q: name must consist of letters, digits, '_', '.' and '-' and must not start with '.' or '-'", ErrInvalidDestination, raw.Name)
+		}
+		if _, ok := names[raw.Name]; ok {
+			return nil, fmt.Errorf("%w %q: duplicate name", ErrInvalidDestination, raw.Name)
+		}
+		names[raw.Name] = struct{}{}
+
+		if u, err := url.Parse(raw.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("%w %q: url must be an absolute http or https url", ErrInvalidDestination, raw.Name)
+		}
+		for _, pattern := range raw.Include {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("%w %q: bad pattern %q", ErrInvalidDestination, raw.Name, pattern)
+			}
+		}
+		if raw.Format == "" {
+			raw.Format = FormatJSON
+		}
+		if !raw.Format.Valid() {
+			return nil, fmt.Errorf("%w %q: unknown format %q", ErrInvalidDestination, raw.Name, raw.Format)
+		}
+
+		destinations = append(destinations, Destination{
+			Name:    raw.Name,
+			URL:     raw.URL,
+			Include: raw.Include,
+			Format:  raw.Format,
+			Prefix:  raw.Prefix,
+			Headers: raw.Headers,
+		})
+	}
+	return destinations, nil
+}
@@ -0,0 +1,124 @@
+package forwarding
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/invinciblewest/metrics/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseDestinations(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    []Destination
+		wantErr bool
+	}{
+		{
+			name: "valid",
+			data: `{"destinations":[
+				{"name":"relay","url":"http://metrics.local/updates/"},
+				{"name":"influx","url":"https://influx.local/write","include":["CPU*","*Memory"],"format":"influx","prefix":"host1.","headers":{"Authorization":"Token secret"}}
+			]}`,
+			want: []Destination{
+				{Name: "relay", URL: "http://metrics.local/updates/", Format: FormatJSON},
+				{
+					Name:    "influx",
+					URL:     "https://influx.local/write",
+					Include: []string{"CPU*", "*Memory"},
+					Format:  FormatInflux,
+					Prefix:  "host1.",
+					Headers: map[string]string{"Authorization": "Token secret"},
+				},
+			},
+		},
+		{name: "missing name", data: `{"destinations":[{"url":"http://a.local"}]}`, wantErr: true},
+		{name: "path in name", data: `{"destinations":[{"name":"../a","url":"http://a.local"}]}`, wantErr: true},
+		{name: "duplicate name", data: `{"destinations":[{"name":"a","url":"http://a.local"},{"name":"a","url":"http://b.local"}]}`, wantErr: true},
+		{name: "relative url", data: `{"destinations":[{"name":"a","url":"/updates"}]}`, wantErr: true},
+		{name: "bad pattern", data: `{"destinations":[{"name":"a","url":"http://a.local","include":["CPU["]}]}`, wantErr: true},
+		{name: "unknown format", data: `{"destinations":[{"name":"a","url":"http://a.local","format":"xml"}]}`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			destinations, err := ParseDestinations([]byte(tt.data))
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidDestination)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, destinations)
+		})
+	}
+}
+
+func TestDestination_Filter(t *testing.T) {
+	value := 1.5
+	delta := int64(3)
+	metrics := []models.Metric{
+		{ID: "CPUutilization1", MType: models.TypeGauge, Value: &value},
+		{ID: "FreeMemory", MType: models.TypeGauge, Value: &value},
+		{ID: "PollCount", MType: models.TypeCounter, Delta: &delta},
+	}
+
+	all := Destination{Prefix: "host1."}.filter(metrics)
+	require.Len(t, all, 3)
+	assert.Equal(t, "host1.PollCount", all[2].ID)
+	assert.Equal(t, "PollCount", metrics[2].ID)
+
+	selected := Destination{Include: []string{"CPU*", "*Memory"}}.filter(metrics)
+	require.Len(t, selected, 2)
+	assert.Equal(t, "CPUutilization1", selected[0].ID)
+	assert.Equal(t, "FreeMemory", selected[1].ID)
+
+	nan, inf := math.NaN(), math.Inf(1)
+	finite := Destination{}.filter(append([]models.Metric{
+		{ID: "NaN", MType: models.TypeGauge, Value: &nan},
+		{ID: "Inf", MType: models.TypeGauge, Value: &inf},
+		{ID: "NoValue", MType: models.TypeGauge},
+	}, metrics...))
+	assert.Equal(t, metrics, finite, "non-finite values are skipped, the rest of the batch is kept")
+}
+
+func TestFormat_Encode(t *testing.T) {
+	value := 1.5
+	delta := int64(3)
+	metrics := []models.Metric{
+		{ID: "Free Memory", MType: models.TypeGauge, Value: &value},
+		{ID: "PollCount", MType: models.TypeCounter, Delta: &delta},
+	}
+	at := time.Unix(1700000000, 0)
+
+	tests := []struct {
+		format      Format
+		contentType string
+		body        string
+	}{
+		{
+			format:      FormatJSON,
+			contentType: "application/json",
+			body:        `[{"id":"Free Memory","type":"gauge","value":1.5},{"id":"PollCount","type":"counter","delta":3}]` + "\n",
+		},
+		{
+			format:      FormatNDJSON,
+			contentType: "application/x-ndjson",
+			body:        `{"id":"Free Memory","type":"gauge","value":1.5}` + "\n" + `{"id":"PollCount","type":"counter","delta":3}` + "\n",
+		},
+		{
+			format:      FormatInflux,
+			contentType: "text/plain; charset=utf-8",
+			body:        "Free\\ Memory,type=gauge value=1.5 1700000000000000000\nPollCount,type=counter value=3i 1700000000000000000\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.format), func(t *testing.T) {
+			contentType, body, err := tt.format.encode(metrics, at)
+			require.NoError(t, err)
+			assert.Equal(t, tt.contentType, contentType)
+			assert.Equal(t, tt.body, string(body))
+		})
+	}
+}
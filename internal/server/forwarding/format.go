@@ -0,0 +1,56 @@
+package forwarding
+
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+
+	"github.com/invinciblewest/metrics/internal/export"
+	"github.com/invinciblewest/metrics/internal/models"
+)
+
+// Format формат тела запроса к адресату.
+type Format string
+
+const (
+	FormatJSON   Format = "json"   // FormatJSON массив метрик в формате /updates, например для другого сервера метрик.
+	FormatNDJSON Format = "ndjson" // FormatNDJSON метрики по одной на строку в формате /updates/stream.
+	FormatInflux Format = "influx" // FormatInflux строки InfluxDB line protocol с меткой времени приема пакета, как у export.Influx.
+)
+
+// Valid сообщает, является ли формат известным.
+func (f Format) Valid() bool {
+	switch f {
+	case FormatJSON, FormatNDJSON, FormatInflux:
+		return true
+	}
+	return false
+}
+
+// encode кодирует пакет метрик, принятый в момент at, в формате f.
+// Возвращает тип содержимого и тело запроса.
+func (f Format) encode(metrics []models.Metric, at time.Time) (string, []byte, error) {
+	var buf bytes.Buffer
+	switch f {
+	case FormatNDJSON:
+		enc := json.NewEncoder(&buf)
+		for _, metric := range metrics {
+			if err := enc.Encode(metric); err != nil {
+				return "", nil, err
+			}
+		}
+		return "application/x-ndjson", buf.Bytes(), nil
+	case FormatInflux:
+		// Приращение счетчика записывается в то же поле value, что и при выгрузке экспортером.
+		var body []byte
+		for _, metric := range metrics {
+			body = export.AppendInflux(body, "", metric, at)
+		}
+		return "text/plain; charset=utf-8", body, nil
+	default:
+		if err := json.NewEncoder(&buf).Encode(metrics); err != nil {
+			return "", nil, err
+		}
+		return "application/json", buf.Bytes(), nil
+	}
+}
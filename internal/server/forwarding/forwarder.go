@@ -0,0 +1,382 @@
+package forwarding
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/invinciblewest/metrics/internal/logger"
+	"github.com/invinciblewest/metrics/internal/models"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultQueueSize      = 256              // defaultQueueSize количество пакетов в очереди адресата в памяти.
+	defaultSpoolLimit     = 10000            // defaultSpoolLimit количество пакетов в очереди адресата на диске.
+	defaultAttempts       = 3                // defaultAttempts количество попыток доставки пакета.
+	defaultBackoff        = time.Second      // defaultBackoff пауза перед второй попыткой доставки, далее она удваивается.
+	defaultMaxBackoff     = 30 * time.Second // defaultMaxBackoff наибольшая пауза между попытками доставки.
+	defaultReplayInterval = 30 * time.Second // defaultReplayInterval интервал повторной доставки пакетов с диска.
+	defaultTimeout        = 10 * time.Second // defaultTimeout время ожидания ответа адресата.
+)
+
+// ErrRejected возвращается, если адресат отклонил пакет ошибкой клиента: повторная отправка не поможет.
+var ErrRejected = errors.New("batch rejected by destination")
+
+// Option задает дополнительную настройку Forwarder.
+type Option func(*Forwarder)
+
+// WithClient задает HTTP-клиент для запросов к адресатам.
+func WithClient(client *http.Client) Option {
+	return func(f *Forwarder) {
+		if client != nil {
+			f.client = client
+		}
+	}
+}
+
+// WithQueueSize задает количество пакетов в очереди каждого адресата в памяти. Пакеты, не поместившиеся
+// в очередь, записываются в очередь на диске рабочей горутиной адресата, а без нее отбрасываются.
+// Таких пакетов в памяти ожидает не больше n, остальные тоже отбрасываются. Нулевое значение оставляет размер по умолчанию.
+func WithQueueSize(n int) Option {
+	return func(f *Forwarder) {
+		if n > 0 {
+			f.queueSize = n
+		}
+	}
+}
+
+// WithRetry задает количество попыток доставки пакета и паузу перед второй попыткой;
+// каждая следующая пауза вдвое больше предыдущей, но не больше maxBackoff.
+// Нулевые значения оставляют значения по умолчанию.
+func WithRetry(attempts int, backoff, maxBackoff time.Duration) Option {
+	return func(f *Forwarder) {
+		if attempts > 0 {
+			f.attempts = attempts
+		}
+		if backoff > 0 {
+			f.backoff = backoff
+		}
+		if maxBackoff > 0 {
+			f.maxBackoff = maxBackoff
+		}
+	}
+}
+
+// WithSpool включает очередь на диске: пакеты, которые не удалось доставить за все попытки, записываются
+// в подкаталог dir с именем адресата и доставляются повторно каждые interval, в том числе после перезапуска
+// сервера. limit ограничивает количество пакетов в очереди адресата, при переполнении удаляются самые старые.
+// Нулевые значения limit и interval оставляют значения по умолчанию.
+func WithSpool(dir string, limit int, interval time.Duration) Option {
+	return func(f *Forwarder) {
+		f.spoolDir = dir
+		if limit > 0 {
+			f.spoolLimit = limit
+		}
+		if interval > 0 {
+			f.replayInterval = interval
+		}
+	}
+}
+
+// Forwarder пересылает принятые сервером пакеты метрик адресатам. У каждого адресата своя очередь,
+// поэтому недоступный адресат не задерживает доставку остальным.
+type Forwarder struct {
+	destinations   []*destination
+	client         *http.Client
+	queueSize      int
+	attempts       int
+	backoff        time.Duration
+	maxBackoff     time.Duration
+	spoolDir       string
+	spoolLimit     int
+	replayInterval time.Duration
+	now            func() time.Time
+}
+
+// destination адресат с очередями пакетов.
+type destination struct {
+	Destination
+	queue    chan batch
+	spool    *spool
+	mu       sync.Mutex
+	overflow []batch       // overflow пакеты, не поместившиеся в очередь и ожидающие записи на диск.
+	wake     chan struct{} // wake сообщает рабочей горутине о пакетах в overflow.
+	dropped  atomic.Int64  // dropped количество пакетов, отброшенных при переполнении очереди.
+}
+
+// NewForwarder создает пересылку пакетов адресатам destinations.
+// Возвращает ошибку, если не удалось открыть очередь на диске.
+func NewForwarder(destinations []Destination, opts ...Option) (*Forwarder, error) {
+	f := &Forwarder{
+		client:         &http.Client{Timeout: defaultTimeout},
+		queueSize:      defaultQueueSize,
+		attempts:       defaultAttempts,
+		backoff:        defaultBackoff,
+		maxBackoff:     defaultMaxBackoff,
+		spoolLimit:     defaultSpoolLimit,
+		replayInterval: defaultReplayInterval,
+		now:            time.Now,
+	}
+	for _, opt := range opts {
+		opt(f)
+	}
+
+	for _, dest := range destinations {
+		d := &destination{
+			Destination: dest,
+			queue:       make(chan batch, f.queueSize),
+			wake:        make(chan struct{}, 1),
+		}
+		if f.spoolDir != "" {
+			var err error
+			if d.spool, err = openSpool(filepath.Join(f.spoolDir, dest.Name), f.spoolLimit); err != nil {
+				return nil, fmt.Errorf("open spool of %q: %w", dest.Name, err)
+			}
+		}
+		f.destinations = append(f.destinations, d)
+	}
+	return f, nil
+}
+
+// Forward ставит пакет метрик в очереди адресатов, которым пересылается хотя бы одна его метрика.
+// Метод не ждет доставки, не обращается к диску и не блокирует запись метрик.
+func (f *Forwarder) Forward(metrics []models.Metric) {
+	at := f.now()
+	for _, d := range f.destinations {
+		selected := d.filter(metrics)
+		if len(selected) == 0 {
+			continue
+		}
+		f.enqueue(d, batch{At: at, Metrics: selected})
+	}
+}
+
+// Dropped возвращает количество пакетов каждого адресата, отброшенных при переполнении очереди в памяти.
+func (f *Forwarder) Dropped() map[string]int64 {
+	dropped := make(map[string]int64, len(f.destinations))
+	for _, d := range f.destinations {
+		dropped[d.Name] = d.dropped.Load()
+	}
+	return dropped
+}
+
+// enqueue ставит пакет в очередь адресата в памяти. Пакет, не поместившийся в нее, передается рабочей горутине
+// для записи на диск; пока такие пакеты ожидают записи, следующие пакеты встают за ними, чтобы сохранить порядок.
+// Без очереди на диске или если записи ожидает слишком много пакетов, пакет отбрасывается.
+func (f *Forwarder) enqueue(d *destination, b batch) {
+	d.mu.Lock()
+	if len(d.overflow) == 0 {
+		select {
+		case d.queue <- b:
+			d.mu.Unlock()
+			return
+		default:
+		}
+	}
+	accepted := d.spool != nil && len(d.overflow) < f.queueSize
+	if accepted {
+		d.overflow = append(d.overflow, b)
+	}
+	d.mu.Unlock()
+
+	if accepted {
+		select {
+		case d.wake <- struct{}{}:
+		default:
+		}
+		return
+	}
+	d.dropped.Add(1)
+	logger.Log.Warn("forwarded batch dropped", zap.String("destination", d.Name), zap.Int("metrics", len(b.Metrics)), zap.String("reason", "queue is full"))
+}
+
+// spillOverflow записывает в очередь на диске пакеты, не поместившиеся в очередь в памяти. Более ранние пакеты
+// из очереди в памяти записываются перед ними: пока overflow не пуст, новые пакеты в очередь не попадают.
+func (f *Forwarder) spillOverflow(d *destination) {
+	d.mu.Lock()
+	var pending []batch
+	if len(d.overflow) > 0 {
+	queued:
+		for {
+			select {
+			case b := <-d.queue:
+				pending = append(pending, b)
+			default:
+				break queued
+			}
+		}
+		pending = append(pending, d.overflow...)
+		d.overflow = nil
+	}
+	d.mu.Unlock()
+
+	for _, b := range pending {
+		f.spill(d, b, errors.New("queue is full"))
+	}
+}
+
+// Run доставляет пакеты адресатам до отмены контекста. После отмены пакеты из очередей в памяти
+// записываются в очередь на диске, если она включена, и Run возвращает управление.
+func (f *Forwarder) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, d := range f.destinations {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			f.work(ctx, d)
+		}()
+	}
+	wg.Wait()
+}
+
+// work доставляет пакеты адресату d.
+func (f *Forwarder) work(ctx context.Context, d *destination) {
+	ticker := time.NewTicker(f.replayInterval)
+	defer ticker.Stop()
+
+	f.replay(ctx, d)
+	for {
+		select {
+		case <-ctx.Done():
+			f.drain(d)
+			return
+		case <-d.wake:
+			f.spillOverflow(d)
+			f.replay(ctx, d)
+		case b := <-d.queue:
+			if d.spool != nil && d.spool.len() > 0 {
+				// Пакеты с диска доставляются первыми, чтобы адресат получал значения в порядке приема.
+				f.spill(d, b, errors.New("earlier batches are spooled"))
+				f.replay(ctx, d)
+				continue
+			}
+			if err := f.deliver(ctx, d, b); err != nil {
+				f.spill(d, b, err)
+			}
+		case <-ticker.C:
+			f.replay(ctx, d)
+		}
+	}
+}
+
+// deliver отправляет пакет адресату, повторяя попытку с растущей паузой, пока адресат недоступен.
+func (f *Forwarder) deliver(ctx context.Context, d *destination, b batch) error {
+	delay := f.backoff
+	for attempt := 1; ; attempt++ {
+		err := f.send(ctx, d, b)
+		if err == nil || errors.Is(err, ErrRejected) || attempt >= f.attempts {
+			return err
+		}
+		logger.Log.Debug("forwarding failed, retrying", zap.String("destination", d.Name), zap.Int("attempt", attempt), zap.Error(err))
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+		delay = min(delay*2, f.maxBackoff)
+	}
+}
+
+// send выполняет одну попытку доставки пакета.
+func (f *Forwarder) send(ctx context.Context, d *destination, b batch) error {
+	contentType, body, err := d.Format.encode(b.Metrics, b.At)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrRejected, err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrRejected, err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	for key, value := range d.Headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode >= 400 && resp.StatusCode < 500 &&
+		resp.StatusCode != http.StatusRequestTimeout && resp.StatusCode != http.StatusTooManyRequests:
+		return fmt.Errorf("%w: %s", ErrRejected, resp.Status)
+	default:
+		return fmt.Errorf("destination responded %s", resp.Status)
+	}
+}
+
+// spill записывает недоставленный пакет в очередь на диске. Пакет, отклоненный адресатом,
+// и пакет адресата без очереди на диске отбрасываются.
+func (f *Forwarder) spill(d *destination, b batch, reason error) {
+	fields := []zap.Field{zap.String("destination", d.Name), zap.Int("metrics", len(b.Metrics)), zap.Error(reason)}
+	if d.spool == nil || errors.Is(reason, ErrRejected) {
+		logger.Log.Warn("forwarded batch dropped", fields...)
+		return
+	}
+	dropped, err := d.spool.push(b)
+	if err != nil {
+		logger.Log.Error("failed to spool forwarded batch", append(fields, zap.NamedError("spool_error", err))...)
+		return
+	}
+	if dropped > 0 {
+		logger.Log.Warn("spool is full, oldest forwarded batches dropped", zap.String("destination", d.Name), zap.Int("batches", dropped))
+	}
+	logger.Log.Debug("forwarded batch spooled", fields...)
+}
+
+// replay доставляет пакеты из очереди на диске по порядку, пока адресат их принимает.
+// Каждый пакет отправляется один раз: при ошибке доставка откладывается до следующего вызова.
+func (f *Forwarder) replay(ctx context.Context, d *destination) {
+	if d.spool == nil {
+		return
+	}
+	for ctx.Err() == nil {
+		name, b, err := d.spool.peek()
+		if err != nil {
+			logger.Log.Error("spooled batch dropped", zap.String("destination", d.Name), zap.Error(err))
+			continue
+		}
+		if name == "" {
+			return
+		}
+		if err = f.send(ctx, d, b); err != nil && !errors.Is(err, ErrRejected) {
+			logger.Log.Debug("spooled batch not delivered", zap.String("destination", d.Name), zap.Error(err))
+			return
+		}
+		if err != nil {
+			logger.Log.Warn("spooled batch dropped", zap.String("destination", d.Name), zap.Error(err))
+		}
+		if err = d.spool.remove(name); err != nil {
+			logger.Log.Error("failed to remove spooled batch", zap.String("destination", d.Name), zap.Error(err))
+		}
+	}
+}
+
+// drain переносит пакеты из очереди в памяти в очередь на диске при остановке.
+func (f *Forwarder) drain(d *destination) {
+	f.spillOverflow(d)
+	for {
+		select {
+		case b := <-d.queue:
+			f.spill(d, b, errors.New("forwarder is stopping"))
+		default:
+			return
+		}
+	}
+}
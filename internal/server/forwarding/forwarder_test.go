@@ -0,0 +1,211 @@
+package forwarding
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/invinciblewest/metrics/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// downstream тестовый адресат, запоминающий принятые пакеты.
+type downstream struct {
+	*httptest.Server
+	mu      sync.Mutex
+	batches [][]models.Metric
+	headers []http.Header
+	status  atomic.Int32
+}
+
+func newDownstream(t *testing.T) *downstream {
+	d := &downstream{}
+	d.status.Store(http.StatusOK)
+	d.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status := int(d.status.Load())
+		if status == http.StatusOK {
+			var metrics []models.Metric
+			body, _ := io.ReadAll(r.Body)
+			require.NoError(t, json.Unmarshal(body, &metrics))
+			d.mu.Lock()
+			d.batches = append(d.batches, metrics)
+			d.headers = append(d.headers, r.Header.Clone())
+			d.mu.Unlock()
+		}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(d.Close)
+	return d
+}
+
+func (d *downstream) received() [][]models.Metric {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([][]models.Metric(nil), d.batches...)
+}
+
+func gauge(id string, value float64) models.Metric {
+	return models.Metric{ID: id, MType: models.TypeGauge, Value: &value}
+}
+
+// run запускает пересылку и возвращает функцию ее остановки.
+func run(f *Forwarder) func() {
+	ctx, cancel := context.WithCancel(context.TODO())
+	done := make(chan struct{})
+	go func() {
+		f.Run(ctx)
+		close(done)
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+func TestForwarder_Forward(t *testing.T) {
+	all := newDownstream(t)
+	cpu := newDownstream(t)
+	forwarder, err := NewForwarder([]Destination{
+		{Name: "all", URL: all.URL, Headers: map[string]string{"Authorization": "Token secret"}},
+		{Name: "cpu", URL: cpu.URL, Include: []string{"CPU*"}, Prefix: "host1."},
+	})
+	require.NoError(t, err)
+	stop := run(forwarder)
+	defer stop()
+
+	forwarder.Forward([]models.Metric{gauge("CPUutilization1", 12.5), gauge("FreeMemory", 100)})
+	forwarder.Forward([]models.Metric{gauge("FreeMemory", 200)})
+
+	require.Eventually(t, func() bool { return len(all.received()) == 2 && len(cpu.received()) == 1 }, time.Second, 10*time.Millisecond)
+	assert.Len(t, all.received()[0], 2)
+	assert.Equal(t, "Token secret", all.headers[0].Get("Authorization"))
+	assert.Equal(t, "application/json", all.headers[0].Get("Content-Type"))
+	assert.Equal(t, []models.Metric{gauge("host1.CPUutilization1", 12.5)}, cpu.received()[0])
+}
+
+func TestForwarder_Retry(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	forwarder, err := NewForwarder([]Destination{{Name: "flaky", URL: server.URL}},
+		WithRetry(3, time.Millisecond, 5*time.Millisecond))
+	require.NoError(t, err)
+	stop := run(forwarder)
+	defer stop()
+
+	forwarder.Forward([]models.Metric{gauge("FreeMemory", 100)})
+	require.Eventually(t, func() bool { return calls.Load() == 3 }, time.Second, 5*time.Millisecond)
+}
+
+func TestForwarder_Spool(t *testing.T) {
+	dir := t.TempDir()
+	target := newDownstream(t)
+	target.status.Store(http.StatusServiceUnavailable)
+
+	forwarder, err := NewForwarder([]Destination{{Name: "target", URL: target.URL}},
+		WithRetry(2, time.Millisecond, time.Millisecond),
+		WithSpool(dir, 0, 20*time.Millisecond))
+	require.NoError(t, err)
+	stop := run(forwarder)
+
+	forwarder.Forward([]models.Metric{gauge("FreeMemory", 1)})
+	require.Eventually(t, func() bool { return forwarder.destinations[0].spool.len() == 1 }, time.Second, 5*time.Millisecond)
+	// Следующий пакет ставится в очередь на диске за недоставленным, чтобы сохранить порядок.
+	forwarder.Forward([]models.Metric{gauge("FreeMemory", 2)})
+	require.Eventually(t, func() bool { return forwarder.destinations[0].spool.len() == 2 }, time.Second, 5*time.Millisecond)
+	stop()
+
+	// Очередь на диске доставляется после перезапуска, когда адресат снова доступен.
+	target.status.Store(http.StatusOK)
+	restarted, err := NewForwarder([]Destination{{Name: "target", URL: target.URL}}, WithSpool(dir, 0, 20*time.Millisecond))
+	require.NoError(t, err)
+	require.Equal(t, 2, restarted.destinations[0].spool.len())
+	stop = run(restarted)
+	defer stop()
+
+	require.Eventually(t, func() bool { return len(target.received()) == 2 }, time.Second, 5*time.Millisecond)
+	assert.Equal(t, []models.Metric{gauge("FreeMemory", 1)}, target.received()[0])
+	assert.Equal(t, []models.Metric{gauge("FreeMemory", 2)}, target.received()[1])
+	assert.Equal(t, 0, restarted.destinations[0].spool.len())
+}
+
+func TestForwarder_Rejected(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	forwarder, err := NewForwarder([]Destination{{Name: "strict", URL: server.URL}},
+		WithRetry(3, time.Millisecond, time.Millisecond),
+		WithSpool(t.TempDir(), 0, time.Hour))
+	require.NoError(t, err)
+	stop := run(forwarder)
+
+	forwarder.Forward([]models.Metric{gauge("FreeMemory", 1)})
+	require.Eventually(t, func() bool { return calls.Load() == 1 }, time.Second, 5*time.Millisecond)
+	stop()
+	assert.Equal(t, int32(1), calls.Load(), "rejected batch is not retried")
+	assert.Equal(t, 0, forwarder.destinations[0].spool.len(), "rejected batch is not spooled")
+}
+
+func TestSpool_Limit(t *testing.T) {
+	s, err := openSpool(t.TempDir(), 2)
+	require.NoError(t, err)
+	for i := range 3 {
+		dropped, pushErr := s.push(batch{At: time.Now(), Metrics: []models.Metric{gauge("FreeMemory", float64(i))}})
+		require.NoError(t, pushErr)
+		assert.Equal(t, max(i-1, 0), dropped)
+	}
+
+	name, b, err := s.peek()
+	require.NoError(t, err)
+	assert.Equal(t, 1.0, *b.Metrics[0].Value)
+	require.NoError(t, s.remove(name))
+	assert.Equal(t, 1, s.len())
+}
+
+func TestForwarder_Overflow(t *testing.T) {
+	t.Run("spooled by worker", func(t *testing.T) {
+		target := newDownstream(t)
+		forwarder, err := NewForwarder([]Destination{{Name: "target", URL: target.URL}},
+			WithQueueSize(1),
+			WithSpool(t.TempDir(), 0, time.Hour))
+		require.NoError(t, err)
+
+		for i := range 3 {
+			forwarder.Forward([]models.Metric{gauge("FreeMemory", float64(i))})
+		}
+		// Forward не пишет на диск: пакет сверх очереди ждет рабочую горутину, а следующий отбрасывается.
+		assert.Equal(t, 0, forwarder.destinations[0].spool.len())
+		assert.Equal(t, map[string]int64{"target": 1}, forwarder.Dropped())
+
+		stop := run(forwarder)
+		defer stop()
+		require.Eventually(t, func() bool { return len(target.received()) == 2 }, time.Second, 5*time.Millisecond)
+		assert.Equal(t, [][]models.Metric{{gauge("FreeMemory", 0)}, {gauge("FreeMemory", 1)}}, target.received())
+	})
+
+	t.Run("without spool", func(t *testing.T) {
+		forwarder, err := NewForwarder([]Destination{{Name: "target", URL: "http://localhost"}}, WithQueueSize(1))
+		require.NoError(t, err)
+		forwarder.Forward([]models.Metric{gauge("FreeMemory", 1)})
+		forwarder.Forward([]models.Metric{gauge("FreeMemory", 2)})
+		assert.Equal(t, map[string]int64{"target": 1}, forwarder.Dropped())
+	})
+}
@@ -0,0 +1,131 @@
+package forwarding
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/invinciblewest/metrics/internal/models"
+)
+
+// spoolExt расширение файлов пакетов в очереди на диске.
+const spoolExt = ".json"
+
+// batch пакет метрик, принятый сервером в момент At.
+type batch struct {
+	At      time.Time       `json:"at"`
+	Metrics []models.Metric `json:"metrics"`
+}
+
+// spool очередь пакетов на диске, которые не удалось доставить адресату. Каждый пакет хранится
+// в отдельном файле, имя которого — порядковый номер записи, поэтому пакеты доставляются в порядке записи
+// и после перезапуска сервера. Если пакетов больше limit, самые старые удаляются.
+type spool struct {
+	mu    sync.Mutex
+	dir   string
+	limit int
+	seq   uint64
+	files []string
+}
+
+// openSpool открывает очередь в каталоге dir, создавая его при необходимости.
+func openSpool(dir string, limit int) (*spool, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	s := &spool{dir: dir, limit: limit}
+	for _, entry := range entries {
+		if entry.Type().IsRegular() && strings.HasSuffix(entry.Name(), spoolExt) {
+			s.files = append(s.files, entry.Name())
+		}
+	}
+	slices.Sort(s.files)
+	if n := len(s.files); n > 0 {
+		if s.seq, err = strconv.ParseUint(strings.TrimSuffix(s.files[n-1], spoolExt), 10, 64); err != nil {
+			return nil, fmt.Errorf("unexpected spool file %s: %w", s.files[n-1], err)
+		}
+	}
+	return s, nil
+}
+
+// len возвращает количество пакетов в очереди.
+func (s *spool) len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.files)
+}
+
+// push записывает пакет в конец очереди. Возвращает количество вытесненных старых пакетов.
+func (s *spool) push(b batch) (int, error) {
+	data, err := json.Marshal(b)
+	if err != nil {
+		return 0, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.seq++
+	name := fmt.Sprintf("%020d%s", s.seq, spoolExt)
+	tmp := filepath.Join(s.dir, "."+name+".tmp")
+	if err = os.WriteFile(tmp, data, 0o600); err != nil {
+		return 0, err
+	}
+	if err = os.Rename(tmp, filepath.Join(s.dir, name)); err != nil {
+		_ = os.Remove(tmp)
+		return 0, err
+	}
+	s.files = append(s.files, name)
+
+	dropped := 0
+	for len(s.files) > s.limit {
+		_ = os.Remove(filepath.Join(s.dir, s.files[0]))
+		s.files = s.files[1:]
+		dropped++
+	}
+	return dropped, nil
+}
+
+// peek читает первый пакет очереди и возвращает его имя. Поврежденный файл удаляется из очереди с ошибкой.
+func (s *spool) peek() (string, batch, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.files) == 0 {
+		return "", batch{}, nil
+	}
+	name := s.files[0]
+	data, err := os.ReadFile(filepath.Join(s.dir, name))
+	var b batch
+	if err == nil {
+		err = json.Unmarshal(data, &b)
+	}
+	if err != nil {
+		_ = os.Remove(filepath.Join(s.dir, name))
+		s.files = s.files[1:]
+		return "", batch{}, fmt.Errorf("spooled batch %s: %w", name, err)
+	}
+	return name, b, nil
+}
+
+// remove удаляет доставленный пакет name, если он еще не вытеснен из очереди.
+func (s *spool) remove(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.files) == 0 || s.files[0] != name {
+		return nil
+	}
+	s.files = s.files[1:]
+	return os.Remove(filepath.Join(s.dir, name))
+}
@@ -0,0 +1,256 @@
+package grpcserver
+
+import (
+	"context"
+	"crypto/hmac"
+	"encoding/base64"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/invinciblewest/metrics/internal/logger"
+	pb "github.com/invinciblewest/metrics/internal/proto"
+	"github.com/invinciblewest/metrics/internal/signature"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	defaultHashWindow     = 5 * time.Minute // defaultHashWindow допустимое отклонение метки времени подписанного вызова.
+	defaultNonceCacheSize = 100000          // defaultNonceCacheSize максимальное количество запоминаемых nonce.
+)
+
+// HashPolicy задает требования к подписи вызовов, как handlers.WithHashPolicy для HTTP.
+type HashPolicy struct {
+	Strict bool          // Strict требует подписи, метки времени и nonce в вызовах записи.
+	Window time.Duration // Window допустимое отклонение метки времени, нулевое значение означает 5 минут.
+}
+
+// hashGuard проверяет подписи вызовов ключами keys и защищает подписанные вызовы от повторной отправки.
+type hashGuard struct {
+	keys   *signature.Keys
+	guard  *signature.ReplayGuard
+	strict bool
+}
+
+// newHashGuard создает проверку подписи по политике policy. Без ключей проверка отключена.
+func newHashGuard(keys *signature.Keys, policy HashPolicy) *hashGuard {
+	g := &hashGuard{keys: keys}
+	if !keys.Enabled() {
+		return g
+	}
+	if policy.Window <= 0 {
+		policy.Window = defaultHashWindow
+	}
+	g.guard = signature.NewReplayGuard(policy.Window, defaultNonceCacheSize)
+	g.strict = policy.Strict
+	return g
+}
+
+// check проверяет метку времени и nonce подписанного вызова.
+func (g *hashGuard) check(timestamp, nonce string) error {
+	if timestamp == "" && nonce == "" {
+		return nil
+	}
+	if err := g.guard.Check(timestamp, nonce); err != nil {
+		logger.Log.Info("rejected signed call", zap.Error(err))
+		return status.Error(codes.Unauthenticated, err.Error())
+	}
+	return nil
+}
+
+// writeMethod сообщает, записывает ли метод метрики: в строгом режиме такие вызовы должны быть подписаны.
+func writeMethod(method string) bool {
+	return method != pb.Metrics_Get_FullMethodName && method != pb.Metrics_Ping_FullMethodName
+}
+
+// hashUnaryInterceptor создает перехватчик унарных вызовов, проверяющий HMAC-SHA256 запроса из метаданных
+// и добавляющий подпись ответа в заголовок. Ответ подписывается тем же ключом, что и запрос.
+// Метка времени и nonce из метаданных входят в подпись вместе с именем метода и проверяются для защиты
+// от повторной отправки,
+// а в строгом режиме вызовы записи без подписи, метки времени или nonce отклоняются.
+func hashUnaryInterceptor(g *hashGuard) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if !g.keys.Enabled() {
+			return handler(ctx, req)
+		}
+
+		hashKey := g.keys.Primary()
+		md, _ := metadata.FromIncomingContext(ctx)
+		received := firstValue(md, pb.HashMetadataKey)
+		timestamp := firstValue(md, pb.TimestampMetadataKey)
+		nonce := firstValue(md, pb.NonceMetadataKey)
+		if g.strict && writeMethod(info.FullMethod) && (received == "" || timestamp == "" || nonce == "") {
+			logger.Log.Info("unsigned call rejected", zap.String("method", info.FullMethod))
+			return nil, status.Error(codes.Unauthenticated, "missing hash, timestamp or nonce")
+		}
+
+		if received != "" {
+			decoded, err := base64.StdEncoding.DecodeString(received)
+			if err != nil {
+				logger.Log.Info("failed to decode hash", zap.Error(err))
+				return nil, status.Error(codes.InvalidArgument, "invalid hash")
+			}
+			message, ok := req.(proto.Message)
+			if !ok {
+				return nil, status.Error(codes.Internal, "unsupported message")
+			}
+			var matched bool
+			for _, key := range g.keys.Candidates(firstValue(md, pb.KeyIDMetadataKey)) {
+				expected, signErr := pb.SignCall(key, info.FullMethod, timestamp, nonce, message)
+				if signErr != nil {
+					return nil, status.Error(codes.Internal, "failed to compute hash")
+				}
+				if hmac.Equal(expected, decoded) {
+					hashKey, matched = key, true
+					break
+				}
+			}
+			if !matched {
+				logger.Log.Info("hash mismatch", zap.String("method", info.FullMethod))
+				return nil, status.Error(codes.InvalidArgument, "hash mismatch")
+			}
+			if err = g.check(timestamp, nonce); err != nil {
+				return nil, err
+			}
+		}
+
+		resp, err := handler(ctx, req)
+		if err != nil {
+			return resp, err
+		}
+
+		if message, ok := resp.(proto.Message); ok {
+			var hash []byte
+			if hash, err = pb.Sign(hashKey, message); err == nil {
+				err = grpc.SetHeader(ctx, metadata.Pairs(
+					pb.HashMetadataKey, base64.StdEncoding.EncodeToString(hash),
+					pb.KeyIDMetadataKey, signature.KeyID(hashKey),
+				))
+			}
+			if err != nil {
+				logger.Log.Error("failed to sign response", zap.Error(err))
+			}
+		}
+		return resp, nil
+	}
+}
+
+// hashStreamInterceptor создает перехватчик потоковых вызовов, проверяющий подпись каждой части пакета.
+// Если в метаданных потока есть метка времени и nonce, каждая часть должна быть подписана с ними, именем метода
+// и своим номером, а сам поток проверяется на повторную отправку по первой подписанной части. Такой поток должен
+// заканчиваться подписанным завершающим сообщением с количеством сообщений, иначе он считается оборванным.
+// В строгом режиме потоки без метки времени и nonce отклоняются.
+func hashStreamInterceptor(g *hashGuard) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if !g.keys.Enabled() {
+			return handler(srv, ss)
+		}
+		md, _ := metadata.FromIncomingContext(ss.Context())
+		stream := &hashServerStream{
+			ServerStream: ss,
+			guard:        g,
+			keys:         g.keys.Candidates(firstValue(md, pb.KeyIDMetadataKey)),
+			method:       info.FullMethod,
+			timestamp:    firstValue(md, pb.TimestampMetadataKey),
+			nonce:        firstValue(md, pb.NonceMetadataKey),
+		}
+		stream.required = stream.timestamp != "" || stream.nonce != ""
+		if g.strict && writeMethod(info.FullMethod) && (stream.timestamp == "" || stream.nonce == "") {
+			logger.Log.Info("unsigned stream rejected", zap.String("method", info.FullMethod))
+			return status.Error(codes.Unauthenticated, "missing timestamp or nonce")
+		}
+		return handler(srv, stream)
+	}
+}
+
+// hashServerStream проверяет подпись принимаемых частей пакета.
+type hashServerStream struct {
+	grpc.ServerStream
+	guard     *hashGuard
+	keys      []string
+	method    string
+	timestamp string
+	nonce     string
+	required  bool // required требует подписи каждой части и завершающего сообщения: поток подписан меткой времени и nonce.
+	seq       int
+	checked   bool
+}
+
+func (s *hashServerStream) RecvMsg(m any) error {
+	err := s.ServerStream.RecvMsg(m)
+	if errors.Is(err, io.EOF) && s.required {
+		logger.Log.Info("truncated batch stream rejected", zap.Int("parts", s.seq))
+		return status.Error(codes.InvalidArgument, "stream ended without final message")
+	}
+	if err != nil {
+		return err
+	}
+
+	req, ok := m.(*pb.UpdateBatchRequest)
+	if !ok {
+		return nil
+	}
+	seq := s.seq
+	s.seq++
+	if len(req.GetHash()) == 0 {
+		if s.required {
+			logger.Log.Info("unsigned batch part rejected", zap.Int("seq", seq))
+			return status.Error(codes.Unauthenticated, "missing hash")
+		}
+		return nil
+	}
+
+	for _, key := range s.keys {
+		valid, verifyErr := pb.VerifyBatch(key, s.method, s.timestamp, s.nonce, seq, req)
+		if verifyErr != nil {
+			return status.Error(codes.Internal, "failed to compute hash")
+		}
+		if !valid {
+			continue
+		}
+		if !s.checked {
+			s.checked = true
+			if err = s.guard.check(s.timestamp, s.nonce); err != nil {
+				return err
+			}
+		}
+		if req.GetParts() != 0 {
+			return s.finish(seq, req)
+		}
+		return nil
+	}
+	logger.Log.Info("batch hash mismatch", zap.Int("seq", seq))
+	return status.Error(codes.InvalidArgument, "hash mismatch")
+}
+
+// finish проверяет завершающее сообщение потока с порядковым номером seq и сообщает обработчику
+// об окончании пакета. После завершающего сообщения клиент должен закрыть поток.
+func (s *hashServerStream) finish(seq int, req *pb.UpdateBatchRequest) error {
+	if req.GetParts() != int64(seq+1) || len(req.GetMetrics()) != 0 {
+		logger.Log.Info("batch part count mismatch", zap.Int64("parts", req.GetParts()), zap.Int("received", seq+1))
+		return status.Error(codes.InvalidArgument, "part count mismatch")
+	}
+	err := s.ServerStream.RecvMsg(new(pb.UpdateBatchRequest))
+	if err == nil {
+		logger.Log.Info("message after end of batch stream rejected")
+		return status.Error(codes.InvalidArgument, "message after final message")
+	}
+	if !errors.Is(err, io.EOF) {
+		return err
+	}
+	s.required = false
+	return io.EOF
+}
+
+// firstValue возвращает первое значение ключа метаданных или пустую строку.
+func firstValue(md metadata.MD, key string) string {
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
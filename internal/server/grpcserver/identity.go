@@ -0,0 +1,47 @@
+package grpcserver
+
+import (
+	"context"
+
+	"github.com/invinciblewest/metrics/internal/identity"
+	"github.com/invinciblewest/metrics/pkg/tlsconfig"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+// identityUnaryInterceptor сохраняет в контексте вызова идентичность агента из клиентского сертификата.
+func identityUnaryInterceptor(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	return handler(withIdentity(ctx), req)
+}
+
+// identityStreamInterceptor сохраняет в контексте потока идентичность агента из клиентского сертификата.
+func identityStreamInterceptor(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	return handler(srv, &identityServerStream{ServerStream: ss, ctx: withIdentity(ss.Context())})
+}
+
+// identityServerStream подменяет контекст потока.
+type identityServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *identityServerStream) Context() context.Context {
+	return s.ctx
+}
+
+// withIdentity добавляет в контекст идентичность агента, если соединение установлено с клиентским сертификатом.
+func withIdentity(ctx context.Context) context.Context {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ctx
+	}
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok {
+		return ctx
+	}
+	if agent := tlsconfig.Identity(&info.State); agent != "" {
+		return identity.WithAgent(ctx, agent)
+	}
+	return ctx
+}
@@ -0,0 +1,53 @@
+package grpcserver
+
+import (
+	"context"
+	"time"
+
+	"github.com/invinciblewest/metrics/internal/identity"
+	"github.com/invinciblewest/metrics/internal/logger"
+	pb "github.com/invinciblewest/metrics/internal/proto"
+	"github.com/invinciblewest/metrics/internal/ratelimit"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// WithRateLimit возвращает опции сервера, ограничивающие частоту вызовов каждого агента или адреса.
+// Ping не ограничивается. Опции нужно передавать после WithTokens, чтобы агент определялся по токену.
+func WithRateLimit(limiter *ratelimit.Limiter) []grpc.ServerOption {
+	return []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+			if info.FullMethod != pb.Metrics_Ping_FullMethodName {
+				if err := checkRate(ctx, limiter); err != nil {
+					return nil, err
+				}
+			}
+			return handler(ctx, req)
+		}),
+		grpc.ChainStreamInterceptor(func(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			if err := checkRate(ss.Context(), limiter); err != nil {
+				return err
+			}
+			return handler(srv, ss)
+		}),
+	}
+}
+
+// checkRate расходует токен клиента, определенного по идентичности агента или адресу соединения.
+// Метаданным x-real-ip здесь не доверяется: клиент мог бы получать новую квоту в каждом вызове.
+func checkRate(ctx context.Context, limiter *ratelimit.Limiter) error {
+	key, ok := identity.Agent(ctx)
+	if ok {
+		key = "agent:" + key
+	} else {
+		key = "ip:" + peerAddr(ctx)
+	}
+
+	if allowed, retryAfter := limiter.Allow(key); !allowed {
+		logger.Log.Info("rate limit exceeded", zap.String("client", key))
+		return status.Errorf(codes.ResourceExhausted, "rate limit exceeded, retry after %s", retryAfter.Round(time.Millisecond))
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+package grpcserver
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"github.com/invinciblewest/metrics/internal/logger"
+	"github.com/invinciblewest/metrics/internal/models"
+	pb "github.com/invinciblewest/metrics/internal/proto"
+	"github.com/invinciblewest/metrics/internal/server/services"
+	"github.com/invinciblewest/metrics/internal/signature"
+	"github.com/invinciblewest/metrics/internal/storage"
+	"github.com/invinciblewest/metrics/internal/tokens"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	_ "google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Server реализует gRPC-сервис метрик поверх MetricsService.
+type Server struct {
+	pb.UnimplementedMetricsServer
+	service services.MetricsService
+}
+
+// NewServer создает gRPC-сервер с зарегистрированным сервисом метрик и перехватчиками проверки подписи.
+// Для соединений mTLS в контекст вызовов добавляется идентичность агента из клиентского сертификата.
+// Сжатие gzip поддерживается автоматически для клиентов, которые его используют.
+// Подпись проверяется любым активным ключом из keys, значение nil отключает проверку.
+// policy задает строгий режим и окно проверки метки времени подписанных вызовов.
+func NewServer(service services.MetricsService, keys *signature.Keys, policy HashPolicy, opts ...grpc.ServerOption) *grpc.Server {
+	guard := newHashGuard(keys, policy)
+	opts = append([]grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(identityUnaryInterceptor, hashUnaryInterceptor(guard)),
+		grpc.ChainStreamInterceptor(identityStreamInterceptor, hashStreamInterceptor(guard)),
+	}, opts...)
+
+	s := grpc.NewServer(opts...)
+	pb.RegisterMetricsServer(s, &Server{service: service})
+	return s
+}
+
+// Update обновляет одну метрику.
+func (s *Server) Update(ctx context.Context, req *pb.UpdateRequest) (*pb.UpdateResponse, error) {
+	if req.GetMetric() == nil {
+		return nil, status.Error(codes.InvalidArgument, "metric is required")
+	}
+	if req.GetMetric().GetId() == "" {
+		return nil, status.Error(codes.NotFound, "id is empty")
+	}
+
+	metric, err := s.service.Update(ctx, pb.ToModel(req.GetMetric()))
+	if err != nil {
+		if code := updateErrorCode(err); code != codes.Unknown {
+			return nil, status.Error(code, err.Error())
+		}
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	return &pb.UpdateResponse{Metric: pb.FromModel(metric)}, nil
+}
+
+// UpdateBatch принимает поток частей пакета и применяет все метрики одним пакетом.
+// Пакет с ключом идемпотентности в метаданных, уже примененный в пределах окна, повторно не применяется.
+func (s *Server) UpdateBatch(stream grpc.ClientStreamingServer[pb.UpdateBatchRequest, pb.UpdateBatchResponse]) error {
+	metrics := make([]models.Metric, 0)
+	for {
+		req, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		for _, metric := range req.GetMetrics() {
+			metrics = append(metrics, pb.ToModel(metric))
+		}
+	}
+
+	if len(metrics) == 0 {
+		return status.Error(codes.InvalidArgument, "batch is empty")
+	}
+
+	var key string
+	if md, ok := metadata.FromIncomingContext(stream.Context()); ok {
+		if values := md.Get(pb.IdempotencyKeyMetadataKey); len(values) > 0 {
+			key = values[0]
+		}
+	}
+
+	replayed, err := s.service.UpdateBatchOnce(stream.Context(), key, metrics)
+	if err != nil {
+		if code := updateErrorCode(err); code != codes.Unknown {
+			return status.Error(code, err.Error())
+		}
+		logger.Log.Error("failed to update batch", zap.Error(err))
+		return status.Error(codes.Internal, "failed to update batch")
+	}
+	if replayed {
+		logger.Log.Info("repeated batch skipped", zap.String("idempotency_key", key))
+	}
+
+	return stream.SendAndClose(&pb.UpdateBatchResponse{Accepted: int64(len(metrics))})
+}
+
+// updateErrorCode возвращает код ответа для отказа в записи метрик или codes.Unknown для остальных ошибок.
+// Некорректная метрика пакета считается ошибкой клиента.
+func updateErrorCode(err error) codes.Code {
+	var itemErr *services.ItemError
+	switch {
+	case errors.As(err, &itemErr):
+		return codes.InvalidArgument
+	case errors.Is(err, tokens.ErrForbidden):
+		return codes.PermissionDenied
+	case errors.Is(err, services.ErrBatchTooLarge), errors.Is(err, services.ErrMetricsLimit):
+		return codes.ResourceExhausted
+	}
+	return codes.Unknown
+}
+
+// Get возвращает метрику по типу и идентификатору.
+func (s *Server) Get(ctx context.Context, req *pb.GetRequest) (*pb.GetResponse, error) {
+	if req.GetId() == "" {
+		return nil, status.Error(codes.NotFound, "id is empty")
+	}
+
+	metric, err := s.service.Get(ctx, pb.TypeToModel(req.GetType()), req.GetId())
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) || errors.Is(err, storage.ErrWrongType) {
+			return nil, status.Error(codes.NotFound, err.Error())
+		}
+		logger.Log.Error("failed to get metric", zap.Error(err))
+		return nil, status.Error(codes.Internal, "failed to get metric")
+	}
+
+	return &pb.GetResponse{Metric: pb.FromModel(metric)}, nil
+}
+
+// Ping проверяет доступность хранилища.
+func (s *Server) Ping(ctx context.Context, _ *pb.PingRequest) (*pb.PingResponse, error) {
+	if !s.service.PingStorage(ctx) {
+		return nil, status.Error(codes.Unavailable, "storage is unavailable")
+	}
+	return &pb.PingResponse{}, nil
+}
@@ -0,0 +1,355 @@
+package grpcserver
+
+import (
+	"context"
+	"encoding/base64"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/invinciblewest/metrics/internal/agent/senders"
+	"github.com/invinciblewest/metrics/internal/models"
+	pb "github.com/invinciblewest/metrics/internal/proto"
+	"github.com/invinciblewest/metrics/internal/ratelimit"
+	"github.com/invinciblewest/metrics/internal/server/services"
+	"github.com/invinciblewest/metrics/internal/signature"
+	"github.com/invinciblewest/metrics/internal/storage/memstorage"
+	"github.com/invinciblewest/metrics/internal/tokens"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestServer(t *testing.T) {
+	ctx := context.TODO()
+	st := memstorage.NewMemStorage("", false)
+	dialer := startServer(t, st, "secret")
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(dialer),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	defer conn.Close()
+	client := pb.NewMetricsClient(conn)
+
+	t.Run("update", func(t *testing.T) {
+		value := 3.14
+		var header metadata.MD
+		resp, err := client.Update(ctx, &pb.UpdateRequest{
+			Metric: &pb.Metric{Id: "test", Type: pb.Metric_GAUGE, Value: &value},
+		}, grpc.Header(&header))
+		require.NoError(t, err)
+		assert.Equal(t, value, resp.GetMetric().GetValue())
+		assert.NotEmpty(t, header.Get(pb.HashMetadataKey))
+	})
+	t.Run("update without value", func(t *testing.T) {
+		_, err := client.Update(ctx, &pb.UpdateRequest{
+			Metric: &pb.Metric{Id: "test", Type: pb.Metric_GAUGE},
+		})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+	t.Run("update with wrong hash", func(t *testing.T) {
+		value := 1.0
+		mdCtx := metadata.AppendToOutgoingContext(ctx, pb.HashMetadataKey, "d3Jvbmc=")
+		_, err := client.Update(mdCtx, &pb.UpdateRequest{
+			Metric: &pb.Metric{Id: "test", Type: pb.Metric_GAUGE, Value: &value},
+		})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+	t.Run("get", func(t *testing.T) {
+		resp, err := client.Get(ctx, &pb.GetRequest{Id: "test", Type: pb.Metric_GAUGE})
+		require.NoError(t, err)
+		assert.Equal(t, 3.14, resp.GetMetric().GetValue())
+	})
+	t.Run("get not found", func(t *testing.T) {
+		_, err := client.Get(ctx, &pb.GetRequest{Id: "unknown", Type: pb.Metric_COUNTER})
+		assert.Equal(t, codes.NotFound, status.Code(err))
+	})
+	t.Run("ping", func(t *testing.T) {
+		_, err := client.Ping(ctx, &pb.PingRequest{})
+		assert.NoError(t, err)
+	})
+}
+
+func TestServer_UpdateBatch(t *testing.T) {
+	ctx := context.TODO()
+	st := memstorage.NewMemStorage("", false)
+	dialer := startServer(t, st, "secret")
+
+	metrics := make([]models.Metric, 0, 250)
+	for i := 0; i < 250; i++ {
+		delta := int64(1)
+		metrics = append(metrics, models.Metric{ID: "PollCount", MType: models.TypeCounter, Delta: &delta})
+	}
+
+	t.Run("signed", func(t *testing.T) {
+		sender, err := senders.NewGRPCSender("passthrough:///bufnet", "secret", grpc.WithContextDialer(dialer))
+		require.NoError(t, err)
+		defer sender.Close()
+
+		require.NoError(t, sender.SendMetric(ctx, metrics))
+		counter, err := st.GetCounter(ctx, "PollCount")
+		require.NoError(t, err)
+		assert.Equal(t, int64(250), *counter.Delta)
+	})
+	t.Run("wrong key", func(t *testing.T) {
+		sender, err := senders.NewGRPCSender("passthrough:///bufnet", "wrong", grpc.WithContextDialer(dialer))
+		require.NoError(t, err)
+		defer sender.Close()
+
+		err = sender.SendMetric(ctx, metrics)
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+	t.Run("empty", func(t *testing.T) {
+		sender, err := senders.NewGRPCSender("passthrough:///bufnet", "secret", grpc.WithContextDialer(dialer))
+		require.NoError(t, err)
+		defer sender.Close()
+
+		err = sender.SendMetric(ctx, nil)
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+}
+
+func TestServer_TrustedSubnet(t *testing.T) {
+	ctx := context.TODO()
+	_, write, err := net.ParseCIDR("192.168.1.0/24")
+	require.NoError(t, err)
+
+	dialer := startServer(t, memstorage.NewMemStorage("", false), "", WithTrustedSubnet(write, nil)...)
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(dialer),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	defer conn.Close()
+	client := pb.NewMetricsClient(conn)
+
+	value := 1.0
+	req := &pb.UpdateRequest{Metric: &pb.Metric{Id: "test", Type: pb.Metric_GAUGE, Value: &value}}
+
+	t.Run("trusted", func(t *testing.T) {
+		mdCtx := metadata.AppendToOutgoingContext(ctx, realIPMetadataKey, "192.168.1.5")
+		_, err := client.Update(mdCtx, req)
+		assert.NoError(t, err)
+	})
+	t.Run("untrusted", func(t *testing.T) {
+		mdCtx := metadata.AppendToOutgoingContext(ctx, realIPMetadataKey, "10.0.0.1")
+		_, err := client.Update(mdCtx, req)
+		assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	})
+	t.Run("connection address", func(t *testing.T) {
+		stream, err := client.UpdateBatch(ctx)
+		require.NoError(t, err)
+		_, err = stream.CloseAndRecv()
+		assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	})
+	t.Run("read is not restricted", func(t *testing.T) {
+		_, err := client.Ping(ctx, &pb.PingRequest{})
+		assert.NoError(t, err)
+	})
+}
+
+func startServer(t *testing.T, st *memstorage.MemStorage, hashKey string, opts ...grpc.ServerOption) func(context.Context, string) (net.Conn, error) {
+	return startServerWithPolicy(t, st, hashKey, HashPolicy{}, opts...)
+}
+
+func startServerWithPolicy(
+	t *testing.T, st *memstorage.MemStorage, hashKey string, policy HashPolicy, opts ...grpc.ServerOption,
+) func(context.Context, string) (net.Conn, error) {
+	listener := bufconn.Listen(1024 * 1024)
+	server := NewServer(services.NewMetricsService(st), signature.NewKeys(hashKey), policy, opts...)
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	t.Cleanup(server.Stop)
+
+	return func(ctx context.Context, _ string) (net.Conn, error) {
+		return listener.DialContext(ctx)
+	}
+}
+
+func TestServer_Tokens(t *testing.T) {
+	ctx := context.TODO()
+	store, err := tokens.NewFileStore(filepath.Join(t.TempDir(), "tokens.json"))
+	require.NoError(t, err)
+	secret, _, err := tokens.Issue(ctx, store, "host1", []string{"host1."}, false)
+	require.NoError(t, err)
+
+	dialer := startServer(t, memstorage.NewMemStorage("", false), "", WithTokens(store)...)
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(dialer),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	defer conn.Close()
+	client := pb.NewMetricsClient(conn)
+
+	value := 1.0
+	update := func(id string) error {
+		mdCtx := metadata.AppendToOutgoingContext(ctx, authorizationMetadataKey, "Bearer "+secret)
+		_, updateErr := client.Update(mdCtx, &pb.UpdateRequest{Metric: &pb.Metric{Id: id, Type: pb.Metric_GAUGE, Value: &value}})
+		return updateErr
+	}
+
+	assert.NoError(t, update("host1.cpu"))
+	assert.Equal(t, codes.PermissionDenied, status.Code(update("host2.cpu")))
+
+	_, err = client.Update(ctx, &pb.UpdateRequest{Metric: &pb.Metric{Id: "host1.cpu", Type: pb.Metric_GAUGE, Value: &value}})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	mdCtx := metadata.AppendToOutgoingContext(ctx, authorizationMetadataKey, "Bearer "+secret)
+	_, err = client.Get(mdCtx, &pb.GetRequest{Id: "host1.cpu", Type: pb.Metric_GAUGE})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	sender, err := senders.NewGRPCSender("passthrough:///bufnet", "", grpc.WithContextDialer(dialer), senders.WithToken(secret))
+	require.NoError(t, err)
+	defer sender.Close()
+	assert.NoError(t, sender.SendMetric(ctx, []models.Metric{{ID: "host1.mem", MType: models.TypeGauge, Value: &value}}))
+	err = sender.SendMetric(ctx, []models.Metric{{ID: "host2.mem", MType: models.TypeGauge, Value: &value}})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
+
+func TestServer_RateLimit(t *testing.T) {
+	ctx := context.TODO()
+	dialer := startServer(t, memstorage.NewMemStorage("", false), "", WithRateLimit(ratelimit.NewLimiter(0.1, 1))...)
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(dialer),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	defer conn.Close()
+	client := pb.NewMetricsClient(conn)
+
+	value := 1.0
+	req := &pb.UpdateRequest{Metric: &pb.Metric{Id: "test", Type: pb.Metric_GAUGE, Value: &value}}
+	_, err = client.Update(ctx, req)
+	assert.NoError(t, err)
+	_, err = client.Update(ctx, req)
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	_, err = client.Ping(ctx, &pb.PingRequest{})
+	assert.NoError(t, err)
+}
+
+func TestServer_Strict(t *testing.T) {
+	ctx := context.TODO()
+	st := memstorage.NewMemStorage("", false)
+	dialer := startServerWithPolicy(t, st, "secret", HashPolicy{Strict: true, Window: time.Minute})
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(dialer),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	defer conn.Close()
+	client := pb.NewMetricsClient(conn)
+
+	value := 1.0
+	req := &pb.UpdateRequest{Metric: &pb.Metric{Id: "test", Type: pb.Metric_GAUGE, Value: &value}}
+	// signedAs подписывает запрос для метода method с nonce signedNonce, а передает в метаданных nonce.
+	signedAs := func(method, timestamp, signedNonce, nonce string) context.Context {
+		hash, signErr := pb.SignCall("secret", method, timestamp, signedNonce, req)
+		require.NoError(t, signErr)
+		return metadata.AppendToOutgoingContext(ctx,
+			pb.HashMetadataKey, base64.StdEncoding.EncodeToString(hash),
+			pb.TimestampMetadataKey, timestamp,
+			pb.NonceMetadataKey, nonce,
+		)
+	}
+	signed := func(timestamp, nonce string) context.Context {
+		return signedAs(pb.Metrics_Update_FullMethodName, timestamp, nonce, nonce)
+	}
+	timestamp := signature.Timestamp(time.Now())
+
+	t.Run("unary", func(t *testing.T) {
+		tests := []struct {
+			name string
+			ctx  context.Context
+			code codes.Code
+		}{
+			{name: "unsigned", ctx: ctx, code: codes.Unauthenticated},
+			{name: "without nonce", ctx: signed("", ""), code: codes.Unauthenticated},
+			{name: "signed", ctx: signed(timestamp, "n1"), code: codes.OK},
+			{name: "replayed", ctx: signed(timestamp, "n1"), code: codes.Unauthenticated},
+			{name: "stale", ctx: signed(signature.Timestamp(time.Now().Add(-time.Hour)), "n2"), code: codes.Unauthenticated},
+			{name: "nonce not signed", ctx: signedAs(pb.Metrics_Update_FullMethodName, timestamp, "n3", "n4"), code: codes.InvalidArgument},
+			{name: "signed for another method", ctx: signedAs(pb.Metrics_Get_FullMethodName, timestamp, "n5", "n5"), code: codes.InvalidArgument},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				_, err := client.Update(tt.ctx, req)
+				assert.Equal(t, tt.code, status.Code(err))
+			})
+		}
+	})
+
+	t.Run("read is not restricted", func(t *testing.T) {
+		_, err := client.Get(ctx, &pb.GetRequest{Id: "test", Type: pb.Metric_GAUGE})
+		assert.NoError(t, err)
+	})
+
+	t.Run("sender", func(t *testing.T) {
+		sender, err := senders.NewGRPCSender("passthrough:///bufnet", "secret", grpc.WithContextDialer(dialer))
+		require.NoError(t, err)
+		defer sender.Close()
+		delta := int64(1)
+		require.NoError(t, sender.SendMetric(ctx, []models.Metric{{ID: "PollCount", MType: models.TypeCounter, Delta: &delta}}))
+	})
+
+	// send отправляет части пакета, подписанные с указанными номерами, в потоке с меткой времени и nonce.
+	// Если parts не равно нулю, поток завершается сообщением с этим количеством сообщений.
+	send := func(nonce string, parts int64, seqs ...int) error {
+		streamCtx := ctx
+		if nonce != "" {
+			streamCtx = metadata.AppendToOutgoingContext(ctx, pb.TimestampMetadataKey, timestamp, pb.NonceMetadataKey, nonce)
+		}
+		stream, err := client.UpdateBatch(streamCtx)
+		require.NoError(t, err)
+		for _, seq := range seqs {
+			delta := int64(1)
+			part := &pb.UpdateBatchRequest{Metrics: []*pb.Metric{{Id: "Parts", Type: pb.Metric_COUNTER, Delta: &delta}}}
+			require.NoError(t, pb.SignBatch("secret", pb.Metrics_UpdateBatch_FullMethodName, timestamp, nonce, seq, part))
+			if err = stream.Send(part); err != nil {
+				break
+			}
+		}
+		if err == nil && parts != 0 {
+			final := &pb.UpdateBatchRequest{Parts: parts}
+			require.NoError(t, pb.SignBatch("secret", pb.Metrics_UpdateBatch_FullMethodName, timestamp, nonce, len(seqs), final))
+			_ = stream.Send(final)
+		}
+		_, err = stream.CloseAndRecv()
+		return err
+	}
+
+	t.Run("stream", func(t *testing.T) {
+		tests := []struct {
+			name  string
+			nonce string
+			parts int64
+			seqs  []int
+			code  codes.Code
+		}{
+			{name: "without nonce", seqs: []int{0}, code: codes.Unauthenticated},
+			{name: "in order", nonce: "s1", parts: 3, seqs: []int{0, 1}, code: codes.OK},
+			{name: "replayed", nonce: "s1", parts: 3, seqs: []int{0, 1}, code: codes.Unauthenticated},
+			{name: "reordered", nonce: "s2", parts: 3, seqs: []int{1, 0}, code: codes.InvalidArgument},
+			{name: "repeated part", nonce: "s3", parts: 3, seqs: []int{0, 0}, code: codes.InvalidArgument},
+			{name: "truncated", nonce: "s4", seqs: []int{0, 1}, code: codes.InvalidArgument},
+			{name: "part count mismatch", nonce: "s5", parts: 2, seqs: []int{0, 1}, code: codes.InvalidArgument},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				assert.Equal(t, tt.code, status.Code(send(tt.nonce, tt.parts, tt.seqs...)))
+			})
+		}
+		counter, err := st.GetCounter(ctx, "Parts")
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), *counter.Delta)
+	})
+}
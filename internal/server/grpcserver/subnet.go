@@ -0,0 +1,80 @@
+package grpcserver
+
+import (
+	"context"
+	"net"
+
+	"github.com/invinciblewest/metrics/internal/logger"
+	pb "github.com/invinciblewest/metrics/internal/proto"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// realIPMetadataKey ключ метаданных с адресом клиента.
+const realIPMetadataKey = "x-real-ip"
+
+// WithTrustedSubnet возвращает опции сервера, ограничивающие вызовы записи метрик подсетью write,
+// а вызовы чтения (Get, Ping) — подсетью read. Значение nil снимает ограничение.
+func WithTrustedSubnet(write, read *net.IPNet) []grpc.ServerOption {
+	return []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+			if err := checkSubnet(ctx, subnetFor(info.FullMethod, write, read)); err != nil {
+				return nil, err
+			}
+			return handler(ctx, req)
+		}),
+		grpc.ChainStreamInterceptor(func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			if err := checkSubnet(ss.Context(), subnetFor(info.FullMethod, write, read)); err != nil {
+				return err
+			}
+			return handler(srv, ss)
+		}),
+	}
+}
+
+// subnetFor выбирает подсеть, которой ограничен метод.
+func subnetFor(method string, write, read *net.IPNet) *net.IPNet {
+	switch method {
+	case pb.Metrics_Update_FullMethodName, pb.Metrics_UpdateBatch_FullMethodName:
+		return write
+	}
+	return read
+}
+
+// checkSubnet проверяет, что адрес клиента из метаданных x-real-ip или адрес соединения входит в подсеть.
+func checkSubnet(ctx context.Context, subnet *net.IPNet) error {
+	if subnet == nil {
+		return nil
+	}
+
+	addr := clientAddr(ctx)
+	ip := net.ParseIP(addr)
+	if ip == nil || !subnet.Contains(ip) {
+		logger.Log.Info("request from untrusted address", zap.String("ip", addr))
+		return status.Error(codes.PermissionDenied, "untrusted address")
+	}
+	return nil
+}
+
+// clientAddr возвращает адрес клиента из метаданных x-real-ip, а при их отсутствии — адрес соединения.
+func clientAddr(ctx context.Context) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if values := md.Get(realIPMetadataKey); len(values) > 0 {
+		return values[0]
+	}
+	return peerAddr(ctx)
+}
+
+// peerAddr возвращает адрес соединения клиента.
+func peerAddr(ctx context.Context) string {
+	if p, ok := peer.FromContext(ctx); ok {
+		if host, _, err := net.SplitHostPort(p.Addr.String()); err == nil {
+			return host
+		}
+	}
+	return ""
+}
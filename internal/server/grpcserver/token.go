@@ -0,0 +1,69 @@
+package grpcserver
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/invinciblewest/metrics/internal/identity"
+	"github.com/invinciblewest/metrics/internal/logger"
+	pb "github.com/invinciblewest/metrics/internal/proto"
+	"github.com/invinciblewest/metrics/internal/tokens"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// authorizationMetadataKey ключ метаданных с токеном агента.
+const authorizationMetadataKey = "authorization"
+
+// WithTokens возвращает опции сервера, требующие токен агента из store в метаданных authorization.
+// Вызовы чтения (Get) дополнительно требуют права чтения, ограничения на имена метрик проверяет сервис.
+func WithTokens(store tokens.Store) []grpc.ServerOption {
+	return []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+			if info.FullMethod == pb.Metrics_Ping_FullMethodName {
+				return handler(ctx, req)
+			}
+			ctx, err := authenticate(ctx, store, info.FullMethod == pb.Metrics_Get_FullMethodName)
+			if err != nil {
+				return nil, err
+			}
+			return handler(ctx, req)
+		}),
+		grpc.ChainStreamInterceptor(func(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			ctx, err := authenticate(ss.Context(), store, false)
+			if err != nil {
+				return err
+			}
+			return handler(srv, &identityServerStream{ServerStream: ss, ctx: ctx})
+		}),
+	}
+}
+
+// authenticate проверяет токен из метаданных и добавляет его и имя агента в контекст.
+func authenticate(ctx context.Context, store tokens.Store, read bool) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	secret, _ := strings.CutPrefix(firstValue(md, authorizationMetadataKey), "Bearer ")
+	token, err := tokens.Authenticate(ctx, store, secret)
+	if err != nil {
+		if errors.Is(err, tokens.ErrInvalidToken) {
+			logger.Log.Info("request with invalid token rejected")
+			return ctx, status.Error(codes.Unauthenticated, "invalid token")
+		}
+		logger.Log.Error("failed to look up token", zap.Error(err))
+		return ctx, status.Error(codes.Internal, "failed to look up token")
+	}
+	if read && !token.Read {
+		logger.Log.Info("token without read scope rejected", zap.String("agent", token.Agent))
+		return ctx, status.Error(codes.PermissionDenied, "token does not allow reading")
+	}
+
+	ctx = tokens.WithToken(ctx, token)
+	if _, ok := identity.Agent(ctx); !ok {
+		ctx = identity.WithAgent(ctx, token.Agent)
+	}
+	return ctx, nil
+}
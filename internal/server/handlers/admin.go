@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/invinciblewest/metrics/internal/backup"
+	"github.com/invinciblewest/metrics/internal/logger"
+	"github.com/invinciblewest/metrics/internal/server/services"
+	"github.com/invinciblewest/metrics/pkg/encryption"
+	"go.uber.org/zap"
+)
+
+// AdminHandler представляет собой обработчик административных HTTP-запросов.
+type AdminHandler struct {
+	service services.MetricsService
+	keyring *encryption.Keyring
+}
+
+// NewAdminHandler создает новый экземпляр AdminHandler.
+// Если задан keyring, резервные копии шифруются его основным ключом и расшифровываются любым из его ключей.
+func NewAdminHandler(service services.MetricsService, keyring *encryption.Keyring) *AdminHandler {
+	return &AdminHandler{
+		service: service,
+		keyring: keyring,
+	}
+}
+
+// Backup возвращает архив с согласованным снимком состояния хранилища.
+func (h *AdminHandler) Backup(w http.ResponseWriter, r *http.Request) {
+	archive, err := h.service.Backup(r.Context())
+	if err != nil {
+		logger.Log.Error("failed to create backup", zap.Error(err))
+		writeError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	var buf bytes.Buffer
+	if err = backup.Write(&buf, archive, h.keyring.Primary()); err != nil {
+		logger.Log.Error("failed to write backup", zap.Error(err))
+		writeError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	filename := fmt.Sprintf("metrics-%s.bak", archive.CreatedAt.Format("20060102T150405Z"))
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.WriteHeader(http.StatusOK)
+	if _, err = w.Write(buf.Bytes()); err != nil {
+		logger.Log.Error("failed to send backup", zap.Error(err))
+	}
+}
+
+// Restore восстанавливает состояние хранилища из архива, переданного в теле запроса.
+// Режим восстановления задается параметром mode (replace или merge, по умолчанию replace).
+func (h *AdminHandler) Restore(w http.ResponseWriter, r *http.Request) {
+	mode := backup.Mode(r.URL.Query().Get("mode"))
+	if mode == "" {
+		mode = backup.ModeReplace
+	}
+	if mode != backup.ModeReplace && mode != backup.ModeMerge {
+		writeError(w, r, http.StatusBadRequest, backup.ErrUnknownMode)
+		return
+	}
+
+	archive, err := backup.Read(r.Body, h.keyring)
+	if err != nil {
+		logger.Log.Info("failed to read backup", zap.Error(err))
+		writeError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	if err = h.service.Restore(r.Context(), archive, mode); err != nil {
+		logger.Log.Error("failed to restore backup", zap.Error(err))
+		writeError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	logger.Log.Info("backup restored",
+		zap.String("mode", string(mode)),
+		zap.Int("metrics", len(archive.Metrics)),
+		zap.Time("created_at", archive.CreatedAt),
+		zap.Duration("age", time.Since(archive.CreatedAt)),
+	)
+	w.WriteHeader(http.StatusOK)
+}
+
+// adminAuthMiddleware создает middleware, пропускающий только запросы с заданным токеном в заголовке Authorization.
+func adminAuthMiddleware(token string) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			received, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || subtle.ConstantTimeCompare([]byte(received), []byte(token)) != 1 {
+				writeAPIError(w, r, http.StatusUnauthorized, APIError{Code: CodeUnauthorized, Message: "invalid admin token"})
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/invinciblewest/metrics/internal/models"
+	"github.com/invinciblewest/metrics/internal/server/services"
+	"github.com/invinciblewest/metrics/internal/storage/memstorage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdminHandler_BackupRestore(t *testing.T) {
+	ctx := context.TODO()
+	st := memstorage.NewMemStorage("", false)
+	value := 3.14
+	require.NoError(t, st.UpdateGauge(ctx, models.Metric{ID: "test", MType: models.TypeGauge, Value: &value}))
+
+	service := services.NewMetricsService(st)
+	router := GetRouter(NewHandler(service), nil, nil, WithAdmin(NewAdminHandler(service, nil), "secret"))
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	t.Run("unauthorized", func(t *testing.T) {
+		resp, err := resty.New().R().SetAuthToken("wrong").Get(server.URL + "/admin/backup")
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode())
+	})
+
+	var archive []byte
+	t.Run("backup", func(t *testing.T) {
+		resp, err := resty.New().R().SetAuthToken("secret").Get(server.URL + "/admin/backup")
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode())
+		archive = resp.Body()
+	})
+
+	other := 1.0
+	require.NoError(t, st.UpdateGauge(ctx, models.Metric{ID: "other", MType: models.TypeGauge, Value: &other}))
+
+	t.Run("restore bad mode", func(t *testing.T) {
+		resp, err := resty.New().R().SetAuthToken("secret").SetBody(archive).
+			Post(server.URL + "/admin/restore?mode=unknown")
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode())
+	})
+	t.Run("restore bad archive", func(t *testing.T) {
+		resp, err := resty.New().R().SetAuthToken("secret").SetBody([]byte("garbage")).
+			Post(server.URL + "/admin/restore")
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode())
+	})
+	t.Run("restore", func(t *testing.T) {
+		resp, err := resty.New().R().SetAuthToken("secret").SetBody(archive).
+			Post(server.URL + "/admin/restore?mode=replace")
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode())
+
+		_, err = st.GetGauge(ctx, "other")
+		assert.Error(t, err)
+		_, err = st.GetGauge(ctx, "test")
+		assert.NoError(t, err)
+	})
+}
+
+func TestGetRouter_AdminDisabled(t *testing.T) {
+	st := memstorage.NewMemStorage("", false)
+	server := httptest.NewServer(newRouter(st))
+	defer server.Close()
+
+	resp, err := resty.New().R().SetAuthToken("secret").Get(server.URL + "/admin/backup")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode())
+}
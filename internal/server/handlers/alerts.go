@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+
+	"github.com/invinciblewest/metrics/internal/logger"
+	"github.com/invinciblewest/metrics/internal/server/alerting"
+	"go.uber.org/zap"
+)
+
+// AlertsHandler представляет собой обработчик HTTP-запросов к состоянию оповещений.
+type AlertsHandler struct {
+	engine *alerting.Engine
+}
+
+// NewAlertsHandler создает новый экземпляр AlertsHandler для правил engine.
+func NewAlertsHandler(engine *alerting.Engine) *AlertsHandler {
+	return &AlertsHandler{
+		engine: engine,
+	}
+}
+
+// List возвращает текущее состояние оповещений всех правил.
+// Параметр state (inactive, pending, firing, resolved) оставляет только оповещения в этом состоянии.
+func (h *AlertsHandler) List(w http.ResponseWriter, r *http.Request) {
+	state := alerting.State(r.URL.Query().Get("state"))
+	alerts := make([]alerting.Alert, 0)
+	for _, alert := range h.engine.Alerts() {
+		if state == "" || alert.State == state {
+			alerts = append(alerts, alert)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(alerts); err != nil {
+		writeError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		logger.Log.Error("failed to write response", zap.Error(err))
+	}
+}
@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/invinciblewest/metrics/internal/models"
+	"github.com/invinciblewest/metrics/internal/server/alerting"
+	"github.com/invinciblewest/metrics/internal/server/services"
+	"github.com/invinciblewest/metrics/internal/storage/memstorage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAlertsHandler_List(t *testing.T) {
+	service := services.NewMetricsService(memstorage.NewMemStorage("", false))
+	value := 100e6
+	_, err := service.Update(context.TODO(), models.Metric{ID: "FreeMemory", MType: models.TypeGauge, Value: &value})
+	require.NoError(t, err)
+
+	rules, err := alerting.ParseRules([]byte(`{"rules":[
+		{"name":"low-memory","metric":"FreeMemory","type":"gauge","op":"<","threshold":"500MB"},
+		{"name":"high-memory","metric":"FreeMemory","type":"gauge","op":">","threshold":"500MB"}
+	]}`))
+	require.NoError(t, err)
+	engine := alerting.NewEngine(&service, rules)
+	engine.Evaluate(context.TODO())
+
+	server := httptest.NewServer(GetRouter(NewHandler(service), nil, nil, WithAlerts(NewAlertsHandler(engine))))
+	defer server.Close()
+
+	resp, err := resty.New().R().Get(server.URL + "/alerts")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode())
+	var alerts []alerting.Alert
+	require.NoError(t, json.Unmarshal(resp.Body(), &alerts))
+	require.Len(t, alerts, 2)
+	assert.Equal(t, alerting.StateFiring, alerts[0].State)
+	assert.Equal(t, "gauge FreeMemory < 5e+08", alerts[0].Description)
+	assert.Equal(t, alerting.StateInactive, alerts[1].State)
+
+	resp, err = resty.New().R().Get(server.URL + "/alerts?state=inactive")
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(resp.Body(), &alerts))
+	require.Len(t, alerts, 1)
+	assert.Equal(t, "high-memory", alerts[0].Rule)
+
+	noAlerts := httptest.NewServer(GetRouter(NewHandler(service), nil, nil))
+	defer noAlerts.Close()
+	resp, err = resty.New().R().Get(noAlerts.URL + "/alerts")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode())
+}
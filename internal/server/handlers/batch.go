@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+
+	"github.com/invinciblewest/metrics/internal/logger"
+	"github.com/invinciblewest/metrics/internal/models"
+	"go.uber.org/zap"
+)
+
+// Статусы метрик в отчете о записи пакета.
+const (
+	ItemAccepted = "accepted" // ItemAccepted метрика записана.
+	ItemRejected = "rejected" // ItemRejected метрика отклонена.
+)
+
+// BatchItemReport описывает результат записи одной метрики пакета.
+type BatchItemReport struct {
+	Index  int       `json:"index"`           // Index позиция метрики в пакете.
+	ID     string    `json:"id"`              // ID идентификатор метрики.
+	MType  string    `json:"type"`            // MType тип метрики.
+	Status string    `json:"status"`          // Status accepted или rejected.
+	Error  *APIError `json:"error,omitempty"` // Error причина отказа для отклоненной метрики.
+}
+
+// BatchReportResponse отчет о записи пакета в режиме частичного применения.
+type BatchReportResponse struct {
+	Accepted int               `json:"accepted"` // Accepted количество записанных метрик.
+	Rejected int               `json:"rejected"` // Rejected количество отклоненных метрик.
+	Items    []BatchItemReport `json:"items"`    // Items результаты в порядке метрик пакета.
+}
+
+// updateMetricsBatchPartial записывает корректные метрики пакета и отвечает отчетом по каждой метрике:
+// 200, если приняты все метрики, и 207, если часть метрик отклонена.
+func (h *Handler) updateMetricsBatchPartial(w http.ResponseWriter, r *http.Request, metrics []models.Metric) {
+	report, err := h.service.UpdateBatchPartial(r.Context(), metrics)
+	if err != nil {
+		logger.Log.Error("failed to update batch", zap.Error(err))
+		writeError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	response := BatchReportResponse{
+		Accepted: report.Accepted,
+		Rejected: report.Rejected,
+		Items:    make([]BatchItemReport, 0, len(report.Items)),
+	}
+	for _, item := range report.Items {
+		itemReport := BatchItemReport{
+			Index:  item.Index,
+			ID:     item.Metric.ID,
+			MType:  item.Metric.MType,
+			Status: ItemAccepted,
+		}
+		if item.Err != nil {
+			apiErr := describeError(item.Err, http.StatusBadRequest)
+			itemReport.Status = ItemRejected
+			itemReport.Error = &apiErr
+		}
+		response.Items = append(response.Items, itemReport)
+	}
+
+	var buf bytes.Buffer
+	if err = json.NewEncoder(&buf).Encode(response); err != nil {
+		writeError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	status := http.StatusOK
+	if report.Rejected > 0 {
+		status = http.StatusMultiStatus
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if _, err = w.Write(buf.Bytes()); err != nil {
+		logger.Log.Error("failed to write response", zap.Error(err))
+	}
+}
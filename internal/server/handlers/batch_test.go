@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/invinciblewest/metrics/internal/server/services"
+	"github.com/invinciblewest/metrics/internal/storage"
+	"github.com/invinciblewest/metrics/internal/storage/memstorage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdateMetricsBatch_Partial(t *testing.T) {
+	st := memstorage.NewMemStorage("", false)
+	server := httptest.NewServer(GetRouter(NewHandler(services.NewMetricsService(st)), nil, nil))
+	defer server.Close()
+
+	body := `[{"id":"a","type":"gauge","value":1},{"id":"b","type":"unknown","value":1},{"id":"c","type":"counter"}]`
+
+	t.Run("atomic", func(t *testing.T) {
+		resp, err := resty.New().R().
+			SetHeader("Content-Type", "application/json").
+			SetBody(body).
+			Post(server.URL + "/updates/")
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode())
+
+		var response ErrorResponse
+		require.NoError(t, json.Unmarshal(resp.Body(), &response))
+		assert.Equal(t, CodeWrongType, response.Error.Code)
+		assert.Equal(t, "[1].type", response.Error.Field)
+
+		metrics, err := storage.Collect(st.List(context.TODO()))
+		require.NoError(t, err)
+		assert.Empty(t, metrics)
+	})
+	t.Run("partial", func(t *testing.T) {
+		resp, err := resty.New().R().
+			SetHeader("Content-Type", "application/json").
+			SetBody(body).
+			Post(server.URL + "/updates/?partial=true")
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusMultiStatus, resp.StatusCode())
+
+		var report BatchReportResponse
+		require.NoError(t, json.Unmarshal(resp.Body(), &report))
+		assert.Equal(t, 1, report.Accepted)
+		assert.Equal(t, 2, report.Rejected)
+		require.Len(t, report.Items, 3)
+		assert.Equal(t, BatchItemReport{Index: 0, ID: "a", MType: "gauge", Status: ItemAccepted}, report.Items[0])
+		assert.Equal(t, BatchItemReport{
+			Index:  1,
+			ID:     "b",
+			MType:  "unknown",
+			Status: ItemRejected,
+			Error:  &APIError{Code: CodeWrongType, Message: "unknown metric type", Field: "type"},
+		}, report.Items[1])
+		assert.Equal(t, &APIError{Code: CodeMissingField, Message: "delta is nil", Field: "delta"}, report.Items[2].Error)
+
+		_, err = st.GetGauge(context.TODO(), "a")
+		assert.NoError(t, err)
+	})
+	t.Run("partial all accepted", func(t *testing.T) {
+		resp, err := resty.New().R().
+			SetHeader("Content-Type", "application/json").
+			SetBody(`[{"id":"d","type":"gauge","value":1}]`).
+			Post(server.URL + "/updates/?partial=true")
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode())
+		assert.JSONEq(t, `{"accepted":1,"rejected":0,"items":[{"index":0,"id":"d","type":"gauge","status":"accepted"}]}`, resp.String())
+	})
+}
+
+func TestUpdateMetricsBatch_IdempotencyKey(t *testing.T) {
+	st := memstorage.NewMemStorage("", false)
+	service := services.NewMetricsService(st, services.WithIdempotencyWindow(time.Minute))
+	server := httptest.NewServer(GetRouter(NewHandler(service), nil, nil))
+	defer server.Close()
+
+	send := func(path string) *resty.Response {
+		resp, err := resty.New().R().
+			SetHeader("Content-Type", "application/json").
+			SetHeader(HeaderIdempotencyKey, "report-1").
+			SetBody(`[{"id":"PollCount","type":"counter","delta":2}]`).
+			Post(server.URL + path)
+		require.NoError(t, err)
+		return resp
+	}
+
+	resp := send("/updates/")
+	assert.Equal(t, http.StatusOK, resp.StatusCode())
+	assert.Empty(t, resp.Header().Get(HeaderIdempotentReplayed))
+
+	resp = send("/updates/")
+	assert.Equal(t, http.StatusOK, resp.StatusCode())
+	assert.Equal(t, "true", resp.Header().Get(HeaderIdempotentReplayed))
+
+	counter, err := st.GetCounter(context.TODO(), "PollCount")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), *counter.Delta)
+
+	resp = send("/updates/?partial=true")
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode())
+}
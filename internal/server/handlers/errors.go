@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/invinciblewest/metrics/internal/logger"
+	"github.com/invinciblewest/metrics/internal/server/services"
+	"github.com/invinciblewest/metrics/internal/storage"
+	"github.com/invinciblewest/metrics/internal/tokens"
+	"go.uber.org/zap"
+)
+
+// Коды ошибок, возвращаемые в поле code ответа.
+const (
+	CodeBadRequest      = "bad_request"       // CodeBadRequest некорректный запрос.
+	CodeUnsupportedType = "unsupported_media" // CodeUnsupportedType неподдерживаемый Content-Type запроса.
+	CodeInvalidJSON     = "invalid_json"      // CodeInvalidJSON тело запроса не является корректным JSON.
+	CodeInvalidValue    = "invalid_value"     // CodeInvalidValue значение метрики не удалось разобрать.
+	CodeMissingField    = "missing_field"     // CodeMissingField не задано обязательное поле.
+	CodeWrongType       = "wrong_type"        // CodeWrongType неизвестный тип метрики.
+	CodeNotFound        = "not_found"         // CodeNotFound метрика не найдена.
+	CodeBadQuery        = "bad_query"         // CodeBadQuery некорректный запрос агрегации.
+	CodeUnauthorized    = "unauthorized"      // CodeUnauthorized запрос не аутентифицирован.
+	CodeForbidden       = "forbidden"         // CodeForbidden запрос не разрешен.
+	CodeBodyTooLarge    = "body_too_large"    // CodeBodyTooLarge тело запроса превышает допустимый размер.
+	CodeBatchTooLarge   = "batch_too_large"   // CodeBatchTooLarge пакет содержит слишком много метрик.
+	CodeRateLimited     = "rate_limited"      // CodeRateLimited превышена частота запросов.
+	CodeQuotaExceeded   = "quota_exceeded"    // CodeQuotaExceeded исчерпана квота различных метрик.
+	CodeNotSupported    = "not_supported"     // CodeNotSupported операция не поддерживается хранилищем.
+	CodeUnavailable     = "unavailable"       // CodeUnavailable хранилище недоступно.
+	CodeSlowConsumer    = "slow_consumer"     // CodeSlowConsumer подписчик не успевал читать обновления.
+	CodeNoData          = "no_data"           // CodeNoData для ответа недостаточно данных.
+	CodeInternal        = "internal_error"    // CodeInternal внутренняя ошибка сервера.
+)
+
+// APIError описывает ошибку, возвращаемую клиенту.
+type APIError struct {
+	Code    string `json:"code"`            // Code машиночитаемый код ошибки.
+	Message string `json:"message"`         // Message описание ошибки для человека.
+	Field   string `json:"field,omitempty"` // Field поле запроса, к которому относится ошибка.
+}
+
+// ErrorResponse конверт ответа с ошибкой в формате JSON.
+type ErrorResponse struct {
+	Error APIError `json:"error"`
+}
+
+// describeError сопоставляет ошибку хранилища, сервиса или разбора запроса описанию для клиента.
+// Для ошибки отдельной метрики пакета поле указывается вместе с позицией метрики, например [2].value.
+// Описание неизвестных ошибок при статусе 5xx не раскрывается, чтобы не передавать клиенту детали реализации.
+func describeError(err error, status int) APIError {
+	var maxBytesErr *http.MaxBytesError
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	var itemErr *services.ItemError
+
+	switch {
+	case errors.As(err, &itemErr):
+		apiErr := describeError(itemErr.Err, status)
+		apiErr.Message = itemErr.Error()
+		field := "[" + strconv.Itoa(itemErr.Index) + "]"
+		if apiErr.Field != "" {
+			field += "." + apiErr.Field
+		}
+		apiErr.Field = field
+		return apiErr
+	case errors.As(err, &maxBytesErr):
+		return APIError{Code: CodeBodyTooLarge, Message: "request body too large, limit " + strconv.FormatInt(maxBytesErr.Limit, 10) + " bytes"}
+	case errors.As(err, &syntaxErr):
+		return APIError{Code: CodeInvalidJSON, Message: err.Error()}
+	case errors.As(err, &typeErr):
+		return APIError{Code: CodeInvalidJSON, Message: err.Error(), Field: typeErr.Field}
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return APIError{Code: CodeInvalidJSON, Message: "unexpected end of request body"}
+	case errors.Is(err, services.ErrEmptyID):
+		return APIError{Code: CodeMissingField, Message: err.Error(), Field: "id"}
+	case errors.Is(err, services.ErrMissingValue):
+		return APIError{Code: CodeMissingField, Message: err.Error(), Field: "value"}
+	case errors.Is(err, services.ErrMissingDelta):
+		return APIError{Code: CodeMissingField, Message: err.Error(), Field: "delta"}
+	case errors.Is(err, storage.ErrWrongType):
+		return APIError{Code: CodeWrongType, Message: "unknown metric type", Field: "type"}
+	case errors.Is(err, storage.ErrNotFound):
+		return APIError{Code: CodeNotFound, Message: "metric not found"}
+	case errors.Is(err, services.ErrNotEnoughSamples):
+		return APIError{Code: CodeNoData, Message: err.Error()}
+	case errors.Is(err, storage.ErrBadQuery):
+		return APIError{Code: CodeBadQuery, Message: err.Error()}
+	case errors.Is(err, storage.ErrNotSupported):
+		return APIError{Code: CodeNotSupported, Message: err.Error()}
+	case errors.Is(err, tokens.ErrInvalidToken):
+		return APIError{Code: CodeUnauthorized, Message: err.Error()}
+	case errors.Is(err, tokens.ErrForbidden):
+		return APIError{Code: CodeForbidden, Message: err.Error()}
+	case errors.Is(err, services.ErrBatchTooLarge):
+		return APIError{Code: CodeBatchTooLarge, Message: err.Error()}
+	case errors.Is(err, services.ErrMetricsLimit):
+		return APIError{Code: CodeQuotaExceeded, Message: err.Error()}
+	}
+
+	if status >= http.StatusInternalServerError {
+		return APIError{Code: CodeInternal, Message: http.StatusText(status)}
+	}
+	return APIError{Code: CodeBadRequest, Message: err.Error()}
+}
+
+// errorStatus возвращает код ответа для ошибок, которые однозначно определяют его, и fallback для остальных.
+func errorStatus(err error, fallback int) int {
+	var maxBytesErr *http.MaxBytesError
+	switch {
+	case errors.As(err, &maxBytesErr), errors.Is(err, services.ErrBatchTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, tokens.ErrForbidden):
+		return http.StatusForbidden
+	case errors.Is(err, services.ErrMetricsLimit):
+		return http.StatusTooManyRequests
+	case errors.Is(err, storage.ErrNotSupported):
+		return http.StatusNotImplemented
+	}
+	return fallback
+}
+
+// writeError отвечает ошибкой err. Код ответа определяется ошибкой, а если она его не определяет, равен fallback.
+func writeError(w http.ResponseWriter, r *http.Request, fallback int, err error) {
+	status := errorStatus(err, fallback)
+	writeAPIError(w, r, status, describeError(err, status))
+}
+
+// writeAPIError отвечает ошибкой в формате, который принимает клиент: JSON-конверт ErrorResponse
+// или, для запросов в URL-стиле, текстовое описание ошибки.
+func writeAPIError(w http.ResponseWriter, r *http.Request, status int, apiErr APIError) {
+	if !wantsJSON(r) {
+		http.Error(w, apiErr.Message, status)
+		return
+	}
+
+	body, err := json.Marshal(ErrorResponse{Error: apiErr})
+	if err != nil {
+		logger.Log.Error("failed to encode error response", zap.Error(err))
+		http.Error(w, apiErr.Message, status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	if _, err = w.Write(append(body, '\n')); err != nil {
+		logger.Log.Error("failed to write error response", zap.Error(err))
+	}
+}
+
+// wantsJSON сообщает, ожидает ли клиент ошибку в формате JSON: если в Accept явно указан JSON
+// или текст, выбирается указанный формат, иначе формат определяется по Content-Type запроса.
+func wantsJSON(r *http.Request) bool {
+	for _, accepted := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(accepted))
+		if err != nil {
+			continue
+		}
+		switch mediaType {
+		case "application/json":
+			return true
+		case "text/plain":
+			return false
+		}
+	}
+
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && mediaType == "application/json"
+}
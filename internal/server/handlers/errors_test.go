@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/invinciblewest/metrics/internal/server/services"
+	"github.com/invinciblewest/metrics/internal/storage/memstorage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestErrorResponses(t *testing.T) {
+	service := services.NewMetricsService(memstorage.NewMemStorage("", false))
+	server := httptest.NewServer(GetRouter(NewHandler(service), nil, nil))
+	defer server.Close()
+
+	tests := []struct {
+		name          string
+		method        string
+		path          string
+		contentType   string
+		accept        string
+		body          string
+		expectedCode  int
+		expectedError APIError
+	}{
+		{
+			name:          "invalid json",
+			method:        http.MethodPost,
+			path:          "/update/",
+			contentType:   "application/json",
+			body:          `{"id":`,
+			expectedCode:  http.StatusBadRequest,
+			expectedError: APIError{Code: CodeInvalidJSON, Message: "unexpected end of request body"},
+		},
+		{
+			name:          "wrong field type",
+			method:        http.MethodPost,
+			path:          "/update/",
+			contentType:   "application/json",
+			body:          `{"id":"test","type":"gauge","value":"one"}`,
+			expectedCode:  http.StatusBadRequest,
+			expectedError: APIError{Code: CodeInvalidJSON, Message: "json: cannot unmarshal string into Go struct field Metric.value of type float64", Field: "value"},
+		},
+		{
+			name:          "missing value",
+			method:        http.MethodPost,
+			path:          "/update/",
+			contentType:   "application/json",
+			body:          `{"id":"test","type":"gauge"}`,
+			expectedCode:  http.StatusBadRequest,
+			expectedError: APIError{Code: CodeMissingField, Message: "value is nil", Field: "value"},
+		},
+		{
+			name:          "wrong metric type",
+			method:        http.MethodPost,
+			path:          "/update/",
+			contentType:   "application/json",
+			body:          `{"id":"test","type":"unknown","value":1}`,
+			expectedCode:  http.StatusBadRequest,
+			expectedError: APIError{Code: CodeWrongType, Message: "unknown metric type", Field: "type"},
+		},
+		{
+			name:          "empty id",
+			method:        http.MethodPost,
+			path:          "/value/",
+			contentType:   "application/json",
+			body:          `{"type":"gauge"}`,
+			expectedCode:  http.StatusNotFound,
+			expectedError: APIError{Code: CodeMissingField, Message: "id is empty", Field: "id"},
+		},
+		{
+			name:          "not found",
+			method:        http.MethodPost,
+			path:          "/value/",
+			contentType:   "application/json",
+			body:          `{"id":"unknown","type":"gauge"}`,
+			expectedCode:  http.StatusNotFound,
+			expectedError: APIError{Code: CodeNotFound, Message: "metric not found"},
+		},
+		{
+			name:          "wrong content type",
+			method:        http.MethodPost,
+			path:          "/updates/",
+			contentType:   "text/plain",
+			accept:        "application/json",
+			body:          `[]`,
+			expectedCode:  http.StatusBadRequest,
+			expectedError: APIError{Code: CodeUnsupportedType, Message: "content type must be application/json"},
+		},
+		{
+			name:          "invalid value in url",
+			method:        http.MethodPost,
+			path:          "/update/counter/test/1.5",
+			accept:        "application/json",
+			expectedCode:  http.StatusBadRequest,
+			expectedError: APIError{Code: CodeInvalidValue, Message: `invalid metric value "1.5"`, Field: "value"},
+		},
+		{
+			name:          "bad query",
+			method:        http.MethodGet,
+			path:          "/query?func=sum&regex=(",
+			accept:        "application/json",
+			expectedCode:  http.StatusBadRequest,
+			expectedError: APIError{Code: CodeBadQuery, Message: "error parsing regexp: missing closing ): `(`", Field: "regex"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := resty.New().R().SetBody(test.body)
+			if test.contentType != "" {
+				req.SetHeader("Content-Type", test.contentType)
+			}
+			if test.accept != "" {
+				req.SetHeader("Accept", test.accept)
+			}
+			resp, err := req.Execute(test.method, server.URL+test.path)
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedCode, resp.StatusCode())
+			assert.Equal(t, "application/json", resp.Header().Get("Content-Type"))
+
+			var response ErrorResponse
+			require.NoError(t, json.Unmarshal(resp.Body(), &response))
+			assert.Equal(t, test.expectedError, response.Error)
+		})
+	}
+}
+
+func TestErrorResponses_TextFallback(t *testing.T) {
+	service := services.NewMetricsService(memstorage.NewMemStorage("", false))
+	server := httptest.NewServer(GetRouter(NewHandler(service), nil, nil))
+	defer server.Close()
+
+	tests := []struct {
+		name         string
+		method       string
+		path         string
+		accept       string
+		expectedCode int
+		expectedBody string
+	}{
+		{
+			name:         "not found",
+			method:       http.MethodGet,
+			path:         "/value/gauge/unknown",
+			expectedCode: http.StatusNotFound,
+			expectedBody: "metric not found",
+		},
+		{
+			name:         "wrong type",
+			method:       http.MethodPost,
+			path:         "/update/unknown/test/1",
+			expectedCode: http.StatusBadRequest,
+			expectedBody: "unknown metric type",
+		},
+		{
+			name:         "invalid value",
+			method:       http.MethodPost,
+			path:         "/update/gauge/test/abc",
+			accept:       "text/plain, application/json",
+			expectedCode: http.StatusBadRequest,
+			expectedBody: `invalid metric value "abc"`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := resty.New().R()
+			if test.accept != "" {
+				req.SetHeader("Accept", test.accept)
+			}
+			resp, err := req.Execute(test.method, server.URL+test.path)
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedCode, resp.StatusCode())
+			assert.Equal(t, "text/plain; charset=utf-8", resp.Header().Get("Content-Type"))
+			assert.Equal(t, test.expectedBody, resp.String())
+		})
+	}
+}
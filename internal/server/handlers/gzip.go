@@ -7,9 +7,13 @@ import (
 	"strings"
 )
 
+// compressWriter сжимает тело успешных ответов и ответов 404. Остальные ответы, например тексты ошибок,
+// передаются без сжатия, чтобы клиент получил их без заголовка Content-Encoding в читаемом виде.
 type compressWriter struct {
-	w  http.ResponseWriter
-	zw *gzip.Writer
+	w           http.ResponseWriter
+	zw          *gzip.Writer
+	compress    bool
+	wroteHeader bool
 }
 
 func newCompressWriter(w http.ResponseWriter) *compressWriter {
@@ -24,17 +28,32 @@ func (c *compressWriter) Header() http.Header {
 }
 
 func (c *compressWriter) Write(p []byte) (int, error) {
-	return c.zw.Write(p)
+	if !c.wroteHeader {
+		c.WriteHeader(http.StatusOK)
+	}
+	if c.compress {
+		return c.zw.Write(p)
+	}
+	return c.w.Write(p)
 }
 
 func (c *compressWriter) WriteHeader(statusCode int) {
+	if c.wroteHeader {
+		return
+	}
+	c.wroteHeader = true
 	if statusCode < 300 || statusCode == http.StatusNotFound {
 		c.w.Header().Set("Content-Encoding", "gzip")
+		c.w.Header().Del("Content-Length")
+		c.compress = true
 	}
 	c.w.WriteHeader(statusCode)
 }
 
 func (c *compressWriter) Close() error {
+	if !c.compress {
+		return nil
+	}
 	return c.zw.Close()
 }
 
@@ -86,7 +105,7 @@ func gzipMiddleware() func(next http.Handler) http.Handler {
 			if sendsGzip {
 				cr, err := newCompressReader(r.Body)
 				if err != nil {
-					w.WriteHeader(http.StatusInternalServerError)
+					writeAPIError(w, r, http.StatusInternalServerError, APIError{Code: CodeInternal, Message: "failed to decompress request body"})
 					return
 				}
 				r.Body = cr
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"errors"
 	"net/http"
+	"regexp"
 	"strconv"
 
 	"github.com/go-chi/chi/v5"
@@ -15,6 +16,14 @@ import (
 	"go.uber.org/zap"
 )
 
+const (
+	HeaderIdempotencyKey     = "Idempotency-Key"     // HeaderIdempotencyKey заголовок с ключом идемпотентности пакета метрик.
+	HeaderIdempotentReplayed = "Idempotent-Replayed" // HeaderIdempotentReplayed заголовок ответа на повторно полученный пакет.
+)
+
+// maxIdempotencyKeyLen максимальная длина ключа идемпотентности.
+const maxIdempotencyKeyLen = 256
+
 // Handler представляет собой обработчик HTTP-запросов для работы с метриками.
 type Handler struct {
 	service services.MetricsService
@@ -36,7 +45,7 @@ func (h *Handler) UpdateMetric(w http.ResponseWriter, r *http.Request) {
 	metricValue := chi.URLParam(r, "value")
 
 	if metricName == "" {
-		w.WriteHeader(http.StatusNotFound)
+		writeAPIError(w, r, http.StatusNotFound, APIError{Code: CodeMissingField, Message: "metric name is empty", Field: "name"})
 		return
 	}
 
@@ -48,24 +57,24 @@ func (h *Handler) UpdateMetric(w http.ResponseWriter, r *http.Request) {
 	case models.TypeGauge:
 		value, err := strconv.ParseFloat(metricValue, 64)
 		if err != nil {
-			w.WriteHeader(http.StatusBadRequest)
+			writeInvalidValue(w, r, metricValue)
 			return
 		}
 		metric.Value = &value
 	case models.TypeCounter:
 		delta, err := strconv.ParseInt(metricValue, 10, 64)
 		if err != nil {
-			w.WriteHeader(http.StatusBadRequest)
+			writeInvalidValue(w, r, metricValue)
 			return
 		}
 		metric.Delta = &delta
 	default:
-		w.WriteHeader(http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, storage.ErrWrongType)
 		return
 	}
 
 	if _, err := h.service.Update(ctx, metric); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, err)
 		return
 	}
 
@@ -76,35 +85,35 @@ func (h *Handler) UpdateMetric(w http.ResponseWriter, r *http.Request) {
 func (h *Handler) UpdateMetricJSON(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	if r.Header.Get("Content-Type") != "application/json" {
-		w.WriteHeader(http.StatusBadRequest)
+		writeUnsupportedType(w, r)
 		return
 	}
 
 	var metrics models.Metric
 	if err := json.NewDecoder(r.Body).Decode(&metrics); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, err)
 		return
 	}
 
 	if metrics.ID == "" {
-		w.WriteHeader(http.StatusNotFound)
+		writeError(w, r, http.StatusNotFound, services.ErrEmptyID)
 		return
 	}
 
 	updatedMetrics, err := h.service.Update(ctx, metrics)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, err)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-
 	var buf bytes.Buffer
 	if err = json.NewEncoder(&buf).Encode(updatedMetrics); err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
+		writeError(w, r, http.StatusInternalServerError, err)
 		return
 	}
 
+	w.Header().Set("Content-Type", "application/json")
+
 	w.WriteHeader(http.StatusOK)
 	_, err = w.Write(buf.Bytes())
 	if err != nil {
@@ -113,31 +122,55 @@ func (h *Handler) UpdateMetricJSON(w http.ResponseWriter, r *http.Request) {
 }
 
 // UpdateMetricsBatch обновляет пакет метрик, полученных в формате JSON из тела запроса.
+// По умолчанию пакет применяется целиком или не применяется совсем. С параметром partial=true
+// корректные метрики записываются, некорректные отклоняются, а в ответе возвращается отчет по каждой метрике.
+// Пакет с заголовком Idempotency-Key, уже примененный в пределах окна идемпотентности, повторно не применяется:
+// сервер отвечает 200 с заголовком Idempotent-Replayed.
 func (h *Handler) UpdateMetricsBatch(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	if r.Header.Get("Content-Type") != "application/json" {
-		w.WriteHeader(http.StatusBadRequest)
+		writeUnsupportedType(w, r)
 		return
 	}
 
 	var metrics []models.Metric
 	if err := json.NewDecoder(r.Body).Decode(&metrics); err != nil {
 		logger.Log.Error("failed to decode metrics", zap.Error(err))
-		w.WriteHeader(http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, err)
 		return
 	}
 
 	if len(metrics) == 0 {
-		w.WriteHeader(http.StatusBadRequest)
+		writeAPIError(w, r, http.StatusBadRequest, APIError{Code: CodeBadRequest, Message: "batch is empty"})
+		return
+	}
+
+	key := r.Header.Get(HeaderIdempotencyKey)
+	if len(key) > maxIdempotencyKeyLen {
+		writeAPIError(w, r, http.StatusBadRequest, APIError{Code: CodeBadRequest, Message: "idempotency key is too long", Field: HeaderIdempotencyKey})
+		return
+	}
+
+	if partial, _ := strconv.ParseBool(r.URL.Query().Get("partial")); partial {
+		if key != "" {
+			writeAPIError(w, r, http.StatusBadRequest, APIError{Code: CodeBadRequest, Message: "idempotency key is not supported in partial mode", Field: HeaderIdempotencyKey})
+			return
+		}
+		h.updateMetricsBatchPartial(w, r, metrics)
 		return
 	}
 
-	if err := h.service.UpdateBatch(ctx, metrics); err != nil {
+	replayed, err := h.service.UpdateBatchOnce(ctx, key, metrics)
+	if err != nil {
 		logger.Log.Error("failed to update batch", zap.Error(err))
-		w.WriteHeader(http.StatusInternalServerError)
+		writeError(w, r, batchErrorStatus(err), err)
 		return
 	}
 
+	if replayed {
+		logger.Log.Info("repeated batch skipped", zap.String("idempotency_key", key))
+		w.Header().Set(HeaderIdempotentReplayed, "true")
+	}
 	w.WriteHeader(http.StatusOK)
 }
 
@@ -150,9 +183,10 @@ func (h *Handler) GetMetric(w http.ResponseWriter, r *http.Request) {
 	metrics, err := h.service.Get(ctx, metricType, metricName)
 	if err != nil {
 		if errors.Is(err, storage.ErrNotFound) || errors.Is(err, storage.ErrWrongType) {
-			w.WriteHeader(http.StatusNotFound)
+			writeError(w, r, http.StatusNotFound, err)
 		} else {
-			w.WriteHeader(http.StatusInternalServerError)
+			logger.Log.Error("failed to get metric", zap.Error(err))
+			writeError(w, r, http.StatusInternalServerError, err)
 		}
 		return
 	}
@@ -179,38 +213,38 @@ func (h *Handler) GetMetric(w http.ResponseWriter, r *http.Request) {
 func (h *Handler) GetMetricJSON(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	if r.Header.Get("Content-Type") != "application/json" {
-		w.WriteHeader(http.StatusBadRequest)
+		writeUnsupportedType(w, r)
 		return
 	}
 
 	var metrics models.Metric
 	if err := json.NewDecoder(r.Body).Decode(&metrics); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, err)
 		return
 	}
 
 	if metrics.ID == "" {
-		w.WriteHeader(http.StatusNotFound)
+		writeError(w, r, http.StatusNotFound, services.ErrEmptyID)
 		return
 	}
 
 	result, err := h.service.Get(ctx, metrics.MType, metrics.ID)
 	if err != nil {
 		if errors.Is(err, storage.ErrNotFound) || errors.Is(err, storage.ErrWrongType) {
-			w.WriteHeader(http.StatusNotFound)
+			writeError(w, r, http.StatusNotFound, err)
 		} else {
 			logger.Log.Error("failed to get metric", zap.Error(err))
-			w.WriteHeader(http.StatusInternalServerError)
+			writeError(w, r, http.StatusInternalServerError, err)
 		}
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
 	var buf bytes.Buffer
 	if err = json.NewEncoder(&buf).Encode(result); err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
+		writeError(w, r, http.StatusInternalServerError, err)
 		return
 	}
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	_, err = w.Write(buf.Bytes())
 	if err != nil {
@@ -225,6 +259,98 @@ func (h *Handler) PingStorage(w http.ResponseWriter, r *http.Request) {
 	if h.service.PingStorage(ctx) {
 		w.WriteHeader(http.StatusOK)
 	} else {
-		w.WriteHeader(http.StatusInternalServerError)
+		writeAPIError(w, r, http.StatusInternalServerError, APIError{Code: CodeUnavailable, Message: "storage is unavailable"})
+	}
+}
+
+// aggregateResponse представляет собой ответ на запрос агрегации.
+type aggregateResponse struct {
+	Func   storage.AggregateFunc     `json:"func"`
+	Value  *float64                  `json:"value,omitempty"`
+	Count  *int64                    `json:"count,omitempty"`
+	Groups []storage.AggregateResult `json:"groups,omitempty"`
+}
+
+// AggregateMetrics вычисляет агрегированное значение метрик, имя которых соответствует шаблону.
+// Параметры запроса: pattern (шаблон имени) или regex (регулярное выражение, первая группа которого
+// используется для группировки), type (необязательный тип метрик) и func (sum, avg, min, max, count).
+func (h *Handler) AggregateMetrics(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	params := r.URL.Query()
+
+	q := storage.AggregateQuery{
+		MType: params.Get("type"),
+		Func:  storage.AggregateFunc(params.Get("func")),
+	}
+
+	var err error
+	var field string
+	switch {
+	case params.Get("regex") != "":
+		field = "regex"
+		q.Regexp, err = regexp.Compile(params.Get("regex"))
+	case params.Get("pattern") != "":
+		field = "pattern"
+		q.Glob = params.Get("pattern")
+		q.Regexp, err = storage.GlobToRegexp(q.Glob)
+	default:
+		field = "pattern"
+		err = errors.New("pattern or regex is required")
+	}
+	if err != nil {
+		writeAPIError(w, r, http.StatusBadRequest, APIError{Code: CodeBadQuery, Message: err.Error(), Field: field})
+		return
+	}
+
+	results, err := h.service.Aggregate(ctx, q)
+	if err != nil {
+		if errors.Is(err, storage.ErrBadQuery) || errors.Is(err, storage.ErrWrongType) {
+			writeError(w, r, http.StatusBadRequest, err)
+		} else {
+			logger.Log.Error("failed to aggregate metrics", zap.Error(err))
+			writeError(w, r, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	response := aggregateResponse{Func: q.Func}
+	if q.Grouped() {
+		response.Groups = results
+	} else if len(results) > 0 {
+		response.Value = results[0].Value
+		response.Count = &results[0].Count
 	}
+
+	var buf bytes.Buffer
+	if err = json.NewEncoder(&buf).Encode(response); err != nil {
+		writeError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if _, err = w.Write(buf.Bytes()); err != nil {
+		logger.Log.Error("failed to write response", zap.Error(err))
+	}
+}
+
+// batchErrorStatus возвращает код ответа на ошибку записи пакета: ошибки в самих метриках
+// считаются ошибками клиента, остальные — ошибками сервера.
+func batchErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, storage.ErrWrongType), errors.Is(err, services.ErrEmptyID),
+		errors.Is(err, services.ErrMissingValue), errors.Is(err, services.ErrMissingDelta):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// writeInvalidValue отвечает 400 на значение метрики, которое не удалось разобрать.
+func writeInvalidValue(w http.ResponseWriter, r *http.Request, value string) {
+	writeAPIError(w, r, http.StatusBadRequest, APIError{Code: CodeInvalidValue, Message: "invalid metric value " + strconv.Quote(value), Field: "value"})
+}
+
+// writeUnsupportedType отвечает 400 на запрос, тело которого не в формате JSON.
+func writeUnsupportedType(w http.ResponseWriter, r *http.Request) {
+	writeAPIError(w, r, http.StatusBadRequest, APIError{Code: CodeUnsupportedType, Message: "content type must be application/json"})
 }
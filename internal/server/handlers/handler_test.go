@@ -371,7 +371,65 @@ func newRouter(st storage.Storage) http.Handler {
 		NewHandler(
 			services.NewMetricsService(st),
 		),
-		"",
+		nil,
 		nil,
 	)
 }
+
+func TestMetricsHandler_AggregateMetrics(t *testing.T) {
+	tests := []struct {
+		name         string
+		query        string
+		expectedCode int
+		expectedBody string
+	}{
+		{
+			name:         "sum by pattern",
+			query:        "pattern=test*&func=sum",
+			expectedCode: http.StatusOK,
+			expectedBody: `{"func":"sum","value":4,"count":2}`,
+		},
+		{
+			name:         "grouped by regex",
+			query:        "regex=^(test)&type=gauge&func=max",
+			expectedCode: http.StatusOK,
+			expectedBody: `{"func":"max","groups":[{"group":"test","value":3,"count":1}]}`,
+		},
+		{
+			name:         "no pattern",
+			query:        "func=sum",
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "bad regex",
+			query:        "regex=(&func=sum",
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "unknown func",
+			query:        "pattern=*&func=median",
+			expectedCode: http.StatusBadRequest,
+		},
+	}
+
+	st := memstorage.NewMemStorage("", false)
+	value := 3.0
+	delta := int64(1)
+	assert.NoError(t, st.UpdateBatch(context.TODO(), []models.Metric{
+		{ID: "testGauge", MType: models.TypeGauge, Value: &value},
+		{ID: "testCounter", MType: models.TypeCounter, Delta: &delta},
+	}))
+	server := httptest.NewServer(newRouter(st))
+	defer server.Close()
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp, err := resty.New().R().SetQueryString(test.query).Get(server.URL + "/query/")
+			assert.NoError(t, err)
+			assert.Equal(t, test.expectedCode, resp.StatusCode())
+			if test.expectedBody != "" {
+				assert.JSONEq(t, test.expectedBody, string(resp.Body()))
+			}
+		})
+	}
+}
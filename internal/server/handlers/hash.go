@@ -5,72 +5,154 @@ import (
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/base64"
+	"hash"
 	"io"
 	"net/http"
-	"strings"
 
 	"github.com/invinciblewest/metrics/internal/logger"
+	"github.com/invinciblewest/metrics/internal/signature"
+	"github.com/invinciblewest/metrics/pkg/encryption"
 	"go.uber.org/zap"
 )
 
+// responseRecorder вычисляет HMAC тела ответа по мере записи, не накапливая тело:
+// ответ на подписку может передаваться сколь угодно долго.
 type responseRecorder struct {
 	http.ResponseWriter
-	body *strings.Builder
+	hash hash.Hash
 }
 
 func (r *responseRecorder) Write(b []byte) (int, error) {
-	r.body.Write(b)
+	r.hash.Write(b)
 	return r.ResponseWriter.Write(b)
 }
 
+// Unwrap возвращает исходный http.ResponseWriter для http.ResponseController.
+func (r *responseRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
 // hashMiddleware создает middleware для проверки и добавления SHA256 хеша к запросам и ответам.
-func hashMiddleware(hashKey string) func(next http.Handler) http.Handler {
+// Подпись запроса проверяется ключом из заголовка X-Hash-Key-ID или, если он не передан, любым активным ключом.
+// Вместо HMAC агент может подписать запрос ключом Ed25519 или ECDSA: такая подпись проверяется verifier.
+// Ответ подписывается тем же ключом, что и запрос, а для неподписанных запросов — основным ключом.
+// Если в запросе есть метка времени и nonce, они входят в подпись вместе с методом и URI запроса
+// и проверяются guard для защиты от повторной отправки.
+func hashMiddleware(keys *signature.Keys, verifier *encryption.Verifier, guard *signature.ReplayGuard) func(next http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			if hashKey != "" {
-				receivedHash := r.Header.Get("HashSHA256")
-				if receivedHash != "" {
-					decodedHash, err := base64.StdEncoding.DecodeString(receivedHash)
-					if err != nil {
+			receivedHash := r.Header.Get(signature.HeaderHash)
+			receivedSignature := r.Header.Get(signature.HeaderSignature)
+			checkHash := keys.Enabled() && receivedHash != ""
+			checkSignature := verifier != nil && receivedSignature != ""
+
+			responseKey := keys.Primary()
+			if checkHash || checkSignature {
+				body, err := io.ReadAll(r.Body)
+				if err != nil {
+					logger.Log.Info("failed to read request body", zap.Error(err))
+					writeError(w, r, http.StatusInternalServerError, err)
+					return
+				}
+				r.Body = io.NopCloser(bytes.NewBuffer(body))
+
+				timestamp := r.Header.Get(signature.HeaderTimestamp)
+				nonce := r.Header.Get(signature.HeaderNonce)
+				uri := r.URL.RequestURI()
+
+				if checkHash {
+					var decodedHash []byte
+					if decodedHash, err = base64.StdEncoding.DecodeString(receivedHash); err != nil {
 						logger.Log.Info("failed to decode hash", zap.Error(err))
-						w.WriteHeader(http.StatusBadRequest)
+						writeAPIError(w, r, http.StatusBadRequest, APIError{Code: CodeBadRequest, Message: "malformed hash", Field: signature.HeaderHash})
+						return
+					}
+					key, ok := verify(keys.Candidates(r.Header.Get(signature.HeaderKeyID)), r.Method, uri, timestamp, nonce, body, decodedHash)
+					if !ok {
+						logger.Log.Info(
+							"hash mismatch",
+							zap.String("key_id", r.Header.Get(signature.HeaderKeyID)),
+							zap.String("received", receivedHash),
+						)
+						writeAPIError(w, r, http.StatusBadRequest, APIError{Code: CodeBadRequest, Message: "hash mismatch", Field: signature.HeaderHash})
 						return
 					}
-					body, err := io.ReadAll(r.Body)
+					responseKey = key
+				}
+
+				if checkSignature {
+					var decodedSignature []byte
+					if decodedSignature, err = base64.StdEncoding.DecodeString(receivedSignature); err == nil {
+						err = verifier.Verify(r.Header.Get(signature.HeaderSignatureKeyID), signature.Payload(r.Method, uri, timestamp, nonce, body), decodedSignature)
+					}
 					if err != nil {
-						logger.Log.Info("failed to read request body", zap.Error(err))
-						w.WriteHeader(http.StatusInternalServerError)
+						logger.Log.Info("signature mismatch", zap.String("key_id", r.Header.Get(signature.HeaderSignatureKeyID)), zap.Error(err))
+						writeAPIError(w, r, http.StatusBadRequest, APIError{Code: CodeBadRequest, Message: "signature mismatch", Field: signature.HeaderSignature})
 						return
 					}
-					r.Body = io.NopCloser(bytes.NewBuffer(body))
+				}
 
-					hash := hmac.New(sha256.New, []byte(hashKey))
-					hash.Write(body)
-					computedHash := hash.Sum(nil)
-					if !hmac.Equal(computedHash, decodedHash) {
-						logger.Log.Info(
-							"hash mismatch",
-							zap.String("expected", base64.StdEncoding.EncodeToString(computedHash)),
-							zap.String("received", r.Header.Get("HashSHA256")),
-						)
-						w.WriteHeader(http.StatusBadRequest)
+				if (timestamp != "" || nonce != "") && guard != nil {
+					if err = guard.Check(timestamp, nonce); err != nil {
+						logger.Log.Info("rejected signed request", zap.Error(err))
+						writeAPIError(w, r, http.StatusUnauthorized, APIError{Code: CodeUnauthorized, Message: err.Error()})
 						return
 					}
 				}
 			}
 
+			if responseKey == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Set(signature.HeaderKeyID, signature.KeyID(responseKey))
 			rec := &responseRecorder{
 				ResponseWriter: w,
-				body:           new(strings.Builder),
+				hash:           hmac.New(sha256.New, []byte(responseKey)),
 			}
 			next.ServeHTTP(rec, r)
 
-			if hashKey != "" {
-				hash := hmac.New(sha256.New, []byte(hashKey))
-				hash.Write([]byte(rec.body.String()))
-				computedHash := hash.Sum(nil)
-				w.Header().Set("HashSHA256", base64.StdEncoding.EncodeToString(computedHash))
+			w.Header().Set(signature.HeaderHash, base64.StdEncoding.EncodeToString(rec.hash.Sum(nil)))
+		})
+	}
+}
+
+// verify ищет среди ключей тот, которым подписан запрос.
+func verify(keys []string, method, uri, timestamp, nonce string, body, received []byte) (string, bool) {
+	for _, key := range keys {
+		if hmac.Equal(signature.Sum(key, method, uri, timestamp, nonce, body), received) {
+			return key, true
+		}
+	}
+	return "", false
+}
+
+// requireSignatureMiddleware создает middleware строгого режима, отклоняющий запросы без подписи
+// HMAC или Ed25519/ECDSA, метки времени и nonce. Учитываются только подписи, которые сервер умеет проверять:
+// сама подпись к этому моменту уже проверена hashMiddleware.
+func requireSignatureMiddleware(keys *signature.Keys, verifier *encryption.Verifier) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			hashed := keys.Enabled() && r.Header.Get(signature.HeaderHash) != ""
+			signed := verifier != nil && r.Header.Get(signature.HeaderSignature) != ""
+			if !hashed && !signed {
+				logger.Log.Info("unsigned request rejected")
+				writeAPIError(w, r, http.StatusUnauthorized, APIError{
+					Code:    CodeUnauthorized,
+					Message: "missing " + signature.HeaderHash + " or " + signature.HeaderSignature + " header",
+					Field:   signature.HeaderHash,
+				})
+				return
+			}
+			for _, header := range []string{signature.HeaderTimestamp, signature.HeaderNonce} {
+				if r.Header.Get(header) == "" {
+					logger.Log.Info("unsigned request rejected", zap.String("missing", header))
+					writeAPIError(w, r, http.StatusUnauthorized, APIError{Code: CodeUnauthorized, Message: "missing " + header + " header", Field: header})
+					return
+				}
 			}
+			next.ServeHTTP(w, r)
 		})
 	}
 }
@@ -0,0 +1,225 @@
+package handlers
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/invinciblewest/metrics/internal/server/services"
+	"github.com/invinciblewest/metrics/internal/signature"
+	"github.com/invinciblewest/metrics/internal/storage/memstorage"
+	"github.com/invinciblewest/metrics/pkg/encryption"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHashMiddleware(t *testing.T) {
+	const key = "secret"
+	body := []byte(`{"id":"test","type":"counter","delta":1}`)
+
+	signFor := func(method, uri, timestamp, nonce string) map[string]string {
+		headers := map[string]string{
+			signature.HeaderHash: base64.StdEncoding.EncodeToString(signature.Sum(key, method, uri, timestamp, nonce, body)),
+		}
+		if timestamp != "" {
+			headers[signature.HeaderTimestamp] = timestamp
+		}
+		if nonce != "" {
+			headers[signature.HeaderNonce] = nonce
+		}
+		return headers
+	}
+	sign := func(timestamp, nonce string) map[string]string {
+		return signFor(http.MethodPost, "/update/", timestamp, nonce)
+	}
+	now := signature.Timestamp(time.Now())
+
+	tests := []struct {
+		name         string
+		strict       bool
+		headers      map[string]string
+		expectedCode int
+	}{
+		{
+			name:         "unsigned",
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "legacy signature",
+			headers:      sign("", ""),
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "wrong signature",
+			headers:      map[string]string{signature.HeaderHash: base64.StdEncoding.EncodeToString([]byte("wrong"))},
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "tampered timestamp",
+			headers:      map[string]string{signature.HeaderHash: sign(now, "n1")[signature.HeaderHash], signature.HeaderTimestamp: "1", signature.HeaderNonce: "n1"},
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "signed for another path",
+			headers:      signFor(http.MethodPost, "/updates/", now, "n4"),
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "signed for another method",
+			headers:      signFor(http.MethodPut, "/update/", now, "n5"),
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "stale timestamp",
+			headers:      sign(signature.Timestamp(time.Now().Add(-time.Hour)), "n2"),
+			expectedCode: http.StatusUnauthorized,
+		},
+		{
+			name:         "strict unsigned",
+			strict:       true,
+			expectedCode: http.StatusUnauthorized,
+		},
+		{
+			name:         "strict legacy signature",
+			strict:       true,
+			headers:      sign("", ""),
+			expectedCode: http.StatusUnauthorized,
+		},
+		{
+			name:         "strict signed",
+			strict:       true,
+			headers:      sign(now, "n3"),
+			expectedCode: http.StatusOK,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			service := services.NewMetricsService(memstorage.NewMemStorage("", false))
+			server := httptest.NewServer(GetRouter(NewHandler(service), signature.NewKeys(key), nil, WithHashPolicy(test.strict, time.Minute)))
+			defer server.Close()
+
+			resp, err := resty.New().R().
+				SetHeader("Content-Type", "application/json").
+				SetHeaders(test.headers).
+				SetBody(body).
+				Post(server.URL + "/update/")
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedCode, resp.StatusCode())
+		})
+	}
+
+	t.Run("replay", func(t *testing.T) {
+		service := services.NewMetricsService(memstorage.NewMemStorage("", false))
+		server := httptest.NewServer(GetRouter(NewHandler(service), signature.NewKeys(key), nil, WithHashPolicy(true, time.Minute)))
+		defer server.Close()
+
+		headers := sign(now, "replayed")
+		for _, expectedCode := range []int{http.StatusOK, http.StatusUnauthorized} {
+			resp, err := resty.New().R().
+				SetHeader("Content-Type", "application/json").
+				SetHeaders(headers).
+				SetBody(body).
+				Post(server.URL + "/update/")
+			require.NoError(t, err)
+			assert.Equal(t, expectedCode, resp.StatusCode())
+		}
+	})
+}
+
+func TestHashMiddleware_KeyRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys")
+	require.NoError(t, os.WriteFile(path, []byte("old\n"), 0600))
+	keys, err := signature.LoadKeys("new", path)
+	require.NoError(t, err)
+
+	service := services.NewMetricsService(memstorage.NewMemStorage("", false))
+	server := httptest.NewServer(GetRouter(NewHandler(service), keys, nil))
+	defer server.Close()
+
+	body := []byte(`{"id":"test","type":"counter","delta":1}`)
+	send := func(key, keyID string) *resty.Response {
+		req := resty.New().R().
+			SetHeader("Content-Type", "application/json").
+			SetHeader(signature.HeaderHash, base64.StdEncoding.EncodeToString(signature.Sum(key, "", "", "", "", body))).
+			SetBody(body)
+		if keyID != "" {
+			req.SetHeader(signature.HeaderKeyID, keyID)
+		}
+		resp, err := req.Post(server.URL + "/update/")
+		require.NoError(t, err)
+		return resp
+	}
+
+	resp := send("old", signature.KeyID("old"))
+	assert.Equal(t, http.StatusOK, resp.StatusCode())
+	assert.Equal(t, signature.KeyID("old"), resp.Header().Get(signature.HeaderKeyID))
+
+	assert.Equal(t, http.StatusOK, send("new", "").StatusCode())
+	assert.Equal(t, http.StatusBadRequest, send("old", signature.KeyID("new")).StatusCode())
+
+	require.NoError(t, os.WriteFile(path, []byte(""), 0600))
+	require.NoError(t, keys.Reload())
+	assert.Equal(t, http.StatusBadRequest, send("old", "").StatusCode())
+}
+
+func TestHashMiddleware_Signature(t *testing.T) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	privateDER, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	publicDER, err := x509.MarshalPKIXPublicKey(key.Public())
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	privatePath := filepath.Join(dir, "private.pem")
+	publicPath := filepath.Join(dir, "public.pem")
+	require.NoError(t, os.WriteFile(privatePath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER}), 0600))
+	require.NoError(t, os.WriteFile(publicPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER}), 0600))
+
+	signer, err := encryption.NewSigner(privatePath)
+	require.NoError(t, err)
+	verifier, err := encryption.NewVerifier(publicPath)
+	require.NoError(t, err)
+
+	service := services.NewMetricsService(memstorage.NewMemStorage("", false))
+	server := httptest.NewServer(GetRouter(NewHandler(service), nil, nil, WithVerifier(verifier), WithHashPolicy(true, time.Minute)))
+	defer server.Close()
+
+	body := []byte(`{"id":"test","type":"counter","delta":1}`)
+	send := func(nonce string, payload []byte) *resty.Response {
+		timestamp := signature.Timestamp(time.Now())
+		sig, signErr := signer.Sign(signature.Payload(http.MethodPost, "/update/", timestamp, nonce, payload))
+		require.NoError(t, signErr)
+		resp, postErr := resty.New().R().
+			SetHeader("Content-Type", "application/json").
+			SetHeader(signature.HeaderTimestamp, timestamp).
+			SetHeader(signature.HeaderNonce, nonce).
+			SetHeader(signature.HeaderSignatureKeyID, signer.KeyID()).
+			SetHeader(signature.HeaderSignature, base64.StdEncoding.EncodeToString(sig)).
+			SetBody(body).
+			Post(server.URL + "/update/")
+		require.NoError(t, postErr)
+		return resp
+	}
+
+	assert.Equal(t, http.StatusOK, send("n1", body).StatusCode())
+	assert.Equal(t, http.StatusBadRequest, send("n2", []byte("other")).StatusCode())
+
+	resp, err := resty.New().R().
+		SetHeader("Content-Type", "application/json").
+		SetHeader(signature.HeaderHash, base64.StdEncoding.EncodeToString(signature.Sum("secret", "", "", "", "", body))).
+		SetBody(body).
+		Post(server.URL + "/update/")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode())
+}
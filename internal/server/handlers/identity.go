@@ -0,0 +1,21 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/invinciblewest/metrics/internal/identity"
+	"github.com/invinciblewest/metrics/pkg/tlsconfig"
+)
+
+// identityMiddleware создает middleware, сохраняющий в контексте запроса идентичность агента,
+// определенную по клиентскому сертификату mTLS-соединения.
+func identityMiddleware() func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if agent := tlsconfig.Identity(r.TLS); agent != "" {
+				r = r.WithContext(identity.WithAgent(r.Context(), agent))
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
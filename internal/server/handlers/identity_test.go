@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/invinciblewest/metrics/internal/identity"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIdentityMiddleware(t *testing.T) {
+	var agent string
+	var found bool
+	handler := identityMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		agent, found = identity.Agent(r.Context())
+	}))
+
+	t.Run("without certificate", func(t *testing.T) {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+		assert.False(t, found)
+	})
+	t.Run("client certificate", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{
+			{Subject: pkix.Name{CommonName: "agent-1"}},
+		}}
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+		assert.True(t, found)
+		assert.Equal(t, "agent-1", agent)
+	})
+}
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/invinciblewest/metrics/internal/identity"
+	"github.com/invinciblewest/metrics/internal/logger"
+	"github.com/invinciblewest/metrics/internal/ratelimit"
+	"go.uber.org/zap"
+)
+
+// rateLimitMiddleware создает middleware, ограничивающий частоту запросов каждого клиента.
+// Клиент определяется по идентичности агента (сертификат mTLS или токен), а при ее отсутствии — по адресу
+// соединения. Заголовку X-Real-IP здесь не доверяется: клиент, меняющий его в каждом запросе,
+// получал бы новую полную квоту.
+func rateLimitMiddleware(limiter *ratelimit.Limiter) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key, ok := identity.Agent(r.Context())
+			if ok {
+				key = "agent:" + key
+			} else {
+				key = "ip:" + remoteIP(r)
+			}
+
+			if allowed, retryAfter := limiter.Allow(key); !allowed {
+				logger.Log.Info("rate limit exceeded", zap.String("client", key))
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+				writeAPIError(w, r, http.StatusTooManyRequests, APIError{
+					Code:    CodeRateLimited,
+					Message: "rate limit exceeded, retry after " + retryAfter.Round(time.Millisecond).String(),
+				})
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// bodyLimitMiddleware создает middleware, ограничивающий размер тела запроса max байтами.
+// Чтение сверх предела завершается ошибкой *http.MaxBytesError, на которую обработчики отвечают 413.
+// Административные маршруты не ограничиваются: резервные копии могут быть больше пакетов метрик.
+func bodyLimitMiddleware(max int64) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !strings.HasPrefix(r.URL.Path, "/admin/") {
+				r.Body = http.MaxBytesReader(w, r.Body, max)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// clientIP возвращает адрес клиента из заголовка X-Real-IP, а при его отсутствии — адрес соединения.
+func clientIP(r *http.Request) string {
+	if addr := r.Header.Get("X-Real-IP"); addr != "" {
+		return addr
+	}
+	return remoteIP(r)
+}
+
+// remoteIP возвращает адрес соединения клиента.
+func remoteIP(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
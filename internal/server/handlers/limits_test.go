@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/invinciblewest/metrics/internal/ratelimit"
+	"github.com/invinciblewest/metrics/internal/server/services"
+	"github.com/invinciblewest/metrics/internal/storage/memstorage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimitMiddleware(t *testing.T) {
+	service := services.NewMetricsService(memstorage.NewMemStorage("", false))
+	server := httptest.NewServer(GetRouter(NewHandler(service), nil, nil, WithRateLimit(ratelimit.NewLimiter(0.1, 2))))
+	defer server.Close()
+
+	send := func(realIP string) *resty.Response {
+		resp, err := resty.New().R().SetHeader("X-Real-IP", realIP).Post(server.URL + "/update/gauge/test/1")
+		require.NoError(t, err)
+		return resp
+	}
+
+	// Квота учитывается по адресу соединения: новый X-Real-IP в каждом запросе ее не сбрасывает.
+	assert.Equal(t, http.StatusOK, send("10.0.0.1").StatusCode())
+	assert.Equal(t, http.StatusOK, send("10.0.0.2").StatusCode())
+	resp := send("10.0.0.3")
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode())
+	assert.Equal(t, "10", resp.Header().Get("Retry-After"))
+	assert.Contains(t, resp.String(), "rate limit exceeded")
+
+	t.Run("connection address", func(t *testing.T) {
+		handler := rateLimitMiddleware(ratelimit.NewLimiter(0.1, 1))(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}))
+		serve := func(remoteAddr string) int {
+			req := httptest.NewRequest(http.MethodPost, "/update/gauge/test/1", nil)
+			req.RemoteAddr = remoteAddr
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			return rec.Code
+		}
+		assert.Equal(t, http.StatusOK, serve("10.0.0.1:1000"))
+		assert.Equal(t, http.StatusTooManyRequests, serve("10.0.0.1:2000"))
+		assert.Equal(t, http.StatusOK, serve("10.0.0.2:1000"))
+	})
+}
+
+func TestLimits(t *testing.T) {
+	service := services.NewMetricsService(memstorage.NewMemStorage("", false),
+		services.WithMaxBatchSize(2),
+		services.WithMaxMetrics(3),
+	)
+	server := httptest.NewServer(GetRouter(NewHandler(service), nil, nil, WithMaxBodySize(256)))
+	defer server.Close()
+
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	_, err := gz.Write([]byte(`[{"id":"` + strings.Repeat("a", 1024) + `","type":"gauge","value":1}]`))
+	require.NoError(t, err)
+	require.NoError(t, gz.Close())
+	require.Less(t, compressed.Len(), 256)
+
+	tests := []struct {
+		name         string
+		path         string
+		body         []byte
+		gzip         bool
+		expectedCode int
+		expectedBody string
+	}{
+		{
+			name:         "body too large",
+			path:         "/updates/",
+			body:         []byte(`[{"id":"` + strings.Repeat("a", 512) + `","type":"gauge","value":1}]`),
+			expectedCode: http.StatusRequestEntityTooLarge,
+			expectedBody: `{"error":{"code":"body_too_large","message":"request body too large, limit 256 bytes"}}`,
+		},
+		{
+			name:         "decompressed body too large",
+			path:         "/updates/",
+			body:         compressed.Bytes(),
+			gzip:         true,
+			expectedCode: http.StatusRequestEntityTooLarge,
+			expectedBody: `{"error":{"code":"body_too_large","message":"request body too large, limit 256 bytes"}}`,
+		},
+		{
+			name:         "batch too large",
+			path:         "/updates/",
+			body:         []byte(`[{"id":"a","type":"gauge","value":1},{"id":"b","type":"gauge","value":1},{"id":"c","type":"gauge","value":1}]`),
+			expectedCode: http.StatusRequestEntityTooLarge,
+			expectedBody: `{"error":{"code":"batch_too_large","message":"batch too large: 3 metrics, limit 2"}}`,
+		},
+		{
+			name:         "within limits",
+			path:         "/updates/",
+			body:         []byte(`[{"id":"a","type":"gauge","value":1},{"id":"b","type":"gauge","value":1}]`),
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "last distinct metric",
+			path:         "/update/",
+			body:         []byte(`{"id":"c","type":"gauge","value":1}`),
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "distinct metrics limit",
+			path:         "/update/",
+			body:         []byte(`{"id":"d","type":"gauge","value":1}`),
+			expectedCode: http.StatusTooManyRequests,
+			expectedBody: `{"error":{"code":"quota_exceeded","message":"distinct metrics limit exceeded: limit 3, metric \"d\""}}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := resty.New().R().
+				SetHeader("Content-Type", "application/json").
+				SetBody(test.body)
+			if test.gzip {
+				req.SetHeader("Content-Encoding", "gzip")
+			}
+			resp, err := req.Post(server.URL + test.path)
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedCode, resp.StatusCode())
+			if test.expectedBody != "" {
+				assert.JSONEq(t, test.expectedBody, resp.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/invinciblewest/metrics/internal/logger"
+	"github.com/invinciblewest/metrics/internal/server/services"
+	"github.com/invinciblewest/metrics/internal/storage"
+	"go.uber.org/zap"
+)
+
+// GetRate возвращает скорость роста счетчика, имя которого получено из URL-параметра.
+// Необязательный параметр window (например, 5m) задает интервал, на котором вычисляется скорость;
+// без него скорость вычисляется между двумя последними записанными значениями счетчика.
+// Скорость отдается только этим маршрутом: тело ответа — JSON-объект services.Rate, в поле rate которого
+// прирост счетчика в секунду, а ответы /value для счетчиков остаются прежними.
+func (h *Handler) GetRate(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	name := chi.URLParam(r, "name")
+
+	var window time.Duration
+	if raw := r.URL.Query().Get("window"); raw != "" {
+		var err error
+		if window, err = time.ParseDuration(raw); err != nil || window <= 0 {
+			writeAPIError(w, r, http.StatusBadRequest, APIError{Code: CodeBadQuery, Message: "invalid window " + raw, Field: "window"})
+			return
+		}
+	}
+
+	rate, err := h.service.Rate(ctx, name, window)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) || errors.Is(err, services.ErrNotEnoughSamples) || errors.Is(err, services.ErrEmptyID) {
+			writeError(w, r, http.StatusNotFound, err)
+		} else {
+			logger.Log.Error("failed to compute rate", zap.Error(err))
+			writeError(w, r, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	var buf bytes.Buffer
+	if err = json.NewEncoder(&buf).Encode(rate); err != nil {
+		writeError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if _, err = w.Write(buf.Bytes()); err != nil {
+		logger.Log.Error("failed to write response", zap.Error(err))
+	}
+}
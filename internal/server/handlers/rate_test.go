@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/invinciblewest/metrics/internal/models"
+	"github.com/invinciblewest/metrics/internal/server/services"
+	"github.com/invinciblewest/metrics/internal/storage/memstorage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandler_GetRate(t *testing.T) {
+	service := services.NewMetricsService(memstorage.NewMemStorage("", false))
+	for _, delta := range []int64{10, 20} {
+		_, err := service.Update(context.TODO(), models.Metric{ID: "PollCount", MType: models.TypeCounter, Delta: &delta})
+		require.NoError(t, err)
+	}
+	delta := int64(1)
+	_, err := service.Update(context.TODO(), models.Metric{ID: "Once", MType: models.TypeCounter, Delta: &delta})
+	require.NoError(t, err)
+
+	server := httptest.NewServer(GetRouter(NewHandler(service), nil, nil))
+	defer server.Close()
+
+	tests := []struct {
+		name   string
+		path   string
+		status int
+		code   string
+	}{
+		{name: "last interval", path: "/rate/PollCount", status: http.StatusOK},
+		{name: "window", path: "/rate/PollCount?window=1m", status: http.StatusOK},
+		{name: "bad window", path: "/rate/PollCount?window=soon", status: http.StatusBadRequest, code: CodeBadQuery},
+		{name: "negative window", path: "/rate/PollCount?window=-1m", status: http.StatusBadRequest, code: CodeBadQuery},
+		{name: "unknown counter", path: "/rate/Unknown", status: http.StatusNotFound, code: CodeNotFound},
+		{name: "single sample", path: "/rate/Once", status: http.StatusNotFound, code: CodeNoData},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := resty.New().R().SetHeader("Accept", "application/json").Get(server.URL + tt.path)
+			require.NoError(t, err)
+			assert.Equal(t, tt.status, resp.StatusCode())
+			if tt.code != "" {
+				var body ErrorResponse
+				require.NoError(t, json.Unmarshal(resp.Body(), &body))
+				assert.Equal(t, tt.code, body.Error.Code)
+				return
+			}
+
+			var rate services.Rate
+			require.NoError(t, json.Unmarshal(resp.Body(), &rate))
+			assert.Equal(t, "PollCount", rate.ID)
+			assert.Equal(t, int64(30), rate.Value)
+			assert.Equal(t, int64(20), rate.Increase)
+			assert.Positive(t, rate.Rate)
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/invinciblewest/metrics/internal/logger"
+	"github.com/invinciblewest/metrics/internal/server/remotewrite"
+	"github.com/invinciblewest/metrics/internal/server/services"
+	"github.com/invinciblewest/metrics/internal/storage"
+	"go.uber.org/zap"
+)
+
+// defaultRemoteWriteSize допустимый размер распакованного запроса remote_write, если размер тела не ограничен.
+const defaultRemoteWriteSize = 32 << 20
+
+// RemoteWriteHandler представляет собой обработчик запросов Prometheus remote_write.
+type RemoteWriteHandler struct {
+	receiver *remotewrite.Receiver
+	maxSize  int64
+}
+
+// NewRemoteWriteHandler создает обработчик, передающий ряды запросов в receiver.
+// maxSize ограничивает размер распакованного запроса, нулевое значение означает 32 МиБ.
+func NewRemoteWriteHandler(receiver *remotewrite.Receiver, maxSize int64) *RemoteWriteHandler {
+	if maxSize <= 0 {
+		maxSize = defaultRemoteWriteSize
+	}
+	return &RemoteWriteHandler{
+		receiver: receiver,
+		maxSize:  maxSize,
+	}
+}
+
+// Write принимает запрос remote_write версии 1: protobuf prometheus.WriteRequest, сжатый snappy.
+// Запросы версии 2 отклоняются с кодом 415, чтобы Prometheus перешел на версию 1.
+// Некорректный запрос отклоняется с кодом 400 и не повторяется Prometheus, ошибка хранилища — с кодом 500,
+// а превышение квоты метрик — с кодом 429, после которого запрос повторяется.
+func (h *RemoteWriteHandler) Write(w http.ResponseWriter, r *http.Request) {
+	if contentType := r.Header.Get("Content-Type"); contentType != "" {
+		mediaType, params, err := mime.ParseMediaType(contentType)
+		if err != nil || mediaType != "application/x-protobuf" ||
+			(params["proto"] != "" && params["proto"] != "prometheus.WriteRequest") {
+			writeAPIError(w, r, http.StatusUnsupportedMediaType, APIError{Code: CodeUnsupportedType, Message: "unsupported content type " + contentType})
+			return
+		}
+	}
+	if encoding := r.Header.Get("Content-Encoding"); !strings.EqualFold(encoding, "snappy") {
+		writeAPIError(w, r, http.StatusBadRequest, APIError{Code: CodeBadRequest, Message: "unsupported content encoding " + encoding})
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	req, err := remotewrite.Decode(body, h.maxSize)
+	if err != nil {
+		if errors.Is(err, remotewrite.ErrTooLarge) {
+			writeAPIError(w, r, http.StatusRequestEntityTooLarge, APIError{Code: CodeBodyTooLarge, Message: err.Error()})
+		} else {
+			writeError(w, r, http.StatusBadRequest, err)
+		}
+		return
+	}
+
+	if err = h.receiver.Receive(r.Context(), req); err != nil {
+		var itemErr *services.ItemError
+		if errors.As(err, &itemErr) || errors.Is(err, storage.ErrWrongType) {
+			writeError(w, r, http.StatusBadRequest, err)
+		} else {
+			logger.Log.Error("failed to apply remote write", zap.Error(err))
+			writeError(w, r, http.StatusInternalServerError, err)
+		}
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/invinciblewest/metrics/internal/models"
+	"github.com/invinciblewest/metrics/internal/server/remotewrite"
+	"github.com/invinciblewest/metrics/internal/server/services"
+	"github.com/invinciblewest/metrics/internal/signature"
+	"github.com/invinciblewest/metrics/internal/storage/memstorage"
+	"github.com/invinciblewest/metrics/internal/tokens"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRemoteWriteHandler_Write(t *testing.T) {
+	service := services.NewMetricsService(memstorage.NewMemStorage("", false))
+	handler := NewRemoteWriteHandler(remotewrite.NewReceiver(&service), 1024)
+	server := httptest.NewServer(GetRouter(NewHandler(service), nil, nil, WithRemoteWrite(handler)))
+	defer server.Close()
+
+	write := func(value float64, timestamp int64) []byte {
+		return remotewrite.Encode(remotewrite.WriteRequest{Series: []remotewrite.TimeSeries{{
+			Labels:  []remotewrite.Label{{Name: "__name__", Value: "requests_total"}, {Name: "job", Value: "api"}},
+			Samples: []remotewrite.Sample{{Value: value, Timestamp: timestamp}},
+		}}})
+	}
+	large := remotewrite.Encode(remotewrite.WriteRequest{Series: []remotewrite.TimeSeries{{
+		Labels: []remotewrite.Label{{Name: "__name__", Value: string(make([]byte, 2048))}},
+	}}})
+
+	tests := []struct {
+		name        string
+		contentType string
+		encoding    string
+		body        []byte
+		status      int
+		code        string
+	}{
+		{name: "first write", contentType: "application/x-protobuf", encoding: "snappy", body: write(10, 1000), status: http.StatusNoContent},
+		{name: "second write", contentType: "application/x-protobuf", encoding: "snappy", body: write(25, 2000), status: http.StatusNoContent},
+		{name: "repeated write", contentType: "application/x-protobuf", encoding: "snappy", body: write(25, 2000), status: http.StatusNoContent},
+		{name: "not snappy", contentType: "application/x-protobuf", encoding: "gzip", body: write(30, 4000), status: http.StatusBadRequest, code: CodeBadRequest},
+		{name: "corrupt body", contentType: "application/x-protobuf", encoding: "snappy", body: []byte("garbage"), status: http.StatusBadRequest, code: CodeBadRequest},
+		{name: "too large", contentType: "application/x-protobuf", encoding: "snappy", body: large, status: http.StatusRequestEntityTooLarge, code: CodeBodyTooLarge},
+		{
+			name:        "remote write 2.0",
+			contentType: "application/x-protobuf;proto=io.prometheus.write.v2.Request",
+			encoding:    "snappy",
+			body:        write(30, 4000),
+			status:      http.StatusUnsupportedMediaType,
+			code:        CodeUnsupportedType,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := resty.New().R().
+				SetHeader("Accept", "application/json").
+				SetHeader("Content-Type", tt.contentType).
+				SetHeader("Content-Encoding", tt.encoding).
+				SetBody(tt.body).
+				Post(server.URL + "/api/v1/write")
+			require.NoError(t, err)
+			assert.Equal(t, tt.status, resp.StatusCode())
+			if tt.code != "" {
+				var body ErrorResponse
+				require.NoError(t, json.Unmarshal(resp.Body(), &body))
+				assert.Equal(t, tt.code, body.Error.Code)
+			}
+		})
+	}
+
+	metric, err := service.Get(context.TODO(), models.TypeCounter, `requests_total{job="api"}`)
+	require.NoError(t, err)
+	assert.Equal(t, int64(25), *metric.Delta)
+}
+
+func TestRemoteWriteHandler_Strict(t *testing.T) {
+	ctx := context.TODO()
+	store, err := tokens.NewFileStore(filepath.Join(t.TempDir(), "tokens.json"))
+	require.NoError(t, err)
+	secret, _, err := tokens.Issue(ctx, store, "prometheus", []string{"requests"}, false)
+	require.NoError(t, err)
+
+	body := remotewrite.Encode(remotewrite.WriteRequest{Series: []remotewrite.TimeSeries{{
+		Labels:  []remotewrite.Label{{Name: "__name__", Value: "requests_total"}},
+		Samples: []remotewrite.Sample{{Value: 1, Timestamp: 1000}},
+	}}})
+	newRouter := func(opts ...RouterOption) *httptest.Server {
+		service := services.NewMetricsService(memstorage.NewMemStorage("", false))
+		handler := NewRemoteWriteHandler(remotewrite.NewReceiver(&service), 0)
+		opts = append(opts, WithHashPolicy(true, time.Minute), WithRemoteWrite(handler))
+		server := httptest.NewServer(GetRouter(NewHandler(service), signature.NewKeys("key"), nil, opts...))
+		t.Cleanup(server.Close)
+		return server
+	}
+
+	tests := []struct {
+		name   string
+		server *httptest.Server
+		token  string
+		status int
+	}{
+		{name: "unsigned without tokens", server: newRouter(), status: http.StatusUnauthorized},
+		{name: "no token", server: newRouter(WithTokens(store)), status: http.StatusUnauthorized},
+		{name: "token", server: newRouter(WithTokens(store)), token: secret, status: http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := resty.New().R().
+				SetAuthToken(tt.token).
+				SetHeader("Content-Type", "application/x-protobuf").
+				SetHeader("Content-Encoding", "snappy").
+				SetBody(body).
+				Post(tt.server.URL + "/api/v1/write")
+			require.NoError(t, err)
+			assert.Equal(t, tt.status, resp.StatusCode())
+		})
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		service := services.NewMetricsService(memstorage.NewMemStorage("", false))
+		server := httptest.NewServer(GetRouter(NewHandler(service), nil, nil))
+		defer server.Close()
+		resp, err := resty.New().R().SetBody(body).Post(server.URL + "/api/v1/write")
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode())
+	})
+}
@@ -1,23 +1,178 @@
 package handlers
 
 import (
+	"net"
 	"net/http"
+	"time"
 
 	"github.com/invinciblewest/metrics/pkg/encryption"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/invinciblewest/metrics/internal/logger"
+	"github.com/invinciblewest/metrics/internal/ratelimit"
+	"github.com/invinciblewest/metrics/internal/signature"
+	"github.com/invinciblewest/metrics/internal/tokens"
 	"go.uber.org/zap"
 )
 
+// RouterOption задает дополнительную настройку маршрутизатора.
+type RouterOption func(*routerOptions)
+
+type routerOptions struct {
+	admin       *AdminHandler
+	adminToken  string
+	writeSubnet *net.IPNet
+	readSubnet  *net.IPNet
+	hashStrict  bool
+	hashWindow  time.Duration
+	verifier    *encryption.Verifier
+	tokens      tokens.Store
+	limiter     *ratelimit.Limiter
+	maxBodySize int64
+	alerts      *AlertsHandler
+	remoteWrite *RemoteWriteHandler
+}
+
+const (
+	defaultHashWindow     = 5 * time.Minute // defaultHashWindow допустимое отклонение метки времени подписанного запроса.
+	defaultNonceCacheSize = 100000          // defaultNonceCacheSize максимальное количество запоминаемых nonce.
+)
+
+// WithAdmin подключает административные маршруты /admin, доступные по токену.
+func WithAdmin(admin *AdminHandler, token string) RouterOption {
+	return func(o *routerOptions) {
+		o.admin = admin
+		o.adminToken = token
+	}
+}
+
+// WithTrustedSubnet ограничивает доступ к маршрутам записи метрик (/update, /updates, /api/v1/write) подсетью write,
+// а к маршрутам чтения (/value, /query, /rate, /ping) — подсетью read. Значение nil снимает ограничение.
+func WithTrustedSubnet(write, read *net.IPNet) RouterOption {
+	return func(o *routerOptions) {
+		o.writeSubnet = write
+		o.readSubnet = read
+	}
+}
+
+// WithHashPolicy задает политику проверки подписи запросов. В строгом режиме маршруты записи метрик
+// принимают только запросы с подписью, меткой времени и nonce. window задает допустимое отклонение
+// метки времени от времени сервера, нулевое значение означает значение по умолчанию.
+func WithHashPolicy(strict bool, window time.Duration) RouterOption {
+	return func(o *routerOptions) {
+		o.hashStrict = strict
+		o.hashWindow = window
+	}
+}
+
+// WithVerifier включает проверку подписей запросов ключами Ed25519 или ECDSA агентов как альтернативу HMAC.
+func WithVerifier(verifier *encryption.Verifier) RouterOption {
+	return func(o *routerOptions) {
+		o.verifier = verifier
+	}
+}
+
+// WithTokens требует токен агента из store для записи и чтения метрик.
+// Запись ограничивается префиксами имен из области действия токена, чтение — правом read.
+func WithTokens(store tokens.Store) RouterOption {
+	return func(o *routerOptions) {
+		o.tokens = store
+	}
+}
+
+// WithRateLimit ограничивает частоту запросов записи и чтения метрик каждого агента или адреса.
+func WithRateLimit(limiter *ratelimit.Limiter) RouterOption {
+	return func(o *routerOptions) {
+		o.limiter = limiter
+	}
+}
+
+// WithMaxBodySize ограничивает размер тела запроса n байтами. Для сжатых запросов на запись метрик
+// предел действует как для переданного, так и для распакованного тела; для потоковой записи /updates/stream —
+// только для переданного. Нулевое значение снимает ограничение.
+func WithMaxBodySize(n int64) RouterOption {
+	return func(o *routerOptions) {
+		o.maxBodySize = n
+	}
+}
+
+// WithAlerts подключает маршрут /alerts с состоянием оповещений, доступный на тех же условиях, что и чтение метрик.
+func WithAlerts(alerts *AlertsHandler) RouterOption {
+	return func(o *routerOptions) {
+		o.alerts = alerts
+	}
+}
+
+// WithRemoteWrite подключает маршрут /api/v1/write для запросов Prometheus remote_write,
+// доступный на тех же условиях, что и запись метрик. Тело запросов не расшифровывается: Prometheus их не шифрует.
+// В строгом режиме подписи запрос должен быть аутентифицирован токеном агента, если токены заданы, а иначе подписан.
+func WithRemoteWrite(remoteWrite *RemoteWriteHandler) RouterOption {
+	return func(o *routerOptions) {
+		o.remoteWrite = remoteWrite
+	}
+}
+
+// writeGuards возвращает проверки, общие для всех маршрутов записи метрик: доверенная подсеть, токен агента
+// с правом записи и ограничение частоты запросов.
+func writeGuards(options routerOptions) []func(http.Handler) http.Handler {
+	var guards []func(http.Handler) http.Handler
+	if options.writeSubnet != nil {
+		guards = append(guards, trustedSubnetMiddleware(options.writeSubnet))
+	}
+	if options.tokens != nil {
+		guards = append(guards, tokenMiddleware(options.tokens, false))
+	}
+	if options.limiter != nil {
+		guards = append(guards, rateLimitMiddleware(options.limiter))
+	}
+	return guards
+}
+
+// readGuards возвращает проверки, общие для всех маршрутов чтения метрик: доверенная подсеть, токен агента
+// с правом чтения и ограничение частоты запросов.
+func readGuards(options routerOptions) []func(http.Handler) http.Handler {
+	var guards []func(http.Handler) http.Handler
+	if options.readSubnet != nil {
+		guards = append(guards, trustedSubnetMiddleware(options.readSubnet))
+	}
+	if options.tokens != nil {
+		guards = append(guards, tokenMiddleware(options.tokens, true))
+	}
+	if options.limiter != nil {
+		guards = append(guards, rateLimitMiddleware(options.limiter))
+	}
+	return guards
+}
+
 // GetRouter создает и настраивает маршрутизатор Chi с заданным обработчиком.
-func GetRouter(handler *Handler, hashKey string, cryptor *encryption.Cryptor) *chi.Mux {
+// Запросы подписываются ключами keys, тело запросов на запись метрик расшифровывается ключами keyring.
+// Значение nil отключает соответствующую проверку.
+func GetRouter(handler *Handler, keys *signature.Keys, keyring *encryption.Keyring, opts ...RouterOption) *chi.Mux {
+	var options routerOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
 	r := chi.NewRouter()
 
+	r.Use(identityMiddleware())
 	r.Use(logger.Middleware())
 	r.Use(middleware.Recoverer)
-	r.Use(hashMiddleware(hashKey))
+	signed := keys.Enabled() || options.verifier != nil
+	var guard *signature.ReplayGuard
+	if signed {
+		if options.hashWindow <= 0 {
+			options.hashWindow = defaultHashWindow
+		}
+		guard = signature.NewReplayGuard(options.hashWindow, defaultNonceCacheSize)
+	}
+	strict := signed && options.hashStrict
+
+	if options.maxBodySize > 0 {
+		r.Use(bodyLimitMiddleware(options.maxBodySize))
+	}
+	r.Use(hashMiddleware(keys, options.verifier, guard))
 
 	r.Get("/", func(w http.ResponseWriter, req *http.Request) {
 		w.Header().Set("Content-Type", "text/html")
@@ -29,30 +184,91 @@ func GetRouter(handler *Handler, hashKey string, cryptor *encryption.Cryptor) *c
 	})
 
 	r.Route("/updates", func(r chi.Router) {
-		if cryptor != nil {
-			r.Use(encryption.DecryptBodyMiddleware(cryptor))
+		r.Use(writeGuards(options)...)
+		if strict {
+			r.Use(requireSignatureMiddleware(keys, options.verifier))
+		}
+		if keyring != nil {
+			r.Use(encryption.DecryptBodyMiddleware(keyring))
 		}
 		r.Use(gzipMiddleware())
-		r.Post("/", handler.UpdateMetricsBatch)
+		// Размер распакованного тела потоковой записи не ограничивается: она читает метрики по частям.
+		r.Post("/stream", handler.UpdateMetricsStream)
+		if options.maxBodySize > 0 {
+			r.With(bodyLimitMiddleware(options.maxBodySize)).Post("/", handler.UpdateMetricsBatch)
+		} else {
+			r.Post("/", handler.UpdateMetricsBatch)
+		}
 	})
 	r.Route("/update", func(r chi.Router) {
-		if cryptor != nil {
-			r.Use(encryption.DecryptBodyMiddleware(cryptor))
+		r.Use(writeGuards(options)...)
+		if strict {
+			r.Use(requireSignatureMiddleware(keys, options.verifier))
+		}
+		if keyring != nil {
+			r.Use(encryption.DecryptBodyMiddleware(keyring))
 		}
 		r.Use(gzipMiddleware())
+		if options.maxBodySize > 0 {
+			r.Use(bodyLimitMiddleware(options.maxBodySize))
+		}
 		r.Post("/", handler.UpdateMetricJSON)
 		r.Post("/{type}/{name}/{value}", handler.UpdateMetric)
 	})
 	r.Route("/value", func(r chi.Router) {
+		r.Use(readGuards(options)...)
 		r.Use(gzipMiddleware())
 
 		r.Post("/", handler.GetMetricJSON)
 		r.Get("/{type}/{name}", handler.GetMetric)
 	})
+	r.Route("/query", func(r chi.Router) {
+		r.Use(readGuards(options)...)
+		r.Use(gzipMiddleware())
+		r.Get("/", handler.AggregateMetrics)
+	})
+	r.Route("/rate", func(r chi.Router) {
+		r.Use(readGuards(options)...)
+		r.Use(gzipMiddleware())
+		r.Get("/{name}", handler.GetRate)
+	})
+	r.Route("/subscribe", func(r chi.Router) {
+		r.Use(readGuards(options)...)
+		// Поток событий не сжимается: gzip задерживал бы обновления в буфере.
+		r.Get("/", handler.SubscribeMetrics)
+	})
 	r.Route("/ping", func(r chi.Router) {
+		// Проверке доступности не нужен токен и ограничение частоты: ее опрашивают балансировщики и оркестраторы.
+		if options.readSubnet != nil {
+			r.Use(trustedSubnetMiddleware(options.readSubnet))
+		}
 		r.Use(gzipMiddleware())
 		r.Get("/", handler.PingStorage)
 	})
+	if options.alerts != nil {
+		r.Route("/alerts", func(r chi.Router) {
+			r.Use(readGuards(options)...)
+			r.Use(gzipMiddleware())
+			r.Get("/", options.alerts.List)
+		})
+	}
+	if options.remoteWrite != nil {
+		r.Route("/api/v1/write", func(r chi.Router) {
+			r.Use(writeGuards(options)...)
+			// Prometheus не подписывает запросы, поэтому в строгом режиме подпись заменяет токен агента.
+			if strict && options.tokens == nil {
+				r.Use(requireSignatureMiddleware(keys, options.verifier))
+			}
+			r.Post("/", options.remoteWrite.Write)
+		})
+	}
+	if options.admin != nil && options.adminToken != "" {
+		r.Route("/admin", func(r chi.Router) {
+			r.Use(adminAuthMiddleware(options.adminToken))
+			r.Get("/backup", options.admin.Backup)
+			r.Post("/restore", options.admin.Restore)
+		})
+	}
 
 	return r
 }
@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+
+	"github.com/invinciblewest/metrics/internal/logger"
+	"github.com/invinciblewest/metrics/internal/models"
+	"github.com/invinciblewest/metrics/internal/server/services"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultStreamBatchSize = 1000    // defaultStreamBatchSize количество метрик в одном пакете потоковой записи.
+	maxStreamItemSize      = 1 << 20 // maxStreamItemSize максимальный размер одной метрики в потоке в байтах.
+)
+
+// errStreamItemTooLarge возвращается, если одна метрика потока превышает maxStreamItemSize.
+var errStreamItemTooLarge = fmt.Errorf("metric in stream exceeds %d bytes", maxStreamItemSize)
+
+// StreamResponse ответ на потоковую запись метрик. При ошибке содержит количество метрик,
+// записанных до нее, и описание ошибки в том же виде, что и ErrorResponse.
+type StreamResponse struct {
+	Accepted int       `json:"accepted"`        // Accepted количество записанных метрик.
+	Batches  int       `json:"batches"`         // Batches количество записанных пакетов.
+	Replayed int       `json:"replayed"`        // Replayed количество пакетов, пропущенных как уже примененные.
+	Error    *APIError `json:"error,omitempty"` // Error причина, по которой запись прервана.
+}
+
+// UpdateMetricsStream записывает метрики из тела запроса по мере чтения пакетами ограниченного размера.
+// Тело передается в формате NDJSON (application/x-ndjson, по одной метрике на строку) или
+// как массив JSON (application/json). Пакеты применяются по отдельности: при ошибке уже записанные пакеты
+// остаются записанными, а в ответе указывается их количество. Если задан заголовок Idempotency-Key,
+// каждый пакет получает ключ вида <ключ>/<номер пакета>, поэтому повтор запроса с тем же ключом
+// пропускает пакеты, примененные при предыдущей попытке.
+func (h *Handler) UpdateMetricsStream(w http.ResponseWriter, r *http.Request) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "application/x-ndjson" && mediaType != "application/json" {
+		writeAPIError(w, r, http.StatusBadRequest, APIError{Code: CodeUnsupportedType, Message: "content type must be application/x-ndjson or application/json"})
+		return
+	}
+	key := r.Header.Get(HeaderIdempotencyKey)
+	if len(key) > maxIdempotencyKeyLen {
+		writeAPIError(w, r, http.StatusBadRequest, APIError{Code: CodeBadRequest, Message: "idempotency key is too long", Field: HeaderIdempotencyKey})
+		return
+	}
+
+	batchSize := defaultStreamBatchSize
+	if limit := h.service.MaxBatchSize(); limit > 0 && limit < batchSize {
+		batchSize = limit
+	}
+
+	body := &itemLimitReader{r: r.Body, max: maxStreamItemSize}
+	dec := json.NewDecoder(body)
+	var response StreamResponse
+	status := http.StatusOK
+	if fallback, err := h.applyStream(r, dec, body, mediaType == "application/json", key, batchSize, &response); err != nil {
+		logger.Log.Info("stream ingestion stopped", zap.Int("accepted", response.Accepted), zap.Error(err))
+		var apiErr APIError
+		status, apiErr = describeStreamError(err, fallback)
+		response.Error = &apiErr
+	}
+
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(response); err != nil {
+		writeError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		logger.Log.Error("failed to write response", zap.Error(err))
+	}
+}
+
+// applyStream читает метрики из dec и записывает их пакетами по batchSize, обновляя response.
+// Возвращает ошибку, прервавшую запись, и код ответа для нее, если ошибка сама его не определяет.
+func (h *Handler) applyStream(r *http.Request, dec *json.Decoder, body *itemLimitReader, array bool, key string, batchSize int, response *StreamResponse) (int, error) {
+	if array {
+		if err := expectDelim(dec, '['); err != nil {
+			return http.StatusBadRequest, err
+		}
+	}
+
+	batch := make([]models.Metric, 0, batchSize)
+	offset := 0 // offset номер первой метрики пакета в потоке.
+	flush := func() (int, error) {
+		if len(batch) == 0 {
+			return 0, nil
+		}
+		batchKey := ""
+		if key != "" {
+			batchKey = fmt.Sprintf("%s/%d", key, response.Batches+response.Replayed)
+		}
+		replayed, err := h.service.UpdateBatchOnce(r.Context(), batchKey, batch)
+		if err != nil {
+			var itemErr *services.ItemError
+			if errors.As(err, &itemErr) {
+				// Номер метрики указывается относительно всего потока, а не пакета.
+				err = &services.ItemError{Index: offset + itemErr.Index, ID: itemErr.ID, Err: itemErr.Err}
+			}
+			return batchErrorStatus(err), err
+		}
+		if replayed {
+			response.Replayed++
+		} else {
+			response.Batches++
+			response.Accepted += len(batch)
+		}
+		offset += len(batch)
+		batch = batch[:0]
+		return 0, nil
+	}
+
+	for body.reset(); dec.More(); body.reset() {
+		var metric models.Metric
+		if err := dec.Decode(&metric); err != nil {
+			return http.StatusBadRequest, err
+		}
+		batch = append(batch, metric)
+		if len(batch) == batchSize {
+			if status, err := flush(); err != nil {
+				return status, err
+			}
+		}
+	}
+
+	if array {
+		if err := expectDelim(dec, ']'); err != nil {
+			return http.StatusBadRequest, err
+		}
+	}
+	return flush()
+}
+
+// describeStreamError возвращает код ответа и описание ошибки, прервавшей потоковую запись.
+func describeStreamError(err error, fallback int) (int, APIError) {
+	if errors.Is(err, errStreamItemTooLarge) {
+		return http.StatusRequestEntityTooLarge, APIError{Code: CodeBodyTooLarge, Message: err.Error()}
+	}
+	status := errorStatus(err, fallback)
+	return status, describeError(err, status)
+}
+
+// expectDelim читает из dec следующий токен и проверяет, что он равен delim.
+func expectDelim(dec *json.Decoder, delim json.Delim) error {
+	token, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if token != delim {
+		return fmt.Errorf("expected %q at offset %d", delim, dec.InputOffset())
+	}
+	return nil
+}
+
+// itemLimitReader ограничивает количество байт, прочитанных с последнего вызова reset.
+// Декодер читает данные с опережением, поэтому предел соблюдается с точностью до размера его буфера.
+type itemLimitReader struct {
+	r   io.Reader
+	n   int64
+	max int64
+}
+
+// Read читает данные из исходного потока и возвращает errStreamItemTooLarge при превышении предела.
+func (l *itemLimitReader) Read(p []byte) (int, error) {
+	if l.n >= l.max {
+		return 0, errStreamItemTooLarge
+	}
+	if remaining := l.max - l.n; int64(len(p)) > remaining {
+		p = p[:remaining]
+	}
+	n, err := l.r.Read(p)
+	l.n += int64(n)
+	return n, err
+}
+
+// reset начинает отсчет для следующей метрики.
+func (l *itemLimitReader) reset() {
+	l.n = 0
+}
@@ -0,0 +1,208 @@
+package handlers
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/invinciblewest/metrics/internal/server/services"
+	"github.com/invinciblewest/metrics/internal/signature"
+	"github.com/invinciblewest/metrics/internal/storage"
+	"github.com/invinciblewest/metrics/internal/storage/memstorage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdateMetricsStream(t *testing.T) {
+	ndjson := func(n int) string {
+		var sb strings.Builder
+		for i := 0; i < n; i++ {
+			fmt.Fprintf(&sb, `{"id":"g%d","type":"gauge","value":%d}`+"\n", i, i)
+		}
+		return sb.String()
+	}
+
+	tests := []struct {
+		name         string
+		contentType  string
+		body         string
+		expectedCode int
+		expected     StreamResponse
+		stored       int
+	}{
+		{
+			name:         "ndjson",
+			contentType:  "application/x-ndjson",
+			body:         ndjson(7),
+			expectedCode: http.StatusOK,
+			expected:     StreamResponse{Accepted: 7, Batches: 3},
+			stored:       7,
+		},
+		{
+			name:         "json array",
+			contentType:  "application/json",
+			body:         `[{"id":"a","type":"gauge","value":1}, {"id":"b","type":"counter","delta":2}]`,
+			expectedCode: http.StatusOK,
+			expected:     StreamResponse{Accepted: 2, Batches: 1},
+			stored:       2,
+		},
+		{
+			name:         "empty",
+			contentType:  "application/x-ndjson",
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "invalid item mid-stream",
+			contentType:  "application/x-ndjson",
+			body:         ndjson(3) + `{"id":"x","type":"unknown","value":1}` + "\n" + ndjson(2),
+			expectedCode: http.StatusBadRequest,
+			expected: StreamResponse{
+				Accepted: 3,
+				Batches:  1,
+				Error:    &APIError{Code: CodeWrongType, Message: `metric 3 ("x"): wrong type`, Field: "[3].type"},
+			},
+			stored: 3,
+		},
+		{
+			name:         "malformed json",
+			contentType:  "application/x-ndjson",
+			body:         ndjson(3) + "{\n",
+			expectedCode: http.StatusBadRequest,
+			expected: StreamResponse{
+				Accepted: 3,
+				Batches:  1,
+				Error:    &APIError{Code: CodeInvalidJSON, Message: "unexpected end of request body"},
+			},
+			stored: 3,
+		},
+		{
+			name:         "item too large",
+			contentType:  "application/x-ndjson",
+			body:         `{"id":"` + strings.Repeat("a", maxStreamItemSize) + `","type":"gauge","value":1}`,
+			expectedCode: http.StatusRequestEntityTooLarge,
+			expected: StreamResponse{
+				Error: &APIError{Code: CodeBodyTooLarge, Message: errStreamItemTooLarge.Error()},
+			},
+		},
+		{
+			name:         "wrong content type",
+			contentType:  "text/plain",
+			body:         ndjson(1),
+			expectedCode: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := memstorage.NewMemStorage("", false)
+			service := services.NewMetricsService(st, services.WithMaxBatchSize(3))
+			server := httptest.NewServer(GetRouter(NewHandler(service), nil, nil))
+			defer server.Close()
+
+			resp, err := resty.New().R().
+				SetHeader("Content-Type", tt.contentType).
+				SetBody(tt.body).
+				Post(server.URL + "/updates/stream")
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedCode, resp.StatusCode())
+
+			if tt.contentType != "text/plain" {
+				var response StreamResponse
+				require.NoError(t, json.Unmarshal(resp.Body(), &response))
+				assert.Equal(t, tt.expected, response)
+			}
+
+			metrics, err := storage.Collect(st.List(context.TODO()))
+			require.NoError(t, err)
+			assert.Len(t, metrics, tt.stored)
+		})
+	}
+}
+
+func TestUpdateMetricsStream_GzipAndHash(t *testing.T) {
+	const key = "secret"
+	st := memstorage.NewMemStorage("", false)
+	server := httptest.NewServer(GetRouter(NewHandler(services.NewMetricsService(st)), signature.NewKeys(key), nil))
+	defer server.Close()
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	for i := 0; i < 2500; i++ {
+		_, err := fmt.Fprintf(gz, `{"id":"c%d","type":"counter","delta":1}`+"\n", i%10)
+		require.NoError(t, err)
+	}
+	require.NoError(t, gz.Close())
+	body := buf.Bytes()
+
+	timestamp := signature.Timestamp(time.Now())
+	resp, err := resty.New().R().
+		SetHeader("Content-Type", "application/x-ndjson").
+		SetHeader("Content-Encoding", "gzip").
+		SetHeader(signature.HeaderTimestamp, timestamp).
+		SetHeader(signature.HeaderNonce, "nonce-1").
+		SetHeader(signature.HeaderHash, base64.StdEncoding.EncodeToString(signature.Sum(key, http.MethodPost, "/updates/stream", timestamp, "nonce-1", body))).
+		SetBody(body).
+		Post(server.URL + "/updates/stream")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode())
+	assert.JSONEq(t, `{"accepted":2500,"batches":3,"replayed":0}`, resp.String())
+
+	counter, err := st.GetCounter(context.TODO(), "c0")
+	require.NoError(t, err)
+	assert.Equal(t, int64(250), *counter.Delta)
+
+	resp, err = resty.New().R().
+		SetHeader("Content-Type", "application/x-ndjson").
+		SetHeader("Content-Encoding", "gzip").
+		SetBody(body).
+		Post(server.URL + "/updates/stream")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode(), "unsigned requests are accepted in non-strict mode")
+
+	resp, err = resty.New().R().
+		SetHeader("Content-Type", "application/x-ndjson").
+		SetHeader("Content-Encoding", "gzip").
+		SetHeader(signature.HeaderHash, base64.StdEncoding.EncodeToString([]byte("bad"))).
+		SetBody(body).
+		Post(server.URL + "/updates/stream")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode())
+}
+
+func TestUpdateMetricsStream_IdempotencyKey(t *testing.T) {
+	st := memstorage.NewMemStorage("", false)
+	service := services.NewMetricsService(st, services.WithMaxBatchSize(2), services.WithIdempotencyWindow(time.Minute))
+	server := httptest.NewServer(GetRouter(NewHandler(service), nil, nil))
+	defer server.Close()
+
+	send := func(body string) *resty.Response {
+		resp, err := resty.New().R().
+			SetHeader("Content-Type", "application/x-ndjson").
+			SetHeader(HeaderIdempotencyKey, "report-1").
+			SetBody(body).
+			Post(server.URL + "/updates/stream")
+		require.NoError(t, err)
+		return resp
+	}
+	item := `{"id":"PollCount","type":"counter","delta":1}` + "\n"
+
+	// Первая попытка прерывается после двух пакетов.
+	resp := send(strings.Repeat(item, 4) + "{\n")
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode())
+
+	resp = send(strings.Repeat(item, 5))
+	assert.Equal(t, http.StatusOK, resp.StatusCode())
+	assert.JSONEq(t, `{"accepted":1,"batches":1,"replayed":2}`, resp.String())
+
+	counter, err := st.GetCounter(context.TODO(), "PollCount")
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), *counter.Delta)
+}
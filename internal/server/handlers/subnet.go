@@ -0,0 +1,27 @@
+package handlers
+
+import (
+	"net"
+	"net/http"
+
+	"github.com/invinciblewest/metrics/internal/logger"
+	"go.uber.org/zap"
+)
+
+// trustedSubnetMiddleware создает middleware, пропускающий только запросы из доверенной подсети.
+// Адрес клиента берется из заголовка X-Real-IP, а при его отсутствии — из адреса соединения.
+func trustedSubnetMiddleware(subnet *net.IPNet) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			addr := clientIP(r)
+			ip := net.ParseIP(addr)
+			if ip == nil || !subnet.Contains(ip) {
+				logger.Log.Info("request from untrusted address", zap.String("ip", addr))
+				writeAPIError(w, r, http.StatusForbidden, APIError{Code: CodeForbidden, Message: "address is not in trusted subnet"})
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/invinciblewest/metrics/internal/server/services"
+	"github.com/invinciblewest/metrics/internal/storage/memstorage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrustedSubnetMiddleware(t *testing.T) {
+	_, write, err := net.ParseCIDR("192.168.1.0/24")
+	require.NoError(t, err)
+	_, read, err := net.ParseCIDR("127.0.0.0/8")
+	require.NoError(t, err)
+
+	service := services.NewMetricsService(memstorage.NewMemStorage("", false))
+	server := httptest.NewServer(GetRouter(NewHandler(service), nil, nil, WithTrustedSubnet(write, read)))
+	defer server.Close()
+
+	tests := []struct {
+		name         string
+		method       string
+		path         string
+		realIP       string
+		expectedCode int
+	}{
+		{
+			name:         "trusted header",
+			method:       http.MethodPost,
+			path:         "/update/gauge/test/1",
+			realIP:       "192.168.1.10",
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "untrusted header",
+			method:       http.MethodPost,
+			path:         "/update/gauge/test/1",
+			realIP:       "10.0.0.1",
+			expectedCode: http.StatusForbidden,
+		},
+		{
+			name:         "invalid header",
+			method:       http.MethodPost,
+			path:         "/updates/",
+			realIP:       "not an ip",
+			expectedCode: http.StatusForbidden,
+		},
+		{
+			name:         "connection address outside subnet",
+			method:       http.MethodPost,
+			path:         "/updates/",
+			expectedCode: http.StatusForbidden,
+		},
+		{
+			name:         "read from connection address",
+			method:       http.MethodGet,
+			path:         "/value/gauge/test",
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "ping from untrusted address",
+			method:       http.MethodGet,
+			path:         "/ping/",
+			realIP:       "192.168.1.10",
+			expectedCode: http.StatusForbidden,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := resty.New().R()
+			if test.realIP != "" {
+				req.SetHeader("X-Real-IP", test.realIP)
+			}
+			resp, err := req.Execute(test.method, server.URL+test.path)
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedCode, resp.StatusCode())
+		})
+	}
+}
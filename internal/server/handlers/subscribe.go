@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/invinciblewest/metrics/internal/logger"
+	"github.com/invinciblewest/metrics/internal/server/services"
+	"go.uber.org/zap"
+)
+
+const (
+	EventMetric = "metric" // EventMetric событие с текущим значением обновленной метрики.
+	EventError  = "error"  // EventError событие с причиной, по которой сервер закрывает подписку.
+)
+
+// SubscribeMetrics передает клиенту обновления метрик в формате Server-Sent Events.
+// Метрики выбираются параметрами запроса id (имя метрики) и pattern (шаблон имени в формате path.Match),
+// каждый из которых можно указать несколько раз; без параметров передаются обновления всех метрик.
+// Каждое обновление передается событием metric с метрикой в том же виде, что и ответ /value.
+// В отсутствие обновлений сервер периодически отправляет комментарий, чтобы соединение не закрывалось
+// промежуточными прокси. Если клиент не успевает читать обновления, сервер отправляет событие error
+// с кодом slow_consumer и закрывает соединение; клиенту следует переподключиться.
+func (h *Handler) SubscribeMetrics(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	sub, err := h.service.Subscribe(services.SubscriptionFilter{IDs: query["id"], Patterns: query["pattern"]})
+	if err != nil {
+		writeAPIError(w, r, http.StatusBadRequest, APIError{Code: CodeBadQuery, Message: "malformed pattern", Field: "pattern"})
+		return
+	}
+	defer sub.Close()
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if err = rc.Flush(); err != nil {
+		logger.Log.Error("streaming is not supported", zap.Error(err))
+		return
+	}
+
+	heartbeat := time.NewTicker(h.service.Heartbeat())
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case metric := <-sub.Updates():
+			err = writeEvent(w, EventMetric, metric)
+		case <-heartbeat.C:
+			_, err = fmt.Fprint(w, ": heartbeat\n\n")
+		case <-sub.Done():
+			if errors.Is(sub.Err(), services.ErrSlowConsumer) {
+				logger.Log.Info("slow subscriber dropped")
+				err = writeEvent(w, EventError, ErrorResponse{Error: APIError{Code: CodeSlowConsumer, Message: sub.Err().Error()}})
+				if err == nil {
+					err = rc.Flush()
+				}
+			}
+			if err != nil {
+				logger.Log.Info("failed to write event", zap.Error(err))
+			}
+			return
+		case <-r.Context().Done():
+			return
+		}
+
+		if err == nil {
+			err = rc.Flush()
+		}
+		if err != nil {
+			logger.Log.Info("subscriber disconnected", zap.Error(err))
+			return
+		}
+	}
+}
+
+// writeEvent записывает событие Server-Sent Events с данными в формате JSON.
+func writeEvent(w http.ResponseWriter, event string, data any) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, payload)
+	return err
+}
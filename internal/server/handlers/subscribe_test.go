@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/invinciblewest/metrics/internal/server/services"
+	"github.com/invinciblewest/metrics/internal/storage/memstorage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubscribeMetrics(t *testing.T) {
+	subscribe := func(t *testing.T, url string) (*bufio.Reader, func()) {
+		ctx, cancel := context.WithCancel(context.TODO())
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		require.NoError(t, err)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+		return bufio.NewReader(resp.Body), func() {
+			cancel()
+			resp.Body.Close()
+		}
+	}
+	// readEvent читает строки одного события до пустой строки.
+	readEvent := func(t *testing.T, r *bufio.Reader) string {
+		var lines []string
+		for {
+			line, err := r.ReadString('\n')
+			require.NoError(t, err)
+			if line == "\n" {
+				return strings.Join(lines, "")
+			}
+			lines = append(lines, line)
+		}
+	}
+
+	t.Run("updates", func(t *testing.T) {
+		service := services.NewMetricsService(memstorage.NewMemStorage("", false))
+		server := httptest.NewServer(GetRouter(NewHandler(service), nil, nil))
+		defer server.Close()
+
+		events, stop := subscribe(t, server.URL+"/subscribe/?id=PollCount&pattern=cpu.*")
+		defer stop()
+
+		client := resty.New()
+		_, err := client.R().Post(server.URL + "/update/counter/PollCount/2")
+		require.NoError(t, err)
+		_, err = client.R().Post(server.URL + "/update/gauge/Alloc/1")
+		require.NoError(t, err)
+		_, err = client.R().
+			SetHeader("Content-Type", "application/json").
+			SetBody(`[{"id":"cpu.0","type":"gauge","value":0.5},{"id":"PollCount","type":"counter","delta":3}]`).
+			Post(server.URL + "/updates/")
+		require.NoError(t, err)
+
+		assert.Equal(t, "event: metric\ndata: {\"id\":\"PollCount\",\"type\":\"counter\",\"delta\":2}\n", readEvent(t, events))
+		assert.Equal(t, "event: metric\ndata: {\"id\":\"cpu.0\",\"type\":\"gauge\",\"value\":0.5}\n", readEvent(t, events))
+		assert.Equal(t, "event: metric\ndata: {\"id\":\"PollCount\",\"type\":\"counter\",\"delta\":5}\n", readEvent(t, events))
+	})
+	t.Run("heartbeat", func(t *testing.T) {
+		service := services.NewMetricsService(memstorage.NewMemStorage("", false), services.WithHeartbeat(10*time.Millisecond))
+		server := httptest.NewServer(GetRouter(NewHandler(service), nil, nil))
+		defer server.Close()
+
+		events, stop := subscribe(t, server.URL+"/subscribe/")
+		defer stop()
+		assert.Equal(t, ": heartbeat\n", readEvent(t, events))
+	})
+	t.Run("bad pattern", func(t *testing.T) {
+		service := services.NewMetricsService(memstorage.NewMemStorage("", false))
+		server := httptest.NewServer(GetRouter(NewHandler(service), nil, nil))
+		defer server.Close()
+
+		resp, err := resty.New().R().SetHeader("Accept", "application/json").Get(server.URL + "/subscribe/?pattern=cpu[")
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode())
+		assert.JSONEq(t, `{"error":{"code":"bad_query","message":"malformed pattern","field":"pattern"}}`, resp.String())
+	})
+}
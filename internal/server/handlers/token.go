@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/invinciblewest/metrics/internal/identity"
+	"github.com/invinciblewest/metrics/internal/logger"
+	"github.com/invinciblewest/metrics/internal/tokens"
+	"go.uber.org/zap"
+)
+
+// tokenMiddleware создает middleware, пропускающий только запросы с действующим токеном агента
+// в заголовке Authorization. Токен и имя агента сохраняются в контексте запроса: ограничения
+// на имена записываемых метрик проверяет сервис. Если read задан, токен должен разрешать чтение.
+func tokenMiddleware(store tokens.Store, read bool) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			secret, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			token, err := tokens.Authenticate(r.Context(), store, secret)
+			if err != nil {
+				if errors.Is(err, tokens.ErrInvalidToken) {
+					logger.Log.Info("request with invalid token rejected")
+					w.Header().Set("WWW-Authenticate", "Bearer")
+					writeError(w, r, http.StatusUnauthorized, err)
+				} else {
+					logger.Log.Error("failed to look up token", zap.Error(err))
+					writeError(w, r, http.StatusInternalServerError, err)
+				}
+				return
+			}
+			if read && !token.Read {
+				logger.Log.Info("token without read scope rejected", zap.String("agent", token.Agent))
+				writeAPIError(w, r, http.StatusForbidden, APIError{Code: CodeForbidden, Message: "token does not allow reading metrics"})
+				return
+			}
+
+			ctx := tokens.WithToken(r.Context(), token)
+			if _, ok := identity.Agent(ctx); !ok {
+				ctx = identity.WithAgent(ctx, token.Agent)
+			}
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/invinciblewest/metrics/internal/server/services"
+	"github.com/invinciblewest/metrics/internal/storage/memstorage"
+	"github.com/invinciblewest/metrics/internal/tokens"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenMiddleware(t *testing.T) {
+	ctx := context.TODO()
+	store, err := tokens.NewFileStore(filepath.Join(t.TempDir(), "tokens.json"))
+	require.NoError(t, err)
+	writer, _, err := tokens.Issue(ctx, store, "host1", []string{"host1."}, false)
+	require.NoError(t, err)
+	reader, _, err := tokens.Issue(ctx, store, "dashboard", []string{"-"}, true)
+	require.NoError(t, err)
+
+	service := services.NewMetricsService(memstorage.NewMemStorage("", false))
+	server := httptest.NewServer(GetRouter(NewHandler(service), nil, nil, WithTokens(store)))
+	defer server.Close()
+
+	tests := []struct {
+		name         string
+		method       string
+		path         string
+		token        string
+		body         string
+		expectedCode int
+	}{
+		{
+			name:         "no token",
+			method:       http.MethodPost,
+			path:         "/update/gauge/host1.cpu/1",
+			expectedCode: http.StatusUnauthorized,
+		},
+		{
+			name:         "unknown token",
+			method:       http.MethodPost,
+			path:         "/update/gauge/host1.cpu/1",
+			token:        "mt_unknown",
+			expectedCode: http.StatusUnauthorized,
+		},
+		{
+			name:         "write in scope",
+			method:       http.MethodPost,
+			path:         "/update/gauge/host1.cpu/1",
+			token:        writer,
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "write out of scope",
+			method:       http.MethodPost,
+			path:         "/update/gauge/host2.cpu/1",
+			token:        writer,
+			expectedCode: http.StatusForbidden,
+		},
+		{
+			name:         "batch with metric out of scope",
+			method:       http.MethodPost,
+			path:         "/updates/",
+			token:        writer,
+			body:         `[{"id":"host1.mem","type":"gauge","value":1},{"id":"host2.mem","type":"gauge","value":1}]`,
+			expectedCode: http.StatusForbidden,
+		},
+		{
+			name:         "read without scope",
+			method:       http.MethodGet,
+			path:         "/value/gauge/host1.cpu",
+			token:        writer,
+			expectedCode: http.StatusForbidden,
+		},
+		{
+			name:         "read with scope",
+			method:       http.MethodGet,
+			path:         "/value/gauge/host1.cpu",
+			token:        reader,
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "ping without token",
+			method:       http.MethodGet,
+			path:         "/ping/",
+			expectedCode: http.StatusOK,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := resty.New().R()
+			if test.token != "" {
+				req.SetAuthToken(test.token)
+			}
+			if test.body != "" {
+				req.SetHeader("Content-Type", "application/json").SetBody(test.body)
+			}
+			resp, err := req.Execute(test.method, server.URL+test.path)
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedCode, resp.StatusCode())
+		})
+	}
+}
@@ -0,0 +1,450 @@
+package recording
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/invinciblewest/metrics/internal/models"
+	"github.com/invinciblewest/metrics/internal/storage"
+)
+
+var (
+	ErrSyntax = errors.New("syntax error")               // ErrSyntax возвращается для выражения, которое не удалось разобрать.
+	ErrNoData = errors.New("no data for the expression") // ErrNoData возвращается, если для вычисления выражения недостаточно данных.
+)
+
+// Expr разобранное выражение правила записи.
+type Expr struct {
+	source string
+	root   node
+}
+
+// ParseExpr разбирает выражение над метриками. Выражение состоит из чисел, имен метрик, операций
+// +, -, *, / и скобок, функций агрегации sum, avg, min, max и count над метриками, имена которых
+// соответствуют шаблону в формате path.Match, например avg("CPUutilization*") или sum("Disk*", "gauge"),
+// и функции rate(счетчик), возвращающей скорость роста счетчика в секунду между вычислениями.
+func ParseExpr(source string) (*Expr, error) {
+	p := &parser{lexer: lexer{input: source}}
+	p.next()
+	root, err := p.parseSum()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokEOF {
+		return nil, p.errorf("unexpected %s", p.tok)
+	}
+	return &Expr{source: source, root: root}, nil
+}
+
+// String возвращает исходный текст выражения.
+func (e *Expr) String() string {
+	return e.source
+}
+
+// Patterns возвращает шаблоны имен функций агрегации выражения.
+func (e *Expr) Patterns() []string {
+	var patterns []string
+	walk(e.root, func(n node) {
+		if agg, ok := n.(*aggregateNode); ok {
+			patterns = append(patterns, agg.pattern)
+		}
+	})
+	return patterns
+}
+
+// Source источник значений метрик для вычисления выражений.
+type Source interface {
+	Get(ctx context.Context, mType, id string) (models.Metric, error)
+	Aggregate(ctx context.Context, q storage.AggregateQuery) ([]storage.AggregateResult, error)
+}
+
+// Eval вычисляет выражение по текущим значениям метрик source в момент now.
+// Функции rate запоминают значение счетчика, поэтому выражение с ними нельзя вычислять параллельно.
+func (e *Expr) Eval(ctx context.Context, source Source, now time.Time) (float64, error) {
+	return e.root.eval(ctx, &env{source: source, now: now})
+}
+
+// env окружение вычисления выражения.
+type env struct {
+	source Source
+	now    time.Time
+}
+
+// node узел дерева выражения.
+type node interface {
+	eval(ctx context.Context, e *env) (float64, error)
+}
+
+// walk обходит дерево выражения.
+func walk(n node, fn func(node)) {
+	fn(n)
+	switch n := n.(type) {
+	case *binaryNode:
+		walk(n.left, fn)
+		walk(n.right, fn)
+	case *negNode:
+		walk(n.x, fn)
+	}
+}
+
+type numberNode struct {
+	value float64
+}
+
+func (n *numberNode) eval(context.Context, *env) (float64, error) {
+	return n.value, nil
+}
+
+// metricNode значение метрики. Имя ищется среди метрик gauge, затем среди счетчиков.
+type metricNode struct {
+	id string
+}
+
+func (n *metricNode) eval(ctx context.Context, e *env) (float64, error) {
+	if metric, err := e.source.Get(ctx, models.TypeGauge, n.id); err == nil {
+		return *metric.Value, nil
+	}
+	metric, err := e.source.Get(ctx, models.TypeCounter, n.id)
+	if errors.Is(err, storage.ErrNotFound) {
+		return 0, fmt.Errorf("%w: metric %q not found", ErrNoData, n.id)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return float64(*metric.Delta), nil
+}
+
+type binaryNode struct {
+	op          byte
+	left, right node
+}
+
+func (n *binaryNode) eval(ctx context.Context, e *env) (float64, error) {
+	left, err := n.left.eval(ctx, e)
+	if err != nil {
+		return 0, err
+	}
+	right, err := n.right.eval(ctx, e)
+	if err != nil {
+		return 0, err
+	}
+	switch n.op {
+	case '+':
+		return left + right, nil
+	case '-':
+		return left - right, nil
+	case '*':
+		return left * right, nil
+	default:
+		if right == 0 {
+			return 0, fmt.Errorf("%w: division by zero", ErrNoData)
+		}
+		return left / right, nil
+	}
+}
+
+type negNode struct {
+	x node
+}
+
+func (n *negNode) eval(ctx context.Context, e *env) (float64, error) {
+	value, err := n.x.eval(ctx, e)
+	return -value, err
+}
+
+// aggregateNode агрегация значений метрик, имена которых соответствуют шаблону.
+type aggregateNode struct {
+	fn      storage.AggregateFunc
+	pattern string
+	mType   string
+	re      *regexp.Regexp
+}
+
+func (n *aggregateNode) eval(ctx context.Context, e *env) (float64, error) {
+	results, err := e.source.Aggregate(ctx, storage.AggregateQuery{Regexp: n.re, Glob: n.pattern, MType: n.mType, Func: n.fn})
+	if err != nil {
+		return 0, err
+	}
+	if len(results) == 0 || results[0].Value == nil {
+		return 0, fmt.Errorf("%w: no metrics match %q", ErrNoData, n.pattern)
+	}
+	return *results[0].Value, nil
+}
+
+// rateNode скорость роста счетчика в секунду с предыдущего вычисления. Уменьшение счетчика считается
+// сбросом: рост с момента сброса оценивается текущим значением.
+type rateNode struct {
+	id   string
+	prev *sample
+}
+
+// sample значение счетчика в момент вычисления.
+type sample struct {
+	value int64
+	at    time.Time
+}
+
+func (n *rateNode) eval(ctx context.Context, e *env) (float64, error) {
+	metric, err := e.source.Get(ctx, models.TypeCounter, n.id)
+	if errors.Is(err, storage.ErrNotFound) {
+		return 0, fmt.Errorf("%w: counter %q not found", ErrNoData, n.id)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	prev := n.prev
+	n.prev = &sample{value: *metric.Delta, at: e.now}
+	if prev == nil {
+		return 0, fmt.Errorf("%w: first sample of counter %q", ErrNoData, n.id)
+	}
+	elapsed := e.now.Sub(prev.at).Seconds()
+	if elapsed <= 0 {
+		return 0, fmt.Errorf("%w: no time elapsed since the previous sample of %q", ErrNoData, n.id)
+	}
+	increase := *metric.Delta - prev.value
+	if increase < 0 {
+		increase = *metric.Delta
+	}
+	return float64(increase) / elapsed, nil
+}
+
+// parser разбирает выражение методом рекурсивного спуска.
+type parser struct {
+	lexer lexer
+	tok   token
+}
+
+func (p *parser) next() {
+	p.tok = p.lexer.next()
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	return fmt.Errorf("%w at offset %d: %s", ErrSyntax, p.tok.pos, fmt.Sprintf(format, args...))
+}
+
+// parseSum разбирает сложение и вычитание.
+func (p *parser) parseSum() (node, error) {
+	left, err := p.parseProduct()
+	if err != nil {
+		return nil, err
+	}
+	for p.tok.kind == tokOp && (p.tok.text == "+" || p.tok.text == "-") {
+		op := p.tok.text[0]
+		p.next()
+		var right node
+		if right, err = p.parseProduct(); err != nil {
+			return nil, err
+		}
+		left = &binaryNode{op: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+// parseProduct разбирает умножение и деление.
+func (p *parser) parseProduct() (node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.tok.kind == tokOp && (p.tok.text == "*" || p.tok.text == "/") {
+		op := p.tok.text[0]
+		p.next()
+		var right node
+		if right, err = p.parseUnary(); err != nil {
+			return nil, err
+		}
+		left = &binaryNode{op: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+// parseUnary разбирает унарный минус.
+func (p *parser) parseUnary() (node, error) {
+	if p.tok.kind == tokOp && p.tok.text == "-" {
+		p.next()
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &negNode{x: x}, nil
+	}
+	return p.parsePrimary()
+}
+
+// parsePrimary разбирает число, имя метрики, вызов функции или выражение в скобках.
+func (p *parser) parsePrimary() (node, error) {
+	tok := p.tok
+	switch tok.kind {
+	case tokNumber:
+		p.next()
+		value, err := strconv.ParseFloat(tok.text, 64)
+		if err != nil {
+			return nil, p.errorf("malformed number %q", tok.text)
+		}
+		return &numberNode{value: value}, nil
+	case tokIdent:
+		p.next()
+		if p.tok.kind != tokLParen {
+			return &metricNode{id: tok.text}, nil
+		}
+		return p.parseCall(tok.text)
+	case tokLParen:
+		p.next()
+		x, err := p.parseSum()
+		if err != nil {
+			return nil, err
+		}
+		if p.tok.kind != tokRParen {
+			return nil, p.errorf("expected ')', got %s", p.tok)
+		}
+		p.next()
+		return x, nil
+	}
+	return nil, p.errorf("unexpected %s", tok)
+}
+
+// parseCall разбирает аргументы функции name; текущий токен — открывающая скобка.
+func (p *parser) parseCall(name string) (node, error) {
+	p.next()
+	var n node
+	if name == "rate" {
+		if p.tok.kind != tokIdent {
+			return nil, p.errorf("rate expects a counter name, got %s", p.tok)
+		}
+		n = &rateNode{id: p.tok.text}
+		p.next()
+	} else {
+		fn := storage.AggregateFunc(name)
+		if !fn.Valid() {
+			return nil, p.errorf("unknown function %q", name)
+		}
+		if p.tok.kind != tokString {
+			return nil, p.errorf("%s expects a quoted name pattern, got %s", name, p.tok)
+		}
+		agg := &aggregateNode{fn: fn, pattern: p.tok.text}
+		p.next()
+		if p.tok.kind == tokComma {
+			p.next()
+			if p.tok.kind != tokString || (p.tok.text != models.TypeGauge && p.tok.text != models.TypeCounter) {
+				return nil, p.errorf("%s expects a metric type as the second argument, got %s", name, p.tok)
+			}
+			agg.mType = p.tok.text
+			p.next()
+		}
+		re, err := storage.GlobToRegexp(agg.pattern)
+		if err != nil {
+			return nil, p.errorf("malformed pattern %q", agg.pattern)
+		}
+		agg.re = re
+		n = agg
+	}
+	if p.tok.kind != tokRParen {
+		return nil, p.errorf("expected ')', got %s", p.tok)
+	}
+	p.next()
+	return n, nil
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokNumber
+	tokIdent
+	tokString
+	tokOp
+	tokLParen
+	tokRParen
+	tokComma
+	tokInvalid
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokEOF:
+		return "end of expression"
+	case tokString:
+		return strconv.Quote(t.text)
+	}
+	return "'" + t.text + "'"
+}
+
+// lexer разбивает выражение на токены.
+type lexer struct {
+	input string
+	pos   int
+}
+
+func (l *lexer) next() token {
+	for l.pos < len(l.input) && unicode.IsSpace(rune(l.input[l.pos])) {
+		l.pos++
+	}
+	start := l.pos
+	if l.pos >= len(l.input) {
+		return token{kind: tokEOF, pos: start}
+	}
+
+	c := l.input[l.pos]
+	switch {
+	case c >= '0' && c <= '9' || c == '.':
+		l.pos++
+		for l.pos < len(l.input) {
+			c = l.input[l.pos]
+			prev := l.input[l.pos-1]
+			if c >= '0' && c <= '9' || c == '.' || c == 'e' || c == 'E' || (c == '+' || c == '-') && (prev == 'e' || prev == 'E') {
+				l.pos++
+				continue
+			}
+			break
+		}
+		return token{kind: tokNumber, text: l.input[start:l.pos], pos: start}
+	case isIdentStart(c):
+		for l.pos < len(l.input) && isIdentPart(l.input[l.pos]) {
+			l.pos++
+		}
+		return token{kind: tokIdent, text: l.input[start:l.pos], pos: start}
+	case c == '"':
+		end := strings.IndexByte(l.input[l.pos+1:], '"')
+		if end < 0 {
+			l.pos = len(l.input)
+			return token{kind: tokInvalid, text: l.input[start:], pos: start}
+		}
+		l.pos += end + 2
+		return token{kind: tokString, text: l.input[start+1 : l.pos-1], pos: start}
+	}
+
+	l.pos++
+	text := l.input[start:l.pos]
+	switch c {
+	case '+', '-', '*', '/':
+		return token{kind: tokOp, text: text, pos: start}
+	case '(':
+		return token{kind: tokLParen, text: text, pos: start}
+	case ')':
+		return token{kind: tokRParen, text: text, pos: start}
+	case ',':
+		return token{kind: tokComma, text: text, pos: start}
+	}
+	return token{kind: tokInvalid, text: text, pos: start}
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func isIdentPart(c byte) bool {
+	return isIdentStart(c) || c >= '0' && c <= '9' || c == '.' || c == ':'
+}
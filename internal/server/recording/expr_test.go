@@ -0,0 +1,115 @@
+package recording
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/invinciblewest/metrics/internal/models"
+	"github.com/invinciblewest/metrics/internal/server/services"
+	"github.com/invinciblewest/metrics/internal/storage/memstorage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newService(t *testing.T, metrics ...models.Metric) *services.MetricsService {
+	service := services.NewMetricsService(memstorage.NewMemStorage("", false))
+	require.NoError(t, service.UpdateBatch(context.TODO(), metrics))
+	return &service
+}
+
+func gauge(id string, value float64) models.Metric {
+	return models.Metric{ID: id, MType: models.TypeGauge, Value: &value}
+}
+
+func counter(id string, delta int64) models.Metric {
+	return models.Metric{ID: id, MType: models.TypeCounter, Delta: &delta}
+}
+
+func TestExpr_Eval(t *testing.T) {
+	service := newService(t,
+		gauge("TotalMemory", 8e9),
+		gauge("FreeMemory", 2e9),
+		gauge("CPUutilization0", 10),
+		gauge("CPUutilization1", 30),
+		counter("PollCount", 7),
+		counter("CPUutilizationCount", 100),
+	)
+
+	tests := []struct {
+		expr     string
+		expected float64
+		noData   bool
+	}{
+		{expr: "TotalMemory - FreeMemory", expected: 6e9},
+		{expr: "(TotalMemory - FreeMemory) / TotalMemory * 100", expected: 75},
+		{expr: "-FreeMemory + 1e9", expected: -1e9},
+		{expr: "2 * 3 + 4", expected: 10},
+		{expr: "2 * (3 + 4)", expected: 14},
+		{expr: "PollCount * 2", expected: 14},
+		{expr: `avg("CPUutilization*", "gauge")`, expected: 20},
+		{expr: `sum("CPUutilization*")`, expected: 140},
+		{expr: `max("CPUutilization?") - min("CPUutilization?")`, expected: 20},
+		{expr: `count("CPUutilization*")`, expected: 3},
+		{expr: "Missing + 1", noData: true},
+		{expr: `avg("Disk*")`, noData: true},
+		{expr: "TotalMemory / (FreeMemory - FreeMemory)", noData: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			expr, err := ParseExpr(tt.expr)
+			require.NoError(t, err)
+			value, err := expr.Eval(context.TODO(), service, time.Now())
+			if tt.noData {
+				assert.ErrorIs(t, err, ErrNoData)
+				return
+			}
+			require.NoError(t, err)
+			assert.InDelta(t, tt.expected, value, 1e-9)
+		})
+	}
+}
+
+func TestExpr_Rate(t *testing.T) {
+	ctx := context.TODO()
+	service := newService(t, counter("PollCount", 10))
+	expr, err := ParseExpr("rate(PollCount)")
+	require.NoError(t, err)
+
+	start := time.Now()
+	_, err = expr.Eval(ctx, service, start)
+	assert.ErrorIs(t, err, ErrNoData, "first sample has no rate")
+
+	_, err = service.Update(ctx, counter("PollCount", 20))
+	require.NoError(t, err)
+	value, err := expr.Eval(ctx, service, start.Add(10*time.Second))
+	require.NoError(t, err)
+	assert.Equal(t, 2.0, value)
+
+	// Сброс счетчика: рост оценивается текущим значением.
+	reset := newService(t, counter("PollCount", 5))
+	value, err = expr.Eval(ctx, reset, start.Add(15*time.Second))
+	require.NoError(t, err)
+	assert.Equal(t, 1.0, value)
+}
+
+func TestParseExpr_Errors(t *testing.T) {
+	for _, source := range []string{
+		"",
+		"TotalMemory -",
+		"(TotalMemory",
+		"TotalMemory FreeMemory",
+		`median("CPU*")`,
+		"avg(CPUutilization)",
+		`avg("CPU*", "histogram")`,
+		`avg("CPU[")`,
+		"rate(\"PollCount\")",
+		`avg("CPU*`,
+		"TotalMemory % 2",
+	} {
+		t.Run(source, func(t *testing.T) {
+			_, err := ParseExpr(source)
+			assert.ErrorIs(t, err, ErrSyntax)
+		})
+	}
+}
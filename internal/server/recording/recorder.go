@@ -0,0 +1,98 @@
+package recording
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/invinciblewest/metrics/internal/logger"
+	"github.com/invinciblewest/metrics/internal/models"
+	"go.uber.org/zap"
+)
+
+// defaultInterval интервал вычисления правил по умолчанию.
+const defaultInterval = 15 * time.Second
+
+// Target источник метрик, в который записываются результаты правил.
+type Target interface {
+	Source
+	Update(ctx context.Context, metric models.Metric) (models.Metric, error)
+}
+
+// Option задает дополнительную настройку Recorder.
+type Option func(*Recorder)
+
+// WithInterval задает интервал вычисления правил. Нулевое значение оставляет интервал по умолчанию.
+func WithInterval(d time.Duration) Option {
+	return func(r *Recorder) {
+		if d > 0 {
+			r.interval = d
+		}
+	}
+}
+
+// Recorder периодически вычисляет правила записи и сохраняет их результаты.
+type Recorder struct {
+	target   Target
+	rules    []Rule
+	interval time.Duration
+	now      func() time.Time
+	mu       sync.Mutex
+}
+
+// NewRecorder создает вычислитель правил rules, записывающий результаты в target.
+func NewRecorder(target Target, rules []Rule, opts ...Option) *Recorder {
+	r := &Recorder{
+		target:   target,
+		rules:    rules,
+		interval: defaultInterval,
+		now:      time.Now,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// Run вычисляет правила каждые interval до отмены контекста.
+func (r *Recorder) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.Evaluate(ctx)
+		}
+	}
+}
+
+// Evaluate вычисляет правила по порядку и сохраняет их результаты как метрики gauge.
+// Правило, для которого недостаточно данных, например отсутствует метрика или это первое вычисление rate,
+// пропускается до следующего вычисления; прежнее значение производной метрики сохраняется.
+func (r *Recorder) Evaluate(ctx context.Context) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.now()
+	for _, rule := range r.rules {
+		value, err := rule.Expr.Eval(ctx, r.target, now)
+		switch {
+		case errors.Is(err, ErrNoData):
+			logger.Log.Debug("recording rule skipped", zap.String("rule", rule.Name), zap.Error(err))
+			continue
+		case err != nil:
+			logger.Log.Error("failed to evaluate recording rule", zap.String("rule", rule.Name), zap.Error(err))
+			continue
+		case math.IsNaN(value) || math.IsInf(value, 0):
+			logger.Log.Debug("recording rule skipped", zap.String("rule", rule.Name), zap.Float64("value", value))
+			continue
+		}
+		if _, err = r.target.Update(ctx, models.Metric{ID: rule.Name, MType: models.TypeGauge, Value: &value}); err != nil {
+			logger.Log.Error("failed to record metric", zap.String("rule", rule.Name), zap.Error(err))
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package recording
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/invinciblewest/metrics/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		names   []string
+		wantErr bool
+	}{
+		{
+			name: "valid",
+			data: `{"rules":[
+				{"name":"MemoryUsed","expr":"TotalMemory - FreeMemory"},
+				{"name":"MemoryUsedPercent","expr":"MemoryUsed / TotalMemory * 100"},
+				{"name":"AvgCPU","expr":"avg(\"CPUutilization*\")"}
+			]}`,
+			names: []string{"MemoryUsed", "MemoryUsedPercent", "AvgCPU"},
+		},
+		{
+			name:    "syntax error",
+			data:    `{"rules":[{"name":"a","expr":"TotalMemory -"}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "duplicate name",
+			data:    `{"rules":[{"name":"a","expr":"1"},{"name":"a","expr":"2"}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "missing name",
+			data:    `{"rules":[{"expr":"1"}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "output matches pattern",
+			data:    `{"rules":[{"name":"CPUutilizationAvg","expr":"avg(\"CPUutilization*\")"}]}`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, err := ParseRules([]byte(tt.data))
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidRule)
+				return
+			}
+			require.NoError(t, err)
+			names := make([]string, 0, len(rules))
+			for _, rule := range rules {
+				names = append(names, rule.Name)
+			}
+			assert.Equal(t, tt.names, names)
+		})
+	}
+}
+
+func TestRecorder_Evaluate(t *testing.T) {
+	ctx := context.TODO()
+	service := newService(t,
+		gauge("TotalMemory", 8e9),
+		gauge("FreeMemory", 2e9),
+		gauge("CPUutilization0", 10),
+		gauge("CPUutilization1", 30),
+		counter("PollCount", 10),
+	)
+	rules, err := ParseRules([]byte(`{"rules":[
+		{"name":"MemoryUsed","expr":"TotalMemory - FreeMemory"},
+		{"name":"MemoryUsedPercent","expr":"MemoryUsed / TotalMemory * 100"},
+		{"name":"AvgCPU","expr":"avg(\"CPUutilization*\")"},
+		{"name":"PollRate","expr":"rate(PollCount)"},
+		{"name":"Broken","expr":"Missing * 2"}
+	]}`))
+	require.NoError(t, err)
+
+	now := time.Now()
+	recorder := NewRecorder(service, rules)
+	recorder.now = func() time.Time { return now }
+
+	recorder.Evaluate(ctx)
+	get := func(id string) (float64, bool) {
+		metric, getErr := service.Get(ctx, models.TypeGauge, id)
+		if getErr != nil {
+			return 0, false
+		}
+		return *metric.Value, true
+	}
+
+	value, ok := get("MemoryUsed")
+	require.True(t, ok)
+	assert.Equal(t, 6e9, value)
+	value, ok = get("MemoryUsedPercent")
+	require.True(t, ok)
+	assert.Equal(t, 75.0, value)
+	value, ok = get("AvgCPU")
+	require.True(t, ok)
+	assert.Equal(t, 20.0, value)
+	_, ok = get("PollRate")
+	assert.False(t, ok, "rate needs two samples")
+	_, ok = get("Broken")
+	assert.False(t, ok)
+
+	_, err = service.Update(ctx, counter("PollCount", 30))
+	require.NoError(t, err)
+	now = now.Add(15 * time.Second)
+	recorder.Evaluate(ctx)
+	value, ok = get("PollRate")
+	require.True(t, ok)
+	assert.Equal(t, 2.0, value)
+}
@@ -0,0 +1,82 @@
+// Package recording вычисляет правила записи: производные метрики, которые сервер периодически
+// вычисляет по выражениям над существующими метриками и сохраняет как метрики gauge.
+package recording
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+)
+
+// ErrInvalidRule возвращается для правила с некорректным описанием.
+var ErrInvalidRule = errors.New("invalid recording rule")
+
+// Rule правило записи: значение выражения Expr сохраняется как метрика gauge с именем Name.
+type Rule struct {
+	Name string // Name имя производной метрики.
+	Expr *Expr  // Expr выражение над метриками.
+}
+
+// rulesFile структура файла правил.
+type rulesFile struct {
+	Rules []ruleJSON `json:"rules"`
+}
+
+// ruleJSON описание правила в файле.
+type ruleJSON struct {
+	Name string `json:"name"`
+	Expr string `json:"expr"`
+}
+
+// LoadRules читает правила записи из JSON-файла вида {"rules": [{"name": ..., "expr": ...}]}.
+func LoadRules(path string) ([]Rule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseRules(data)
+}
+
+// ParseRules разбирает правила записи в формате файла правил. Правила вычисляются в порядке описания,
+// поэтому выражение может ссылаться на результат предыдущего правила. Результат правила не должен
+// соответствовать шаблонам агрегации: иначе агрегация включала бы в себя производные значения.
+func ParseRules(data []byte) ([]Rule, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	var file rulesFile
+	if err := dec.Decode(&file); err != nil {
+		return nil, err
+	}
+
+	rules := make([]Rule, 0, len(file.Rules))
+	names := make(map[string]struct{}, len(file.Rules))
+	for _, raw := range file.Rules {
+		if raw.Name == "" {
+			return nil, fmt.Errorf("%w: name is required", ErrInvalidRule)
+		}
+		if _, ok := names[raw.Name]; ok {
+			return nil, fmt.Errorf("%w %q: duplicate name", ErrInvalidRule, raw.Name)
+		}
+		names[raw.Name] = struct{}{}
+
+		expr, err := ParseExpr(raw.Expr)
+		if err != nil {
+			return nil, fmt.Errorf("%w %q: %w", ErrInvalidRule, raw.Name, err)
+		}
+		rules = append(rules, Rule{Name: raw.Name, Expr: expr})
+	}
+
+	for _, rule := range rules {
+		for _, pattern := range rule.Expr.Patterns() {
+			for name := range names {
+				if matched, _ := path.Match(pattern, name); matched {
+					return nil, fmt.Errorf("%w %q: pattern %q matches recorded metric %q", ErrInvalidRule, rule.Name, pattern, name)
+				}
+			}
+		}
+	}
+	return rules, nil
+}
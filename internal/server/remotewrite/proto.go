@@ -0,0 +1,242 @@
+// Package remotewrite принимает запросы Prometheus remote_write: сервер метрик может быть приемником
+// для агентов Prometheus наравне с собственными агентами.
+package remotewrite
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/golang/snappy"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+var (
+	ErrMalformed = errors.New("malformed remote write request")
+	ErrTooLarge  = errors.New("remote write request too large")
+)
+
+// MetricType тип метрики Prometheus из метаданных запроса.
+type MetricType int32
+
+// Типы метрик prometheus.MetricMetadata.MetricType.
+const (
+	TypeUnknown        MetricType = 0
+	TypeCounter        MetricType = 1
+	TypeGauge          MetricType = 2
+	TypeHistogram      MetricType = 3
+	TypeGaugeHistogram MetricType = 4
+	TypeSummary        MetricType = 5
+	TypeInfo           MetricType = 6
+	TypeStateset       MetricType = 7
+)
+
+// WriteRequest запрос remote_write версии 1 (prometheus.WriteRequest).
+// Экземпляры и нативные гистограммы не поддерживаются и пропускаются при разборе.
+type WriteRequest struct {
+	Series   []TimeSeries
+	Metadata []Metadata
+}
+
+// TimeSeries временной ряд: метки и значения.
+type TimeSeries struct {
+	Labels  []Label
+	Samples []Sample
+}
+
+// Label метка временного ряда. Имя метрики передается меткой __name__.
+type Label struct {
+	Name  string
+	Value string
+}
+
+// Sample значение ряда с меткой времени в миллисекундах.
+type Sample struct {
+	Value     float64
+	Timestamp int64
+}
+
+// Metadata метаданные семейства метрик.
+type Metadata struct {
+	Type   MetricType
+	Family string
+}
+
+// Name возвращает имя метрики ряда.
+func (ts TimeSeries) Name() string {
+	for _, label := range ts.Labels {
+		if label.Name == "__name__" {
+			return label.Value
+		}
+	}
+	return ""
+}
+
+// Decode распаковывает тело запроса в формате snappy и разбирает его.
+// Запрос, распакованный размер которого больше maxSize, отклоняется до распаковки; 0 снимает ограничение.
+func Decode(body []byte, maxSize int64) (WriteRequest, error) {
+	size, err := snappy.DecodedLen(body)
+	if err != nil {
+		return WriteRequest{}, fmt.Errorf("%w: %w", ErrMalformed, err)
+	}
+	if maxSize > 0 && int64(size) > maxSize {
+		return WriteRequest{}, fmt.Errorf("%w: %d bytes decoded, limit %d", ErrTooLarge, size, maxSize)
+	}
+	data, err := snappy.Decode(nil, body)
+	if err != nil {
+		return WriteRequest{}, fmt.Errorf("%w: %w", ErrMalformed, err)
+	}
+
+	var req WriteRequest
+	err = walk(data, func(num protowire.Number, typ protowire.Type, value []byte) error {
+		switch {
+		case num == 1 && typ == protowire.BytesType:
+			ts, parseErr := parseTimeSeries(value)
+			if parseErr != nil {
+				return parseErr
+			}
+			req.Series = append(req.Series, ts)
+		case num == 3 && typ == protowire.BytesType:
+			md, parseErr := parseMetadata(value)
+			if parseErr != nil {
+				return parseErr
+			}
+			req.Metadata = append(req.Metadata, md)
+		}
+		return nil
+	})
+	if err != nil {
+		return WriteRequest{}, fmt.Errorf("%w: %w", ErrMalformed, err)
+	}
+	return req, nil
+}
+
+// Encode кодирует запрос в protobuf и сжимает его snappy, как это делает Prometheus.
+func Encode(req WriteRequest) []byte {
+	var data []byte
+	for _, ts := range req.Series {
+		var series []byte
+		for _, label := range ts.Labels {
+			var msg []byte
+			msg = protowire.AppendTag(msg, 1, protowire.BytesType)
+			msg = protowire.AppendString(msg, label.Name)
+			msg = protowire.AppendTag(msg, 2, protowire.BytesType)
+			msg = protowire.AppendString(msg, label.Value)
+			series = protowire.AppendTag(series, 1, protowire.BytesType)
+			series = protowire.AppendBytes(series, msg)
+		}
+		for _, sample := range ts.Samples {
+			var msg []byte
+			msg = protowire.AppendTag(msg, 1, protowire.Fixed64Type)
+			msg = protowire.AppendFixed64(msg, math.Float64bits(sample.Value))
+			msg = protowire.AppendTag(msg, 2, protowire.VarintType)
+			msg = protowire.AppendVarint(msg, uint64(sample.Timestamp))
+			series = protowire.AppendTag(series, 2, protowire.BytesType)
+			series = protowire.AppendBytes(series, msg)
+		}
+		data = protowire.AppendTag(data, 1, protowire.BytesType)
+		data = protowire.AppendBytes(data, series)
+	}
+	for _, md := range req.Metadata {
+		var msg []byte
+		msg = protowire.AppendTag(msg, 1, protowire.VarintType)
+		msg = protowire.AppendVarint(msg, uint64(md.Type))
+		msg = protowire.AppendTag(msg, 2, protowire.BytesType)
+		msg = protowire.AppendString(msg, md.Family)
+		data = protowire.AppendTag(data, 3, protowire.BytesType)
+		data = protowire.AppendBytes(data, msg)
+	}
+	return snappy.Encode(nil, data)
+}
+
+func parseTimeSeries(data []byte) (TimeSeries, error) {
+	var ts TimeSeries
+	err := walk(data, func(num protowire.Number, typ protowire.Type, value []byte) error {
+		switch {
+		case num == 1 && typ == protowire.BytesType:
+			label, err := parseLabel(value)
+			if err != nil {
+				return err
+			}
+			ts.Labels = append(ts.Labels, label)
+		case num == 2 && typ == protowire.BytesType:
+			sample, err := parseSample(value)
+			if err != nil {
+				return err
+			}
+			ts.Samples = append(ts.Samples, sample)
+		}
+		return nil
+	})
+	return ts, err
+}
+
+func parseLabel(data []byte) (Label, error) {
+	var label Label
+	err := walk(data, func(num protowire.Number, typ protowire.Type, value []byte) error {
+		switch {
+		case num == 1 && typ == protowire.BytesType:
+			label.Name = string(value)
+		case num == 2 && typ == protowire.BytesType:
+			label.Value = string(value)
+		}
+		return nil
+	})
+	return label, err
+}
+
+func parseSample(data []byte) (Sample, error) {
+	var sample Sample
+	err := walk(data, func(num protowire.Number, typ protowire.Type, value []byte) error {
+		switch {
+		case num == 1 && typ == protowire.Fixed64Type:
+			bits, _ := protowire.ConsumeFixed64(value)
+			sample.Value = math.Float64frombits(bits)
+		case num == 2 && typ == protowire.VarintType:
+			v, _ := protowire.ConsumeVarint(value)
+			sample.Timestamp = int64(v)
+		}
+		return nil
+	})
+	return sample, err
+}
+
+func parseMetadata(data []byte) (Metadata, error) {
+	var md Metadata
+	err := walk(data, func(num protowire.Number, typ protowire.Type, value []byte) error {
+		switch {
+		case num == 1 && typ == protowire.VarintType:
+			v, _ := protowire.ConsumeVarint(value)
+			md.Type = MetricType(v)
+		case num == 2 && typ == protowire.BytesType:
+			md.Family = string(value)
+		}
+		return nil
+	})
+	return md, err
+}
+
+// walk перебирает поля сообщения protobuf. Для вложенных сообщений и строк fn получает содержимое поля,
+// для чисел - закодированное значение, которое разбирается функциями protowire.Consume*.
+func walk(data []byte, fn func(num protowire.Number, typ protowire.Type, value []byte) error) error {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+		size := protowire.ConsumeFieldValue(num, typ, data)
+		if size < 0 {
+			return protowire.ParseError(size)
+		}
+		value := data[:size]
+		if typ == protowire.BytesType {
+			value, _ = protowire.ConsumeBytes(value)
+		}
+		if err := fn(num, typ, value); err != nil {
+			return err
+		}
+		data = data[size:]
+	}
+	return nil
+}
@@ -0,0 +1,326 @@
+package remotewrite
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/invinciblewest/metrics/internal/models"
+	"github.com/invinciblewest/metrics/internal/storage"
+)
+
+// Target сервис метрик, в который записываются принятые ряды.
+type Target interface {
+	Get(ctx context.Context, mType, id string) (models.Metric, error)
+	UpdateBatch(ctx context.Context, metrics []models.Metric) error
+	MaxBatchSize() int
+}
+
+// defaultRetention время, в течение которого помнятся ряды и метаданные, не встречавшиеся в запросах.
+const defaultRetention = time.Hour
+
+// Суффиксы рядов, которые Prometheus передает как монотонные счетчики.
+var counterSuffixes = []string{"_total", "_count", "_sum", "_bucket"}
+
+// Option задает дополнительную настройку Receiver.
+type Option func(*Receiver)
+
+// WithRetention задает, сколько помнятся последние значения рядов-счетчиков и типы метрик,
+// не встречавшиеся в запросах. Нулевое значение оставляет значение по умолчанию.
+func WithRetention(d time.Duration) Option {
+	return func(r *Receiver) {
+		if d > 0 {
+			r.retention = d
+		}
+	}
+}
+
+// counterState последнее принятое значение ряда-счетчика.
+type counterState struct {
+	value     float64
+	timestamp int64
+	seen      time.Time
+}
+
+// typeState тип семейства метрик из метаданных.
+type typeState struct {
+	typ  MetricType
+	seen time.Time
+}
+
+// update метрика, полученная из ряда запроса, и состояние счетчика до запроса, восстанавливаемое при ошибке записи.
+type update struct {
+	metric models.Metric
+	id     string
+	state  *counterState
+	prev   counterState
+	known  bool
+}
+
+// Receiver преобразует ряды remote_write в метрики сервера.
+// Ряд gauge записывается последним значением из запроса. Ряд counter Prometheus передает накопленным значением,
+// поэтому Receiver запоминает последнее значение каждого ряда и записывает приращение с прошлого запроса;
+// уменьшение значения считается сбросом счетчика, и приращением становится само значение.
+// Дробная часть значений счетчиков отбрасывается. Ряды и метаданные, не встречавшиеся дольше retention, забываются,
+// поэтому память не растет с каждым когда-либо принятым набором меток.
+type Receiver struct {
+	target    Target
+	retention time.Duration
+	now       func() time.Time
+	mu        sync.Mutex
+	types     map[string]typeState
+	counters  map[string]counterState
+	swept     time.Time
+}
+
+// NewReceiver создает приемник, записывающий метрики в target.
+func NewReceiver(target Target, opts ...Option) *Receiver {
+	r := &Receiver{
+		target:    target,
+		retention: defaultRetention,
+		now:       time.Now,
+		types:     make(map[string]typeState),
+		counters:  make(map[string]counterState),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// Receive записывает ряды запроса пакетами не больше допустимого размера пакета сервиса.
+// Типы метрик берутся из метаданных этого или предыдущих запросов, а без метаданных определяются по суффиксу имени.
+// Ряды без имени, метки устаревания и значения NaN и ±Inf пропускаются, как и значения не новее уже принятых.
+// Первое значение ряда-счетчика записывается целиком, если такой метрики еще нет, и иначе только запоминается:
+// после перезапуска сервера накопленное значение не добавляется к счетчику повторно.
+//
+// Приращения вычисляются под блокировкой, а запись в хранилище выполняется без нее, поэтому запросы
+// записываются параллельно. Если запись не удалась, последние значения рядов запроса восстанавливаются,
+// и повтор запроса Prometheus записывает те же приращения.
+func (r *Receiver) Receive(ctx context.Context, req WriteRequest) error {
+	ids := make([]string, len(req.Series))
+	for i, ts := range req.Series {
+		if name := ts.Name(); name != "" {
+			ids[i] = metricID(name, ts.Labels)
+		}
+	}
+
+	exists := make(map[string]bool)
+	for _, id := range r.unknownCounters(req, ids) {
+		_, err := r.target.Get(ctx, models.TypeCounter, id)
+		switch {
+		case err == nil:
+			exists[id] = true
+		case !errors.Is(err, storage.ErrNotFound):
+			return err
+		}
+	}
+
+	updates := r.prepare(req, ids, exists)
+	size := r.target.MaxBatchSize()
+	if size <= 0 {
+		size = len(updates)
+	}
+	for len(updates) > 0 {
+		n := min(size, len(updates))
+		metrics := make([]models.Metric, n)
+		for i, u := range updates[:n] {
+			metrics[i] = u.metric
+		}
+		if err := r.target.UpdateBatch(ctx, metrics); err != nil {
+			r.rollback(updates)
+			return err
+		}
+		updates = updates[n:]
+	}
+	return nil
+}
+
+// unknownCounters запоминает типы из метаданных запроса и возвращает ряды-счетчики, последнее значение которых неизвестно.
+func (r *Receiver) unknownCounters(req WriteRequest, ids []string) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.now()
+	for _, md := range req.Metadata {
+		if md.Family != "" {
+			r.types[md.Family] = typeState{typ: md.Type, seen: now}
+		}
+	}
+
+	var unknown []string
+	for i, ts := range req.Series {
+		if ids[i] == "" || !r.isCounter(ts.Name()) {
+			continue
+		}
+		if _, ok := r.counters[ids[i]]; !ok {
+			unknown = append(unknown, ids[i])
+		}
+	}
+	return unknown
+}
+
+// prepare преобразует ряды в метрики и сразу запоминает новые значения счетчиков, чтобы параллельный запрос
+// с теми же рядами вычислял приращения от них. exists отмечает счетчики, которые уже есть в хранилище.
+func (r *Receiver) prepare(req WriteRequest, ids []string, exists map[string]bool) []update {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.now()
+	var updates []update
+	for i, ts := range req.Series {
+		if ids[i] == "" {
+			continue
+		}
+		if u, ok := r.convert(ts, ids[i], exists[ids[i]], now); ok {
+			updates = append(updates, u)
+		}
+	}
+	r.sweep(now)
+	return updates
+}
+
+// rollback восстанавливает значения счетчиков, запомненные до незаписанных обновлений.
+// Значение, которое уже изменил другой запрос, не восстанавливается.
+func (r *Receiver) rollback(updates []update) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, u := range updates {
+		if u.state == nil {
+			continue
+		}
+		current, ok := r.counters[u.id]
+		if !ok || current.value != u.state.value || current.timestamp != u.state.timestamp {
+			continue
+		}
+		if u.known {
+			r.counters[u.id] = u.prev
+		} else {
+			delete(r.counters, u.id)
+		}
+	}
+}
+
+// sweep забывает ряды и типы метрик, не встречавшиеся дольше retention. Проверка выполняется не чаще,
+// чем раз в четверть retention.
+func (r *Receiver) sweep(now time.Time) {
+	if now.Sub(r.swept) < r.retention/4 {
+		return
+	}
+	r.swept = now
+	for id, state := range r.counters {
+		if now.Sub(state.seen) >= r.retention {
+			delete(r.counters, id)
+		}
+	}
+	for family, state := range r.types {
+		if now.Sub(state.seen) >= r.retention {
+			delete(r.types, family)
+		}
+	}
+}
+
+// convert преобразует ряд в метрику. ok равно false, если для ряда нечего записывать.
+func (r *Receiver) convert(ts TimeSeries, id string, exists bool, now time.Time) (u update, ok bool) {
+	u.id = id
+	if !r.isCounter(ts.Name()) {
+		for i := len(ts.Samples) - 1; i >= 0; i-- {
+			value := ts.Samples[i].Value
+			if !math.IsNaN(value) && !math.IsInf(value, 0) {
+				u.metric = models.Metric{ID: id, MType: models.TypeGauge, Value: &value}
+				return u, true
+			}
+		}
+		return update{}, false
+	}
+
+	state, seen := r.counters[id]
+	u.prev, u.known = state, seen
+	var delta int64
+	for _, sample := range ts.Samples {
+		if math.IsNaN(sample.Value) || math.IsInf(sample.Value, 0) || (seen && sample.Timestamp <= state.timestamp) {
+			continue
+		}
+		switch {
+		case !seen:
+			if !exists {
+				delta = int64(sample.Value)
+			}
+		case sample.Value < state.value:
+			delta += int64(sample.Value)
+		default:
+			delta += int64(sample.Value) - int64(state.value)
+		}
+		state = counterState{value: sample.Value, timestamp: sample.Timestamp}
+		seen = true
+		u.state = &state
+	}
+	if !seen {
+		return update{}, false
+	}
+	state.seen = now
+	r.counters[id] = state
+	if u.state == nil {
+		return update{}, false
+	}
+	u.metric = models.Metric{ID: id, MType: models.TypeCounter, Delta: &delta}
+	return u, true
+}
+
+// isCounter сообщает, передает ли ряд с именем name накопленное значение счетчика.
+// Ряды _bucket, _count и _sum гистограмм и сводок — счетчики, а квантили сводок — gauge.
+func (r *Receiver) isCounter(name string) bool {
+	if state, ok := r.types[name]; ok && state.typ != TypeUnknown {
+		return state.typ == TypeCounter
+	}
+	for _, suffix := range counterSuffixes {
+		family, found := strings.CutSuffix(name, suffix)
+		if !found {
+			continue
+		}
+		switch r.types[family].typ {
+		case TypeCounter, TypeHistogram, TypeSummary, TypeUnknown:
+			return true
+		default:
+			return false
+		}
+	}
+	return false
+}
+
+// metricID возвращает имя метрики для ряда в записи Prometheus: name{label="value",...} с метками по алфавиту.
+// Ряд без меток называется именем метрики.
+func metricID(name string, labels []Label) string {
+	sorted := make([]Label, 0, len(labels))
+	for _, label := range labels {
+		if label.Name != "__name__" && label.Value != "" {
+			sorted = append(sorted, label)
+		}
+	}
+	if len(sorted) == 0 {
+		return name
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+
+	var b strings.Builder
+	b.WriteString(name)
+	b.WriteByte('{')
+	for i, label := range sorted {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(label.Name)
+		b.WriteString(`="`)
+		b.WriteString(labelEscaper.Replace(label.Value))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
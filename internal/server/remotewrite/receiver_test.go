@@ -0,0 +1,226 @@
+package remotewrite
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/invinciblewest/metrics/internal/models"
+	"github.com/invinciblewest/metrics/internal/server/services"
+	"github.com/invinciblewest/metrics/internal/storage/memstorage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func series(name string, samples ...Sample) TimeSeries {
+	return TimeSeries{Labels: []Label{{Name: "__name__", Value: name}}, Samples: samples}
+}
+
+func TestDecode(t *testing.T) {
+	req := WriteRequest{
+		Series: []TimeSeries{{
+			Labels:  []Label{{Name: "__name__", Value: "up"}, {Name: "job", Value: "node"}},
+			Samples: []Sample{{Value: 1, Timestamp: 1000}, {Value: 0.5, Timestamp: 2000}},
+		}},
+		Metadata: []Metadata{{Type: TypeGauge, Family: "up"}},
+	}
+	decoded, err := Decode(Encode(req), 0)
+	require.NoError(t, err)
+	assert.Equal(t, req, decoded)
+	assert.Equal(t, "up", decoded.Series[0].Name())
+
+	_, err = Decode(Encode(req), 10)
+	assert.ErrorIs(t, err, ErrTooLarge)
+	_, err = Decode([]byte("not snappy"), 0)
+	assert.ErrorIs(t, err, ErrMalformed)
+	_, err = Decode(snappy.Encode(nil, []byte{0x0a, 0x05, 0x01}), 0)
+	assert.ErrorIs(t, err, ErrMalformed)
+}
+
+func TestMetricID(t *testing.T) {
+	tests := []struct {
+		name   string
+		labels []Label
+		want   string
+	}{
+		{name: "no labels", labels: []Label{{Name: "__name__", Value: "up"}}, want: "up"},
+		{
+			name:   "sorted labels",
+			labels: []Label{{Name: "job", Value: "node"}, {Name: "__name__", Value: "up"}, {Name: "instance", Value: "host:9100"}},
+			want:   `up{instance="host:9100",job="node"}`,
+		},
+		{name: "empty label", labels: []Label{{Name: "job", Value: ""}}, want: "up"},
+		{name: "escaped value", labels: []Label{{Name: "path", Value: "C:\\\"tmp\"\n"}}, want: `up{path="C:\\\"tmp\"\n"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, metricID("up", tt.labels))
+		})
+	}
+}
+
+func TestReceiver_Receive(t *testing.T) {
+	ctx := context.TODO()
+	service := services.NewMetricsService(memstorage.NewMemStorage("", false), services.WithMaxBatchSize(2))
+	receiver := NewReceiver(&service)
+
+	value := func(mType, id string) any {
+		metric, err := service.Get(ctx, mType, id)
+		require.NoError(t, err)
+		if mType == models.TypeGauge {
+			return *metric.Value
+		}
+		return *metric.Delta
+	}
+
+	require.NoError(t, receiver.Receive(ctx, WriteRequest{
+		Series: []TimeSeries{
+			series("http_requests_total", Sample{Value: 10, Timestamp: 1000}, Sample{Value: 15, Timestamp: 2000}),
+			series("temperature", Sample{Value: 20, Timestamp: 1000}, Sample{Value: 21.5, Timestamp: 2000}),
+			series("cpu_seconds", Sample{Value: 3, Timestamp: 1000}),
+			series("stale", Sample{Value: math.NaN(), Timestamp: 1000}),
+			{Samples: []Sample{{Value: 1, Timestamp: 1000}}},
+		},
+		Metadata: []Metadata{{Type: TypeCounter, Family: "cpu_seconds"}},
+	}))
+	assert.Equal(t, int64(15), value(models.TypeCounter, "http_requests_total"), "new counter starts at its value")
+	assert.Equal(t, 21.5, value(models.TypeGauge, "temperature"), "gauge takes the last sample")
+	assert.Equal(t, int64(3), value(models.TypeCounter, "cpu_seconds"), "metadata marks counters")
+	_, err := service.Get(ctx, models.TypeGauge, "stale")
+	assert.Error(t, err)
+
+	require.NoError(t, receiver.Receive(ctx, WriteRequest{Series: []TimeSeries{
+		series("http_requests_total", Sample{Value: 15, Timestamp: 2000}, Sample{Value: 22, Timestamp: 3000}),
+		series("cpu_seconds", Sample{Value: 5, Timestamp: 2000}),
+	}}))
+	assert.Equal(t, int64(22), value(models.TypeCounter, "http_requests_total"), "repeated sample is ignored")
+	assert.Equal(t, int64(5), value(models.TypeCounter, "cpu_seconds"), "metadata is remembered")
+
+	// Сброс счетчика: приращением становится новое значение.
+	require.NoError(t, receiver.Receive(ctx, WriteRequest{Series: []TimeSeries{
+		series("http_requests_total", Sample{Value: 4, Timestamp: 4000}),
+	}}))
+	assert.Equal(t, int64(26), value(models.TypeCounter, "http_requests_total"))
+
+	// После перезапуска приемника уже записанный счетчик не получает накопленное значение повторно.
+	receiver = NewReceiver(&service)
+	require.NoError(t, receiver.Receive(ctx, WriteRequest{Series: []TimeSeries{
+		series("http_requests_total", Sample{Value: 6, Timestamp: 5000}),
+	}}))
+	assert.Equal(t, int64(26), value(models.TypeCounter, "http_requests_total"))
+	require.NoError(t, receiver.Receive(ctx, WriteRequest{Series: []TimeSeries{
+		series("http_requests_total", Sample{Value: 9, Timestamp: 6000}),
+	}}))
+	assert.Equal(t, int64(29), value(models.TypeCounter, "http_requests_total"))
+}
+
+func TestReceiver_IsCounter(t *testing.T) {
+	receiver := NewReceiver(nil)
+	receiver.types["rpc_duration_seconds"] = typeState{typ: TypeSummary}
+	receiver.types["queue_length_total"] = typeState{typ: TypeGauge}
+	receiver.types["build_info"] = typeState{typ: TypeInfo}
+
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{name: "requests_total", want: true},
+		{name: "request_duration_seconds_bucket", want: true},
+		{name: "rpc_duration_seconds_count", want: true},
+		{name: "rpc_duration_seconds", want: false},
+		{name: "queue_length_total", want: false},
+		{name: "build_info", want: false},
+		{name: "temperature", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, receiver.isCounter(tt.name))
+		})
+	}
+}
+
+// blockingTarget сервис, запись в который ждет сигнала release и может завершиться ошибкой err.
+type blockingTarget struct {
+	*services.MetricsService
+	started chan struct{}
+	release chan struct{}
+	err     error
+}
+
+func (t *blockingTarget) UpdateBatch(ctx context.Context, metrics []models.Metric) error {
+	if t.started != nil {
+		t.started <- struct{}{}
+		<-t.release
+	}
+	if t.err != nil {
+		return t.err
+	}
+	return t.MetricsService.UpdateBatch(ctx, metrics)
+}
+
+func TestReceiver_Concurrent(t *testing.T) {
+	ctx := context.TODO()
+	service := services.NewMetricsService(memstorage.NewMemStorage("", false))
+	target := &blockingTarget{MetricsService: &service, started: make(chan struct{}), release: make(chan struct{})}
+	receiver := NewReceiver(target)
+
+	done := make(chan error, 2)
+	go func() {
+		done <- receiver.Receive(ctx, WriteRequest{Series: []TimeSeries{series("a_total", Sample{Value: 1, Timestamp: 1000})}})
+	}()
+	<-target.started
+	go func() {
+		done <- receiver.Receive(ctx, WriteRequest{Series: []TimeSeries{series("b_total", Sample{Value: 2, Timestamp: 1000})}})
+	}()
+	// Вторая запись начинается, пока первая еще не завершена: блокировка не удерживается во время записи.
+	<-target.started
+	close(target.release)
+	require.NoError(t, <-done)
+	require.NoError(t, <-done)
+}
+
+func TestReceiver_Rollback(t *testing.T) {
+	ctx := context.TODO()
+	service := services.NewMetricsService(memstorage.NewMemStorage("", false))
+	target := &blockingTarget{MetricsService: &service}
+	receiver := NewReceiver(target)
+	write := func(value float64, timestamp int64) error {
+		return receiver.Receive(ctx, WriteRequest{Series: []TimeSeries{series("requests_total", Sample{Value: value, Timestamp: timestamp})}})
+	}
+
+	require.NoError(t, write(10, 1000))
+	target.err = errors.New("storage unavailable")
+	assert.ErrorIs(t, write(15, 2000), target.err)
+
+	// Повтор после ошибки записывает то же приращение.
+	target.err = nil
+	require.NoError(t, write(15, 2000))
+	metric, err := service.Get(ctx, models.TypeCounter, "requests_total")
+	require.NoError(t, err)
+	assert.Equal(t, int64(15), *metric.Delta)
+}
+
+func TestReceiver_Retention(t *testing.T) {
+	ctx := context.TODO()
+	service := services.NewMetricsService(memstorage.NewMemStorage("", false))
+	receiver := NewReceiver(&service, WithRetention(time.Hour))
+	now := time.Unix(1700000000, 0)
+	receiver.now = func() time.Time { return now }
+
+	require.NoError(t, receiver.Receive(ctx, WriteRequest{
+		Series:   []TimeSeries{series("old_total", Sample{Value: 1, Timestamp: 1000})},
+		Metadata: []Metadata{{Type: TypeCounter, Family: "old_seconds"}},
+	}))
+	now = now.Add(50 * time.Minute)
+	require.NoError(t, receiver.Receive(ctx, WriteRequest{Series: []TimeSeries{series("new_total", Sample{Value: 1, Timestamp: 1000})}}))
+	assert.Len(t, receiver.counters, 2)
+
+	now = now.Add(20 * time.Minute)
+	require.NoError(t, receiver.Receive(ctx, WriteRequest{Series: []TimeSeries{series("new_total", Sample{Value: 2, Timestamp: 2000})}}))
+	assert.Len(t, receiver.counters, 1)
+	assert.Contains(t, receiver.counters, "new_total")
+	assert.Empty(t, receiver.types)
+}
@@ -0,0 +1,115 @@
+package services
+
+import (
+	"context"
+	"math"
+	"sort"
+
+	"github.com/invinciblewest/metrics/internal/models"
+	"github.com/invinciblewest/metrics/internal/storage"
+)
+
+// accumulator накапливает значения метрик одной группы.
+type accumulator struct {
+	sum   float64
+	min   float64
+	max   float64
+	count int64
+}
+
+func (a *accumulator) add(value float64) {
+	if a.count == 0 {
+		a.min, a.max = value, value
+	}
+	a.sum += value
+	a.min = math.Min(a.min, value)
+	a.max = math.Max(a.max, value)
+	a.count++
+}
+
+// result возвращает значение заданной функции агрегации.
+func (a *accumulator) result(group string, fn storage.AggregateFunc) storage.AggregateResult {
+	result := storage.AggregateResult{
+		Group: group,
+		Count: a.count,
+	}
+
+	var value float64
+	switch fn {
+	case storage.AggregateSum:
+		value = a.sum
+	case storage.AggregateCount:
+		value = float64(a.count)
+	case storage.AggregateAvg:
+		if a.count == 0 {
+			return result
+		}
+		value = a.sum / float64(a.count)
+	case storage.AggregateMin:
+		if a.count == 0 {
+			return result
+		}
+		value = a.min
+	case storage.AggregateMax:
+		if a.count == 0 {
+			return result
+		}
+		value = a.max
+	}
+	result.Value = &value
+	return result
+}
+
+// aggregate вычисляет агрегацию по текущим значениям метрик хранилища.
+func aggregate(ctx context.Context, st storage.Storage, q storage.AggregateQuery) ([]storage.AggregateResult, error) {
+	groups := make(map[string]*accumulator)
+	if !q.Grouped() {
+		groups[""] = &accumulator{}
+	}
+
+	for metric, err := range st.List(ctx) {
+		if err != nil {
+			return nil, err
+		}
+		if q.MType != "" && metric.MType != q.MType {
+			continue
+		}
+
+		match := q.Regexp.FindStringSubmatch(metric.ID)
+		if match == nil {
+			continue
+		}
+		group := ""
+		if q.Grouped() {
+			group = match[1]
+		}
+
+		acc, ok := groups[group]
+		if !ok {
+			acc = &accumulator{}
+			groups[group] = acc
+		}
+		acc.add(metricValue(metric))
+	}
+
+	results := make([]storage.AggregateResult, 0, len(groups))
+	for group, acc := range groups {
+		results = append(results, acc.result(group, q.Func))
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Group < results[j].Group
+	})
+
+	return results, nil
+}
+
+// metricValue возвращает числовое значение метрики независимо от ее типа.
+func metricValue(metric models.Metric) float64 {
+	switch metric.MType {
+	case models.TypeGauge:
+		return *metric.Value
+	case models.TypeCounter:
+		return float64(*metric.Delta)
+	}
+	return 0
+}
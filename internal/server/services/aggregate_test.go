@@ -0,0 +1,131 @@
+package services
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/invinciblewest/metrics/internal/models"
+	"github.com/invinciblewest/metrics/internal/storage"
+	"github.com/invinciblewest/metrics/internal/storage/memstorage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetricsService_Aggregate(t *testing.T) {
+	ctx := context.TODO()
+	st := memstorage.NewMemStorage("", false)
+	cpu0, cpu1, heapA, heapB := 10.0, 30.0, 100.0, 300.0
+	polls := int64(4)
+	require.NoError(t, st.UpdateBatch(ctx, []models.Metric{
+		{ID: "CPUutilization0", MType: models.TypeGauge, Value: &cpu0},
+		{ID: "CPUutilization1", MType: models.TypeGauge, Value: &cpu1},
+		{ID: "hostA.HeapAlloc", MType: models.TypeGauge, Value: &heapA},
+		{ID: "hostB.HeapAlloc", MType: models.TypeGauge, Value: &heapB},
+		{ID: "hostA.PollCount", MType: models.TypeCounter, Delta: &polls},
+	}))
+	service := NewMetricsService(st)
+
+	glob := func(pattern string) *regexp.Regexp {
+		re, err := storage.GlobToRegexp(pattern)
+		require.NoError(t, err)
+		return re
+	}
+	value := func(v float64) *float64 {
+		return &v
+	}
+
+	tests := []struct {
+		name        string
+		query       storage.AggregateQuery
+		expected    []storage.AggregateResult
+		expectError error
+	}{
+		{
+			name:     "sum",
+			query:    storage.AggregateQuery{Regexp: glob("CPUutilization*"), Func: storage.AggregateSum},
+			expected: []storage.AggregateResult{{Value: value(40), Count: 2}},
+		},
+		{
+			name:     "avg",
+			query:    storage.AggregateQuery{Regexp: glob("CPUutilization*"), Func: storage.AggregateAvg},
+			expected: []storage.AggregateResult{{Value: value(20), Count: 2}},
+		},
+		{
+			name:     "max by type",
+			query:    storage.AggregateQuery{Regexp: glob("hostA.*"), MType: models.TypeGauge, Func: storage.AggregateMax},
+			expected: []storage.AggregateResult{{Value: value(100), Count: 1}},
+		},
+		{
+			name:     "count",
+			query:    storage.AggregateQuery{Regexp: glob("host*"), Func: storage.AggregateCount},
+			expected: []storage.AggregateResult{{Value: value(3), Count: 3}},
+		},
+		{
+			name:     "min without matches",
+			query:    storage.AggregateQuery{Regexp: glob("unknown*"), Func: storage.AggregateMin},
+			expected: []storage.AggregateResult{{Count: 0}},
+		},
+		{
+			name:  "grouped",
+			query: storage.AggregateQuery{Regexp: regexp.MustCompile(`^(host\w)\.`), Func: storage.AggregateSum},
+			expected: []storage.AggregateResult{
+				{Group: "hostA", Value: value(104), Count: 2},
+				{Group: "hostB", Value: value(300), Count: 1},
+			},
+		},
+		{
+			name:        "unknown func",
+			query:       storage.AggregateQuery{Regexp: glob("*"), Func: "median"},
+			expectError: storage.ErrBadQuery,
+		},
+		{
+			name:        "unknown type",
+			query:       storage.AggregateQuery{Regexp: glob("*"), MType: "unknown", Func: storage.AggregateSum},
+			expectError: storage.ErrWrongType,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			results, err := service.Aggregate(ctx, test.query)
+			if test.expectError != nil {
+				assert.ErrorIs(t, err, test.expectError)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, results)
+		})
+	}
+}
+
+// partialAggregator хранилище, выполняющее самостоятельно только запросы по шаблону имени.
+type partialAggregator struct {
+	*memstorage.MemStorage
+	calls int
+}
+
+func (st *partialAggregator) Aggregate(_ context.Context, q storage.AggregateQuery) ([]storage.AggregateResult, error) {
+	if q.Glob == "" {
+		return nil, storage.ErrNotSupported
+	}
+	st.calls++
+	return []storage.AggregateResult{{Count: 42}}, nil
+}
+
+func TestMetricsService_AggregateFallback(t *testing.T) {
+	ctx := context.TODO()
+	st := &partialAggregator{MemStorage: memstorage.NewMemStorage("", false)}
+	value := 1.5
+	require.NoError(t, st.UpdateGauge(ctx, models.Metric{ID: "Alloc", MType: models.TypeGauge, Value: &value}))
+	service := NewMetricsService(st)
+
+	results, err := service.Aggregate(ctx, storage.AggregateQuery{Regexp: regexp.MustCompile("^Al"), Func: storage.AggregateCount})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), results[0].Count)
+	assert.Zero(t, st.calls)
+
+	results, err = service.Aggregate(ctx, storage.AggregateQuery{Regexp: regexp.MustCompile("^Al.*$"), Glob: "Al*", Func: storage.AggregateCount})
+	require.NoError(t, err)
+	assert.Equal(t, int64(42), results[0].Count)
+}
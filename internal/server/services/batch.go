@@ -0,0 +1,119 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/invinciblewest/metrics/internal/models"
+	"github.com/invinciblewest/metrics/internal/storage"
+	"github.com/invinciblewest/metrics/internal/tokens"
+)
+
+// ItemError описывает ошибку отдельной метрики пакета.
+type ItemError struct {
+	Index int    // Index позиция метрики в пакете.
+	ID    string // ID идентификатор метрики.
+	Err   error  // Err причина отказа.
+}
+
+// Error возвращает описание ошибки с позицией и идентификатором метрики.
+func (e *ItemError) Error() string {
+	return fmt.Sprintf("metric %d (%q): %v", e.Index, e.ID, e.Err)
+}
+
+// Unwrap возвращает причину отказа.
+func (e *ItemError) Unwrap() error {
+	return e.Err
+}
+
+// ItemResult содержит результат записи одной метрики пакета.
+type ItemResult struct {
+	Index  int           // Index позиция метрики в пакете.
+	Metric models.Metric // Metric метрика из пакета.
+	Err    error         // Err причина отказа, nil для принятой метрики.
+}
+
+// BatchReport содержит результаты записи каждой метрики пакета.
+type BatchReport struct {
+	Items    []ItemResult // Items результаты в порядке метрик пакета.
+	Accepted int          // Accepted количество принятых метрик.
+	Rejected int          // Rejected количество отклоненных метрик.
+}
+
+// Validate проверяет, что у метрики задан идентификатор, известный тип и значение, соответствующее типу.
+func Validate(metric models.Metric) error {
+	if metric.ID == "" {
+		return ErrEmptyID
+	}
+	switch metric.MType {
+	case models.TypeGauge:
+		if metric.Value == nil {
+			return ErrMissingValue
+		}
+	case models.TypeCounter:
+		if metric.Delta == nil {
+			return ErrMissingDelta
+		}
+	default:
+		return storage.ErrWrongType
+	}
+	return nil
+}
+
+// validateBatch проверяет все метрики пакета до записи и возвращает *ItemError для первой некорректной.
+func validateBatch(metrics []models.Metric) error {
+	for i, metric := range metrics {
+		if err := Validate(metric); err != nil {
+			return &ItemError{Index: i, ID: metric.ID, Err: err}
+		}
+	}
+	return nil
+}
+
+// UpdateBatchPartial записывает корректные метрики пакета и отклоняет остальные.
+// Каждая метрика проверяется отдельно: на корректность, на область действия токена агента и на квоту
+// различных метрик. Принятые метрики записываются одним пакетом; если запись не удалась, возвращается ошибка
+// и не записывается ни одна метрика. Пакет сверх допустимого размера отклоняется целиком.
+func (ms *MetricsService) UpdateBatchPartial(ctx context.Context, metrics []models.Metric) (BatchReport, error) {
+	if ms.maxBatchSize > 0 && len(metrics) > ms.maxBatchSize {
+		return BatchReport{}, fmt.Errorf("%w: %d metrics, limit %d", ErrBatchTooLarge, len(metrics), ms.maxBatchSize)
+	}
+
+	report := BatchReport{Items: make([]ItemResult, 0, len(metrics))}
+	accepted := make([]models.Metric, 0, len(metrics))
+	var reserved []metricKey
+	for i, metric := range metrics {
+		err := Validate(metric)
+		if err == nil {
+			err = tokens.CheckWrite(ctx, metric)
+		}
+		if err == nil {
+			var keys []metricKey
+			if keys, err = ms.reserve(ctx, metric); err == nil {
+				reserved = append(reserved, keys...)
+			}
+		}
+
+		report.Items = append(report.Items, ItemResult{Index: i, Metric: metric, Err: err})
+		if err != nil {
+			report.Rejected++
+			continue
+		}
+		report.Accepted++
+		accepted = append(accepted, metric)
+	}
+
+	if len(accepted) == 0 {
+		return report, nil
+	}
+	forwarded := ms.forwardCopy(accepted...)
+	deltas := counterDeltas(accepted...)
+	if err := ms.st.UpdateBatch(ctx, accepted); err != nil {
+		ms.release(reserved)
+		return BatchReport{}, err
+	}
+	ms.track(ctx, deltas)
+	ms.publish(ctx, accepted...)
+	ms.forward(forwarded)
+	return report, nil
+}
@@ -0,0 +1,123 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/invinciblewest/metrics/internal/models"
+	"github.com/invinciblewest/metrics/internal/storage"
+	"github.com/invinciblewest/metrics/internal/storage/memstorage"
+	"github.com/invinciblewest/metrics/internal/tokens"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidate(t *testing.T) {
+	value := 1.0
+	delta := int64(1)
+	tests := []struct {
+		name     string
+		metric   models.Metric
+		expected error
+	}{
+		{name: "gauge", metric: models.Metric{ID: "a", MType: models.TypeGauge, Value: &value}},
+		{name: "counter", metric: models.Metric{ID: "a", MType: models.TypeCounter, Delta: &delta}},
+		{name: "empty id", metric: models.Metric{MType: models.TypeGauge, Value: &value}, expected: ErrEmptyID},
+		{name: "missing value", metric: models.Metric{ID: "a", MType: models.TypeGauge}, expected: ErrMissingValue},
+		{name: "missing delta", metric: models.Metric{ID: "a", MType: models.TypeCounter, Value: &value}, expected: ErrMissingDelta},
+		{name: "wrong type", metric: models.Metric{ID: "a", MType: "unknown", Value: &value}, expected: storage.ErrWrongType},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := Validate(test.metric)
+			if test.expected == nil {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, test.expected)
+			}
+		})
+	}
+}
+
+func TestMetricsService_UpdateBatch_Atomic(t *testing.T) {
+	ctx := context.TODO()
+	st := memstorage.NewMemStorage("", false)
+	service := NewMetricsService(st)
+	value := 1.0
+
+	err := service.UpdateBatch(ctx, []models.Metric{
+		{ID: "a", MType: models.TypeGauge, Value: &value},
+		{ID: "b", MType: models.TypeCounter},
+		{ID: "c", MType: models.TypeGauge, Value: &value},
+	})
+	var itemErr *ItemError
+	require.ErrorAs(t, err, &itemErr)
+	assert.Equal(t, 1, itemErr.Index)
+	assert.Equal(t, "b", itemErr.ID)
+	assert.ErrorIs(t, err, ErrMissingDelta)
+
+	metrics, err := storage.Collect(st.List(ctx))
+	require.NoError(t, err)
+	assert.Empty(t, metrics)
+}
+
+func TestMetricsService_UpdateBatchPartial(t *testing.T) {
+	ctx := context.TODO()
+	value := 1.0
+	delta := int64(2)
+
+	t.Run("mixed", func(t *testing.T) {
+		st := memstorage.NewMemStorage("", false)
+		service := NewMetricsService(st)
+
+		report, err := service.UpdateBatchPartial(ctx, []models.Metric{
+			{ID: "a", MType: models.TypeGauge, Value: &value},
+			{ID: "b", MType: "unknown", Value: &value},
+			{ID: "c", MType: models.TypeCounter, Delta: &delta},
+			{ID: "", MType: models.TypeGauge, Value: &value},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 2, report.Accepted)
+		assert.Equal(t, 2, report.Rejected)
+		require.Len(t, report.Items, 4)
+		assert.NoError(t, report.Items[0].Err)
+		assert.ErrorIs(t, report.Items[1].Err, storage.ErrWrongType)
+		assert.NoError(t, report.Items[2].Err)
+		assert.ErrorIs(t, report.Items[3].Err, ErrEmptyID)
+
+		metrics, err := storage.Collect(st.List(ctx))
+		require.NoError(t, err)
+		assert.Len(t, metrics, 2)
+	})
+	t.Run("quota and token", func(t *testing.T) {
+		st := memstorage.NewMemStorage("", false)
+		service := NewMetricsService(st, WithMaxMetrics(1))
+		tokenCtx := tokens.WithToken(ctx, tokens.Token{Agent: "agent", Prefixes: []string{"app."}})
+
+		report, err := service.UpdateBatchPartial(tokenCtx, []models.Metric{
+			{ID: "app.a", MType: models.TypeGauge, Value: &value},
+			{ID: "other", MType: models.TypeGauge, Value: &value},
+			{ID: "app.b", MType: models.TypeGauge, Value: &value},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 1, report.Accepted)
+		assert.ErrorIs(t, report.Items[1].Err, tokens.ErrForbidden)
+		assert.ErrorIs(t, report.Items[2].Err, ErrMetricsLimit)
+	})
+	t.Run("nothing accepted", func(t *testing.T) {
+		service := NewMetricsService(memstorage.NewMemStorage("", false))
+		report, err := service.UpdateBatchPartial(ctx, []models.Metric{{ID: "a", MType: models.TypeGauge}})
+		require.NoError(t, err)
+		assert.Equal(t, 0, report.Accepted)
+		assert.Equal(t, 1, report.Rejected)
+	})
+	t.Run("batch too large", func(t *testing.T) {
+		service := NewMetricsService(memstorage.NewMemStorage("", false), WithMaxBatchSize(1))
+		_, err := service.UpdateBatchPartial(ctx, []models.Metric{
+			{ID: "a", MType: models.TypeGauge, Value: &value},
+			{ID: "b", MType: models.TypeGauge, Value: &value},
+		})
+		assert.ErrorIs(t, err, ErrBatchTooLarge)
+	})
+}
@@ -0,0 +1,46 @@
+package services
+
+import (
+	"github.com/invinciblewest/metrics/internal/models"
+)
+
+// Forwarder получает принятые сервисом метрики, например для пересылки во внешние системы.
+// Forward вызывается после успешной записи каждого пакета или отдельной метрики и не должен блокироваться.
+type Forwarder interface {
+	Forward(metrics []models.Metric)
+}
+
+// WithForwarder передает принятые метрики forwarder.
+func WithForwarder(forwarder Forwarder) Option {
+	return func(ms *MetricsService) {
+		ms.forwarder = forwarder
+	}
+}
+
+// forwardCopy копирует метрики для пересылки, если она включена. Копия делается до записи:
+// хранилище может заменить приращение счетчика накопленным значением.
+func (ms *MetricsService) forwardCopy(metrics ...models.Metric) []models.Metric {
+	if ms.forwarder == nil || len(metrics) == 0 {
+		return nil
+	}
+	copied := make([]models.Metric, len(metrics))
+	for i, metric := range metrics {
+		if metric.Value != nil {
+			value := *metric.Value
+			metric.Value = &value
+		}
+		if metric.Delta != nil {
+			delta := *metric.Delta
+			metric.Delta = &delta
+		}
+		copied[i] = metric
+	}
+	return copied
+}
+
+// forward передает скопированные метрики пересылке.
+func (ms *MetricsService) forward(metrics []models.Metric) {
+	if ms.forwarder != nil && len(metrics) > 0 {
+		ms.forwarder.Forward(metrics)
+	}
+}
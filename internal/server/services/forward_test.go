@@ -0,0 +1,44 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/invinciblewest/metrics/internal/models"
+	"github.com/invinciblewest/metrics/internal/storage/memstorage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingForwarder запоминает переданные пакеты.
+type recordingForwarder struct {
+	batches [][]models.Metric
+}
+
+func (f *recordingForwarder) Forward(metrics []models.Metric) {
+	f.batches = append(f.batches, metrics)
+}
+
+func TestMetricsService_Forward(t *testing.T) {
+	ctx := context.TODO()
+	forwarder := &recordingForwarder{}
+	service := NewMetricsService(memstorage.NewMemStorage("", false), WithForwarder(forwarder))
+
+	counter := func(delta int64) models.Metric {
+		return models.Metric{ID: "PollCount", MType: models.TypeCounter, Delta: &delta}
+	}
+
+	require.NoError(t, service.UpdateBatch(ctx, []models.Metric{counter(5)}))
+	_, err := service.Update(ctx, counter(7))
+	require.NoError(t, err)
+	report, err := service.UpdateBatchPartial(ctx, []models.Metric{counter(1), {ID: "PollCount", MType: models.TypeCounter}})
+	require.NoError(t, err)
+	require.Equal(t, 1, report.Accepted)
+	require.Error(t, service.UpdateBatch(ctx, []models.Metric{{ID: "", MType: models.TypeCounter}}))
+
+	// Пересылаются приращения, а не накопленные хранилищем значения.
+	require.Len(t, forwarder.batches, 3)
+	assert.Equal(t, []models.Metric{counter(5)}, forwarder.batches[0])
+	assert.Equal(t, []models.Metric{counter(7)}, forwarder.batches[1])
+	assert.Equal(t, []models.Metric{counter(1)}, forwarder.batches[2])
+}
@@ -0,0 +1,109 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/invinciblewest/metrics/internal/models"
+	"github.com/invinciblewest/metrics/internal/storage"
+)
+
+// WithIdempotencyWindow задает, сколько помнятся ключи идемпотентности примененных пакетов.
+// Нулевое значение отключает проверку ключей.
+func WithIdempotencyWindow(d time.Duration) Option {
+	return func(ms *MetricsService) {
+		if d > 0 {
+			ms.keysWindow = d
+			ms.keys = &recentKeys{seen: make(map[string]time.Time), now: time.Now}
+		}
+	}
+}
+
+// UpdateBatchOnce обновляет пакет метрик не более одного раза для ключа идемпотентности key.
+// Если пакет с тем же ключом уже применен в пределах окна, метрики не записываются повторно и возвращается true:
+// результат исходного запроса был успешным. Если ключ пуст или окно не задано, пакет записывается как UpdateBatch.
+// Хранилища, реализующие storage.Deduplicator, запоминают ключ атомарно с записью метрик;
+// для остальных ключи хранятся в памяти сервиса.
+func (ms *MetricsService) UpdateBatchOnce(ctx context.Context, key string, metrics []models.Metric) (bool, error) {
+	if key == "" || ms.keys == nil {
+		return false, ms.UpdateBatch(ctx, metrics)
+	}
+
+	reserved, err := ms.prepareBatch(ctx, metrics)
+	if err != nil {
+		return false, err
+	}
+
+	forwarded := ms.forwardCopy(metrics...)
+	deltas := counterDeltas(metrics...)
+	var applied bool
+	if dedup, ok := ms.st.(storage.Deduplicator); ok {
+		applied, err = dedup.UpdateBatchOnce(ctx, key, ms.keysWindow, metrics)
+	} else {
+		applied, err = ms.updateBatchOnce(ctx, key, metrics)
+	}
+	if err != nil {
+		ms.release(reserved)
+		return false, err
+	}
+	if !applied {
+		// Повтор ничего не записал: зарезервированные для него метрики не должны занимать квоту.
+		ms.release(reserved)
+		return true, nil
+	}
+	ms.track(ctx, deltas)
+	ms.publish(ctx, metrics...)
+	ms.forward(forwarded)
+	return false, nil
+}
+
+// updateBatchOnce применяет пакет, запоминая ключ в памяти сервиса. Ключ занимается до записи,
+// чтобы параллельный повтор не применил пакет дважды, и освобождается, если запись не удалась.
+// Если пакет записан частично (storage.ErrPartialWrite), ключ остается занятым: повтор учел бы
+// записанные приращения счетчиков дважды.
+func (ms *MetricsService) updateBatchOnce(ctx context.Context, key string, metrics []models.Metric) (bool, error) {
+	if !ms.keys.add(key, ms.keysWindow) {
+		return false, nil
+	}
+	if err := ms.st.UpdateBatch(ctx, metrics); err != nil {
+		if !errors.Is(err, storage.ErrPartialWrite) {
+			ms.keys.remove(key)
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// recentKeys хранит ключи идемпотентности, примененные в пределах окна.
+type recentKeys struct {
+	mu   sync.Mutex
+	seen map[string]time.Time
+	now  func() time.Time
+}
+
+// add запоминает ключ и сообщает, что он новый. Ключи старше window удаляются.
+func (k *recentKeys) add(key string, window time.Duration) bool {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	now := k.now()
+	for seenKey, seenAt := range k.seen {
+		if now.Sub(seenAt) >= window {
+			delete(k.seen, seenKey)
+		}
+	}
+	if _, ok := k.seen[key]; ok {
+		return false
+	}
+	k.seen[key] = now
+	return true
+}
+
+// remove забывает ключ несостоявшейся записи.
+func (k *recentKeys) remove(key string) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	delete(k.seen, key)
+}
@@ -0,0 +1,129 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/invinciblewest/metrics/internal/models"
+	"github.com/invinciblewest/metrics/internal/storage"
+	"github.com/invinciblewest/metrics/internal/storage/memstorage"
+	"github.com/invinciblewest/metrics/internal/storage/shardstorage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetricsService_UpdateBatchOnce(t *testing.T) {
+	ctx := context.TODO()
+
+	newBatch := func() []models.Metric {
+		delta := int64(3)
+		return []models.Metric{{ID: "PollCount", MType: models.TypeCounter, Delta: &delta}}
+	}
+	shards, err := shardstorage.NewShardStorage(memstorage.NewMemStorage("", false), memstorage.NewMemStorage("", false))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name string
+		st   storage.Storage
+	}{
+		{name: "deduplicating storage", st: memstorage.NewMemStorage("", false)},
+		{name: "service keys", st: shards},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			service := NewMetricsService(test.st, WithIdempotencyWindow(time.Minute))
+
+			replayed, err := service.UpdateBatchOnce(ctx, "report-1", newBatch())
+			require.NoError(t, err)
+			assert.False(t, replayed)
+
+			replayed, err = service.UpdateBatchOnce(ctx, "report-1", newBatch())
+			require.NoError(t, err)
+			assert.True(t, replayed)
+
+			replayed, err = service.UpdateBatchOnce(ctx, "report-2", newBatch())
+			require.NoError(t, err)
+			assert.False(t, replayed)
+
+			counter, err := test.st.GetCounter(ctx, "PollCount")
+			require.NoError(t, err)
+			assert.Equal(t, int64(6), *counter.Delta)
+		})
+	}
+
+	t.Run("invalid batch does not remember key", func(t *testing.T) {
+		st := memstorage.NewMemStorage("", false)
+		service := NewMetricsService(st, WithIdempotencyWindow(time.Minute))
+
+		_, err := service.UpdateBatchOnce(ctx, "report", []models.Metric{{ID: "PollCount", MType: models.TypeCounter}})
+		assert.ErrorIs(t, err, ErrMissingDelta)
+
+		replayed, err := service.UpdateBatchOnce(ctx, "report", newBatch())
+		require.NoError(t, err)
+		assert.False(t, replayed)
+	})
+	t.Run("replay does not consume quota", func(t *testing.T) {
+		st, err := shardstorage.NewShardStorage(memstorage.NewMemStorage("", false))
+		require.NoError(t, err)
+		service := NewMetricsService(st, WithIdempotencyWindow(time.Minute), WithMaxMetrics(1))
+		require.True(t, service.keys.add("report", time.Minute))
+
+		replayed, err := service.UpdateBatchOnce(ctx, "report", newBatch())
+		require.NoError(t, err)
+		assert.True(t, replayed)
+
+		value := 1.5
+		_, err = service.Update(ctx, models.Metric{ID: "Alloc", MType: models.TypeGauge, Value: &value})
+		assert.NoError(t, err)
+	})
+	t.Run("partial write keeps key", func(t *testing.T) {
+		st := partialStorage{Storage: memstorage.NewMemStorage("", false)}
+		service := NewMetricsService(st, WithIdempotencyWindow(time.Minute))
+
+		_, err := service.UpdateBatchOnce(ctx, "report", newBatch())
+		require.ErrorIs(t, err, storage.ErrPartialWrite)
+
+		replayed, err := service.UpdateBatchOnce(ctx, "report", newBatch())
+		require.NoError(t, err)
+		assert.True(t, replayed)
+	})
+	t.Run("disabled", func(t *testing.T) {
+		st := memstorage.NewMemStorage("", false)
+		service := NewMetricsService(st)
+
+		for i := 0; i < 2; i++ {
+			replayed, err := service.UpdateBatchOnce(ctx, "report", newBatch())
+			require.NoError(t, err)
+			assert.False(t, replayed)
+		}
+		counter, err := st.GetCounter(ctx, "PollCount")
+		require.NoError(t, err)
+		assert.Equal(t, int64(6), *counter.Delta)
+	})
+}
+
+// partialStorage хранилище, записывающее пакеты частично.
+type partialStorage struct {
+	storage.Storage
+}
+
+func (st partialStorage) UpdateBatch(context.Context, []models.Metric) error {
+	return storage.ErrPartialWrite
+}
+
+func TestRecentKeys(t *testing.T) {
+	now := time.Now()
+	keys := &recentKeys{seen: make(map[string]time.Time), now: func() time.Time { return now }}
+
+	assert.True(t, keys.add("a", time.Minute))
+	assert.False(t, keys.add("a", time.Minute))
+
+	keys.remove("a")
+	assert.True(t, keys.add("a", time.Minute))
+
+	now = now.Add(time.Minute)
+	assert.True(t, keys.add("a", time.Minute))
+	assert.Len(t, keys.seen, 1)
+}
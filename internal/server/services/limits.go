@@ -0,0 +1,110 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/invinciblewest/metrics/internal/models"
+	"github.com/invinciblewest/metrics/internal/storage"
+)
+
+var (
+	ErrBatchTooLarge = errors.New("batch too large")
+	ErrMetricsLimit  = errors.New("distinct metrics limit exceeded")
+)
+
+// Option задает дополнительную настройку сервиса метрик.
+type Option func(*MetricsService)
+
+// WithMaxBatchSize ограничивает количество метрик в одном пакете. Нулевое значение снимает ограничение.
+func WithMaxBatchSize(n int) Option {
+	return func(ms *MetricsService) {
+		ms.maxBatchSize = n
+	}
+}
+
+// MaxBatchSize возвращает допустимое количество метрик в одном пакете, 0 означает отсутствие ограничения.
+func (ms *MetricsService) MaxBatchSize() int {
+	return ms.maxBatchSize
+}
+
+// WithMaxMetrics ограничивает общее количество различных метрик в хранилище: обновления существующих
+// метрик принимаются всегда, а новые отклоняются после достижения предела. Нулевое значение снимает ограничение.
+func WithMaxMetrics(n int) Option {
+	return func(ms *MetricsService) {
+		if n > 0 {
+			ms.quota = &metricsQuota{max: n}
+		}
+	}
+}
+
+// metricKey идентифицирует метрику в хранилище: метрики разных типов с одним именем различаются.
+type metricKey struct {
+	mType string
+	id    string
+}
+
+// metricsQuota отслеживает множество различных метрик хранилища. Множество читается из хранилища
+// при первой проверке и после восстановления из резервной копии, затем пополняется принятыми метриками.
+type metricsQuota struct {
+	mu     sync.Mutex
+	max    int
+	known  map[metricKey]struct{}
+	loaded bool
+}
+
+// reserve проверяет, что новые метрики пакета помещаются в квоту, и резервирует их.
+// Возвращает зарезервированные ключи, которые нужно освободить, если запись не удалась.
+func (q *metricsQuota) reserve(ctx context.Context, st storage.Storage, metrics []models.Metric) ([]metricKey, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if !q.loaded {
+		known := make(map[metricKey]struct{})
+		for metric, err := range st.List(ctx) {
+			if err != nil {
+				return nil, err
+			}
+			known[metricKey{mType: metric.MType, id: metric.ID}] = struct{}{}
+		}
+		q.known, q.loaded = known, true
+	}
+
+	var added []metricKey
+	for _, metric := range metrics {
+		key := metricKey{mType: metric.MType, id: metric.ID}
+		if _, ok := q.known[key]; ok {
+			continue
+		}
+		if len(q.known) >= q.max {
+			for _, k := range added {
+				delete(q.known, k)
+			}
+			return nil, fmt.Errorf("%w: limit %d, metric %q", ErrMetricsLimit, q.max, metric.ID)
+		}
+		q.known[key] = struct{}{}
+		added = append(added, key)
+	}
+	return added, nil
+}
+
+// release освобождает ключи, зарезервированные для несостоявшейся записи.
+func (q *metricsQuota) release(keys []metricKey) {
+	if len(keys) == 0 {
+		return
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, key := range keys {
+		delete(q.known, key)
+	}
+}
+
+// reset сбрасывает множество метрик, чтобы при следующей проверке оно было перечитано из хранилища.
+func (q *metricsQuota) reset() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.known, q.loaded = nil, false
+}
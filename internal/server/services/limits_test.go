@@ -0,0 +1,58 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/invinciblewest/metrics/internal/backup"
+	"github.com/invinciblewest/metrics/internal/models"
+	"github.com/invinciblewest/metrics/internal/storage/memstorage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetricsService_MaxBatchSize(t *testing.T) {
+	service := NewMetricsService(memstorage.NewMemStorage("", false), WithMaxBatchSize(2))
+	value := 1.0
+	batch := []models.Metric{
+		{ID: "a", MType: models.TypeGauge, Value: &value},
+		{ID: "b", MType: models.TypeGauge, Value: &value},
+	}
+
+	assert.NoError(t, service.UpdateBatch(context.TODO(), batch))
+	err := service.UpdateBatch(context.TODO(), append(batch, models.Metric{ID: "c", MType: models.TypeGauge, Value: &value}))
+	assert.ErrorIs(t, err, ErrBatchTooLarge)
+}
+
+func TestMetricsService_MaxMetrics(t *testing.T) {
+	ctx := context.TODO()
+	st := memstorage.NewMemStorage("", false)
+	value := 1.0
+	delta := int64(1)
+	require.NoError(t, st.UpdateGauge(ctx, models.Metric{ID: "existing", MType: models.TypeGauge, Value: &value}))
+
+	service := NewMetricsService(st, WithMaxMetrics(3))
+
+	_, err := service.Update(ctx, models.Metric{ID: "new", MType: models.TypeGauge, Value: &value})
+	require.NoError(t, err)
+
+	err = service.UpdateBatch(ctx, []models.Metric{
+		{ID: "new", MType: models.TypeCounter, Delta: &delta},
+		{ID: "extra", MType: models.TypeGauge, Value: &value},
+	})
+	assert.ErrorIs(t, err, ErrMetricsLimit)
+	_, err = st.GetCounter(ctx, "new")
+	assert.Error(t, err)
+
+	_, err = service.Update(ctx, models.Metric{ID: "new", MType: models.TypeCounter, Delta: &delta})
+	require.NoError(t, err)
+	_, err = service.Update(ctx, models.Metric{ID: "existing", MType: models.TypeGauge, Value: &value})
+	assert.NoError(t, err)
+	_, err = service.Update(ctx, models.Metric{ID: "extra", MType: models.TypeGauge, Value: &value})
+	assert.ErrorIs(t, err, ErrMetricsLimit)
+
+	archive := backup.Archive{Version: backup.Version, Metrics: []models.Metric{{ID: "restored", MType: models.TypeGauge, Value: &value}}}
+	require.NoError(t, service.Restore(ctx, archive, backup.ModeReplace))
+	_, err = service.Update(ctx, models.Metric{ID: "extra", MType: models.TypeGauge, Value: &value})
+	assert.NoError(t, err)
+}
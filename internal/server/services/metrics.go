@@ -3,50 +3,135 @@ package services
 import (
 	"context"
 	"errors"
+	"fmt"
+	"time"
 
+	"github.com/invinciblewest/metrics/internal/backup"
 	"github.com/invinciblewest/metrics/internal/models"
 	"github.com/invinciblewest/metrics/internal/storage"
+	"github.com/invinciblewest/metrics/internal/tokens"
+)
+
+var (
+	ErrEmptyID      = errors.New("id is empty")
+	ErrMissingValue = errors.New("value is nil")
+	ErrMissingDelta = errors.New("delta is nil")
 )
 
 // MetricsService предоставляет методы для работы с метриками в хранилище.
 type MetricsService struct {
-	st storage.Storage
+	st           storage.Storage
+	maxBatchSize int
+	quota        *metricsQuota
+	keysWindow   time.Duration
+	keys         *recentKeys
+	subs         *subscribers
+	rates        *rateTracker
+	forwarder    Forwarder
 }
 
 // NewMetricsService создает новый экземпляр MetricsService с заданным хранилищем.
-func NewMetricsService(st storage.Storage) MetricsService {
-	return MetricsService{
-		st: st,
+func NewMetricsService(st storage.Storage, opts ...Option) MetricsService {
+	ms := MetricsService{
+		st:    st,
+		subs:  newSubscribers(),
+		rates: newRateTracker(),
+	}
+	for _, opt := range opts {
+		opt(&ms)
 	}
+	return ms
 }
 
 // Update обновляет метрику в хранилище в зависимости от ее типа.
+// Если запрос аутентифицирован токеном агента, имя метрики должно входить в его область действия.
+// Новая метрика отклоняется, если квота различных метрик исчерпана.
 func (ms *MetricsService) Update(ctx context.Context, metrics models.Metric) (models.Metric, error) {
+	if err := tokens.CheckWrite(ctx, metrics); err != nil {
+		return models.Metric{}, err
+	}
+
+	var update func(context.Context, models.Metric) error
 	switch metrics.MType {
 	case models.TypeGauge:
 		if metrics.Value == nil {
-			return metrics, errors.New("value is nil")
-		}
-		if err := ms.st.UpdateGauge(ctx, metrics); err != nil {
-			return metrics, err
+			return metrics, ErrMissingValue
 		}
+		update = ms.st.UpdateGauge
 	case models.TypeCounter:
 		if metrics.Delta == nil {
-			return metrics, errors.New("delta is nil")
-		}
-		if err := ms.st.UpdateCounter(ctx, metrics); err != nil {
-			return metrics, err
+			return metrics, ErrMissingDelta
 		}
+		update = ms.st.UpdateCounter
 	default:
 		return models.Metric{}, storage.ErrWrongType
 	}
 
+	reserved, err := ms.reserve(ctx, metrics)
+	if err != nil {
+		return metrics, err
+	}
+	forwarded := ms.forwardCopy(metrics)
+	deltas := counterDeltas(metrics)
+	if err = update(ctx, metrics); err != nil {
+		ms.release(reserved)
+		return metrics, err
+	}
+	ms.track(ctx, deltas)
+	ms.publish(ctx, metrics)
+	ms.forward(forwarded)
+
 	return metrics, nil
 }
 
 // UpdateBatch обновляет пакет метрик в хранилище.
+// Пакет отклоняется целиком, если он превышает допустимый размер, содержит некорректную метрику
+// (ошибка *ItemError), добавляет метрики сверх квоты или содержит метрику вне области действия токена агента.
+// Все метрики проверяются до записи, поэтому некорректная метрика не оставляет пакет записанным частично.
 func (ms *MetricsService) UpdateBatch(ctx context.Context, metrics []models.Metric) error {
-	return ms.st.UpdateBatch(ctx, metrics)
+	reserved, err := ms.prepareBatch(ctx, metrics)
+	if err != nil {
+		return err
+	}
+	forwarded := ms.forwardCopy(metrics...)
+	deltas := counterDeltas(metrics...)
+	if err = ms.st.UpdateBatch(ctx, metrics); err != nil {
+		ms.release(reserved)
+		return err
+	}
+	ms.track(ctx, deltas)
+	ms.publish(ctx, metrics...)
+	ms.forward(forwarded)
+	return nil
+}
+
+// prepareBatch проверяет пакет перед записью и резервирует его новые метрики в квоте.
+func (ms *MetricsService) prepareBatch(ctx context.Context, metrics []models.Metric) ([]metricKey, error) {
+	if ms.maxBatchSize > 0 && len(metrics) > ms.maxBatchSize {
+		return nil, fmt.Errorf("%w: %d metrics, limit %d", ErrBatchTooLarge, len(metrics), ms.maxBatchSize)
+	}
+	if err := validateBatch(metrics); err != nil {
+		return nil, err
+	}
+	if err := tokens.CheckWrite(ctx, metrics...); err != nil {
+		return nil, err
+	}
+	return ms.reserve(ctx, metrics...)
+}
+
+// reserve резервирует новые метрики в квоте различных метрик, если она задана.
+func (ms *MetricsService) reserve(ctx context.Context, metrics ...models.Metric) ([]metricKey, error) {
+	if ms.quota == nil {
+		return nil, nil
+	}
+	return ms.quota.reserve(ctx, ms.st, metrics)
+}
+
+// release освобождает квоту метрик, запись которых не удалась.
+func (ms *MetricsService) release(keys []metricKey) {
+	if ms.quota != nil {
+		ms.quota.release(keys)
+	}
 }
 
 // Get извлекает метрику из хранилища по типу и идентификатору.
@@ -54,7 +139,7 @@ func (ms *MetricsService) Get(ctx context.Context, mType, id string) (models.Met
 	var result models.Metric
 
 	if id == "" {
-		return result, errors.New("id is empty")
+		return result, ErrEmptyID
 	}
 
 	switch mType {
@@ -77,6 +162,42 @@ func (ms *MetricsService) Get(ctx context.Context, mType, id string) (models.Met
 	return result, nil
 }
 
+// Backup создает архив с согласованным снимком состояния хранилища.
+func (ms *MetricsService) Backup(ctx context.Context) (backup.Archive, error) {
+	return backup.Create(ctx, ms.st)
+}
+
+// Restore восстанавливает состояние хранилища из архива в заданном режиме.
+// Восстановление не ограничивается квотой метрик, но после него квота пересчитывается по хранилищу,
+// а значения счетчиков для вычисления скорости сверяются с ним.
+func (ms *MetricsService) Restore(ctx context.Context, archive backup.Archive, mode backup.Mode) error {
+	if ms.quota != nil {
+		defer ms.quota.reset()
+	}
+	defer ms.resyncRates(ctx)
+	return backup.Restore(ctx, ms.st, archive, mode)
+}
+
+// Aggregate вычисляет агрегированное значение метрик, соответствующих запросу.
+// Если хранилище умеет выполнять агрегацию самостоятельно, запрос передается ему,
+// а запросы, которые хранилище не поддерживает, вычисляются перебором метрик.
+func (ms *MetricsService) Aggregate(ctx context.Context, q storage.AggregateQuery) ([]storage.AggregateResult, error) {
+	if q.Regexp == nil || !q.Func.Valid() {
+		return nil, storage.ErrBadQuery
+	}
+	if q.MType != "" && q.MType != models.TypeGauge && q.MType != models.TypeCounter {
+		return nil, storage.ErrWrongType
+	}
+
+	if aggregator, ok := ms.st.(storage.Aggregator); ok {
+		results, err := aggregator.Aggregate(ctx, q)
+		if !errors.Is(err, storage.ErrNotSupported) {
+			return results, err
+		}
+	}
+	return aggregate(ctx, ms.st, q)
+}
+
 // PingStorage проверяет доступность хранилища метрик.
 func (ms *MetricsService) PingStorage(ctx context.Context) bool {
 	if err := ms.st.Ping(ctx); err != nil {
@@ -0,0 +1,249 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/invinciblewest/metrics/internal/models"
+	"github.com/invinciblewest/metrics/internal/storage"
+)
+
+const (
+	defaultRateSamples   = 64        // defaultRateSamples количество значений, запоминаемых для каждого счетчика.
+	defaultRateRetention = time.Hour // defaultRateRetention время, в течение которого значение счетчика участвует в вычислении скорости.
+)
+
+// ErrNotEnoughSamples возвращается, если для вычисления скорости счетчика недостаточно запомненных значений.
+var ErrNotEnoughSamples = errors.New("not enough samples to compute rate")
+
+// WithRateSamples задает, сколько последних значений каждого счетчика запоминается для вычисления скорости.
+// Значение меньше двух оставляет количество по умолчанию.
+func WithRateSamples(n int) Option {
+	return func(ms *MetricsService) {
+		if n > 1 {
+			ms.rates.samples = n
+		}
+	}
+}
+
+// WithRateRetention задает, как долго значение счетчика участвует в вычислении скорости.
+// Нулевое значение оставляет время по умолчанию.
+func WithRateRetention(d time.Duration) Option {
+	return func(ms *MetricsService) {
+		if d > 0 {
+			ms.rates.retention = d
+		}
+	}
+}
+
+// Rate скорость роста счетчика на интервале между двумя его значениями.
+type Rate struct {
+	ID       string    `json:"id"`       // ID имя счетчика.
+	Value    int64     `json:"value"`    // Value значение счетчика в конце интервала.
+	Rate     float64   `json:"rate"`     // Rate прирост в секунду.
+	Increase int64     `json:"increase"` // Increase прирост за интервал с учетом сбросов.
+	From     time.Time `json:"from"`     // From начало интервала.
+	To       time.Time `json:"to"`       // To конец интервала.
+	Resets   int       `json:"resets"`   // Resets количество сбросов счетчика на интервале.
+}
+
+// Rate вычисляет скорость роста счетчика id. Если window равно нулю, скорость вычисляется на интервале
+// между двумя последними записанными значениями, иначе — на интервале от самого раннего значения
+// в пределах window до текущего момента. Уменьшение значения считается сбросом счетчика:
+// прирост после сброса равен новому значению.
+// Значения запоминаются в памяти при записи счетчика через сервис, поэтому сразу после запуска сервера
+// скорость еще не известна и возвращается ErrNotEnoughSamples.
+// Оба конца интервала берутся из запомненных значений, а хранилище только подтверждает, что счетчик существует:
+// если в общее хранилище пишут несколько экземпляров сервера, каждый вычисляет скорость по записанным
+// через него приращениям и не принимает чужие приращения за рост или сброс счетчика.
+func (ms *MetricsService) Rate(ctx context.Context, id string, window time.Duration) (Rate, error) {
+	if id == "" {
+		return Rate{}, ErrEmptyID
+	}
+	if _, err := ms.st.GetCounter(ctx, id); err != nil {
+		return Rate{}, storage.ErrNotFound
+	}
+	return ms.rates.rate(id, window)
+}
+
+// counterDeltas суммирует приращения счетчиков пакета. Вызывается до записи: хранилище может заменить
+// приращение счетчика накопленным значением.
+func counterDeltas(metrics ...models.Metric) map[string]int64 {
+	var deltas map[string]int64
+	for _, metric := range metrics {
+		if metric.MType != models.TypeCounter || metric.Delta == nil {
+			continue
+		}
+		if deltas == nil {
+			deltas = make(map[string]int64)
+		}
+		deltas[metric.ID] += *metric.Delta
+	}
+	return deltas
+}
+
+// track добавляет записанные приращения счетчиков к запомненным значениям для вычисления скорости.
+// Хранилище читается, только если значения счетчика еще не запомнены, например после запуска сервера.
+func (ms *MetricsService) track(ctx context.Context, deltas map[string]int64) {
+	for id, delta := range deltas {
+		if ms.rates.add(id, delta) {
+			continue
+		}
+		counter, err := ms.st.GetCounter(ctx, id)
+		if err != nil {
+			continue
+		}
+		ms.rates.seed(id, *counter.Delta, delta)
+	}
+}
+
+// resyncRates сверяет запомненные значения счетчиков с хранилищем после изменений в обход track,
+// например восстановления из резервной копии. Уменьшившееся значение учитывается как сброс счетчика.
+func (ms *MetricsService) resyncRates(ctx context.Context) {
+	for _, id := range ms.rates.ids() {
+		counter, err := ms.st.GetCounter(ctx, id)
+		switch {
+		case err == nil:
+			ms.rates.record(id, *counter.Delta)
+		case errors.Is(err, storage.ErrNotFound):
+			ms.rates.forget(id)
+		}
+	}
+}
+
+// ratePoint значение счетчика в момент времени.
+type ratePoint struct {
+	value int64
+	at    time.Time
+}
+
+// rateTracker хранит последние значения счетчиков. Для каждого счетчика хранится не больше samples значений
+// не старше retention, поэтому память не растет вместе с историей.
+type rateTracker struct {
+	mu        sync.Mutex
+	samples   int
+	retention time.Duration
+	series    map[string][]ratePoint
+	now       func() time.Time
+}
+
+func newRateTracker() *rateTracker {
+	return &rateTracker{
+		samples:   defaultRateSamples,
+		retention: defaultRateRetention,
+		series:    make(map[string][]ratePoint),
+		now:       time.Now,
+	}
+}
+
+// record добавляет значение счетчика id, вытесняя устаревшие и лишние значения.
+func (t *rateTracker) record(id string, value int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.recordLocked(id, value)
+}
+
+// add добавляет значение счетчика id, увеличенное на delta. Возвращает false, если значения счетчика
+// еще не запомнены и текущее значение неизвестно.
+func (t *rateTracker) add(id string, delta int64) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	points := t.series[id]
+	if len(points) == 0 {
+		return false
+	}
+	t.recordLocked(id, points[len(points)-1].value+delta)
+	return true
+}
+
+// seed запоминает значение total, прочитанное из хранилища после записи приращения delta.
+// Если значения счетчика тем временем запомнил параллельный запрос, к ним добавляется delta.
+func (t *rateTracker) seed(id string, total, delta int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if points := t.series[id]; len(points) > 0 {
+		total = points[len(points)-1].value + delta
+	}
+	t.recordLocked(id, total)
+}
+
+// ids возвращает счетчики, значения которых запомнены.
+func (t *rateTracker) ids() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	ids := make([]string, 0, len(t.series))
+	for id := range t.series {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// forget забывает значения удаленного счетчика.
+func (t *rateTracker) forget(id string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.series, id)
+}
+
+func (t *rateTracker) recordLocked(id string, value int64) {
+	now := t.now()
+	points := append(t.series[id], ratePoint{value: value, at: now})
+	first := 0
+	for first < len(points)-1 && (len(points)-first > t.samples || now.Sub(points[first].at) > t.retention) {
+		first++
+	}
+	if first > 0 {
+		points = append(points[:0], points[first:]...)
+	}
+	t.series[id] = points
+}
+
+// rate вычисляет скорость счетчика id по запомненным значениям.
+func (t *rateTracker) rate(id string, window time.Duration) (Rate, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	points := t.series[id]
+	if window > 0 && len(points) > 0 {
+		// Последнее запомненное значение завершает интервал текущим моментом, даже если счетчик
+		// давно не обновлялся.
+		now := t.now()
+		current := points[len(points)-1].value
+		start := len(points)
+		for start > 0 && now.Sub(points[start-1].at) <= window {
+			start--
+		}
+		points = append(points[start:len(points):len(points)], ratePoint{value: current, at: now})
+	} else if len(points) > 2 {
+		points = points[len(points)-2:]
+	}
+	if len(points) < 2 {
+		return Rate{}, ErrNotEnoughSamples
+	}
+
+	result := Rate{
+		ID:    id,
+		Value: points[len(points)-1].value,
+		From:  points[0].at,
+		To:    points[len(points)-1].at,
+	}
+	elapsed := result.To.Sub(result.From)
+	if elapsed <= 0 {
+		return Rate{}, ErrNotEnoughSamples
+	}
+	for i := 1; i < len(points); i++ {
+		if diff := points[i].value - points[i-1].value; diff >= 0 {
+			result.Increase += diff
+		} else {
+			result.Increase += points[i].value
+			result.Resets++
+		}
+	}
+	result.Rate = float64(result.Increase) / elapsed.Seconds()
+	return result, nil
+}
@@ -0,0 +1,174 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/invinciblewest/metrics/internal/backup"
+	"github.com/invinciblewest/metrics/internal/models"
+	"github.com/invinciblewest/metrics/internal/storage"
+	"github.com/invinciblewest/metrics/internal/storage/memstorage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetricsService_Rate(t *testing.T) {
+	ctx := context.TODO()
+	st := memstorage.NewMemStorage("", false)
+	service := NewMetricsService(st)
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := start
+	service.rates.now = func() time.Time { return now }
+
+	add := func(delta int64) {
+		_, err := service.Update(ctx, models.Metric{ID: "PollCount", MType: models.TypeCounter, Delta: &delta})
+		require.NoError(t, err)
+	}
+
+	_, err := service.Rate(ctx, "PollCount", 0)
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+
+	add(10)
+	_, err = service.Rate(ctx, "PollCount", 0)
+	assert.ErrorIs(t, err, ErrNotEnoughSamples)
+
+	now = start.Add(10 * time.Second)
+	add(20)
+	now = start.Add(20 * time.Second)
+	add(40)
+
+	rate, err := service.Rate(ctx, "PollCount", 0)
+	require.NoError(t, err)
+	assert.Equal(t, Rate{
+		ID:       "PollCount",
+		Value:    70,
+		Rate:     4,
+		Increase: 40,
+		From:     start.Add(10 * time.Second),
+		To:       start.Add(20 * time.Second),
+	}, rate)
+
+	// Окно завершается текущим моментом, даже если счетчик с тех пор не обновлялся.
+	now = start.Add(30 * time.Second)
+	rate, err = service.Rate(ctx, "PollCount", 25*time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, start.Add(10*time.Second), rate.From)
+	assert.Equal(t, now, rate.To)
+	assert.Equal(t, int64(40), rate.Increase)
+	assert.Equal(t, 2.0, rate.Rate)
+
+	t.Run("reset", func(t *testing.T) {
+		// Значение счетчика уменьшилось после восстановления из резервной копии.
+		value := int64(5)
+		now = start.Add(40 * time.Second)
+		require.NoError(t, service.Restore(ctx, backup.Archive{
+			Version: backup.Version,
+			Metrics: []models.Metric{{ID: "PollCount", MType: models.TypeCounter, Delta: &value}},
+		}, backup.ModeMerge))
+
+		rate, err = service.Rate(ctx, "PollCount", 0)
+		require.NoError(t, err)
+		assert.Equal(t, int64(5), rate.Value)
+		assert.Equal(t, int64(5), rate.Increase)
+		assert.Equal(t, 1, rate.Resets)
+		assert.Equal(t, 0.25, rate.Rate)
+	})
+
+	t.Run("empty window", func(t *testing.T) {
+		now = start.Add(time.Hour)
+		_, err = service.Rate(ctx, "PollCount", time.Minute)
+		assert.ErrorIs(t, err, ErrNotEnoughSamples)
+	})
+}
+
+func TestMetricsService_RateSharedStorage(t *testing.T) {
+	ctx := context.TODO()
+	st := memstorage.NewMemStorage("", false)
+	service := NewMetricsService(st)
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := start
+	service.rates.now = func() time.Time { return now }
+
+	add := func(delta int64) {
+		_, err := service.Update(ctx, models.Metric{ID: "PollCount", MType: models.TypeCounter, Delta: &delta})
+		require.NoError(t, err)
+	}
+	add(10)
+	now = start.Add(10 * time.Second)
+	add(20)
+
+	// Другой экземпляр сервера записывает в то же хранилище: его приращения не учитываются в скорости.
+	other := int64(1000)
+	require.NoError(t, st.UpdateCounter(ctx, models.Metric{ID: "PollCount", MType: models.TypeCounter, Delta: &other}))
+	now = start.Add(20 * time.Second)
+
+	rate, err := service.Rate(ctx, "PollCount", 30*time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, Rate{
+		ID:       "PollCount",
+		Value:    30,
+		Rate:     1,
+		Increase: 20,
+		From:     start,
+		To:       now,
+	}, rate)
+}
+
+// countingStorage считает чтения счетчиков из хранилища.
+type countingStorage struct {
+	*memstorage.MemStorage
+	reads int
+}
+
+func (s *countingStorage) GetCounter(ctx context.Context, id string) (models.Metric, error) {
+	s.reads++
+	return s.MemStorage.GetCounter(ctx, id)
+}
+
+func TestMetricsService_TrackRunningSum(t *testing.T) {
+	ctx := context.TODO()
+	st := &countingStorage{MemStorage: memstorage.NewMemStorage("", false)}
+	delta := int64(7)
+	require.NoError(t, st.UpdateCounter(ctx, models.Metric{ID: "PollCount", MType: models.TypeCounter, Delta: &delta}))
+
+	service := NewMetricsService(st)
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := start
+	service.rates.now = func() time.Time { return now }
+
+	for i := range 3 {
+		now = start.Add(time.Duration(i) * time.Second)
+		one, two := int64(1), int64(2)
+		require.NoError(t, service.UpdateBatch(ctx, []models.Metric{
+			{ID: "PollCount", MType: models.TypeCounter, Delta: &one},
+			{ID: "PollCount", MType: models.TypeCounter, Delta: &two},
+		}))
+	}
+	// Накопленное значение читается из хранилища один раз, дальше к нему добавляются приращения.
+	assert.Equal(t, 1, st.reads)
+	points := service.rates.series["PollCount"]
+	require.Len(t, points, 3)
+	assert.Equal(t, []int64{10, 13, 16}, []int64{points[0].value, points[1].value, points[2].value})
+}
+
+func TestRateTracker_Record(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := start
+	tracker := newRateTracker()
+	tracker.samples = 3
+	tracker.retention = time.Minute
+	tracker.now = func() time.Time { return now }
+
+	for i := range 5 {
+		now = start.Add(time.Duration(i) * time.Second)
+		tracker.record("PollCount", int64(i))
+	}
+	require.Len(t, tracker.series["PollCount"], 3)
+	assert.Equal(t, int64(2), tracker.series["PollCount"][0].value)
+
+	now = start.Add(2 * time.Minute)
+	tracker.record("PollCount", 10)
+	require.Len(t, tracker.series["PollCount"], 1)
+	assert.Equal(t, int64(10), tracker.series["PollCount"][0].value)
+}
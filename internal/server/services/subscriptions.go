@@ -0,0 +1,255 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/invinciblewest/metrics/internal/models"
+	"github.com/invinciblewest/metrics/internal/storage"
+)
+
+const (
+	defaultSubscriptionBuffer = 64               // defaultSubscriptionBuffer количество обновлений, которое подписчик может не прочитать.
+	defaultHeartbeat          = 15 * time.Second // defaultHeartbeat интервал сообщений, поддерживающих соединение подписчика.
+)
+
+// ErrSlowConsumer возвращается подпиской, закрытой из-за того, что подписчик не успевал читать обновления.
+var ErrSlowConsumer = errors.New("subscriber is too slow, updates dropped")
+
+// WithSubscriptionBuffer задает, сколько непрочитанных обновлений накапливается для каждого подписчика.
+// Подписчик, буфер которого переполнен, отключается. Нулевое значение оставляет размер по умолчанию.
+func WithSubscriptionBuffer(n int) Option {
+	return func(ms *MetricsService) {
+		if n > 0 {
+			ms.subs.buffer = n
+		}
+	}
+}
+
+// WithHeartbeat задает интервал сообщений, которыми транспорт поддерживает соединение подписчика
+// в отсутствие обновлений. Нулевое значение оставляет интервал по умолчанию.
+func WithHeartbeat(d time.Duration) Option {
+	return func(ms *MetricsService) {
+		if d > 0 {
+			ms.subs.heartbeat = d
+		}
+	}
+}
+
+// Heartbeat возвращает интервал сообщений, поддерживающих соединение подписчика.
+func (ms *MetricsService) Heartbeat() time.Duration {
+	return ms.subs.heartbeat
+}
+
+// SubscriptionFilter выбирает метрики, на обновления которых оформляется подписка.
+// Пустой фильтр выбирает все метрики.
+type SubscriptionFilter struct {
+	IDs      []string // IDs имена метрик.
+	Patterns []string // Patterns шаблоны имен метрик в формате path.Match.
+}
+
+// Subscribe подписывается на обновления метрик, выбранных filter. Подписчик получает текущее значение
+// метрики после каждого обновления, записанного через сервис: для счетчика это накопленная сумма.
+// Подписку нужно закрыть вызовом Close.
+func (ms *MetricsService) Subscribe(filter SubscriptionFilter) (*Subscription, error) {
+	for _, pattern := range filter.Patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, storage.ErrBadQuery
+		}
+	}
+	sub := &Subscription{
+		ids:      make(map[string]struct{}, len(filter.IDs)),
+		patterns: filter.Patterns,
+		updates:  make(chan models.Metric, ms.subs.buffer),
+		done:     make(chan struct{}),
+		hub:      ms.subs,
+	}
+	for _, id := range filter.IDs {
+		sub.ids[id] = struct{}{}
+	}
+	ms.subs.add(sub)
+	return sub, nil
+}
+
+// CloseSubscriptions закрывает все подписки, например перед остановкой сервера:
+// иначе долгие соединения подписчиков не дали бы ему завершиться.
+func (ms *MetricsService) CloseSubscriptions() {
+	for _, sub := range ms.subs.list() {
+		sub.Close()
+	}
+}
+
+// publish рассылает подписчикам текущие значения обновленных метрик. Значения счетчиков читаются
+// из хранилища, только если на метрику есть подписчики.
+func (ms *MetricsService) publish(ctx context.Context, metrics ...models.Metric) {
+	if !ms.subs.active() {
+		return
+	}
+	seen := make(map[metricKey]struct{}, len(metrics))
+	for _, metric := range metrics {
+		key := metricKey{mType: metric.MType, id: metric.ID}
+		if _, ok := seen[key]; ok || !ms.subs.wants(metric.ID) {
+			continue
+		}
+		seen[key] = struct{}{}
+
+		current := models.Metric{ID: metric.ID, MType: metric.MType}
+		switch metric.MType {
+		case models.TypeGauge:
+			value := *metric.Value
+			current.Value = &value
+		case models.TypeCounter:
+			counter, err := ms.st.GetCounter(ctx, metric.ID)
+			if err != nil {
+				continue
+			}
+			current.Delta = counter.Delta
+		}
+		ms.subs.publish(current)
+	}
+}
+
+// Subscription подписка на обновления метрик.
+type Subscription struct {
+	ids      map[string]struct{}
+	patterns []string
+	updates  chan models.Metric
+	done     chan struct{}
+	once     sync.Once
+	err      error
+	hub      *subscribers
+}
+
+// Updates возвращает канал обновлений метрик. Канал не закрывается: окончание подписки сообщает Done.
+func (s *Subscription) Updates() <-chan models.Metric {
+	return s.updates
+}
+
+// Done возвращает канал, который закрывается при окончании подписки.
+func (s *Subscription) Done() <-chan struct{} {
+	return s.done
+}
+
+// Err возвращает причину окончания подписки: ErrSlowConsumer, если подписчик отключен из-за
+// переполнения буфера, или nil, если подписка закрыта вызовом Close.
+func (s *Subscription) Err() error {
+	select {
+	case <-s.done:
+		return s.err
+	default:
+		return nil
+	}
+}
+
+// Close отменяет подписку.
+func (s *Subscription) Close() {
+	s.stop(nil)
+}
+
+// stop удаляет подписчика из рассылки и сообщает причину окончания подписки.
+func (s *Subscription) stop(err error) {
+	s.once.Do(func() {
+		s.hub.remove(s)
+		s.err = err
+		close(s.done)
+	})
+}
+
+// matches сообщает, выбирает ли фильтр подписки метрику id.
+func (s *Subscription) matches(id string) bool {
+	if len(s.ids) == 0 && len(s.patterns) == 0 {
+		return true
+	}
+	if _, ok := s.ids[id]; ok {
+		return true
+	}
+	for _, pattern := range s.patterns {
+		if matched, _ := path.Match(pattern, id); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// subscribers хранит подписчиков на обновления метрик сервиса.
+type subscribers struct {
+	mu        sync.RWMutex
+	subs      map[*Subscription]struct{}
+	buffer    int
+	heartbeat time.Duration
+}
+
+// newSubscribers создает пустой список подписчиков с настройками по умолчанию.
+func newSubscribers() *subscribers {
+	return &subscribers{
+		subs:      make(map[*Subscription]struct{}),
+		buffer:    defaultSubscriptionBuffer,
+		heartbeat: defaultHeartbeat,
+	}
+}
+
+func (h *subscribers) add(sub *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.subs[sub] = struct{}{}
+}
+
+func (h *subscribers) remove(sub *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.subs, sub)
+}
+
+func (h *subscribers) list() []*Subscription {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	subs := make([]*Subscription, 0, len(h.subs))
+	for sub := range h.subs {
+		subs = append(subs, sub)
+	}
+	return subs
+}
+
+// active сообщает, есть ли подписчики.
+func (h *subscribers) active() bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.subs) > 0
+}
+
+// wants сообщает, есть ли подписчики на метрику id.
+func (h *subscribers) wants(id string) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for sub := range h.subs {
+		if sub.matches(id) {
+			return true
+		}
+	}
+	return false
+}
+
+// publish передает обновление подписчикам без ожидания. Подписчики с переполненным буфером отключаются,
+// чтобы медленный клиент не задерживал запись метрик и не получал обновления с пропусками.
+func (h *subscribers) publish(metric models.Metric) {
+	var slow []*Subscription
+	h.mu.RLock()
+	for sub := range h.subs {
+		if !sub.matches(metric.ID) {
+			continue
+		}
+		select {
+		case sub.updates <- metric:
+		default:
+			slow = append(slow, sub)
+		}
+	}
+	h.mu.RUnlock()
+
+	for _, sub := range slow {
+		sub.stop(ErrSlowConsumer)
+	}
+}
@@ -0,0 +1,112 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/invinciblewest/metrics/internal/models"
+	"github.com/invinciblewest/metrics/internal/storage"
+	"github.com/invinciblewest/metrics/internal/storage/memstorage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetricsService_Subscribe(t *testing.T) {
+	ctx := context.TODO()
+	gauge := func(id string, value float64) models.Metric {
+		return models.Metric{ID: id, MType: models.TypeGauge, Value: &value}
+	}
+	counter := func(id string, delta int64) models.Metric {
+		return models.Metric{ID: id, MType: models.TypeCounter, Delta: &delta}
+	}
+	receive := func(sub *Subscription) []models.Metric {
+		var received []models.Metric
+		for {
+			select {
+			case metric := <-sub.Updates():
+				received = append(received, metric)
+			default:
+				return received
+			}
+		}
+	}
+
+	t.Run("filter", func(t *testing.T) {
+		service := NewMetricsService(memstorage.NewMemStorage("", false))
+		sub, err := service.Subscribe(SubscriptionFilter{IDs: []string{"Alloc"}, Patterns: []string{"cpu.*"}})
+		require.NoError(t, err)
+		defer sub.Close()
+
+		_, err = service.Update(ctx, gauge("Alloc", 1))
+		require.NoError(t, err)
+		_, err = service.Update(ctx, gauge("HeapAlloc", 2))
+		require.NoError(t, err)
+		require.NoError(t, service.UpdateBatch(ctx, []models.Metric{gauge("cpu.0", 3), gauge("mem.0", 4)}))
+
+		assert.Equal(t, []models.Metric{gauge("Alloc", 1), gauge("cpu.0", 3)}, receive(sub))
+	})
+	t.Run("counter total", func(t *testing.T) {
+		service := NewMetricsService(memstorage.NewMemStorage("", false))
+		sub, err := service.Subscribe(SubscriptionFilter{})
+		require.NoError(t, err)
+		defer sub.Close()
+
+		_, err = service.Update(ctx, counter("PollCount", 2))
+		require.NoError(t, err)
+		require.NoError(t, service.UpdateBatch(ctx, []models.Metric{counter("PollCount", 3), counter("PollCount", 4)}))
+		_, err = service.UpdateBatchPartial(ctx, []models.Metric{counter("PollCount", 1), {ID: "bad", MType: "unknown"}})
+		require.NoError(t, err)
+
+		assert.Equal(t, []models.Metric{counter("PollCount", 2), counter("PollCount", 9), counter("PollCount", 10)}, receive(sub))
+	})
+	t.Run("failed update", func(t *testing.T) {
+		service := NewMetricsService(memstorage.NewMemStorage("", false), WithMaxBatchSize(1))
+		sub, err := service.Subscribe(SubscriptionFilter{})
+		require.NoError(t, err)
+		defer sub.Close()
+
+		assert.Error(t, service.UpdateBatch(ctx, []models.Metric{gauge("a", 1), gauge("b", 2)}))
+		assert.Empty(t, receive(sub))
+	})
+	t.Run("slow consumer", func(t *testing.T) {
+		service := NewMetricsService(memstorage.NewMemStorage("", false), WithSubscriptionBuffer(2))
+		slow, err := service.Subscribe(SubscriptionFilter{})
+		require.NoError(t, err)
+		defer slow.Close()
+		other, err := service.Subscribe(SubscriptionFilter{IDs: []string{"other"}})
+		require.NoError(t, err)
+		defer other.Close()
+
+		for i := 0; i < 3; i++ {
+			_, err = service.Update(ctx, gauge("Alloc", float64(i)))
+			require.NoError(t, err)
+		}
+
+		<-slow.Done()
+		assert.ErrorIs(t, slow.Err(), ErrSlowConsumer)
+		assert.Len(t, receive(slow), 2)
+		assert.NoError(t, other.Err())
+
+		_, err = service.Update(ctx, gauge("other", 1))
+		require.NoError(t, err)
+		assert.Len(t, receive(other), 1)
+	})
+	t.Run("close", func(t *testing.T) {
+		service := NewMetricsService(memstorage.NewMemStorage("", false))
+		sub, err := service.Subscribe(SubscriptionFilter{})
+		require.NoError(t, err)
+
+		service.CloseSubscriptions()
+		<-sub.Done()
+		assert.NoError(t, sub.Err())
+
+		_, err = service.Update(ctx, gauge("Alloc", 1))
+		require.NoError(t, err)
+		assert.Empty(t, receive(sub))
+	})
+	t.Run("bad pattern", func(t *testing.T) {
+		service := NewMetricsService(memstorage.NewMemStorage("", false))
+		_, err := service.Subscribe(SubscriptionFilter{Patterns: []string{"cpu["}})
+		assert.ErrorIs(t, err, storage.ErrBadQuery)
+	})
+}
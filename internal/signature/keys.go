@@ -0,0 +1,128 @@
+package signature
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"strings"
+	"sync/atomic"
+)
+
+// HeaderKeyID заголовок с идентификатором ключа, которым подписан запрос или ответ.
+const HeaderKeyID = "X-Hash-Key-ID"
+
+// KeyID возвращает идентификатор ключа: первые 8 байт SHA-256 ключа в шестнадцатеричном виде.
+// Идентификатор вычисляется из самого ключа, поэтому агенту не нужно настраивать его отдельно.
+func KeyID(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:8])
+}
+
+// keySet неизменяемый набор активных ключей.
+type keySet struct {
+	primary string
+	byID    map[string]string
+	all     []string
+}
+
+// Keys набор активных ключей HMAC. Основной ключ используется для подписи ответов,
+// проверка подписи выполняется любым активным ключом. Ключи из файла перечитываются методом Reload.
+type Keys struct {
+	primary string
+	path    string
+	current atomic.Pointer[keySet]
+}
+
+// NewKeys создает набор из основного ключа primary. Пустой ключ отключает подпись.
+func NewKeys(primary string) *Keys {
+	k := &Keys{primary: primary}
+	k.current.Store(newKeySet(primary, nil))
+	return k
+}
+
+// LoadKeys создает набор из основного ключа primary и ключей из файла path, по одному на строку.
+// Пустые строки и строки, начинающиеся с #, пропускаются. Если основной ключ не задан,
+// основным становится первый ключ из файла.
+func LoadKeys(primary, path string) (*Keys, error) {
+	k := &Keys{primary: primary, path: path}
+	if err := k.Reload(); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// Reload перечитывает файл ключей. При ошибке продолжает использоваться прежний набор.
+func (k *Keys) Reload() error {
+	var keys []string
+	if k.path != "" {
+		data, err := os.ReadFile(k.path)
+		if err != nil {
+			return err
+		}
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			keys = append(keys, line)
+		}
+		if err = scanner.Err(); err != nil {
+			return err
+		}
+	}
+
+	k.current.Store(newKeySet(k.primary, keys))
+	return nil
+}
+
+// Enabled сообщает, задан ли хотя бы один ключ.
+func (k *Keys) Enabled() bool {
+	return k != nil && k.current.Load().primary != ""
+}
+
+// Primary возвращает основной ключ.
+func (k *Keys) Primary() string {
+	if k == nil {
+		return ""
+	}
+	return k.current.Load().primary
+}
+
+// Candidates возвращает ключи, которыми может быть подписан запрос: ключ с идентификатором id,
+// а если идентификатор не передан — все активные ключи.
+func (k *Keys) Candidates(id string) []string {
+	if k == nil {
+		return nil
+	}
+	set := k.current.Load()
+	if id == "" {
+		return set.all
+	}
+	if key, ok := set.byID[id]; ok {
+		return []string{key}
+	}
+	return nil
+}
+
+// newKeySet собирает набор ключей без повторов, основной ключ идет первым.
+func newKeySet(primary string, keys []string) *keySet {
+	if primary == "" && len(keys) > 0 {
+		primary = keys[0]
+	}
+	set := &keySet{primary: primary, byID: make(map[string]string)}
+	for _, key := range append([]string{primary}, keys...) {
+		if key == "" {
+			continue
+		}
+		id := KeyID(key)
+		if _, ok := set.byID[id]; ok {
+			continue
+		}
+		set.byID[id] = key
+		set.all = append(set.all, key)
+	}
+	return set
+}
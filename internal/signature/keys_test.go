@@ -0,0 +1,52 @@
+package signature
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeys(t *testing.T) {
+	t.Run("disabled", func(t *testing.T) {
+		var keys *Keys
+		assert.False(t, keys.Enabled())
+		assert.False(t, NewKeys("").Enabled())
+		assert.Empty(t, keys.Candidates(""))
+	})
+	t.Run("static", func(t *testing.T) {
+		keys := NewKeys("primary")
+		assert.True(t, keys.Enabled())
+		assert.Equal(t, "primary", keys.Primary())
+		assert.Equal(t, []string{"primary"}, keys.Candidates(KeyID("primary")))
+		assert.Empty(t, keys.Candidates("unknown"))
+	})
+	t.Run("file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "keys")
+		require.NoError(t, os.WriteFile(path, []byte("# active keys\nold\n\nnew\nprimary\n"), 0600))
+
+		keys, err := LoadKeys("primary", path)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"primary", "old", "new"}, keys.Candidates(""))
+		assert.Equal(t, []string{"old"}, keys.Candidates(KeyID("old")))
+
+		require.NoError(t, os.WriteFile(path, []byte("new\n"), 0600))
+		require.NoError(t, keys.Reload())
+		assert.Equal(t, []string{"primary", "new"}, keys.Candidates(""))
+		assert.Empty(t, keys.Candidates(KeyID("old")))
+
+		require.NoError(t, os.Remove(path))
+		assert.Error(t, keys.Reload())
+		assert.Equal(t, []string{"primary", "new"}, keys.Candidates(""))
+	})
+	t.Run("primary from file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "keys")
+		require.NoError(t, os.WriteFile(path, []byte("first\nsecond\n"), 0600))
+
+		keys, err := LoadKeys("", path)
+		require.NoError(t, err)
+		assert.Equal(t, "first", keys.Primary())
+	})
+}
@@ -0,0 +1,86 @@
+package signature
+
+import (
+	"container/list"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var (
+	ErrStaleTimestamp = errors.New("signature timestamp is outside the allowed window") // ErrStaleTimestamp метка времени отсутствует, некорректна или вне допустимого окна.
+	ErrReplay         = errors.New("nonce has already been used")                       // ErrReplay nonce уже встречался в пределах окна.
+)
+
+// nonceEntry запись кеша использованных nonce.
+type nonceEntry struct {
+	nonce string
+	seen  time.Time
+}
+
+// ReplayGuard проверяет метки времени подписанных запросов и запоминает использованные nonce.
+// Кеш ограничен по размеру: при переполнении вытесняются самые старые записи,
+// а записи старше окна удаляются при каждой проверке.
+type ReplayGuard struct {
+	mu     sync.Mutex
+	window time.Duration
+	size   int
+	order  *list.List
+	nonces map[string]*list.Element
+	now    func() time.Time
+}
+
+// NewReplayGuard создает ReplayGuard с допустимым отклонением метки времени window
+// и максимальным количеством запоминаемых nonce size.
+func NewReplayGuard(window time.Duration, size int) *ReplayGuard {
+	return &ReplayGuard{
+		window: window,
+		size:   size,
+		order:  list.New(),
+		nonces: make(map[string]*list.Element),
+		now:    time.Now,
+	}
+}
+
+// Check проверяет, что метка времени попадает в окно, а nonce ранее не использовался, и запоминает nonce.
+func (g *ReplayGuard) Check(timestamp, nonce string) error {
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || nonce == "" {
+		return ErrStaleTimestamp
+	}
+
+	now := g.now()
+	if diff := now.Sub(time.Unix(seconds, 0)); diff > g.window || diff < -g.window {
+		return ErrStaleTimestamp
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.evict(now)
+	if _, ok := g.nonces[nonce]; ok {
+		return ErrReplay
+	}
+
+	g.nonces[nonce] = g.order.PushBack(nonceEntry{nonce: nonce, seen: now})
+	for g.order.Len() > g.size {
+		g.remove(g.order.Front())
+	}
+	return nil
+}
+
+// evict удаляет nonce, которые старше двух окон: запросы с ними будут отклонены по метке времени.
+func (g *ReplayGuard) evict(now time.Time) {
+	for e := g.order.Front(); e != nil; e = g.order.Front() {
+		if now.Sub(e.Value.(nonceEntry).seen) <= 2*g.window {
+			return
+		}
+		g.remove(e)
+	}
+}
+
+func (g *ReplayGuard) remove(e *list.Element) {
+	delete(g.nonces, e.Value.(nonceEntry).nonce)
+	g.order.Remove(e)
+}
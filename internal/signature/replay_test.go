@@ -0,0 +1,51 @@
+package signature
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReplayGuard_Check(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	guard := NewReplayGuard(time.Minute, 2)
+	guard.now = func() time.Time { return now }
+	ts := Timestamp(now)
+
+	assert.NoError(t, guard.Check(ts, "a"))
+	assert.ErrorIs(t, guard.Check(ts, "a"), ErrReplay)
+
+	t.Run("stale timestamp", func(t *testing.T) {
+		assert.ErrorIs(t, guard.Check(Timestamp(now.Add(-2*time.Minute)), "b"), ErrStaleTimestamp)
+		assert.ErrorIs(t, guard.Check(Timestamp(now.Add(2*time.Minute)), "b"), ErrStaleTimestamp)
+	})
+	t.Run("invalid", func(t *testing.T) {
+		assert.ErrorIs(t, guard.Check("abc", "b"), ErrStaleTimestamp)
+		assert.ErrorIs(t, guard.Check(ts, ""), ErrStaleTimestamp)
+	})
+	t.Run("bounded", func(t *testing.T) {
+		assert.NoError(t, guard.Check(ts, "b"))
+		assert.NoError(t, guard.Check(ts, "c"))
+		assert.Equal(t, 2, guard.order.Len())
+		assert.NoError(t, guard.Check(ts, "a"))
+	})
+	t.Run("expired entries are evicted", func(t *testing.T) {
+		now = now.Add(3 * time.Minute)
+		assert.NoError(t, guard.Check(strconv.FormatInt(now.Unix(), 10), "d"))
+		assert.Equal(t, 1, guard.order.Len())
+	})
+}
+
+func TestSum(t *testing.T) {
+	body := []byte("body")
+	assert.NotEqual(t, Sum("key", "POST", "/update/", "", "", body), Sum("key", "POST", "/update/", "1", "n", body))
+	assert.NotEqual(t, Sum("key", "POST", "/update/", "1", "n", body), Sum("key", "POST", "/update/", "2", "n", body))
+	assert.NotEqual(t, Sum("key", "POST", "/update/", "1", "n", body), Sum("key", "POST", "/updates/", "1", "n", body))
+	assert.NotEqual(t, Sum("key", "POST", "/update/", "1", "n", body), Sum("key", "PUT", "/update/", "1", "n", body))
+	assert.Equal(t, Sum("key", "POST", "/update/", "1", "n", body), Sum("key", "POST", "/update/", "1", "n", body))
+	// Без метки времени и nonce подпись, как в предыдущих версиях агента, зависит только от тела.
+	assert.Equal(t, Sum("key", "POST", "/update/", "", "", body), Sum("key", "", "", "", "", body))
+	assert.Equal(t, body, Payload("POST", "/update/", "", "", body))
+}
@@ -0,0 +1,65 @@
+// Package signature реализует подпись HTTP-запросов HMAC-SHA256 с защитой от повторной отправки.
+//
+// Подписанный запрос содержит заголовки HashSHA256 (или X-Signature для подписей Ed25519 и ECDSA),
+// X-Signature-Timestamp и X-Signature-Nonce.
+// Подпись вычисляется от строки "method\nuri\ntimestamp\nnonce\n" и тела запроса, поэтому метку времени,
+// nonce, метод и URI запроса нельзя подменить, не зная ключа: подписанное тело нельзя отправить на другой адрес.
+// Запросы без метки времени подписываются только по телу, как в предыдущих версиях агента.
+package signature
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"time"
+)
+
+const (
+	HeaderHash      = "HashSHA256"            // HeaderHash заголовок с подписью запроса или ответа в base64.
+	HeaderTimestamp = "X-Signature-Timestamp" // HeaderTimestamp заголовок с временем подписи в секундах Unix.
+	HeaderNonce     = "X-Signature-Nonce"     // HeaderNonce заголовок с одноразовым случайным значением.
+
+	HeaderSignature      = "X-Signature"        // HeaderSignature заголовок с подписью Ed25519 или ECDSA в base64.
+	HeaderSignatureKeyID = "X-Signature-Key-ID" // HeaderSignatureKeyID заголовок с идентификатором ключа подписи.
+)
+
+// Sum вычисляет HMAC-SHA256 тела запроса. Если заданы метка времени и nonce, они включаются в подпись
+// вместе с методом и URI запроса.
+func Sum(key, method, uri, timestamp, nonce string, body []byte) []byte {
+	hash := hmac.New(sha256.New, []byte(key))
+	if timestamp != "" || nonce != "" {
+		hash.Write([]byte(prefix(method, uri, timestamp, nonce)))
+	}
+	hash.Write(body)
+	return hash.Sum(nil)
+}
+
+// Payload возвращает подписываемые данные для подписей Ed25519 и ECDSA: так же, как в Sum,
+// метод, URI, метка времени и nonce предшествуют телу запроса.
+func Payload(method, uri, timestamp, nonce string, body []byte) []byte {
+	if timestamp == "" && nonce == "" {
+		return body
+	}
+	return append([]byte(prefix(method, uri, timestamp, nonce)), body...)
+}
+
+// prefix возвращает подписываемую строку, предшествующую телу запроса.
+func prefix(method, uri, timestamp, nonce string) string {
+	return method + "\n" + uri + "\n" + timestamp + "\n" + nonce + "\n"
+}
+
+// Timestamp возвращает метку времени для заголовка HeaderTimestamp.
+func Timestamp(t time.Time) string {
+	return strconv.FormatInt(t.Unix(), 10)
+}
+
+// NewNonce создает случайное значение для заголовка HeaderNonce.
+func NewNonce() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -4,8 +4,10 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"iter"
 	"os"
 	"sync"
+	"time"
 
 	"github.com/invinciblewest/metrics/internal/logger"
 	"github.com/invinciblewest/metrics/internal/models"
@@ -20,6 +22,8 @@ type MemStorage struct {
 	path     string
 	syncSave bool
 	mu       sync.RWMutex
+	keys     map[string]time.Time
+	now      func() time.Time
 }
 
 // NewMemStorage создает новый экземпляр MemStorage с заданным путем к файлу и флагом синхронного сохранения.
@@ -29,6 +33,8 @@ func NewMemStorage(path string, syncSave bool) *MemStorage {
 		Counters: make(storage.CounterList),
 		path:     path,
 		syncSave: syncSave,
+		keys:     make(map[string]time.Time),
+		now:      time.Now,
 	}
 }
 
@@ -61,17 +67,16 @@ func (st *MemStorage) GetGauge(ctx context.Context, id string) (models.Metric, e
 	}
 }
 
-// GetGaugeList возвращает список всех метрик типа Gauge в хранилище.
-func (st *MemStorage) GetGaugeList(ctx context.Context) storage.GaugeList {
-	st.mu.Lock()
-	defer st.mu.Unlock()
-
-	gauges := make(storage.GaugeList, len(st.Gauges))
-	for k, v := range st.Gauges {
-		gauges[k] = v
+// GetGaugeList возвращает итератор по копии всех метрик типа Gauge в хранилище.
+func (st *MemStorage) GetGaugeList(ctx context.Context) iter.Seq2[models.Metric, error] {
+	st.mu.RLock()
+	gauges := make([]models.Metric, 0, len(st.Gauges))
+	for _, v := range st.Gauges {
+		gauges = append(gauges, v)
 	}
+	st.mu.RUnlock()
 
-	return gauges
+	return sequence(gauges)
 }
 
 // UpdateCounter обновляет метрику типа Counter в хранилище.
@@ -109,24 +114,81 @@ func (st *MemStorage) GetCounter(ctx context.Context, id string) (models.Metric,
 	}
 }
 
-// GetCounterList возвращает список всех метрик типа Counter в хранилище.
-func (st *MemStorage) GetCounterList(ctx context.Context) storage.CounterList {
-	st.mu.Lock()
-	defer st.mu.Unlock()
-
-	counters := make(storage.CounterList, len(st.Counters))
-	for k, v := range st.Counters {
-		counters[k] = v
+// GetCounterList возвращает итератор по копии всех метрик типа Counter в хранилище.
+func (st *MemStorage) GetCounterList(ctx context.Context) iter.Seq2[models.Metric, error] {
+	st.mu.RLock()
+	counters := make([]models.Metric, 0, len(st.Counters))
+	for _, v := range st.Counters {
+		counters = append(counters, v)
 	}
+	st.mu.RUnlock()
 
-	return counters
+	return sequence(counters)
+}
+
+// List возвращает итератор по копии всех метрик хранилища, сделанной под одной блокировкой.
+func (st *MemStorage) List(ctx context.Context) iter.Seq2[models.Metric, error] {
+	metrics, err := st.Snapshot(ctx)
+	if err != nil {
+		return func(yield func(models.Metric, error) bool) {
+			yield(models.Metric{}, err)
+		}
+	}
+	return sequence(metrics)
 }
 
 // UpdateBatch обновляет пакет метрик в хранилище.
+// Типы всех метрик проверяются до записи, поэтому пакет с метрикой неизвестного типа не применяется совсем.
 func (st *MemStorage) UpdateBatch(ctx context.Context, metrics []models.Metric) error {
+	if err := checkTypes(metrics); err != nil {
+		return err
+	}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	st.applyBatch(metrics)
+	return nil
+}
+
+// UpdateBatchOnce применяет пакет метрик, если пакет с ключом key не применялся в течение window.
+// Проверка ключа и запись метрик выполняются под одной блокировкой. Ключи хранятся только в памяти
+// и не сохраняются в файл.
+func (st *MemStorage) UpdateBatchOnce(ctx context.Context, key string, window time.Duration, metrics []models.Metric) (bool, error) {
+	if err := checkTypes(metrics); err != nil {
+		return false, err
+	}
+
 	st.mu.Lock()
 	defer st.mu.Unlock()
 
+	now := st.now()
+	for k, appliedAt := range st.keys {
+		if now.Sub(appliedAt) >= window {
+			delete(st.keys, k)
+		}
+	}
+	if _, ok := st.keys[key]; ok {
+		return false, nil
+	}
+
+	st.applyBatch(metrics)
+	st.keys[key] = now
+	return true, nil
+}
+
+// checkTypes проверяет, что все метрики пакета имеют известный тип.
+func checkTypes(metrics []models.Metric) error {
+	for _, metric := range metrics {
+		if metric.MType != models.TypeGauge && metric.MType != models.TypeCounter {
+			return storage.ErrWrongType
+		}
+	}
+	return nil
+}
+
+// applyBatch записывает метрики пакета. Вызывается под блокировкой записи.
+func (st *MemStorage) applyBatch(metrics []models.Metric) {
 	for _, metric := range metrics {
 		switch metric.MType {
 		case models.TypeGauge:
@@ -137,11 +199,67 @@ func (st *MemStorage) UpdateBatch(ctx context.Context, metrics []models.Metric)
 				*metric.Delta += *currentMetric.Delta
 			}
 			st.Counters[metric.ID] = metric
+		}
+	}
+}
+
+// Snapshot возвращает копию всех метрик хранилища, сделанную под блокировкой чтения.
+func (st *MemStorage) Snapshot(ctx context.Context) ([]models.Metric, error) {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+
+	metrics := make([]models.Metric, 0, len(st.Gauges)+len(st.Counters))
+	for _, v := range st.Gauges {
+		value := *v.Value
+		v.Value = &value
+		metrics = append(metrics, v)
+	}
+	for _, v := range st.Counters {
+		delta := *v.Delta
+		v.Delta = &delta
+		metrics = append(metrics, v)
+	}
+
+	return metrics, nil
+}
+
+// Replace заменяет все метрики хранилища заданными.
+func (st *MemStorage) Replace(ctx context.Context, metrics []models.Metric) error {
+	gauges := make(storage.GaugeList)
+	counters := make(storage.CounterList)
+	for _, metric := range metrics {
+		switch metric.MType {
+		case models.TypeGauge:
+			gauges[metric.ID] = metric
+		case models.TypeCounter:
+			counters[metric.ID] = metric
 		default:
 			return storage.ErrWrongType
 		}
 	}
 
+	st.mu.Lock()
+	st.Gauges = gauges
+	st.Counters = counters
+	st.mu.Unlock()
+
+	if st.syncSave {
+		return st.Save(ctx)
+	}
+	return nil
+}
+
+// DeleteCounters удаляет счетчики с заданными идентификаторами.
+func (st *MemStorage) DeleteCounters(ctx context.Context, ids []string) error {
+	st.mu.Lock()
+	for _, id := range ids {
+		delete(st.Counters, id)
+	}
+	st.mu.Unlock()
+
+	if st.syncSave {
+		return st.Save(ctx)
+	}
 	return nil
 }
 
@@ -155,7 +273,7 @@ func (st *MemStorage) Save(ctx context.Context) error {
 	st.mu.Lock()
 	defer st.mu.Unlock()
 
-	file, err := os.OpenFile(st.path, os.O_WRONLY|os.O_CREATE, 0666)
+	file, err := os.OpenFile(st.path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
 	if err != nil {
 		return err
 	}
@@ -211,6 +329,17 @@ func (st *MemStorage) Close(ctx context.Context) error {
 	return nil
 }
 
+// sequence возвращает итератор по срезу метрик.
+func sequence(metrics []models.Metric) iter.Seq2[models.Metric, error] {
+	return func(yield func(models.Metric, error) bool) {
+		for _, metric := range metrics {
+			if !yield(metric, nil) {
+				return
+			}
+		}
+	}
+}
+
 // closeFile закрывает файл и логирует ошибку, если она произошла.
 func closeFile(file *os.File) {
 	err := file.Close()
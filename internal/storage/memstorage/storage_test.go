@@ -3,10 +3,12 @@ package memstorage
 import (
 	"context"
 	"testing"
+	"time"
 
 	"github.com/invinciblewest/metrics/internal/models"
 	"github.com/invinciblewest/metrics/internal/storage"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestNewMemStorage(t *testing.T) {
@@ -57,7 +59,9 @@ func TestMemStorage_Gauge(t *testing.T) {
 		assert.Error(t, err)
 	})
 	t.Run("get gauge list", func(t *testing.T) {
-		assert.Equal(t, list, st.GetGaugeList(ctx))
+		gauges, err := storage.Collect(st.GetGaugeList(ctx))
+		assert.NoError(t, err)
+		assert.ElementsMatch(t, []models.Metric{list["test1"], list["test2"]}, gauges)
 	})
 }
 
@@ -105,7 +109,9 @@ func TestMemStorage_Counter(t *testing.T) {
 		assert.Error(t, err)
 	})
 	t.Run("get counter list", func(t *testing.T) {
-		assert.Equal(t, list, st.GetCounterList(ctx))
+		counters, err := storage.Collect(st.GetCounterList(ctx))
+		assert.NoError(t, err)
+		assert.ElementsMatch(t, []models.Metric{list["test1"], list["test2"]}, counters)
 	})
 	t.Run("increment counter", func(t *testing.T) {
 		for _, v := range list {
@@ -155,6 +161,22 @@ func TestMemStorage_UpdateBatch(t *testing.T) {
 			},
 			expectError: true,
 		},
+		{
+			name: "error after valid metric",
+			metrics: []models.Metric{
+				{
+					ID:    "test3",
+					MType: models.TypeGauge,
+					Value: new(float64),
+				},
+				{
+					ID:    "test4",
+					MType: "unknown",
+					Value: new(float64),
+				},
+			},
+			expectError: true,
+		},
 	}
 
 	ctx := context.TODO()
@@ -165,6 +187,8 @@ func TestMemStorage_UpdateBatch(t *testing.T) {
 			err := st.UpdateBatch(ctx, test.metrics)
 			if test.expectError {
 				assert.Error(t, err)
+				_, err = st.GetGauge(ctx, "test3")
+				assert.Error(t, err)
 			} else {
 				assert.NoError(t, err)
 			}
@@ -172,6 +196,91 @@ func TestMemStorage_UpdateBatch(t *testing.T) {
 	}
 }
 
+func TestMemStorage_UpdateBatchOnce(t *testing.T) {
+	ctx := context.TODO()
+	st := NewMemStorage("", false)
+	now := time.Now()
+	st.now = func() time.Time { return now }
+
+	batch := func() []models.Metric {
+		delta := int64(2)
+		return []models.Metric{{ID: "counter", MType: models.TypeCounter, Delta: &delta}}
+	}
+
+	applied, err := st.UpdateBatchOnce(ctx, "key", time.Minute, batch())
+	require.NoError(t, err)
+	assert.True(t, applied)
+
+	applied, err = st.UpdateBatchOnce(ctx, "key", time.Minute, batch())
+	require.NoError(t, err)
+	assert.False(t, applied)
+
+	_, err = st.UpdateBatchOnce(ctx, "other", time.Minute, []models.Metric{{ID: "test", MType: "unknown"}})
+	assert.ErrorIs(t, err, storage.ErrWrongType)
+
+	now = now.Add(time.Minute)
+	applied, err = st.UpdateBatchOnce(ctx, "key", time.Minute, batch())
+	require.NoError(t, err)
+	assert.True(t, applied)
+
+	counter, err := st.GetCounter(ctx, "counter")
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), *counter.Delta)
+}
+
+func TestMemStorage_SnapshotReplace(t *testing.T) {
+	ctx := context.TODO()
+	st := NewMemStorage("", false)
+
+	value := 3.14
+	delta := int64(2)
+	err := st.UpdateBatch(ctx, []models.Metric{
+		{ID: "gauge", MType: models.TypeGauge, Value: &value},
+		{ID: "counter", MType: models.TypeCounter, Delta: &delta},
+	})
+	assert.NoError(t, err)
+
+	snapshot, err := st.Snapshot(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, snapshot, 2)
+
+	err = st.UpdateCounter(ctx, models.Metric{ID: "counter", MType: models.TypeCounter, Delta: &delta})
+	assert.NoError(t, err)
+	for _, metric := range snapshot {
+		if metric.MType == models.TypeCounter {
+			assert.Equal(t, int64(2), *metric.Delta)
+		}
+	}
+
+	err = st.Replace(ctx, []models.Metric{{ID: "other", MType: models.TypeGauge, Value: &value}})
+	assert.NoError(t, err)
+	metrics, err := storage.Collect(st.List(ctx))
+	assert.NoError(t, err)
+	assert.Len(t, metrics, 1)
+
+	err = st.Replace(ctx, []models.Metric{{ID: "test", MType: "unknown"}})
+	assert.Error(t, err)
+}
+
+func TestMemStorage_DeleteCounters(t *testing.T) {
+	ctx := context.TODO()
+	st := NewMemStorage("", false)
+
+	value := 3.14
+	delta := int64(2)
+	err := st.UpdateBatch(ctx, []models.Metric{
+		{ID: "metric", MType: models.TypeGauge, Value: &value},
+		{ID: "metric", MType: models.TypeCounter, Delta: &delta},
+	})
+	assert.NoError(t, err)
+
+	assert.NoError(t, st.DeleteCounters(ctx, []string{"metric", "missing"}))
+	_, err = st.GetCounter(ctx, "metric")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+	_, err = st.GetGauge(ctx, "metric")
+	assert.NoError(t, err)
+}
+
 func BenchmarkMemStorage_UpdateGauge(b *testing.B) {
 	st := NewMemStorage("", false)
 	ctx := context.Background()
@@ -220,7 +329,8 @@ func BenchmarkMemStorage_GetGaugeList(b *testing.B) {
 	b.ResetTimer()
 
 	for i := 0; i < b.N; i++ {
-		_ = st.GetGaugeList(ctx)
+		for range st.GetGaugeList(ctx) {
+		}
 	}
 }
 
@@ -272,7 +382,8 @@ func BenchmarkMemStorage_GetCounterList(b *testing.B) {
 	b.ResetTimer()
 
 	for i := 0; i < b.N; i++ {
-		_ = st.GetCounterList(ctx)
+		for range st.GetCounterList(ctx) {
+		}
 	}
 }
 
@@ -1,8 +1,16 @@
 package pgstorage
 
-import "database/sql"
+import (
+	"database/sql"
+	"errors"
+	"strings"
 
-// InstallSchema создает таблицу metrics в базе данных, если она не существует.
+	"github.com/invinciblewest/metrics/internal/logger"
+	"github.com/invinciblewest/metrics/internal/models"
+	"go.uber.org/zap"
+)
+
+// InstallSchema создает таблицы metrics и idempotency_keys в базе данных, если они не существуют.
 func InstallSchema(db *sql.DB) error {
 	_, err := db.Exec(`
 	CREATE TABLE IF NOT EXISTS metrics (
@@ -11,9 +19,64 @@ func InstallSchema(db *sql.DB) error {
 		value DOUBLE PRECISION
 	);
 	CREATE UNIQUE INDEX IF NOT EXISTS unique_id_type ON metrics (id, type);
+	CREATE TABLE IF NOT EXISTS idempotency_keys (
+		key TEXT PRIMARY KEY,
+		applied_at TIMESTAMPTZ NOT NULL
+	);
 	`)
 	if err != nil {
 		return err
 	}
 	return nil
 }
+
+// rollback откатывает транзакцию и логирует ошибку, если транзакция еще не завершена.
+func rollback(tx *sql.Tx) {
+	err := tx.Rollback()
+	if err != nil && !errors.Is(err, sql.ErrTxDone) {
+		logger.Log.Error("failed to rollback transaction", zap.Error(err))
+	}
+}
+
+// scanMetric считывает метрику из текущей строки результата запроса вида SELECT id, type, value.
+func scanMetric(rows *sql.Rows) (models.Metric, error) {
+	var metric models.Metric
+	var value float64
+	if err := rows.Scan(&metric.ID, &metric.MType, &value); err != nil {
+		return models.Metric{}, err
+	}
+
+	switch metric.MType {
+	case models.TypeGauge:
+		metric.Value = &value
+	case models.TypeCounter:
+		delta := int64(value)
+		metric.Delta = &delta
+	}
+	return metric, nil
+}
+
+// likePattern преобразует шаблон имени в шаблон LIKE: * в %, ? в _, а % и _ экранируются.
+// Шаблоны с классами символов, экранированием и символами вне печатного ASCII не преобразуются.
+func likePattern(glob string) (string, bool) {
+	if glob == "" {
+		return "", false
+	}
+	var b strings.Builder
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; {
+		case c == '[' || c == ']' || c == '\\' || c < ' ' || c > '~':
+			return "", false
+		case c == '*':
+			b.WriteByte('%')
+		case c == '?':
+			b.WriteByte('_')
+		case c == '%' || c == '_':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String(), true
+}
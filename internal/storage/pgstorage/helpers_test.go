@@ -0,0 +1,31 @@
+package pgstorage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLikePattern(t *testing.T) {
+	tests := []struct {
+		glob    string
+		pattern string
+		ok      bool
+	}{
+		{glob: "CPUutilization*", pattern: "CPUutilization%", ok: true},
+		{glob: "Heap?lloc", pattern: "Heap_lloc", ok: true},
+		{glob: "go_gc_*", pattern: "go\\_gc\\_%", ok: true},
+		{glob: "100%", pattern: "100\\%", ok: true},
+		{glob: "node[0-2].load"},
+		{glob: "a\\*"},
+		{glob: "температура*"},
+		{glob: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.glob, func(t *testing.T) {
+			pattern, ok := likePattern(tt.glob)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.pattern, pattern)
+		})
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"iter"
 	"time"
 
 	"github.com/avast/retry-go"
@@ -12,6 +13,7 @@ import (
 	"github.com/invinciblewest/metrics/internal/storage"
 	"github.com/jackc/pgconn"
 	"github.com/jackc/pgerrcode"
+	"github.com/lib/pq"
 	"go.uber.org/zap"
 )
 
@@ -90,32 +92,9 @@ func (st *PGStorage) GetGauge(ctx context.Context, id string) (models.Metric, er
 	return metric, nil
 }
 
-// GetGaugeList возвращает список всех метрик типа Gauge в хранилище.
-func (st *PGStorage) GetGaugeList(ctx context.Context) storage.GaugeList {
-	var gauges storage.GaugeList
-	err := withRetries(ctx, func() error {
-		rows, err := st.db.QueryContext(ctx, `SELECT id, type, value FROM metrics WHERE type = 'gauge'`)
-		if err != nil {
-			return err
-		}
-		defer rows.Close()
-
-		gauges = make(storage.GaugeList)
-		for rows.Next() {
-			var metric models.Metric
-			err := rows.Scan(&metric.ID, &metric.MType, &metric.Value)
-			if err != nil {
-				logger.Log.Error("failed to scan gauge", zap.Error(err))
-				continue
-			}
-			gauges[metric.ID] = metric
-		}
-		return rows.Err()
-	})
-	if err != nil {
-		logger.Log.Error("failed to get gauge list", zap.Error(err))
-	}
-	return gauges
+// GetGaugeList возвращает итератор по всем метрикам типа Gauge в хранилище.
+func (st *PGStorage) GetGaugeList(ctx context.Context) iter.Seq2[models.Metric, error] {
+	return st.list(ctx, `SELECT id, type, value FROM metrics WHERE type = 'gauge'`)
 }
 
 // UpdateCounter обновляет метрику типа Counter в хранилище.
@@ -146,64 +125,189 @@ func (st *PGStorage) GetCounter(ctx context.Context, id string) (models.Metric,
 	return metric, nil
 }
 
-// GetCounterList возвращает список всех метрик типа Counter в хранилище.
-func (st *PGStorage) GetCounterList(ctx context.Context) storage.CounterList {
-	var counters storage.CounterList
+// GetCounterList возвращает итератор по всем метрикам типа Counter в хранилище.
+func (st *PGStorage) GetCounterList(ctx context.Context) iter.Seq2[models.Metric, error] {
+	return st.list(ctx, `SELECT id, type, value FROM metrics WHERE type = 'counter'`)
+}
+
+// List возвращает итератор по всем метрикам хранилища. Все метрики читаются одним запросом,
+// поэтому результат соответствует одному снимку данных.
+func (st *PGStorage) List(ctx context.Context) iter.Seq2[models.Metric, error] {
+	return st.list(ctx, `SELECT id, type, value FROM metrics`)
+}
+
+// list выполняет запрос и возвращает итератор, построчно читающий метрики из результата.
+// При ошибке итератор возвращает ее последним элементом.
+func (st *PGStorage) list(ctx context.Context, query string, args ...any) iter.Seq2[models.Metric, error] {
+	return func(yield func(models.Metric, error) bool) {
+		var rows *sql.Rows
+		err := withRetries(ctx, func() error {
+			var err error
+			rows, err = st.db.QueryContext(ctx, query, args...)
+			return err
+		})
+		if err != nil {
+			yield(models.Metric{}, err)
+			return
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var metric models.Metric
+			if metric, err = scanMetric(rows); err != nil {
+				yield(models.Metric{}, err)
+				return
+			}
+			if !yield(metric, nil) {
+				return
+			}
+		}
+		if err = rows.Err(); err != nil {
+			yield(models.Metric{}, err)
+		}
+	}
+}
+
+// UpdateBatch обновляет пакет метрик в хранилище в одной транзакции: при любой ошибке пакет не применяется.
+func (st *PGStorage) UpdateBatch(ctx context.Context, metrics []models.Metric) error {
+	return withRetries(ctx, func() error {
+		tx, err := st.db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer rollback(tx)
+
+		if err = applyBatch(ctx, tx, metrics); err != nil {
+			return err
+		}
+		return tx.Commit()
+	})
+}
+
+// UpdateBatchOnce применяет пакет метрик и записывает ключ идемпотентности в одной транзакции.
+// Ключ, записанный раньше window назад, считается истекшим и перезаписывается. Параллельный запрос
+// с тем же ключом ожидает завершения транзакции, записавшей ключ, и затем считается повторным.
+func (st *PGStorage) UpdateBatchOnce(ctx context.Context, key string, window time.Duration, metrics []models.Metric) (bool, error) {
+	var applied bool
+	err := withRetries(ctx, func() error {
+		tx, err := st.db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer rollback(tx)
+
+		var result sql.Result
+		result, err = tx.ExecContext(ctx, `INSERT INTO idempotency_keys (key, applied_at) VALUES ($1, now())
+			ON CONFLICT (key) DO UPDATE SET applied_at = now()
+			WHERE idempotency_keys.applied_at < now() - make_interval(secs => $2)`, key, window.Seconds())
+		if err != nil {
+			return err
+		}
+		var inserted int64
+		if inserted, err = result.RowsAffected(); err != nil {
+			return err
+		}
+		if inserted == 0 {
+			applied = false
+			return nil
+		}
+
+		if err = applyBatch(ctx, tx, metrics); err != nil {
+			return err
+		}
+		if _, err = tx.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE applied_at < now() - make_interval(secs => $1)`, window.Seconds()); err != nil {
+			return err
+		}
+		applied = true
+		return tx.Commit()
+	})
+	if err != nil {
+		return false, err
+	}
+	return applied, nil
+}
+
+// applyBatch записывает пакет метрик в рамках транзакции tx.
+func applyBatch(ctx context.Context, tx *sql.Tx, metrics []models.Metric) error {
+	for _, metric := range metrics {
+		var err error
+		switch metric.MType {
+		case models.TypeGauge:
+			_, err = tx.ExecContext(ctx, `INSERT INTO metrics (id, type, value) VALUES ($1, 'gauge', $2)
+     ON CONFLICT (id, type) DO UPDATE SET value = $2`, metric.ID, metric.Value)
+		case models.TypeCounter:
+			_, err = tx.ExecContext(ctx, `INSERT INTO metrics (id, type, value) VALUES ($1, 'counter', $2)
+     ON CONFLICT (id, type) DO UPDATE SET value = metrics.value + excluded.value`, metric.ID, metric.Delta)
+		default:
+			err = storage.ErrWrongType
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Snapshot возвращает согласованный снимок всех метрик, прочитанный в одной транзакции с уровнем изоляции REPEATABLE READ.
+func (st *PGStorage) Snapshot(ctx context.Context) ([]models.Metric, error) {
+	var metrics []models.Metric
 	err := withRetries(ctx, func() error {
-		rows, err := st.db.QueryContext(ctx, `SELECT id, type, value FROM metrics WHERE type = 'counter'`)
+		tx, err := st.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+		if err != nil {
+			return err
+		}
+		defer rollback(tx)
+
+		rows, err := tx.QueryContext(ctx, `SELECT id, type, value FROM metrics`)
 		if err != nil {
 			return err
 		}
 		defer rows.Close()
 
-		counters = make(storage.CounterList)
+		metrics = make([]models.Metric, 0)
 		for rows.Next() {
 			var metric models.Metric
-			err := rows.Scan(&metric.ID, &metric.MType, &metric.Delta)
-			if err != nil {
-				logger.Log.Error("failed to scan counter", zap.Error(err))
-				continue
+			if metric, err = scanMetric(rows); err != nil {
+				return err
 			}
-			counters[metric.ID] = metric
+			metrics = append(metrics, metric)
 		}
-		return rows.Err()
+		if err = rows.Err(); err != nil {
+			return err
+		}
+
+		return tx.Commit()
 	})
 	if err != nil {
-		logger.Log.Error("failed to get counter list", zap.Error(err))
+		return nil, err
 	}
-	return counters
+	return metrics, nil
 }
 
-// UpdateBatch обновляет пакет метрик в хранилище.
-func (st *PGStorage) UpdateBatch(ctx context.Context, metrics []models.Metric) error {
+// Replace в одной транзакции удаляет все метрики и записывает заданные.
+func (st *PGStorage) Replace(ctx context.Context, metrics []models.Metric) error {
 	return withRetries(ctx, func() error {
 		tx, err := st.db.BeginTx(ctx, nil)
 		if err != nil {
 			return err
 		}
-		defer func(tx *sql.Tx) {
-			err = tx.Rollback()
-			if err != nil && !errors.Is(err, sql.ErrTxDone) {
-				logger.Log.Error("failed to rollback transaction", zap.Error(err))
-			}
-		}(tx)
+		defer rollback(tx)
+
+		if _, err = tx.ExecContext(ctx, `DELETE FROM metrics`); err != nil {
+			return err
+		}
 
 		for _, metric := range metrics {
 			switch metric.MType {
 			case models.TypeGauge:
-				_, err = tx.ExecContext(ctx, `INSERT INTO metrics (id, type, value) VALUES ($1, 'gauge', $2)
-     ON CONFLICT (id, type) DO UPDATE SET value = $2`, metric.ID, metric.Value)
-				if err != nil {
-					return err
-				}
+				_, err = tx.ExecContext(ctx, `INSERT INTO metrics (id, type, value) VALUES ($1, 'gauge', $2)`, metric.ID, metric.Value)
 			case models.TypeCounter:
-				_, err = tx.ExecContext(ctx, `INSERT INTO metrics (id, type, value) VALUES ($1, 'counter', $2)
-     ON CONFLICT (id, type) DO UPDATE SET value = metrics.value + excluded.value`, metric.ID, metric.Delta)
-				if err != nil {
-					return err
-				}
+				_, err = tx.ExecContext(ctx, `INSERT INTO metrics (id, type, value) VALUES ($1, 'counter', $2)`, metric.ID, metric.Delta)
 			default:
-				return storage.ErrWrongType
+				err = storage.ErrWrongType
+			}
+			if err != nil {
+				return err
 			}
 		}
 
@@ -211,6 +315,71 @@ func (st *PGStorage) UpdateBatch(ctx context.Context, metrics []models.Metric) e
 	})
 }
 
+// DeleteCounters удаляет счетчики с заданными идентификаторами одним запросом.
+func (st *PGStorage) DeleteCounters(ctx context.Context, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return withRetries(ctx, func() error {
+		_, err := st.db.ExecContext(ctx, `DELETE FROM metrics WHERE type = 'counter' AND id = ANY($1)`, pq.Array(ids))
+		return err
+	})
+}
+
+// aggregateFuncs сопоставляет функции агрегации выражениям SQL.
+var aggregateFuncs = map[storage.AggregateFunc]string{
+	storage.AggregateSum:   "COALESCE(SUM(value), 0)",
+	storage.AggregateAvg:   "AVG(value)",
+	storage.AggregateMin:   "MIN(value)",
+	storage.AggregateMax:   "MAX(value)",
+	storage.AggregateCount: "COUNT(*)",
+}
+
+// Aggregate выполняет запрос агрегации на стороне базы данных.
+// В базу передаются только запросы по шаблону имени без классов символов: они преобразуются в LIKE,
+// который сопоставляет идентификаторы так же, как Regexp. Регулярные выражения Go и POSIX-выражения
+// PostgreSQL различаются, поэтому остальные запросы отклоняются ошибкой storage.ErrNotSupported
+// и выполняются сервисом метрик.
+func (st *PGStorage) Aggregate(ctx context.Context, q storage.AggregateQuery) ([]storage.AggregateResult, error) {
+	fn, ok := aggregateFuncs[q.Func]
+	if !ok {
+		return nil, storage.ErrBadQuery
+	}
+	pattern, ok := likePattern(q.Glob)
+	if !ok || q.Grouped() {
+		return nil, storage.ErrNotSupported
+	}
+
+	query := `SELECT '', ` + fn + `, COUNT(*) FROM metrics WHERE id LIKE $1 AND ($2 = '' OR type = $2)`
+
+	var results []storage.AggregateResult
+	err := withRetries(ctx, func() error {
+		rows, err := st.db.QueryContext(ctx, query, pattern, q.MType)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		results = make([]storage.AggregateResult, 0)
+		for rows.Next() {
+			var result storage.AggregateResult
+			var value sql.NullFloat64
+			if err = rows.Scan(&result.Group, &value, &result.Count); err != nil {
+				return err
+			}
+			if value.Valid {
+				result.Value = &value.Float64
+			}
+			results = append(results, result)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
 // Save сохраняет текущее состояние хранилища в постоянное хранилище.
 // В данном случае, сохранение в PostgreSQL не требуется, так как все изменения уже сохраняются в базе данных.
 func (st *PGStorage) Save(ctx context.Context) error {
@@ -0,0 +1,93 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+)
+
+// AggregateFunc определяет функцию агрегации значений метрик.
+type AggregateFunc string
+
+const (
+	AggregateSum   AggregateFunc = "sum"   // AggregateSum сумма значений.
+	AggregateAvg   AggregateFunc = "avg"   // AggregateAvg среднее значение.
+	AggregateMin   AggregateFunc = "min"   // AggregateMin минимальное значение.
+	AggregateMax   AggregateFunc = "max"   // AggregateMax максимальное значение.
+	AggregateCount AggregateFunc = "count" // AggregateCount количество метрик.
+)
+
+// ErrBadQuery возвращается при некорректном запросе агрегации.
+var ErrBadQuery = errors.New("bad query")
+
+// AggregateQuery описывает запрос агрегации значений метрик.
+type AggregateQuery struct {
+	Regexp *regexp.Regexp // Regexp выражение, которому должен соответствовать идентификатор метрики. Если в нем есть группа, результат группируется по ее значению.
+	Glob   string         // Glob шаблон имени, из которого получено Regexp, пустой для произвольных выражений.
+	MType  string         // MType тип метрик, пустая строка означает метрики всех типов.
+	Func   AggregateFunc  // Func функция агрегации.
+}
+
+// AggregateResult содержит результат агрегации для одной группы метрик.
+type AggregateResult struct {
+	Group string   `json:"group,omitempty"` // Group значение группы, пустое для запросов без группировки.
+	Value *float64 `json:"value"`           // Value результат агрегации, nil если для функции нет значения.
+	Count int64    `json:"count"`           // Count количество метрик, попавших в группу.
+}
+
+// Aggregator интерфейс хранилища, умеющего самостоятельно выполнять запросы агрегации.
+// Запрос, который хранилище не может выполнить так же, как сравнение с Regexp, отклоняется ошибкой ErrNotSupported.
+type Aggregator interface {
+	Aggregate(ctx context.Context, q AggregateQuery) ([]AggregateResult, error) // Aggregate выполняет запрос агрегации.
+}
+
+// Grouped сообщает, группируется ли результат запроса.
+func (q AggregateQuery) Grouped() bool {
+	return q.Regexp.NumSubexp() > 0
+}
+
+// Valid проверяет, что функция агрегации известна.
+func (f AggregateFunc) Valid() bool {
+	switch f {
+	case AggregateSum, AggregateAvg, AggregateMin, AggregateMax, AggregateCount:
+		return true
+	}
+	return false
+}
+
+// GlobToRegexp преобразует шаблон имени в стиле path.Match (*, ?, [...]) в регулярное выражение,
+// соответствующее всему идентификатору. Символы * и ? соответствуют и переводу строки.
+func GlobToRegexp(pattern string) (*regexp.Regexp, error) {
+	var b strings.Builder
+	b.WriteString("(?s)^")
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		case '[':
+			end := strings.IndexByte(pattern[i:], ']')
+			if end < 0 {
+				return nil, ErrBadQuery
+			}
+			b.WriteString(pattern[i : i+end+1])
+			i += end
+		case '\\':
+			if i+1 < len(pattern) {
+				i++
+			}
+			b.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		default:
+			b.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		}
+	}
+	b.WriteString("$")
+
+	re, err := regexp.Compile(b.String())
+	if err != nil {
+		return nil, ErrBadQuery
+	}
+	return re, nil
+}
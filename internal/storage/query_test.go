@@ -0,0 +1,60 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGlobToRegexp(t *testing.T) {
+	tests := []struct {
+		pattern string
+		match   []string
+		noMatch []string
+	}{
+		{
+			pattern: "CPUutilization*",
+			match:   []string{"CPUutilization", "CPUutilization12"},
+			noMatch: []string{"xCPUutilization1", "CPU"},
+		},
+		{
+			pattern: "Heap?lloc",
+			match:   []string{"HeapAlloc"},
+			noMatch: []string{"HeapAAlloc"},
+		},
+		{
+			pattern: "node[0-2].load",
+			match:   []string{"node1.load"},
+			noMatch: []string{"node3.load", "node1xload"},
+		},
+		{
+			pattern: "line*",
+			match:   []string{"line\nbreak"},
+		},
+		{
+			pattern: "a(b)",
+			match:   []string{"a(b)"},
+			noMatch: []string{"ab"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.pattern, func(t *testing.T) {
+			re, err := GlobToRegexp(test.pattern)
+			require.NoError(t, err)
+			assert.Equal(t, 0, re.NumSubexp())
+			for _, id := range test.match {
+				assert.True(t, re.MatchString(id), id)
+			}
+			for _, id := range test.noMatch {
+				assert.False(t, re.MatchString(id), id)
+			}
+		})
+	}
+
+	t.Run("unclosed class", func(t *testing.T) {
+		_, err := GlobToRegexp("node[0-2")
+		assert.ErrorIs(t, err, ErrBadQuery)
+	})
+}
@@ -0,0 +1,57 @@
+package shardstorage
+
+import (
+	"hash/crc32"
+	"sort"
+	"strconv"
+)
+
+// defaultReplicas количество виртуальных узлов на один шард в кольце хеширования.
+const defaultReplicas = 100
+
+// ring реализует консистентное хеширование идентификаторов метрик по шардам.
+type ring struct {
+	hashes []uint32
+	shards map[uint32]int
+}
+
+// newRing создает кольцо для заданного количества шардов с указанным числом виртуальных узлов.
+func newRing(shardsCount, replicas int) *ring {
+	r := &ring{
+		hashes: make([]uint32, 0, shardsCount*replicas),
+		shards: make(map[uint32]int, shardsCount*replicas),
+	}
+
+	for shard := 0; shard < shardsCount; shard++ {
+		for replica := 0; replica < replicas; replica++ {
+			h := hashKey(strconv.Itoa(shard) + "#" + strconv.Itoa(replica))
+			if _, exists := r.shards[h]; exists {
+				continue
+			}
+			r.shards[h] = shard
+			r.hashes = append(r.hashes, h)
+		}
+	}
+	sort.Slice(r.hashes, func(i, j int) bool {
+		return r.hashes[i] < r.hashes[j]
+	})
+
+	return r
+}
+
+// get возвращает индекс шарда, отвечающего за заданный идентификатор.
+func (r *ring) get(id string) int {
+	h := hashKey(id)
+	idx := sort.Search(len(r.hashes), func(i int) bool {
+		return r.hashes[i] >= h
+	})
+	if idx == len(r.hashes) {
+		idx = 0
+	}
+	return r.shards[r.hashes[idx]]
+}
+
+// hashKey вычисляет CRC-32 хеш строки.
+func hashKey(key string) uint32 {
+	return crc32.ChecksumIEEE([]byte(key))
+}
@@ -0,0 +1,331 @@
+package shardstorage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+	"slices"
+	"sync"
+
+	"github.com/invinciblewest/metrics/internal/models"
+	"github.com/invinciblewest/metrics/internal/storage"
+)
+
+// ErrNoShards возвращается при попытке создать хранилище без шардов.
+var ErrNoShards = errors.New("no shards")
+
+// ShardStorage распределяет метрики по нескольким хранилищам с помощью консистентного хеширования идентификатора.
+type ShardStorage struct {
+	shards []storage.Storage
+	ring   *ring
+}
+
+// NewShardStorage создает новый экземпляр ShardStorage поверх заданных хранилищ-шардов.
+func NewShardStorage(shards ...storage.Storage) (*ShardStorage, error) {
+	if len(shards) == 0 {
+		return nil, ErrNoShards
+	}
+
+	return &ShardStorage{
+		shards: shards,
+		ring:   newRing(len(shards), defaultReplicas),
+	}, nil
+}
+
+// shard возвращает хранилище, отвечающее за метрику с заданным идентификатором.
+func (st *ShardStorage) shard(id string) storage.Storage {
+	return st.shards[st.ring.get(id)]
+}
+
+// UpdateGauge обновляет метрику типа Gauge в соответствующем шарде.
+func (st *ShardStorage) UpdateGauge(ctx context.Context, metric models.Metric) error {
+	return st.shard(metric.ID).UpdateGauge(ctx, metric)
+}
+
+// GetGauge извлекает метрику типа Gauge из соответствующего шарда по идентификатору.
+func (st *ShardStorage) GetGauge(ctx context.Context, id string) (models.Metric, error) {
+	return st.shard(id).GetGauge(ctx, id)
+}
+
+// GetGaugeList возвращает итератор, последовательно обходящий метрики типа Gauge всех шардов.
+func (st *ShardStorage) GetGaugeList(ctx context.Context) iter.Seq2[models.Metric, error] {
+	return st.merge(func(shard storage.Storage) iter.Seq2[models.Metric, error] {
+		return shard.GetGaugeList(ctx)
+	})
+}
+
+// UpdateCounter обновляет метрику типа Counter в соответствующем шарде.
+func (st *ShardStorage) UpdateCounter(ctx context.Context, metric models.Metric) error {
+	return st.shard(metric.ID).UpdateCounter(ctx, metric)
+}
+
+// GetCounter извлекает метрику типа Counter из соответствующего шарда по идентификатору.
+func (st *ShardStorage) GetCounter(ctx context.Context, id string) (models.Metric, error) {
+	return st.shard(id).GetCounter(ctx, id)
+}
+
+// GetCounterList возвращает итератор, последовательно обходящий метрики типа Counter всех шардов.
+func (st *ShardStorage) GetCounterList(ctx context.Context) iter.Seq2[models.Metric, error] {
+	return st.merge(func(shard storage.Storage) iter.Seq2[models.Metric, error] {
+		return shard.GetCounterList(ctx)
+	})
+}
+
+// List возвращает итератор, последовательно обходящий все метрики всех шардов.
+// Результат согласован в пределах каждого шарда, но не между шардами.
+func (st *ShardStorage) List(ctx context.Context) iter.Seq2[models.Metric, error] {
+	return st.merge(func(shard storage.Storage) iter.Seq2[models.Metric, error] {
+		return shard.List(ctx)
+	})
+}
+
+// UpdateBatch разбивает пакет метрик по шардам и обновляет их параллельно.
+// Типы метрик проверяются до записи, чтобы некорректная метрика не оставила часть шардов обновленными.
+// Если запись в один из шардов не удалась, приращения счетчиков в остальных шардах компенсируются обратными,
+// поэтому повтор пакета не учитывает их дважды. Счетчики, созданные пакетом, при этом удаляются, если шард
+// поддерживает storage.CounterDeleter, иначе остаются с нулевым значением. Значения gauge в успешных шардах остаются записанными:
+// повтор записывает те же значения. Если компенсация тоже не удалась, возвращается ошибка storage.ErrPartialWrite.
+func (st *ShardStorage) UpdateBatch(ctx context.Context, metrics []models.Metric) error {
+	for _, metric := range metrics {
+		if metric.MType != models.TypeGauge && metric.MType != models.TypeCounter {
+			return storage.ErrWrongType
+		}
+	}
+	batches := st.split(metrics)
+	// Обратные приращения вычисляются до записи: хранилище может изменить переданные ему метрики.
+	undo := make(map[int][]models.Metric, len(batches))
+	for idx, batch := range batches {
+		undo[idx] = reverseCounters(batch)
+	}
+
+	created := make([][]string, len(st.shards))
+	written := make([]bool, len(st.shards))
+	err := st.forEach(func(idx int, shard storage.Storage) error {
+		batch, ok := batches[idx]
+		if !ok {
+			return nil
+		}
+		ids, err := newCounters(ctx, shard, batch)
+		if err != nil {
+			return err
+		}
+		created[idx] = ids
+		if err = shard.UpdateBatch(ctx, batch); err != nil {
+			return err
+		}
+		written[idx] = true
+		return nil
+	})
+	if err == nil {
+		return nil
+	}
+
+	// Компенсация выполняется и после отмены контекста запроса, иначе приращения останутся записанными.
+	rollbackCtx := context.WithoutCancel(ctx)
+	rollbackErr := st.forEach(func(idx int, shard storage.Storage) error {
+		if !written[idx] {
+			return nil
+		}
+		return rollback(rollbackCtx, shard, undo[idx], created[idx])
+	})
+	if rollbackErr != nil {
+		return fmt.Errorf("%w: %w", storage.ErrPartialWrite, errors.Join(err, rollbackErr))
+	}
+	return err
+}
+
+// newCounters возвращает идентификаторы счетчиков пакета, которых еще нет в шарде.
+// Для шардов, не поддерживающих удаление, проверка не выполняется.
+func newCounters(ctx context.Context, shard storage.Storage, metrics []models.Metric) ([]string, error) {
+	if _, ok := shard.(storage.CounterDeleter); !ok {
+		return nil, nil
+	}
+	var ids []string
+	for _, metric := range metrics {
+		if metric.MType != models.TypeCounter || slices.Contains(ids, metric.ID) {
+			continue
+		}
+		_, err := shard.GetCounter(ctx, metric.ID)
+		switch {
+		case errors.Is(err, storage.ErrNotFound):
+			ids = append(ids, metric.ID)
+		case err != nil:
+			return nil, err
+		}
+	}
+	return ids, nil
+}
+
+// rollback компенсирует запись пакета в шард: созданные пакетом счетчики удаляются,
+// к остальным применяются обратные приращения.
+func rollback(ctx context.Context, shard storage.Storage, undo []models.Metric, created []string) error {
+	if len(created) > 0 {
+		// created заполняется только для шардов, поддерживающих удаление.
+		if err := shard.(storage.CounterDeleter).DeleteCounters(ctx, created); err != nil {
+			return err
+		}
+		undo = slices.DeleteFunc(undo, func(metric models.Metric) bool {
+			return slices.Contains(created, metric.ID)
+		})
+	}
+	if len(undo) == 0 {
+		return nil
+	}
+	return shard.UpdateBatch(ctx, undo)
+}
+
+// reverseCounters возвращает счетчики пакета с обратными приращениями.
+func reverseCounters(metrics []models.Metric) []models.Metric {
+	var reversed []models.Metric
+	for _, metric := range metrics {
+		if metric.MType != models.TypeCounter || metric.Delta == nil {
+			continue
+		}
+		delta := -*metric.Delta
+		reversed = append(reversed, models.Metric{ID: metric.ID, MType: models.TypeCounter, Delta: &delta})
+	}
+	return reversed
+}
+
+// Snapshot возвращает объединенный снимок метрик всех шардов.
+// Снимок согласован в пределах каждого шарда, но не между шардами.
+func (st *ShardStorage) Snapshot(ctx context.Context) ([]models.Metric, error) {
+	snapshots := make([][]models.Metric, len(st.shards))
+	err := st.forEach(func(idx int, shard storage.Storage) error {
+		snapshotter, ok := shard.(storage.Snapshotter)
+		if !ok {
+			return storage.ErrNotSupported
+		}
+		metrics, err := snapshotter.Snapshot(ctx)
+		snapshots[idx] = metrics
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	metrics := make([]models.Metric, 0)
+	for _, snapshot := range snapshots {
+		metrics = append(metrics, snapshot...)
+	}
+	return metrics, nil
+}
+
+// Replace распределяет метрики по шардам и заменяет ими состояние каждого шарда.
+// Перед заменой запоминаются снимки шардов, и если замена одного из шардов не удалась, уже замененные шарды
+// восстанавливаются из снимков; метрики, записанные в них во время замены, при этом теряются.
+// Если восстановление тоже не удалось, возвращается ошибка storage.ErrPartialWrite.
+func (st *ShardStorage) Replace(ctx context.Context, metrics []models.Metric) error {
+	snapshotters := make([]storage.Snapshotter, len(st.shards))
+	for idx, shard := range st.shards {
+		snapshotter, ok := shard.(storage.Snapshotter)
+		if !ok {
+			return storage.ErrNotSupported
+		}
+		snapshotters[idx] = snapshotter
+	}
+
+	previous := make([][]models.Metric, len(st.shards))
+	err := st.forEach(func(idx int, _ storage.Storage) error {
+		snapshot, snapshotErr := snapshotters[idx].Snapshot(ctx)
+		previous[idx] = snapshot
+		return snapshotErr
+	})
+	if err != nil {
+		return err
+	}
+
+	batches := st.split(metrics)
+	replaced := make([]bool, len(st.shards))
+	err = st.forEach(func(idx int, _ storage.Storage) error {
+		if replaceErr := snapshotters[idx].Replace(ctx, batches[idx]); replaceErr != nil {
+			return replaceErr
+		}
+		replaced[idx] = true
+		return nil
+	})
+	if err == nil {
+		return nil
+	}
+
+	rollbackCtx := context.WithoutCancel(ctx)
+	rollbackErr := st.forEach(func(idx int, _ storage.Storage) error {
+		if !replaced[idx] {
+			return nil
+		}
+		return snapshotters[idx].Replace(rollbackCtx, previous[idx])
+	})
+	if rollbackErr != nil {
+		return fmt.Errorf("%w: %w", storage.ErrPartialWrite, errors.Join(err, rollbackErr))
+	}
+	return err
+}
+
+// Save сохраняет состояние всех шардов.
+func (st *ShardStorage) Save(ctx context.Context) error {
+	return st.forEach(func(_ int, shard storage.Storage) error {
+		return shard.Save(ctx)
+	})
+}
+
+// Load загружает состояние всех шардов.
+func (st *ShardStorage) Load(ctx context.Context) error {
+	return st.forEach(func(_ int, shard storage.Storage) error {
+		return shard.Load(ctx)
+	})
+}
+
+// Ping проверяет доступность всех шардов.
+func (st *ShardStorage) Ping(ctx context.Context) error {
+	return st.forEach(func(_ int, shard storage.Storage) error {
+		return shard.Ping(ctx)
+	})
+}
+
+// Close закрывает все шарды.
+func (st *ShardStorage) Close(ctx context.Context) error {
+	return st.forEach(func(_ int, shard storage.Storage) error {
+		return shard.Close(ctx)
+	})
+}
+
+// merge объединяет итераторы всех шардов в один. Итерация прекращается на первой ошибке.
+func (st *ShardStorage) merge(fn func(shard storage.Storage) iter.Seq2[models.Metric, error]) iter.Seq2[models.Metric, error] {
+	return func(yield func(models.Metric, error) bool) {
+		for _, shard := range st.shards {
+			for metric, err := range fn(shard) {
+				if !yield(metric, err) || err != nil {
+					return
+				}
+			}
+		}
+	}
+}
+
+// split распределяет метрики по индексам шардов.
+func (st *ShardStorage) split(metrics []models.Metric) map[int][]models.Metric {
+	batches := make(map[int][]models.Metric)
+	for _, metric := range metrics {
+		idx := st.ring.get(metric.ID)
+		batches[idx] = append(batches[idx], metric)
+	}
+	return batches
+}
+
+// forEach параллельно выполняет функцию для каждого шарда и объединяет возникшие ошибки.
+func (st *ShardStorage) forEach(fn func(idx int, shard storage.Storage) error) error {
+	errs := make([]error, len(st.shards))
+
+	var wg sync.WaitGroup
+	for idx, shard := range st.shards {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[idx] = fn(idx, shard)
+		}()
+	}
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,274 @@
+package shardstorage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+	"testing"
+
+	"github.com/invinciblewest/metrics/internal/models"
+	"github.com/invinciblewest/metrics/internal/storage"
+	"github.com/invinciblewest/metrics/internal/storage/memstorage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewShardStorage(t *testing.T) {
+	t.Run("no shards", func(t *testing.T) {
+		_, err := NewShardStorage()
+		assert.ErrorIs(t, err, ErrNoShards)
+	})
+	t.Run("success", func(t *testing.T) {
+		st, err := NewShardStorage(memstorage.NewMemStorage("", false))
+		require.NoError(t, err)
+		assert.Implements(t, (*storage.Storage)(nil), st)
+	})
+}
+
+func TestRing_Get(t *testing.T) {
+	r := newRing(4, defaultReplicas)
+	used := make(map[int]bool)
+	for i := 0; i < 1000; i++ {
+		id := fmt.Sprintf("metric%d", i)
+		shard := r.get(id)
+		assert.Equal(t, shard, r.get(id))
+		used[shard] = true
+	}
+	assert.Len(t, used, 4)
+}
+
+func TestShardStorage_Gauge(t *testing.T) {
+	ctx := context.TODO()
+	shards := newShards(3)
+	st, err := NewShardStorage(shards...)
+	require.NoError(t, err)
+
+	for i := 0; i < 30; i++ {
+		value := float64(i)
+		err = st.UpdateGauge(ctx, models.Metric{
+			ID:    fmt.Sprintf("gauge%d", i),
+			MType: models.TypeGauge,
+			Value: &value,
+		})
+		require.NoError(t, err)
+	}
+
+	metric, err := st.GetGauge(ctx, "gauge7")
+	require.NoError(t, err)
+	assert.Equal(t, 7.0, *metric.Value)
+
+	_, err = st.GetGauge(ctx, "unknown")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+
+	assertLen(t, st.GetGaugeList(ctx), 30)
+
+	total := 0
+	for _, shard := range shards {
+		gauges, err := storage.Collect(shard.GetGaugeList(ctx))
+		require.NoError(t, err)
+		assert.NotEmpty(t, gauges)
+		total += len(gauges)
+	}
+	assert.Equal(t, 30, total)
+}
+
+func TestShardStorage_Counter(t *testing.T) {
+	ctx := context.TODO()
+	st, err := NewShardStorage(newShards(2)...)
+	require.NoError(t, err)
+
+	for i := 0; i < 2; i++ {
+		delta := int64(5)
+		err = st.UpdateCounter(ctx, models.Metric{
+			ID:    "counter",
+			MType: models.TypeCounter,
+			Delta: &delta,
+		})
+		require.NoError(t, err)
+	}
+
+	metric, err := st.GetCounter(ctx, "counter")
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), *metric.Delta)
+	assertLen(t, st.GetCounterList(ctx), 1)
+}
+
+func TestShardStorage_UpdateBatch(t *testing.T) {
+	ctx := context.TODO()
+
+	t.Run("success", func(t *testing.T) {
+		st, err := NewShardStorage(newShards(4)...)
+		require.NoError(t, err)
+
+		metrics := make([]models.Metric, 0, 40)
+		for i := 0; i < 20; i++ {
+			value := float64(i)
+			delta := int64(i)
+			metrics = append(metrics,
+				models.Metric{ID: fmt.Sprintf("gauge%d", i), MType: models.TypeGauge, Value: &value},
+				models.Metric{ID: fmt.Sprintf("counter%d", i), MType: models.TypeCounter, Delta: &delta},
+			)
+		}
+
+		require.NoError(t, st.UpdateBatch(ctx, metrics))
+		assertLen(t, st.GetGaugeList(ctx), 20)
+		assertLen(t, st.GetCounterList(ctx), 20)
+		assertLen(t, st.List(ctx), 40)
+	})
+	t.Run("wrong type", func(t *testing.T) {
+		st, err := NewShardStorage(newShards(2)...)
+		require.NoError(t, err)
+
+		err = st.UpdateBatch(ctx, []models.Metric{
+			{ID: "test", MType: "unknown", Value: new(float64)},
+		})
+		assert.ErrorIs(t, err, storage.ErrWrongType)
+	})
+}
+
+func TestShardStorage_UpdateBatchRollback(t *testing.T) {
+	ctx := context.TODO()
+	failure := errors.New("shard unavailable")
+
+	metrics := func() []models.Metric {
+		metrics := make([]models.Metric, 0, 20)
+		for i := 0; i < 20; i++ {
+			delta := int64(5)
+			metrics = append(metrics, models.Metric{ID: fmt.Sprintf("counter%d", i), MType: models.TypeCounter, Delta: &delta})
+		}
+		return metrics
+	}
+	total := func(st *ShardStorage) int64 {
+		var sum int64
+		for metric, err := range st.GetCounterList(ctx) {
+			require.NoError(t, err)
+			sum += *metric.Delta
+		}
+		return sum
+	}
+
+	t.Run("counters compensated", func(t *testing.T) {
+		healthy := memstorage.NewMemStorage("", false)
+		st, err := NewShardStorage(healthy, &failingStorage{Storage: memstorage.NewMemStorage("", false), err: failure})
+		require.NoError(t, err)
+
+		err = st.UpdateBatch(ctx, metrics())
+		assert.ErrorIs(t, err, failure)
+		assert.NotErrorIs(t, err, storage.ErrPartialWrite)
+		// Счетчики, созданные пакетом, удалены, а не оставлены с нулевым значением.
+		counters, err := storage.Collect(st.GetCounterList(ctx))
+		require.NoError(t, err)
+		assert.Empty(t, counters)
+	})
+	t.Run("existing counters restored", func(t *testing.T) {
+		healthy := memstorage.NewMemStorage("", false)
+		broken := &failingStorage{Storage: memstorage.NewMemStorage("", false), err: failure, after: 1}
+		st, err := NewShardStorage(healthy, broken)
+		require.NoError(t, err)
+		require.NoError(t, st.UpdateBatch(ctx, metrics()))
+
+		err = st.UpdateBatch(ctx, metrics())
+		assert.ErrorIs(t, err, failure)
+		counters, err := storage.Collect(st.GetCounterList(ctx))
+		require.NoError(t, err)
+		assert.Len(t, counters, 20)
+		assert.Equal(t, int64(100), total(st))
+	})
+	t.Run("counters zeroed without deleter", func(t *testing.T) {
+		healthy := &failingStorage{Storage: memstorage.NewMemStorage("", false), err: failure, after: 2}
+		st, err := NewShardStorage(healthy, &failingStorage{Storage: memstorage.NewMemStorage("", false), err: failure})
+		require.NoError(t, err)
+
+		err = st.UpdateBatch(ctx, metrics())
+		assert.ErrorIs(t, err, failure)
+		assert.NotErrorIs(t, err, storage.ErrPartialWrite)
+		assert.Equal(t, int64(0), total(st))
+	})
+	t.Run("compensation failed", func(t *testing.T) {
+		healthy := &failingStorage{Storage: memstorage.NewMemStorage("", false), err: failure, after: 1}
+		st, err := NewShardStorage(healthy, &failingStorage{Storage: memstorage.NewMemStorage("", false), err: failure})
+		require.NoError(t, err)
+
+		err = st.UpdateBatch(ctx, metrics())
+		assert.ErrorIs(t, err, storage.ErrPartialWrite)
+		assert.ErrorIs(t, err, failure)
+	})
+}
+
+// failingStorage хранилище, запись пакетов в которое завершается ошибкой после after успешных записей.
+type failingStorage struct {
+	storage.Storage
+	err   error
+	after int
+}
+
+func (st *failingStorage) UpdateBatch(ctx context.Context, metrics []models.Metric) error {
+	if st.after == 0 {
+		return st.err
+	}
+	st.after--
+	return st.Storage.UpdateBatch(ctx, metrics)
+}
+
+func TestShardStorage_Ping(t *testing.T) {
+	ctx := context.TODO()
+	st, err := NewShardStorage(newShards(2)...)
+	require.NoError(t, err)
+
+	assert.NoError(t, st.Ping(ctx))
+	assert.NoError(t, st.Save(ctx))
+	assert.NoError(t, st.Load(ctx))
+	assert.NoError(t, st.Close(ctx))
+}
+
+func assertLen(t *testing.T, seq iter.Seq2[models.Metric, error], expected int) {
+	metrics, err := storage.Collect(seq)
+	require.NoError(t, err)
+	assert.Len(t, metrics, expected)
+}
+
+func newShards(n int) []storage.Storage {
+	shards := make([]storage.Storage, 0, n)
+	for i := 0; i < n; i++ {
+		shards = append(shards, memstorage.NewMemStorage("", false))
+	}
+	return shards
+}
+
+// failingReplacer хранилище, замена метрик в котором завершается ошибкой.
+type failingReplacer struct {
+	*memstorage.MemStorage
+	err error
+}
+
+func (st *failingReplacer) Replace(context.Context, []models.Metric) error {
+	return st.err
+}
+
+func TestShardStorage_ReplaceRollback(t *testing.T) {
+	ctx := context.TODO()
+	failure := errors.New("shard is unavailable")
+	shards := []storage.Storage{memstorage.NewMemStorage("", false), &failingReplacer{MemStorage: memstorage.NewMemStorage("", false), err: failure}}
+	st, err := NewShardStorage(shards...)
+	require.NoError(t, err)
+
+	var before []models.Metric
+	for i := range 20 {
+		value := float64(i)
+		before = append(before, models.Metric{ID: fmt.Sprintf("metric%d", i), MType: models.TypeGauge, Value: &value})
+	}
+	require.NoError(t, st.UpdateBatch(ctx, before))
+
+	replacement := make([]models.Metric, 0, len(before))
+	for _, metric := range before {
+		value := *metric.Value + 100
+		replacement = append(replacement, models.Metric{ID: metric.ID, MType: models.TypeGauge, Value: &value})
+	}
+	assert.ErrorIs(t, st.Replace(ctx, replacement), failure)
+
+	// Шард, замена в котором прошла, восстановлен из снимка: состояние не смешано.
+	snapshot, err := st.Snapshot(ctx)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, before, snapshot)
+}
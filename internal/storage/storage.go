@@ -3,6 +3,8 @@ package storage
 import (
 	"context"
 	"errors"
+	"iter"
+	"time"
 
 	"github.com/invinciblewest/metrics/internal/models"
 )
@@ -11,21 +13,58 @@ type GaugeList map[string]models.Metric   // GaugeList содержит метр
 type CounterList map[string]models.Metric // CounterList содержит метрики типа Counter, где ключ - это идентификатор метрики, а значение - сама метрика.
 
 var (
-	ErrNotFound  = errors.New("not found")
-	ErrWrongType = errors.New("wrong type")
+	ErrNotFound     = errors.New("not found")
+	ErrWrongType    = errors.New("wrong type")
+	ErrNotSupported = errors.New("not supported")
+	ErrPartialWrite = errors.New("batch partially written")
 )
 
 // Storage интерфейс для работы с хранилищем метрик.
 type Storage interface {
-	UpdateGauge(ctx context.Context, metric models.Metric) error      // UpdateGauge обновляет метрику типа Gauge в хранилище.
-	GetGauge(ctx context.Context, id string) (models.Metric, error)   // GetGauge извлекает метрику типа Gauge из хранилища по идентификатору.
-	GetGaugeList(ctx context.Context) GaugeList                       // GetGaugeList возвращает список всех метрик типа Gauge в хранилище.
-	UpdateCounter(ctx context.Context, metric models.Metric) error    // UpdateCounter обновляет метрику типа Counter в хранилище.
-	GetCounter(ctx context.Context, id string) (models.Metric, error) // GetCounter извлекает метрику типа Counter из хранилища по идентификатору.
-	GetCounterList(ctx context.Context) CounterList                   // GetCounterList возвращает список всех метрик типа Counter в хранилище.
-	UpdateBatch(ctx context.Context, metrics []models.Metric) error   // UpdateBatch обновляет пакет метрик в хранилище.
-	Save(ctx context.Context) error                                   // Save сохраняет текущее состояние хранилища в постоянное хранилище (например, файл или базу данных).
-	Load(ctx context.Context) error                                   // Load загружает состояние хранилища из постоянного хранилища (например, файла или базы данных).
-	Ping(ctx context.Context) error                                   // Ping проверяет доступность хранилища.
-	Close(ctx context.Context) error                                  // Close закрывает соединение с хранилищем и освобождает ресурсы.
+	UpdateGauge(ctx context.Context, metric models.Metric) error        // UpdateGauge обновляет метрику типа Gauge в хранилище.
+	GetGauge(ctx context.Context, id string) (models.Metric, error)     // GetGauge извлекает метрику типа Gauge из хранилища по идентификатору.
+	GetGaugeList(ctx context.Context) iter.Seq2[models.Metric, error]   // GetGaugeList возвращает итератор по всем метрикам типа Gauge в хранилище.
+	UpdateCounter(ctx context.Context, metric models.Metric) error      // UpdateCounter обновляет метрику типа Counter в хранилище.
+	GetCounter(ctx context.Context, id string) (models.Metric, error)   // GetCounter извлекает метрику типа Counter из хранилища по идентификатору.
+	GetCounterList(ctx context.Context) iter.Seq2[models.Metric, error] // GetCounterList возвращает итератор по всем метрикам типа Counter в хранилище.
+	List(ctx context.Context) iter.Seq2[models.Metric, error]           // List возвращает итератор по всем метрикам хранилища, полученным из одного снимка.
+	UpdateBatch(ctx context.Context, metrics []models.Metric) error     // UpdateBatch обновляет пакет метрик в хранилище.
+	Save(ctx context.Context) error                                     // Save сохраняет текущее состояние хранилища в постоянное хранилище (например, файл или базу данных).
+	Load(ctx context.Context) error                                     // Load загружает состояние хранилища из постоянного хранилища (например, файла или базы данных).
+	Ping(ctx context.Context) error                                     // Ping проверяет доступность хранилища.
+	Close(ctx context.Context) error                                    // Close закрывает соединение с хранилищем и освобождает ресурсы.
+}
+
+// Snapshotter интерфейс хранилища, поддерживающего согласованные снимки состояния.
+type Snapshotter interface {
+	// Snapshot возвращает согласованный снимок всех метрик хранилища.
+	Snapshot(ctx context.Context) ([]models.Metric, error)
+	// Replace заменяет все метрики хранилища заданными. Если замена не удалась, прежнее состояние сохраняется,
+	// а если его не удалось восстановить, возвращается ошибка ErrPartialWrite.
+	Replace(ctx context.Context, metrics []models.Metric) error
+}
+
+// CounterDeleter интерфейс хранилища, умеющего удалять счетчики.
+type CounterDeleter interface {
+	// DeleteCounters удаляет счетчики с заданными идентификаторами. Отсутствующие счетчики пропускаются.
+	DeleteCounters(ctx context.Context, ids []string) error
+}
+
+// Deduplicator интерфейс хранилища, умеющего применять пакет метрик не более одного раза для ключа идемпотентности.
+type Deduplicator interface {
+	// UpdateBatchOnce применяет пакет и запоминает ключ атомарно с записью метрик. Если пакет с тем же ключом
+	// уже применен не раньше window назад, метрики не записываются и возвращается false.
+	UpdateBatchOnce(ctx context.Context, key string, window time.Duration, metrics []models.Metric) (bool, error)
+}
+
+// Collect собирает метрики из итератора в срез. При первой ошибке итерация прекращается и ошибка возвращается.
+func Collect(seq iter.Seq2[models.Metric, error]) ([]models.Metric, error) {
+	metrics := make([]models.Metric, 0)
+	for metric, err := range seq {
+		if err != nil {
+			return nil, err
+		}
+		metrics = append(metrics, metric)
+	}
+	return metrics, nil
 }
@@ -0,0 +1,150 @@
+package tokens
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// FileStore хранит токены в JSON-файле. Файл перечитывается при изменении времени модификации,
+// поэтому токены, выданные или отозванные утилитой администрирования, применяются без перезапуска сервера.
+type FileStore struct {
+	mu      sync.Mutex
+	path    string
+	modTime time.Time
+	size    int64
+	tokens  []Token
+}
+
+// NewFileStore создает хранилище токенов в файле path. Отсутствующий файл считается пустым набором токенов.
+func NewFileStore(path string) (*FileStore, error) {
+	s := &FileStore{path: path}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Lookup ищет токен по хешу секрета.
+func (s *FileStore) Lookup(_ context.Context, hash string) (Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.load(); err != nil {
+		return Token{}, err
+	}
+	for _, token := range s.tokens {
+		if token.Hash == hash {
+			return token, nil
+		}
+	}
+	return Token{}, ErrNotFound
+}
+
+// Add сохраняет новый токен в файл.
+func (s *FileStore) Add(_ context.Context, token Token) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.load(); err != nil {
+		return err
+	}
+	return s.save(append(s.tokens, token))
+}
+
+// Revoke удаляет токен из файла.
+func (s *FileStore) Revoke(_ context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.load(); err != nil {
+		return err
+	}
+
+	tokens := make([]Token, 0, len(s.tokens))
+	for _, token := range s.tokens {
+		if token.ID != id {
+			tokens = append(tokens, token)
+		}
+	}
+	if len(tokens) == len(s.tokens) {
+		return ErrNotFound
+	}
+	return s.save(tokens)
+}
+
+// List возвращает все токены из файла.
+func (s *FileStore) List(_ context.Context) ([]Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return append([]Token(nil), s.tokens...), nil
+}
+
+// Close ничего не делает: файл открывается только на время чтения и записи.
+func (s *FileStore) Close() error {
+	return nil
+}
+
+// load перечитывает файл, если его время модификации или размер изменились с момента последнего чтения.
+func (s *FileStore) load() error {
+	info, err := os.Stat(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		s.tokens, s.modTime, s.size = nil, time.Time{}, 0
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if s.tokens != nil && info.ModTime().Equal(s.modTime) && info.Size() == s.size {
+		return nil
+	}
+
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return err
+	}
+	tokens := make([]Token, 0)
+	if err = json.Unmarshal(data, &tokens); err != nil {
+		return err
+	}
+	s.tokens, s.modTime, s.size = tokens, info.ModTime(), info.Size()
+	return nil
+}
+
+// save атомарно записывает токены во временный файл и переименовывает его.
+func (s *FileStore) save(tokens []Token) error {
+	data, err := json.MarshalIndent(tokens, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp.Name(), s.path); err != nil {
+		return err
+	}
+
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return err
+	}
+	s.tokens, s.modTime, s.size = tokens, info.ModTime(), info.Size()
+	return nil
+}
@@ -0,0 +1,105 @@
+package tokens
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+)
+
+// PGStore хранит токены в таблице agent_tokens базы данных PostgreSQL.
+type PGStore struct {
+	db *sql.DB
+}
+
+// NewPGStore создает хранилище токенов в базе данных и при необходимости создает таблицу agent_tokens.
+func NewPGStore(db *sql.DB) (*PGStore, error) {
+	_, err := db.Exec(`
+	CREATE TABLE IF NOT EXISTS agent_tokens (
+		id TEXT PRIMARY KEY,
+		agent TEXT NOT NULL,
+		hash TEXT NOT NULL UNIQUE,
+		prefixes TEXT NOT NULL DEFAULT '[]',
+		can_read BOOLEAN NOT NULL DEFAULT FALSE,
+		created_at TIMESTAMPTZ NOT NULL
+	);
+	`)
+	if err != nil {
+		return nil, err
+	}
+	return &PGStore{db: db}, nil
+}
+
+// Lookup ищет токен по хешу секрета.
+func (s *PGStore) Lookup(ctx context.Context, hash string) (Token, error) {
+	row := s.db.QueryRowContext(ctx, `SELECT id, agent, hash, prefixes, can_read, created_at FROM agent_tokens WHERE hash = $1`, hash)
+	token, err := scanToken(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Token{}, ErrNotFound
+	}
+	return token, err
+}
+
+// Add сохраняет новый токен.
+func (s *PGStore) Add(ctx context.Context, token Token) error {
+	prefixes, err := json.Marshal(token.Prefixes)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, `INSERT INTO agent_tokens (id, agent, hash, prefixes, can_read, created_at) VALUES ($1, $2, $3, $4, $5, $6)`,
+		token.ID, token.Agent, token.Hash, string(prefixes), token.Read, token.CreatedAt)
+	return err
+}
+
+// Revoke удаляет токен по идентификатору.
+func (s *PGStore) Revoke(ctx context.Context, id string) error {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM agent_tokens WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// List возвращает все токены, упорядоченные по времени выдачи.
+func (s *PGStore) List(ctx context.Context) ([]Token, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT id, agent, hash, prefixes, can_read, created_at FROM agent_tokens ORDER BY created_at`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := make([]Token, 0)
+	for rows.Next() {
+		var token Token
+		if token, err = scanToken(rows); err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens, rows.Err()
+}
+
+// scanToken считывает токен из строки результата запроса.
+func scanToken(row interface{ Scan(dest ...any) error }) (Token, error) {
+	var token Token
+	var prefixes string
+	if err := row.Scan(&token.ID, &token.Agent, &token.Hash, &prefixes, &token.Read, &token.CreatedAt); err != nil {
+		return Token{}, err
+	}
+	if err := json.Unmarshal([]byte(prefixes), &token.Prefixes); err != nil {
+		return Token{}, err
+	}
+	return token, nil
+}
+
+// Close закрывает соединение с базой данных.
+func (s *PGStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,152 @@
+// Package tokens реализует токены доступа агентов. Каждый агент получает собственный токен,
+// область действия которого ограничивает префиксы имен записываемых метрик и право чтения.
+// На сервере хранится только хеш SHA-256 токена.
+package tokens
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/invinciblewest/metrics/internal/models"
+)
+
+var (
+	ErrInvalidToken = errors.New("invalid token")
+	ErrNotFound     = errors.New("token not found")
+	ErrForbidden    = errors.New("token scope does not allow the operation")
+)
+
+// Token описывает выданный агенту токен доступа.
+type Token struct {
+	ID        string    `json:"id"`                 // ID идентификатор токена, используемый для отзыва.
+	Agent     string    `json:"agent"`              // Agent имя агента, которому выдан токен.
+	Hash      string    `json:"hash"`               // Hash хеш SHA-256 секрета токена в шестнадцатеричном виде.
+	Prefixes  []string  `json:"prefixes,omitempty"` // Prefixes префиксы имен метрик, доступных для записи. Пустой список разрешает любые имена.
+	Read      bool      `json:"read"`               // Read разрешает чтение метрик.
+	CreatedAt time.Time `json:"created_at"`         // CreatedAt время выдачи токена.
+}
+
+// Store хранилище токенов.
+type Store interface {
+	Lookup(ctx context.Context, hash string) (Token, error) // Lookup ищет токен по хешу секрета.
+	Add(ctx context.Context, token Token) error             // Add сохраняет новый токен.
+	Revoke(ctx context.Context, id string) error            // Revoke удаляет токен по идентификатору.
+	List(ctx context.Context) ([]Token, error)              // List возвращает все токены.
+	Close() error                                           // Close освобождает ресурсы хранилища.
+}
+
+// Open открывает хранилище токенов по строке: DSN PostgreSQL (postgres://...) или путь к JSON-файлу.
+// Для PostgreSQL драйвер postgres должен быть зарегистрирован вызывающим пакетом.
+func Open(spec string) (Store, error) {
+	if strings.HasPrefix(spec, "postgres://") || strings.HasPrefix(spec, "postgresql://") {
+		db, err := sql.Open("postgres", spec)
+		if err != nil {
+			return nil, err
+		}
+		store, err := NewPGStore(db)
+		if err != nil {
+			db.Close()
+			return nil, err
+		}
+		return store, nil
+	}
+	return NewFileStore(strings.TrimPrefix(spec, "file:"))
+}
+
+// CanWrite сообщает, разрешена ли токену запись метрики с заданным именем.
+func (t Token) CanWrite(id string) bool {
+	if len(t.Prefixes) == 0 {
+		return true
+	}
+	for _, prefix := range t.Prefixes {
+		if strings.HasPrefix(id, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Hash возвращает хеш SHA-256 секрета токена в шестнадцатеричном виде.
+func Hash(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// Issue выпускает токен для агента, сохраняет его в store и возвращает секрет, который больше нигде не хранится.
+func Issue(ctx context.Context, store Store, agent string, prefixes []string, read bool) (string, Token, error) {
+	if agent == "" {
+		return "", Token{}, errors.New("agent name is required")
+	}
+
+	id := make([]byte, 8)
+	secret := make([]byte, 32)
+	if _, err := rand.Read(id); err != nil {
+		return "", Token{}, err
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return "", Token{}, err
+	}
+
+	token := Token{
+		ID:        hex.EncodeToString(id),
+		Agent:     agent,
+		Prefixes:  prefixes,
+		Read:      read,
+		CreatedAt: time.Now().UTC(),
+	}
+	value := "mt_" + token.ID + "_" + base64.RawURLEncoding.EncodeToString(secret)
+	token.Hash = Hash(value)
+
+	if err := store.Add(ctx, token); err != nil {
+		return "", Token{}, err
+	}
+	return value, token, nil
+}
+
+// Authenticate ищет токен по секрету, переданному агентом.
+func Authenticate(ctx context.Context, store Store, secret string) (Token, error) {
+	if secret == "" {
+		return Token{}, ErrInvalidToken
+	}
+	token, err := store.Lookup(ctx, Hash(secret))
+	if errors.Is(err, ErrNotFound) {
+		return Token{}, ErrInvalidToken
+	}
+	return token, err
+}
+
+type contextKey struct{}
+
+// WithToken возвращает контекст с токеном, которым аутентифицирован запрос.
+func WithToken(ctx context.Context, token Token) context.Context {
+	return context.WithValue(ctx, contextKey{}, token)
+}
+
+// FromContext возвращает токен запроса, если запрос аутентифицирован токеном.
+func FromContext(ctx context.Context) (Token, bool) {
+	token, ok := ctx.Value(contextKey{}).(Token)
+	return token, ok
+}
+
+// CheckWrite проверяет, что токен запроса разрешает запись всех метрик.
+// Запросы без токена не ограничиваются: аутентификация выполняется раньше, на уровне транспорта.
+func CheckWrite(ctx context.Context, metrics ...models.Metric) error {
+	token, ok := FromContext(ctx)
+	if !ok {
+		return nil
+	}
+	for _, metric := range metrics {
+		if !token.CanWrite(metric.ID) {
+			return fmt.Errorf("%w: agent %q may not write %q", ErrForbidden, token.Agent, metric.ID)
+		}
+	}
+	return nil
+}
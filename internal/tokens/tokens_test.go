@@ -0,0 +1,95 @@
+package tokens
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/invinciblewest/metrics/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestToken_CanWrite(t *testing.T) {
+	tests := []struct {
+		name     string
+		prefixes []string
+		id       string
+		expected bool
+	}{
+		{name: "any name", id: "Alloc", expected: true},
+		{name: "matching prefix", prefixes: []string{"host1.", "Heap"}, id: "HeapAlloc", expected: true},
+		{name: "other prefix", prefixes: []string{"host1."}, id: "host2.cpu", expected: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, Token{Prefixes: test.prefixes}.CanWrite(test.id))
+		})
+	}
+}
+
+func TestIssueAuthenticate(t *testing.T) {
+	ctx := context.TODO()
+	store, err := NewFileStore(filepath.Join(t.TempDir(), "tokens.json"))
+	require.NoError(t, err)
+
+	secret, token, err := Issue(ctx, store, "host1", []string{"host1."}, false)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(secret, "mt_"+token.ID+"_"))
+	assert.NotContains(t, token.Hash, secret)
+
+	found, err := Authenticate(ctx, store, secret)
+	require.NoError(t, err)
+	assert.Equal(t, "host1", found.Agent)
+	assert.Equal(t, []string{"host1."}, found.Prefixes)
+
+	_, err = Authenticate(ctx, store, secret+"x")
+	assert.ErrorIs(t, err, ErrInvalidToken)
+	_, err = Authenticate(ctx, store, "")
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	_, _, err = Issue(ctx, store, "", nil, false)
+	assert.Error(t, err)
+}
+
+func TestFileStore(t *testing.T) {
+	ctx := context.TODO()
+	path := filepath.Join(t.TempDir(), "tokens.json")
+
+	server, err := NewFileStore(path)
+	require.NoError(t, err)
+	list, err := server.List(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, list)
+
+	cli, err := NewFileStore(path)
+	require.NoError(t, err)
+	secret, token, err := Issue(ctx, cli, "host1", nil, true)
+	require.NoError(t, err)
+
+	found, err := Authenticate(ctx, server, secret)
+	require.NoError(t, err)
+	assert.Equal(t, token.ID, found.ID)
+
+	require.NoError(t, cli.Revoke(ctx, token.ID))
+	assert.ErrorIs(t, cli.Revoke(ctx, token.ID), ErrNotFound)
+	_, err = Authenticate(ctx, server, secret)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	require.NoError(t, os.WriteFile(path, []byte("not json"), 0600))
+	_, err = server.List(ctx)
+	assert.Error(t, err)
+}
+
+func TestCheckWrite(t *testing.T) {
+	metrics := []models.Metric{{ID: "host1.cpu"}, {ID: "host2.cpu"}}
+
+	assert.NoError(t, CheckWrite(context.TODO(), metrics...))
+
+	ctx := WithToken(context.TODO(), Token{Agent: "host1", Prefixes: []string{"host1."}})
+	assert.NoError(t, CheckWrite(ctx, metrics[0]))
+	assert.ErrorIs(t, CheckWrite(ctx, metrics...), ErrForbidden)
+}
@@ -1,12 +1,16 @@
 package encryption
 
 import (
+	"bytes"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
 	"crypto/rand"
 	"crypto/rsa"
-	"crypto/x509"
-	"encoding/pem"
+	"crypto/sha256"
+	"encoding/binary"
 	"errors"
-	"os"
 )
 
 var (
@@ -14,48 +18,45 @@ var (
 	ErrPrivateKeyDecoding = errors.New("не удалось декодировать приватный ключ")
 	ErrNoPublicKey        = errors.New("публичный ключ не задан")
 	ErrNoPrivateKey       = errors.New("приватный ключ не задан")
+	ErrInvalidMessage     = errors.New("некорректное зашифрованное сообщение")
 )
 
+// magic сигнатура сообщения в формате гибридного шифрования.
+var magic = []byte("MENC")
+
+const (
+	versionHybrid byte = 1 // versionHybrid версия формата: ключ AES-256-GCM, зашифрованный RSA-OAEP с SHA-256.
+	versionECIES  byte = 2 // versionECIES версия формата: ключ AES-256-GCM, выработанный ECDH P-256 с эфемерным ключом.
+)
+
+// Cryptor шифрует и расшифровывает сообщения ключами RSA или ECDSA P-256.
 type Cryptor struct {
-	privateKey *rsa.PrivateKey
-	publicKey  *rsa.PublicKey
+	privateKey crypto.PrivateKey
+	publicKey  crypto.PublicKey
 }
 
+// NewCryptor загружает публичный и приватный ключи из PEM-файлов, тип ключей определяется автоматически.
+// Если задан только приватный ключ, публичный ключ вычисляется из него.
 func NewCryptor(publicKeyPath, privateKeyPath string) (*Cryptor, error) {
-	var publicKey *rsa.PublicKey
-	var privateKey *rsa.PrivateKey
+	var publicKey crypto.PublicKey
+	var privateKey crypto.PrivateKey
 
 	if publicKeyPath != "" {
-		publicBytes, err := os.ReadFile(publicKeyPath)
-		if err != nil {
+		var err error
+		if publicKey, err = LoadPublicKey(publicKeyPath); err != nil {
 			return nil, err
 		}
-
-		publicKeyBlock, _ := pem.Decode(publicBytes)
-		var pk interface{}
-		pk, err = x509.ParsePKIXPublicKey(publicKeyBlock.Bytes)
-		if err != nil {
-			return nil, ErrPublicKeyDecoding
-		}
-
-		var ok bool
-		publicKey, ok = pk.(*rsa.PublicKey)
-		if !ok {
-			return nil, ErrPublicKeyDecoding
-		}
 	}
 
 	if privateKeyPath != "" {
-		privateBytes, err := os.ReadFile(privateKeyPath)
-		if err != nil {
+		var err error
+		if privateKey, err = LoadPrivateKey(privateKeyPath); err != nil {
 			return nil, err
 		}
+	}
 
-		privateKeyBlock, _ := pem.Decode(privateBytes)
-		privateKey, err = x509.ParsePKCS1PrivateKey(privateKeyBlock.Bytes)
-		if err != nil {
-			return nil, ErrPrivateKeyDecoding
-		}
+	if publicKey == nil && privateKey != nil {
+		publicKey = publicOf(privateKey)
 	}
 
 	return &Cryptor{
@@ -64,16 +65,120 @@ func NewCryptor(publicKeyPath, privateKeyPath string) (*Cryptor, error) {
 	}, nil
 }
 
+// Encrypt шифрует сообщение произвольного размера ключом AES-256-GCM.
+// Для ключей RSA случайный ключ AES шифруется RSA-OAEP, для ключей ECDSA P-256 вырабатывается по ECDH.
 func (c *Cryptor) Encrypt(plainText []byte) ([]byte, error) {
-	if c.publicKey == nil {
+	switch key := c.publicKey.(type) {
+	case nil:
 		return nil, ErrNoPublicKey
+	case *rsa.PublicKey:
+		return encryptRSA(key, plainText)
+	case *ecdsa.PublicKey:
+		return encryptECIES(key, plainText)
 	}
-	return rsa.EncryptPKCS1v15(rand.Reader, c.publicKey, plainText)
+	return nil, ErrUnsupportedKey
 }
 
+// encryptRSA шифрует сообщение случайным ключом AES-256-GCM, зашифрованным RSA-OAEP.
+//
+// Формат: "MENC" | версия 1 | длина ключа (2 байта) | ключ | nonce | данные.
+// Заголовок из сигнатуры и версии используется как дополнительные данные AES-GCM.
+func encryptRSA(publicKey *rsa.PublicKey, plainText []byte) ([]byte, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	wrappedKey, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, publicKey, key, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	header := append(append([]byte{}, magic...), versionHybrid)
+	out := make([]byte, 0, len(header)+2+len(wrappedKey)+len(nonce)+len(plainText)+gcm.Overhead())
+	out = append(out, header...)
+	out = binary.BigEndian.AppendUint16(out, uint16(len(wrappedKey)))
+	out = append(out, wrappedKey...)
+	out = append(out, nonce...)
+	return gcm.Seal(out, nonce, plainText, header), nil
+}
+
+// Decrypt расшифровывает сообщение, зашифрованное Encrypt.
+// Сообщения без заголовка расшифровываются как RSA PKCS#1 v1.5 для совместимости со старыми агентами.
 func (c *Cryptor) Decrypt(cipherText []byte) ([]byte, error) {
-	if c.privateKey == nil {
+	switch key := c.privateKey.(type) {
+	case nil:
 		return nil, ErrNoPrivateKey
+	case *rsa.PrivateKey:
+		if hasHeader(cipherText, versionHybrid) {
+			plainText, err := decryptRSA(key, cipherText)
+			if err == nil || len(cipherText) != key.Size() {
+				return plainText, err
+			}
+		}
+		return rsa.DecryptPKCS1v15(nil, key, cipherText)
+	case *ecdsa.PrivateKey:
+		if !hasHeader(cipherText, versionECIES) {
+			return nil, ErrInvalidMessage
+		}
+		return decryptECIES(key, cipherText)
+	}
+	return nil, ErrUnsupportedKey
+}
+
+// hasHeader проверяет, что сообщение начинается с сигнатуры формата заданной версии.
+func hasHeader(cipherText []byte, version byte) bool {
+	return len(cipherText) > len(magic) && bytes.Equal(cipherText[:len(magic)], magic) && cipherText[len(magic)] == version
+}
+
+// decryptRSA расшифровывает сообщение версии 1.
+func decryptRSA(privateKey *rsa.PrivateKey, cipherText []byte) ([]byte, error) {
+	header := cipherText[:len(magic)+1]
+
+	rest := cipherText[len(header):]
+	if len(rest) < 2 {
+		return nil, ErrInvalidMessage
+	}
+	keyLen := int(binary.BigEndian.Uint16(rest))
+	rest = rest[2:]
+	if len(rest) < keyLen {
+		return nil, ErrInvalidMessage
+	}
+
+	key, err := rsa.DecryptOAEP(sha256.New(), nil, privateKey, rest[:keyLen], nil)
+	if err != nil {
+		return nil, err
+	}
+	rest = rest[keyLen:]
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) < gcm.NonceSize() {
+		return nil, ErrInvalidMessage
+	}
+
+	plainText, err := gcm.Open(nil, rest[:gcm.NonceSize()], rest[gcm.NonceSize():], header)
+	if err != nil {
+		return nil, ErrInvalidMessage
+	}
+	return plainText, nil
+}
+
+// newGCM создает AES-GCM шифр для заданного ключа.
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
 	}
-	return rsa.DecryptPKCS1v15(nil, c.privateKey, cipherText)
+	return cipher.NewGCM(block)
 }
@@ -1,8 +1,10 @@
 package encryption
 
 import (
+	"bytes"
 	"crypto/rand"
 	"crypto/rsa"
+	"errors"
 	"testing"
 )
 
@@ -35,3 +37,52 @@ func TestCryptor_EncryptDecrypt(t *testing.T) {
 		t.Errorf("Ожидалось: %s, получено: %s", original, decrypted)
 	}
 }
+
+func TestCryptor_LargeMessage(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Ошибка генерации ключа: %v", err)
+	}
+	cryptor := &Cryptor{privateKey: privateKey, publicKey: &privateKey.PublicKey}
+
+	original := bytes.Repeat([]byte("метрика"), 10000)
+	encrypted, err := cryptor.Encrypt(original)
+	if err != nil {
+		t.Fatalf("Ошибка шифрования: %v", err)
+	}
+
+	decrypted, err := cryptor.Decrypt(encrypted)
+	if err != nil {
+		t.Fatalf("Ошибка дешифрования: %v", err)
+	}
+	if !bytes.Equal(decrypted, original) {
+		t.Errorf("Расшифрованное сообщение не совпадает с исходным")
+	}
+
+	encrypted[len(encrypted)-1] ^= 0xff
+	if _, err = cryptor.Decrypt(encrypted); !errors.Is(err, ErrInvalidMessage) {
+		t.Errorf("Ожидалась ошибка %v, получено: %v", ErrInvalidMessage, err)
+	}
+}
+
+func TestCryptor_DecryptLegacy(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Ошибка генерации ключа: %v", err)
+	}
+	cryptor := &Cryptor{privateKey: privateKey, publicKey: &privateKey.PublicKey}
+
+	original := []byte("сообщение старого агента")
+	encrypted, err := rsa.EncryptPKCS1v15(rand.Reader, &privateKey.PublicKey, original)
+	if err != nil {
+		t.Fatalf("Ошибка шифрования: %v", err)
+	}
+
+	decrypted, err := cryptor.Decrypt(encrypted)
+	if err != nil {
+		t.Fatalf("Ошибка дешифрования: %v", err)
+	}
+	if string(decrypted) != string(original) {
+		t.Errorf("Ожидалось: %s, получено: %s", original, decrypted)
+	}
+}
@@ -0,0 +1,92 @@
+package encryption
+
+import (
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+)
+
+// eciesInfo метка, отделяющая ключи этого формата от других применений общего секрета ECDH.
+const eciesInfo = "metrics ecies v2"
+
+// encryptECIES шифрует сообщение ключом AES-256-GCM, выработанным по ECDH между эфемерным ключом
+// и публичным ключом получателя.
+//
+// Формат: "MENC" | версия 2 | эфемерный публичный ключ (65 байт) | nonce | данные.
+// Заголовок вместе с эфемерным ключом используется как дополнительные данные AES-GCM.
+func encryptECIES(publicKey *ecdsa.PublicKey, plainText []byte) ([]byte, error) {
+	recipient, err := publicKey.ECDH()
+	if err != nil {
+		return nil, err
+	}
+	ephemeral, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	shared, err := ephemeral.ECDH(recipient)
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := newGCM(deriveKey(shared, ephemeral.PublicKey().Bytes(), recipient.Bytes()))
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	header := append(append([]byte{}, magic...), versionECIES)
+	header = append(header, ephemeral.PublicKey().Bytes()...)
+	out := append(append([]byte{}, header...), nonce...)
+	return gcm.Seal(out, nonce, plainText, header), nil
+}
+
+// decryptECIES расшифровывает сообщение версии 2.
+func decryptECIES(privateKey *ecdsa.PrivateKey, cipherText []byte) ([]byte, error) {
+	recipient, err := privateKey.ECDH()
+	if err != nil {
+		return nil, err
+	}
+
+	headerLen := len(magic) + 1 + len(recipient.PublicKey().Bytes())
+	if len(cipherText) < headerLen {
+		return nil, ErrInvalidMessage
+	}
+	header := cipherText[:headerLen]
+	ephemeral, err := ecdh.P256().NewPublicKey(header[len(magic)+1:])
+	if err != nil {
+		return nil, ErrInvalidMessage
+	}
+	shared, err := recipient.ECDH(ephemeral)
+	if err != nil {
+		return nil, ErrInvalidMessage
+	}
+
+	gcm, err := newGCM(deriveKey(shared, ephemeral.Bytes(), recipient.PublicKey().Bytes()))
+	if err != nil {
+		return nil, err
+	}
+	rest := cipherText[headerLen:]
+	if len(rest) < gcm.NonceSize() {
+		return nil, ErrInvalidMessage
+	}
+
+	plainText, err := gcm.Open(nil, rest[:gcm.NonceSize()], rest[gcm.NonceSize():], header)
+	if err != nil {
+		return nil, ErrInvalidMessage
+	}
+	return plainText, nil
+}
+
+// deriveKey вырабатывает ключ AES-256 из общего секрета и публичных ключей обеих сторон.
+func deriveKey(shared, ephemeral, recipient []byte) []byte {
+	hash := sha256.New()
+	hash.Write([]byte(eciesInfo))
+	hash.Write(shared)
+	hash.Write(ephemeral)
+	hash.Write(recipient)
+	return hash.Sum(nil)
+}
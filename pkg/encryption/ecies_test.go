@@ -0,0 +1,52 @@
+package encryption
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"testing"
+)
+
+func TestCryptor_ECIES(t *testing.T) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Ошибка генерации ключа: %v", err)
+	}
+	cryptor := &Cryptor{privateKey: privateKey, publicKey: privateKey.Public()}
+
+	original := []byte("секретное сообщение")
+	encrypted, err := cryptor.Encrypt(original)
+	if err != nil {
+		t.Fatalf("Ошибка шифрования: %v", err)
+	}
+	if !hasHeader(encrypted, versionECIES) {
+		t.Fatalf("Ожидался заголовок версии %d", versionECIES)
+	}
+
+	decrypted, err := cryptor.Decrypt(encrypted)
+	if err != nil {
+		t.Fatalf("Ошибка дешифрования: %v", err)
+	}
+	if string(decrypted) != string(original) {
+		t.Errorf("Ожидалось: %s, получено: %s", original, decrypted)
+	}
+
+	encrypted[len(encrypted)-1] ^= 0xff
+	if _, err = cryptor.Decrypt(encrypted); !errors.Is(err, ErrInvalidMessage) {
+		t.Errorf("Ожидалась ошибка %v, получено: %v", ErrInvalidMessage, err)
+	}
+
+	other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Ошибка генерации ключа: %v", err)
+	}
+	encrypted, err = cryptor.Encrypt(original)
+	if err != nil {
+		t.Fatalf("Ошибка шифрования: %v", err)
+	}
+	wrong := &Cryptor{privateKey: other, publicKey: other.Public()}
+	if _, err = wrong.Decrypt(encrypted); err == nil {
+		t.Errorf("Сообщение не должно расшифровываться чужим ключом")
+	}
+}
@@ -0,0 +1,110 @@
+package encryption
+
+import (
+	"errors"
+	"sync/atomic"
+)
+
+// KeyIDHeader заголовок, в котором агент передает идентификатор ключа, которым зашифровано тело запроса.
+const KeyIDHeader = "X-Crypto-Key-ID"
+
+var ErrUnknownKey = errors.New("неизвестный идентификатор ключа")
+
+// KeyID возвращает идентификатор ключа: первые 8 байт SHA-256 публичного ключа в формате PKIX.
+// Агент и сервер вычисляют его независимо по своим половинам пары ключей.
+func (c *Cryptor) KeyID() string {
+	if c.publicKey == nil {
+		return ""
+	}
+	return publicKeyID(c.publicKey)
+}
+
+// keys неизменяемый набор приватных ключей.
+type keys struct {
+	byID  map[string]*Cryptor
+	order []*Cryptor
+}
+
+// Keyring набор приватных ключей сервера для расшифровки сообщений агентов во время ротации ключей.
+// Первый ключ считается основным. Файлы ключей перечитываются методом Reload.
+type Keyring struct {
+	paths   []string
+	current atomic.Pointer[keys]
+}
+
+// NewKeyring загружает приватные ключи из файлов privateKeyPaths.
+func NewKeyring(privateKeyPaths ...string) (*Keyring, error) {
+	k := &Keyring{paths: privateKeyPaths}
+	if err := k.Reload(); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// NewStaticKeyring создает набор из уже загруженных ключей. Reload для него ничего не перечитывает.
+func NewStaticKeyring(cryptors ...*Cryptor) *Keyring {
+	k := &Keyring{}
+	k.current.Store(newKeys(cryptors))
+	return k
+}
+
+// Reload перечитывает файлы ключей. Набор заменяется только если все ключи прочитаны успешно.
+func (k *Keyring) Reload() error {
+	if k.paths == nil {
+		return nil
+	}
+
+	cryptors := make([]*Cryptor, 0, len(k.paths))
+	for _, path := range k.paths {
+		c, err := NewCryptor("", path)
+		if err != nil {
+			return err
+		}
+		cryptors = append(cryptors, c)
+	}
+
+	k.current.Store(newKeys(cryptors))
+	return nil
+}
+
+// Primary возвращает основной ключ или nil, если ключей нет.
+func (k *Keyring) Primary() *Cryptor {
+	if k == nil {
+		return nil
+	}
+	if set := k.current.Load(); len(set.order) > 0 {
+		return set.order[0]
+	}
+	return nil
+}
+
+// Decrypt расшифровывает сообщение ключом с идентификатором keyID.
+// Если идентификатор не передан, по очереди пробуются все ключи, начиная с основного.
+func (k *Keyring) Decrypt(keyID string, cipherText []byte) ([]byte, error) {
+	set := k.current.Load()
+	if keyID != "" {
+		c, ok := set.byID[keyID]
+		if !ok {
+			return nil, ErrUnknownKey
+		}
+		return c.Decrypt(cipherText)
+	}
+
+	err := ErrNoPrivateKey
+	for _, c := range set.order {
+		var plainText []byte
+		if plainText, err = c.Decrypt(cipherText); err == nil {
+			return plainText, nil
+		}
+	}
+	return nil, err
+}
+
+func newKeys(cryptors []*Cryptor) *keys {
+	set := &keys{byID: make(map[string]*Cryptor)}
+	for _, c := range cryptors {
+		set.byID[c.KeyID()] = c
+		set.order = append(set.order, c)
+	}
+	return set
+}
@@ -0,0 +1,75 @@
+package encryption
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestKeyring_Decrypt(t *testing.T) {
+	dir := t.TempDir()
+	oldPath := writePrivateKey(t, dir, "old.pem")
+	newPath := writePrivateKey(t, dir, "new.pem")
+
+	keyring, err := NewKeyring(newPath, oldPath)
+	if err != nil {
+		t.Fatalf("Ошибка загрузки ключей: %v", err)
+	}
+	oldCryptor, err := NewCryptor("", oldPath)
+	if err != nil {
+		t.Fatalf("Ошибка загрузки ключа: %v", err)
+	}
+
+	original := []byte("сообщение")
+	encrypted, err := oldCryptor.Encrypt(original)
+	if err != nil {
+		t.Fatalf("Ошибка шифрования: %v", err)
+	}
+
+	for _, keyID := range []string{oldCryptor.KeyID(), ""} {
+		var decrypted []byte
+		decrypted, err = keyring.Decrypt(keyID, encrypted)
+		if err != nil {
+			t.Fatalf("Ошибка дешифрования ключом %q: %v", keyID, err)
+		}
+		if string(decrypted) != string(original) {
+			t.Errorf("Ожидалось: %s, получено: %s", original, decrypted)
+		}
+	}
+
+	if _, err = keyring.Decrypt("unknown", encrypted); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("Ожидалась ошибка %v, получено: %v", ErrUnknownKey, err)
+	}
+	if keyring.Primary().KeyID() == oldCryptor.KeyID() {
+		t.Errorf("Основным должен быть первый ключ")
+	}
+
+	// Если один из файлов недоступен, набор ключей не меняется.
+	if err = os.Rename(newPath, oldPath); err != nil {
+		t.Fatal(err)
+	}
+	if err = keyring.Reload(); err == nil {
+		t.Errorf("Ожидалась ошибка чтения удаленного ключа")
+	}
+	if _, err = keyring.Decrypt(oldCryptor.KeyID(), encrypted); err != nil {
+		t.Errorf("При ошибке перечитывания должен сохраняться прежний набор: %v", err)
+	}
+}
+
+func writePrivateKey(t *testing.T, dir, name string) string {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Ошибка генерации ключа: %v", err)
+	}
+	path := filepath.Join(dir, name)
+	data := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(privateKey)})
+	if err = os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
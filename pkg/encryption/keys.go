@@ -0,0 +1,99 @@
+package encryption
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+)
+
+var ErrUnsupportedKey = errors.New("тип ключа не поддерживается")
+
+// LoadPublicKey читает публичный ключ из PEM-файла. Тип ключа (RSA, ECDSA P-256, Ed25519)
+// определяется по содержимому блока: поддерживаются форматы PKIX и PKCS#1.
+func LoadPublicKey(path string) (crypto.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParsePublicKey(data)
+}
+
+// ParsePublicKey разбирает публичный ключ в формате PEM.
+func ParsePublicKey(data []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, ErrPublicKeyDecoding
+	}
+
+	if key, err := x509.ParsePKIXPublicKey(block.Bytes); err == nil {
+		return checkKey(key)
+	}
+	if key, err := x509.ParsePKCS1PublicKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	return nil, ErrPublicKeyDecoding
+}
+
+// LoadPrivateKey читает приватный ключ из PEM-файла. Тип ключа определяется по типу блока:
+// "RSA PRIVATE KEY" (PKCS#1), "EC PRIVATE KEY" (SEC 1) или "PRIVATE KEY" (PKCS#8).
+func LoadPrivateKey(path string) (crypto.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParsePrivateKey(data)
+}
+
+// ParsePrivateKey разбирает приватный ключ в формате PEM.
+func ParsePrivateKey(data []byte) (crypto.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, ErrPrivateKeyDecoding
+	}
+
+	var key any
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, ErrPrivateKeyDecoding
+	}
+	return checkKey(key)
+}
+
+// publicOf возвращает публичную половину приватного ключа.
+func publicOf(key crypto.PrivateKey) crypto.PublicKey {
+	if signer, ok := key.(crypto.Signer); ok {
+		return signer.Public()
+	}
+	return nil
+}
+
+// checkKey проверяет, что ключ относится к поддерживаемым типам.
+func checkKey(key any) (any, error) {
+	switch k := key.(type) {
+	case *rsa.PublicKey, *rsa.PrivateKey, ed25519.PublicKey, ed25519.PrivateKey:
+		return key, nil
+	case *ecdsa.PublicKey:
+		if k.Curve == elliptic.P256() {
+			return key, nil
+		}
+	case *ecdsa.PrivateKey:
+		if k.Curve == elliptic.P256() {
+			return key, nil
+		}
+	}
+	return nil, ErrUnsupportedKey
+}
@@ -0,0 +1,102 @@
+package encryption
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"testing"
+)
+
+func TestParseKeys(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Ошибка генерации ключа: %v", err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Ошибка генерации ключа: %v", err)
+	}
+	ecDER, err := x509.MarshalECPrivateKey(ecKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Ошибка генерации ключа: %v", err)
+	}
+	edDER, err := x509.MarshalPKCS8PrivateKey(edKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		key     crypto.Signer
+		private *pem.Block
+	}{
+		{
+			name:    "rsa pkcs1",
+			key:     rsaKey,
+			private: &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)},
+		},
+		{
+			name:    "ecdsa sec1",
+			key:     ecKey,
+			private: &pem.Block{Type: "EC PRIVATE KEY", Bytes: ecDER},
+		},
+		{
+			name:    "ed25519 pkcs8",
+			key:     edKey,
+			private: &pem.Block{Type: "PRIVATE KEY", Bytes: edDER},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			private, err := ParsePrivateKey(pem.EncodeToMemory(test.private))
+			if err != nil {
+				t.Fatalf("Ошибка разбора приватного ключа: %v", err)
+			}
+			if !private.(crypto.Signer).Public().(interface{ Equal(crypto.PublicKey) bool }).Equal(test.key.Public()) {
+				t.Errorf("Разобран другой приватный ключ")
+			}
+
+			der, err := x509.MarshalPKIXPublicKey(test.key.Public())
+			if err != nil {
+				t.Fatal(err)
+			}
+			public, err := ParsePublicKey(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+			if err != nil {
+				t.Fatalf("Ошибка разбора публичного ключа: %v", err)
+			}
+			if !public.(interface{ Equal(crypto.PublicKey) bool }).Equal(test.key.Public()) {
+				t.Errorf("Разобран другой публичный ключ")
+			}
+		})
+	}
+
+	t.Run("unsupported curve", func(t *testing.T) {
+		key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+		if err != nil {
+			t.Fatalf("Ошибка генерации ключа: %v", err)
+		}
+		der, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = ParsePrivateKey(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})); !errors.Is(err, ErrUnsupportedKey) {
+			t.Errorf("Ожидалась ошибка %v, получено: %v", ErrUnsupportedKey, err)
+		}
+	})
+	t.Run("not pem", func(t *testing.T) {
+		if _, err := ParsePublicKey([]byte("garbage")); !errors.Is(err, ErrPublicKeyDecoding) {
+			t.Errorf("Ожидалась ошибка %v, получено: %v", ErrPublicKeyDecoding, err)
+		}
+	})
+}
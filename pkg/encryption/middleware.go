@@ -2,6 +2,7 @@ package encryption
 
 import (
 	"bytes"
+	"errors"
 	"io"
 	"net/http"
 
@@ -9,12 +10,19 @@ import (
 	"go.uber.org/zap"
 )
 
-func DecryptBodyMiddleware(cryptor *Cryptor) func(next http.Handler) http.Handler {
+// DecryptBodyMiddleware расшифровывает тело запроса ключом из keyring.
+// Идентификатор ключа берется из заголовка KeyIDHeader, если агент его передал.
+func DecryptBodyMiddleware(keyring *Keyring) func(next http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		fn := func(w http.ResponseWriter, r *http.Request) {
 			encryptedBody, err := io.ReadAll(r.Body)
 			if err != nil {
 				logger.Log.Error("failed to read request body", zap.Error(err))
+				var maxBytesErr *http.MaxBytesError
+				if errors.As(err, &maxBytesErr) {
+					http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+					return
+				}
 				http.Error(w, "failed to read request body", http.StatusBadRequest)
 				return
 			}
@@ -25,7 +33,7 @@ func DecryptBodyMiddleware(cryptor *Cryptor) func(next http.Handler) http.Handle
 			}
 
 			var decryptedBody []byte
-			decryptedBody, err = cryptor.Decrypt(encryptedBody)
+			decryptedBody, err = keyring.Decrypt(r.Header.Get(KeyIDHeader), encryptedBody)
 			if err != nil {
 				logger.Log.Error("failed to decrypt request body", zap.Error(err))
 				http.Error(w, "failed to decrypt request body", http.StatusBadRequest)
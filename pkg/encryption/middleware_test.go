@@ -43,6 +43,6 @@ func TestDecryptBodyMiddleware(t *testing.T) {
 		}
 	})
 
-	middleware := DecryptBodyMiddleware(cryptor)
+	middleware := DecryptBodyMiddleware(NewStaticKeyring(cryptor))
 	middleware(handler).ServeHTTP(rec, req)
 }
@@ -0,0 +1,114 @@
+package encryption
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"sync/atomic"
+)
+
+var ErrInvalidSignature = errors.New("подпись не прошла проверку")
+
+// Signer подписывает сообщения приватным ключом Ed25519 или ECDSA P-256.
+type Signer struct {
+	key crypto.Signer
+}
+
+// NewSigner загружает ключ подписи из PEM-файла.
+func NewSigner(privateKeyPath string) (*Signer, error) {
+	key, err := LoadPrivateKey(privateKeyPath)
+	if err != nil {
+		return nil, err
+	}
+	switch k := key.(type) {
+	case ed25519.PrivateKey:
+		return &Signer{key: k}, nil
+	case *ecdsa.PrivateKey:
+		return &Signer{key: k}, nil
+	}
+	return nil, ErrUnsupportedKey
+}
+
+// Sign подписывает сообщение. Ed25519 подписывает сообщение целиком, ECDSA — его хеш SHA-256 в формате ASN.1.
+func (s *Signer) Sign(message []byte) ([]byte, error) {
+	if _, ok := s.key.(ed25519.PrivateKey); ok {
+		return s.key.Sign(rand.Reader, message, crypto.Hash(0))
+	}
+	digest := sha256.Sum256(message)
+	return s.key.Sign(rand.Reader, digest[:], crypto.SHA256)
+}
+
+// KeyID возвращает идентификатор ключа подписи, вычисляемый так же, как в Cryptor.KeyID.
+func (s *Signer) KeyID() string {
+	return publicKeyID(s.key.Public())
+}
+
+// Verifier проверяет подписи набором доверенных публичных ключей. Файлы ключей перечитываются методом Reload.
+type Verifier struct {
+	paths   []string
+	current atomic.Pointer[map[string]crypto.PublicKey]
+}
+
+// NewVerifier загружает доверенные публичные ключи Ed25519 или ECDSA P-256 из PEM-файлов.
+func NewVerifier(publicKeyPaths ...string) (*Verifier, error) {
+	v := &Verifier{paths: publicKeyPaths}
+	if err := v.Reload(); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// Reload перечитывает файлы ключей. Набор заменяется только если все ключи прочитаны успешно.
+func (v *Verifier) Reload() error {
+	keys := make(map[string]crypto.PublicKey, len(v.paths))
+	for _, path := range v.paths {
+		key, err := LoadPublicKey(path)
+		if err != nil {
+			return err
+		}
+		switch key.(type) {
+		case ed25519.PublicKey, *ecdsa.PublicKey:
+		default:
+			return ErrUnsupportedKey
+		}
+		keys[publicKeyID(key)] = key
+	}
+	v.current.Store(&keys)
+	return nil
+}
+
+// Verify проверяет подпись сообщения ключом с идентификатором keyID.
+func (v *Verifier) Verify(keyID string, message, sig []byte) error {
+	key, ok := (*v.current.Load())[keyID]
+	if !ok {
+		return ErrUnknownKey
+	}
+
+	var valid bool
+	switch k := key.(type) {
+	case ed25519.PublicKey:
+		valid = ed25519.Verify(k, message, sig)
+	case *ecdsa.PublicKey:
+		digest := sha256.Sum256(message)
+		valid = ecdsa.VerifyASN1(k, digest[:], sig)
+	}
+	if !valid {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// publicKeyID возвращает первые 8 байт SHA-256 публичного ключа в формате PKIX.
+func publicKeyID(key crypto.PublicKey) string {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,85 @@
+package encryption
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSigner_Verify(t *testing.T) {
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Ошибка генерации ключа: %v", err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Ошибка генерации ключа: %v", err)
+	}
+
+	for name, key := range map[string]crypto.Signer{"ed25519": edKey, "ecdsa": ecKey} {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			privatePath, publicPath := writeSigningKey(t, dir, key)
+
+			signer, err := NewSigner(privatePath)
+			if err != nil {
+				t.Fatalf("Ошибка загрузки ключа подписи: %v", err)
+			}
+			verifier, err := NewVerifier(publicPath)
+			if err != nil {
+				t.Fatalf("Ошибка загрузки ключа проверки: %v", err)
+			}
+
+			message := []byte("метрики")
+			sig, err := signer.Sign(message)
+			if err != nil {
+				t.Fatalf("Ошибка подписи: %v", err)
+			}
+			if err = verifier.Verify(signer.KeyID(), message, sig); err != nil {
+				t.Errorf("Подпись должна проходить проверку: %v", err)
+			}
+			if err = verifier.Verify(signer.KeyID(), []byte("другое"), sig); !errors.Is(err, ErrInvalidSignature) {
+				t.Errorf("Ожидалась ошибка %v, получено: %v", ErrInvalidSignature, err)
+			}
+			if err = verifier.Verify("unknown", message, sig); !errors.Is(err, ErrUnknownKey) {
+				t.Errorf("Ожидалась ошибка %v, получено: %v", ErrUnknownKey, err)
+			}
+		})
+	}
+
+	t.Run("rsa key", func(t *testing.T) {
+		path := writePrivateKey(t, t.TempDir(), "private.pem")
+		if _, err := NewSigner(path); !errors.Is(err, ErrUnsupportedKey) {
+			t.Errorf("Ожидалась ошибка %v, получено: %v", ErrUnsupportedKey, err)
+		}
+	})
+}
+
+func writeSigningKey(t *testing.T, dir string, key crypto.Signer) (string, string) {
+	privateDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	privatePath := filepath.Join(dir, "private.pem")
+	publicPath := filepath.Join(dir, "public.pem")
+	if err = os.WriteFile(privatePath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(publicPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return privatePath, publicPath
+}
@@ -0,0 +1,90 @@
+// Package tlsconfig собирает конфигурации TLS сервера и клиента из PEM-файлов
+// и выпускает сертификаты локального центра сертификации для тестовых окружений.
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"os"
+)
+
+// ErrNoCertificates возвращается, если в файле центра сертификации нет ни одного сертификата.
+var ErrNoCertificates = errors.New("no certificates found in CA file")
+
+// Server создает конфигурацию TLS сервера с сертификатом certFile и ключом keyFile.
+// Если задан clientCAFile, сервер требует от клиентов сертификат, подписанный этим центром (mTLS).
+func Server(certFile, keyFile, clientCAFile string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+	}
+
+	if clientCAFile != "" {
+		if cfg.ClientCAs, err = loadPool(clientCAFile); err != nil {
+			return nil, err
+		}
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return cfg, nil
+}
+
+// Client создает конфигурацию TLS клиента. caFile задает центр сертификации для проверки сервера,
+// при пустом значении используются системные корневые сертификаты. Если заданы certFile и keyFile,
+// клиент предъявляет сертификат серверу.
+func Client(caFile, certFile, keyFile string) (*tls.Config, error) {
+	cfg := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if caFile != "" {
+		pool, err := loadPool(caFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RootCAs = pool
+	}
+
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return cfg, nil
+}
+
+// Identity возвращает идентичность клиента по проверенному сертификату соединения:
+// Common Name субъекта, а при его отсутствии — субъект целиком.
+// Для соединений без клиентского сертификата возвращается пустая строка.
+func Identity(state *tls.ConnectionState) string {
+	if state == nil || len(state.PeerCertificates) == 0 {
+		return ""
+	}
+	subject := state.PeerCertificates[0].Subject
+	if subject.CommonName != "" {
+		return subject.CommonName
+	}
+	return subject.String()
+}
+
+// loadPool читает PEM-файл с сертификатами центров сертификации.
+func loadPool(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, ErrNoCertificates
+	}
+	return pool, nil
+}
@@ -0,0 +1,88 @@
+package tlsconfig
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca, err := NewAuthority("test CA")
+	require.NoError(t, err)
+	caKey, err := ca.KeyPEM()
+	require.NoError(t, err)
+	writePair(t, dir, "ca", ca.CertPEM(), caKey)
+
+	cert, key, err := ca.IssueServer("server", []string{"127.0.0.1", "localhost"})
+	require.NoError(t, err)
+	writePair(t, dir, "server", cert, key)
+
+	cert, key, err = ca.IssueClient("agent-1")
+	require.NoError(t, err)
+	writePair(t, dir, "agent", cert, key)
+
+	path := func(name string) string { return filepath.Join(dir, name) }
+
+	serverConfig, err := Server(path("server.pem"), path("server-key.pem"), path("ca.pem"))
+	require.NoError(t, err)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, Identity(r.TLS))
+	}))
+	server.TLS = serverConfig
+	server.StartTLS()
+	defer server.Close()
+
+	t.Run("client certificate", func(t *testing.T) {
+		clientConfig, err := Client(path("ca.pem"), path("agent.pem"), path("agent-key.pem"))
+		require.NoError(t, err)
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: clientConfig}}
+
+		resp, err := client.Get(server.URL)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		assert.Equal(t, "agent-1", string(body))
+	})
+	t.Run("without client certificate", func(t *testing.T) {
+		clientConfig, err := Client(path("ca.pem"), "", "")
+		require.NoError(t, err)
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: clientConfig}}
+
+		_, err = client.Get(server.URL)
+		assert.Error(t, err)
+	})
+	t.Run("unknown server CA", func(t *testing.T) {
+		clientConfig, err := Client("", path("agent.pem"), path("agent-key.pem"))
+		require.NoError(t, err)
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: clientConfig}}
+
+		_, err = client.Get(server.URL)
+		assert.Error(t, err)
+	})
+}
+
+func TestClient_BadCA(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ca.pem")
+	require.NoError(t, os.WriteFile(path, []byte("not a certificate"), 0600))
+
+	_, err := Client(path, "", "")
+	assert.ErrorIs(t, err, ErrNoCertificates)
+}
+
+func TestIdentity(t *testing.T) {
+	assert.Empty(t, Identity(nil))
+}
+
+func writePair(t *testing.T, dir, name string, cert, key []byte) {
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name+".pem"), cert, 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name+"-key.pem"), key, 0600))
+}